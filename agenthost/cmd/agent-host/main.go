@@ -0,0 +1,118 @@
+// Command agent-host serves Claude Code CLI sessions to RemoteTransport
+// clients over TCP and/or WebSocket.
+//
+// Usage:
+//
+//	AGENT_HOST_TOKEN=secret agent-host -listen :7400 -ws :7401 -cwd /workspace
+//
+// Tokens are read from the environment variable named by -token-env, as a
+// comma-separated list, so they do not appear in the process list.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/agenthost"
+)
+
+func main() {
+	listen := flag.String("listen", "", "TCP address to serve on (e.g. :7400)")
+	wsListen := flag.String("ws", "", "HTTP address to serve WebSocket connections on (e.g. :7401)")
+	wsPath := flag.String("ws-path", "/", "URL path of the WebSocket endpoint")
+	tokenEnv := flag.String("token-env", "AGENT_HOST_TOKEN", "environment variable holding the accepted tokens")
+	cliPath := flag.String("cli-path", "", "path to the Claude Code CLI (default: discovered)")
+	cwd := flag.String("cwd", "", "working directory for the CLI")
+	model := flag.String("model", "", "model for every session")
+	permissionMode := flag.String("permission-mode", "", "permission mode for every session")
+	promptTool := flag.Bool("permission-prompt-stdio", true, "route permission prompts to the client's CanUseTool callback")
+	reconnectWindow := flag.Duration("reconnect-window", 30*time.Second, "how long a session waits for its client to reconnect")
+	flag.Parse()
+
+	if *listen == "" && *wsListen == "" {
+		fmt.Fprintln(os.Stderr, "agent-host: at least one of -listen and -ws is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	var tokens []string
+	for _, token := range strings.Split(os.Getenv(*tokenEnv), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		log.Fatalf("agent-host: no tokens in $%s", *tokenEnv)
+	}
+
+	options := &claude.ClaudeAgentOptions{}
+	if *cliPath != "" {
+		options.CliPath = cliPath
+	}
+	if *cwd != "" {
+		options.Cwd = cwd
+	}
+	if *model != "" {
+		options.Model = model
+	}
+	if *permissionMode != "" {
+		mode := claude.PermissionMode(*permissionMode)
+		options.PermissionMode = &mode
+	}
+	if *promptTool {
+		stdio := "stdio"
+		options.PermissionPromptToolName = &stdio
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	server, err := agenthost.NewServer(options, &agenthost.ServerOptions{
+		Tokens:          tokens,
+		ReconnectWindow: *reconnectWindow,
+		ErrorLog:        logger,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errCh := make(chan error, 2)
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Printf("agent-host: serving TCP on %s", l.Addr())
+		go func() { errCh <- server.Serve(l) }()
+	}
+	var httpServer *http.Server
+	if *wsListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle(*wsPath, server)
+		httpServer = &http.Server{Addr: *wsListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		logger.Printf("agent-host: serving WebSocket on %s%s", *wsListen, *wsPath)
+		go func() { errCh <- httpServer.ListenAndServe() }()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logger.Printf("agent-host: %v, shutting down", sig)
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, agenthost.ErrServerClosed) && !errors.Is(err, http.ErrServerClosed) {
+			logger.Printf("agent-host: %v", err)
+		}
+	}
+	if httpServer != nil {
+		httpServer.Close()
+	}
+	server.Close()
+}
@@ -0,0 +1,399 @@
+// Package agenthost serves Claude Code CLI sessions to remote clients.
+//
+// A Server runs on the machine that should execute the agent, for example an
+// isolated worker pod. For every session a RemoteTransport opens, the server
+// starts the CLI through SubprocessCLITransport and relays stream-json frames
+// between the two, over TCP or WebSocket. Clients authenticate with a token,
+// and a session survives dropped connections for ReconnectWindow so the
+// client can resume it. Only the token that started a session can resume it.
+//
+// Example:
+//
+//	server, err := agenthost.NewServer(&claude.ClaudeAgentOptions{
+//	    Cwd: &workdir,
+//	}, &agenthost.ServerOptions{
+//	    Tokens: []string{os.Getenv("AGENT_HOST_TOKEN")},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	listener, _ := net.Listen("tcp", ":7400")
+//	log.Fatal(server.Serve(listener))
+package agenthost
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/wire"
+)
+
+const (
+	defaultHeartbeatTimeout = 45 * time.Second
+	defaultReconnectWindow  = 30 * time.Second
+	defaultMaxMessageSize   = 16 * 1024 * 1024
+	defaultMaxPendingSize   = 64 * 1024 * 1024
+
+	// Received frames between explicit acknowledgements
+	ackInterval = 16
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("agenthost: server closed")
+
+// SessionRequest describes a client asking for a new session.
+type SessionRequest struct {
+	ID         string            // Session ID assigned by the server
+	Metadata   map[string]string // RemoteTransportOptions.Metadata
+	RemoteAddr string
+}
+
+// ServerOptions configures a Server.
+type ServerOptions struct {
+	// Tokens lists the accepted client tokens. Required.
+	Tokens []string
+	// SessionOptions returns the CLI options for a new session. By default
+	// every session uses the options passed to NewServer.
+	SessionOptions func(ctx context.Context, req SessionRequest) (*claude.ClaudeAgentOptions, error)
+	// NewTransport creates the transport a session relays to (default:
+	// claude.NewSubprocessCLITransport)
+	NewTransport func(options *claude.ClaudeAgentOptions) (claude.Transport, error)
+	// HeartbeatTimeout closes a connection that sends nothing for this long
+	// (default: 45s, three client heartbeats)
+	HeartbeatTimeout time.Duration
+	// ReconnectWindow is how long a session waits for its client to
+	// reconnect before the CLI is stopped (default: 30s)
+	ReconnectWindow time.Duration
+	// MaxMessageSize limits a single frame (default: 16MB)
+	MaxMessageSize int
+	// MaxPendingSize limits the CLI output kept for a client that has not
+	// acknowledged it, for example while it is disconnected. The session is
+	// ended when it is exceeded (default: 64MB).
+	MaxPendingSize int
+	// CheckOrigin accepts or refuses a WebSocket request by its Origin
+	// header. By default requests without one, which browsers always send,
+	// and requests whose Origin names the requested host are accepted.
+	CheckOrigin func(r *http.Request) bool
+	// ErrorLog receives connection and session errors (default: discarded)
+	ErrorLog *log.Logger
+}
+
+// Server accepts RemoteTransport connections and runs a CLI per session.
+type Server struct {
+	options       *claude.ClaudeAgentOptions
+	serverOptions ServerOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	listeners map[net.Listener]struct{}
+	conns     map[wire.Conn]struct{}
+	closed    bool
+}
+
+// NewServer creates a server that starts CLIs with options. serverOptions
+// must list at least one token.
+func NewServer(options *claude.ClaudeAgentOptions, serverOptions *ServerOptions) (*Server, error) {
+	if serverOptions == nil || len(serverOptions.Tokens) == 0 {
+		return nil, errors.New("agenthost: at least one token is required")
+	}
+	for _, token := range serverOptions.Tokens {
+		if token == "" {
+			return nil, errors.New("agenthost: tokens must not be empty")
+		}
+	}
+	if options == nil {
+		options = &claude.ClaudeAgentOptions{}
+	}
+
+	so := *serverOptions
+	if so.HeartbeatTimeout <= 0 {
+		so.HeartbeatTimeout = defaultHeartbeatTimeout
+	}
+	if so.ReconnectWindow <= 0 {
+		so.ReconnectWindow = defaultReconnectWindow
+	}
+	if so.MaxMessageSize <= 0 {
+		so.MaxMessageSize = defaultMaxMessageSize
+	}
+	if so.MaxPendingSize <= 0 {
+		so.MaxPendingSize = defaultMaxPendingSize
+	}
+	if so.CheckOrigin == nil {
+		so.CheckOrigin = sameOrigin
+	}
+	if so.NewTransport == nil {
+		so.NewTransport = func(options *claude.ClaudeAgentOptions) (claude.Transport, error) {
+			return claude.NewSubprocessCLITransport("", options, "")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		options:       options,
+		serverOptions: so,
+		ctx:           ctx,
+		cancel:        cancel,
+		sessions:      make(map[string]*session),
+		listeners:     make(map[net.Listener]struct{}),
+		conns:         make(map[wire.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts TCP connections on l, which may be a TLS listener, until
+// Close. Frames are newline-delimited JSON.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(wire.NewLineConn(conn, s.serverOptions.MaxMessageSize), conn.RemoteAddr().String())
+		}()
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and serves one
+// session on it. Mount the server on any path of an http.Server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.isClosed() {
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.serverOptions.CheckOrigin(r) {
+		s.logf("refused WebSocket request from %s with origin %q", r.RemoteAddr, r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	conn, err := wire.AcceptWebSocket(w, r, s.serverOptions.MaxMessageSize)
+	if err != nil {
+		s.logf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	s.wg.Add(1)
+	defer s.wg.Done()
+	s.handle(conn, r.RemoteAddr)
+}
+
+// Sessions returns the number of sessions running a CLI.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Close stops accepting connections, ends every session and waits for their
+// CLIs to exit.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	for _, sess := range sessions {
+		sess.terminate()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.serverOptions.ErrorLog != nil {
+		s.serverOptions.ErrorLog.Printf("agenthost: "+format, args...)
+	}
+}
+
+// authorized reports whether token is one of the configured tokens.
+func (s *Server) authorized(token string) bool {
+	ok := false
+	for _, candidate := range s.serverOptions.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// handle authenticates a connection, attaches it to a new or existing
+// session and relays client frames until it drops.
+func (s *Server) handle(conn wire.Conn, remoteAddr string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(s.serverOptions.HeartbeatTimeout))
+	hello, err := wire.ReadEnvelope(conn)
+	if err != nil {
+		s.logf("reading hello from %s: %v", remoteAddr, err)
+		return
+	}
+	reject := func(reason string) {
+		s.logf("rejected %s: %s", remoteAddr, reason)
+		wire.WriteEnvelope(conn, &wire.Envelope{Type: wire.TypeReject, Error: reason})
+	}
+	if hello.Type != wire.TypeHello {
+		reject("expected hello")
+		return
+	}
+	if !s.authorized(hello.Token) {
+		reject("unauthorized")
+		return
+	}
+
+	owner := sha256.Sum256([]byte(hello.Token))
+	var sess *session
+	if hello.Session == "" {
+		sess, err = s.startSession(owner, hello.Metadata, remoteAddr)
+		if err != nil {
+			reject(err.Error())
+			return
+		}
+	} else {
+		s.mu.Lock()
+		sess = s.sessions[hello.Session]
+		s.mu.Unlock()
+		// Another token's session is reported like a missing one
+		if sess == nil || subtle.ConstantTimeCompare(owner[:], sess.owner[:]) != 1 {
+			reject("unknown or expired session")
+			return
+		}
+	}
+
+	if err := sess.attach(conn, hello.Ack); err != nil {
+		s.logf("attaching %s to session %s: %v", remoteAddr, sess.id, err)
+		sess.detach(conn)
+		return
+	}
+	sess.relay(conn)
+}
+
+// startSession starts a CLI for a new session owned by the token hashing to
+// owner.
+func (s *Server) startSession(owner [sha256.Size]byte, metadata map[string]string, remoteAddr string) (*session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	options := s.options
+	if s.serverOptions.SessionOptions != nil {
+		options, err = s.serverOptions.SessionOptions(s.ctx, SessionRequest{ID: id, Metadata: metadata, RemoteAddr: remoteAddr})
+		if err != nil {
+			return nil, fmt.Errorf("session options: %v", err)
+		}
+	}
+	trans, err := s.serverOptions.NewTransport(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %v", err)
+	}
+	if err := trans.Connect(s.ctx); err != nil {
+		return nil, fmt.Errorf("failed to start CLI: %v", err)
+	}
+
+	sess := &session{server: s, id: id, owner: owner, transport: trans, done: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		trans.Close()
+		return nil, ErrServerClosed
+	}
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		sess.pump()
+	}()
+	return sess, nil
+}
+
+// sameOrigin is the default ServerOptions.CheckOrigin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
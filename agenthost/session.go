@@ -0,0 +1,221 @@
+package agenthost
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/wire"
+)
+
+// session is one CLI process and the client connection currently attached
+// to it, if any.
+type session struct {
+	server    *Server
+	id        string
+	owner     [sha256.Size]byte // Hash of the token that started the session
+	transport claude.Transport
+
+	mu         sync.Mutex
+	conn       wire.Conn
+	reconnect  *time.Timer // Ends the session if no client attaches in time
+	terminated bool
+
+	// writeMu orders sequenced writes and resends. It is separate from mu so
+	// a write blocked on a dead connection does not stop attach from closing
+	// that connection.
+	writeMu sync.Mutex
+	outbox  wire.Outbox
+	inbox   wire.Inbox
+
+	done chan struct{}
+}
+
+// attach makes conn the session's connection, closing the previous one,
+// and resends everything the client has not acknowledged.
+func (s *session) attach(conn wire.Conn, ack uint64) error {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	old := s.conn
+	s.conn = nil
+	if s.reconnect != nil {
+		s.reconnect.Stop()
+		s.reconnect = nil
+	}
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.outbox.Ack(ack)
+	if err := wire.WriteEnvelope(conn, &wire.Envelope{Type: wire.TypeWelcome, Session: s.id, Ack: s.inbox.Last()}); err != nil {
+		return err
+	}
+	for _, env := range s.outbox.Pending() {
+		if err := wire.WriteEnvelope(conn, env); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.terminated {
+		return ErrServerClosed
+	}
+	s.conn = conn
+	return nil
+}
+
+// detach forgets conn after it dropped and gives the client
+// ReconnectWindow to come back.
+func (s *session) detach(conn wire.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != conn || s.terminated {
+		return
+	}
+	s.conn = nil
+	s.reconnect = time.AfterFunc(s.server.serverOptions.ReconnectWindow, func() {
+		s.server.logf("session %s: client did not reconnect", s.id)
+		s.terminate()
+	})
+}
+
+// relay forwards client frames on conn to the CLI until conn drops or the
+// client ends the session.
+func (s *session) relay(conn wire.Conn) {
+	timeout := s.server.serverOptions.HeartbeatTimeout
+	received := 0
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		env, err := wire.ReadEnvelope(conn)
+		if err != nil {
+			s.detach(conn)
+			return
+		}
+		if env.Ack > 0 {
+			s.outbox.Ack(env.Ack)
+		}
+
+		switch env.Type {
+		case wire.TypePing:
+			wire.WriteEnvelope(conn, &wire.Envelope{Type: wire.TypePong, Ack: s.inbox.Last()})
+			continue
+		case wire.TypeClose:
+			s.terminate()
+			return
+		}
+		if !env.Sequenced() || !s.inbox.Accept(env.Seq) {
+			continue
+		}
+		if received++; received%ackInterval == 0 {
+			wire.WriteEnvelope(conn, &wire.Envelope{Type: wire.TypeAck, Ack: env.Seq})
+		}
+
+		switch env.Type {
+		case wire.TypeData:
+			if err := s.transport.Write(s.server.ctx, string(env.Frame)+"\n"); err != nil {
+				s.server.logf("session %s: write to CLI: %v", s.id, err)
+			}
+		case wire.TypeEndInput:
+			if err := s.transport.EndInput(); err != nil {
+				s.server.logf("session %s: end input: %v", s.id, err)
+			}
+		}
+	}
+}
+
+// pump forwards CLI output to the client until the CLI exits.
+func (s *session) pump() {
+	msgCh, errCh := s.transport.ReadMessages(s.server.ctx)
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg, ok := <-msgCh:
+			if !ok {
+				// Pick up an error sent just before the stream ended
+				select {
+				case err, ok := <-errCh:
+					if ok && err != nil {
+						s.send(&wire.Envelope{Type: wire.TypeError, Error: err.Error()})
+						return
+					}
+				default:
+				}
+				s.send(&wire.Envelope{Type: wire.TypeEOF})
+				return
+			}
+			frame, err := json.Marshal(msg)
+			if err != nil {
+				s.send(&wire.Envelope{Type: wire.TypeError, Error: err.Error()})
+				return
+			}
+			s.send(&wire.Envelope{Type: wire.TypeData, Frame: frame})
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			if err != nil {
+				s.send(&wire.Envelope{Type: wire.TypeError, Error: err.Error()})
+				return
+			}
+		}
+	}
+}
+
+// send numbers env and writes it to the attached connection, if any. It is
+// kept and resent on reconnect until the client acknowledges it. The session
+// ends when the unacknowledged output exceeds MaxPendingSize.
+func (s *session) send(env *wire.Envelope) {
+	s.writeMu.Lock()
+	s.outbox.Add(env)
+	if pending := s.outbox.Size(); pending > s.server.serverOptions.MaxPendingSize {
+		s.writeMu.Unlock()
+		s.server.logf("session %s: %d bytes of output not acknowledged, ending session", s.id, pending)
+		s.terminate()
+		return
+	}
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		wire.WriteEnvelope(conn, env)
+	}
+}
+
+// terminate stops the CLI and removes the session.
+func (s *session) terminate() {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	s.terminated = true
+	conn := s.conn
+	s.conn = nil
+	if s.reconnect != nil {
+		s.reconnect.Stop()
+	}
+	s.mu.Unlock()
+
+	close(s.done)
+	if conn != nil {
+		conn.Close()
+	}
+	s.transport.Close()
+
+	s.server.mu.Lock()
+	delete(s.server.sessions, s.id)
+	s.server.mu.Unlock()
+}
@@ -0,0 +1,303 @@
+// Package approval puts a human in the loop of headless agents: tool
+// permission requests (CanUseTool) and PreToolUse hooks wait for a reviewer
+// to approve or deny them through an embeddable HTTP API.
+//
+//	reviews := approval.New(nil)
+//	options.CanUseTool = reviews.CanUseTool
+//	http.Handle("/approvals/", http.StripPrefix("/approvals", reviews))
+//
+// Reviewers list pending requests with GET /requests, decide them with POST
+// /requests/{id}/approve or /deny, and follow GET /events, a server-sent
+// event stream that replays the pending requests on every connection so a
+// page refresh loses nothing.
+//
+// A request waits until it is decided, its timeout expires, or its context
+// ends: the CLI cancelled it, for example because the turn was interrupted,
+// or the query closed.
+//
+// Expiry means deny. A request no one decides in time is answered like a
+// reviewer's denial, with the message "No reviewer decided within
+// <timeout>", so Claude is told why and the turn goes on; it fails closed
+// without an error. Only the end of the context cancels a request, and then
+// CanUseTool and the hook return the context's error.
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// DefaultTimeout is how long a request waits for a decision by default.
+const DefaultTimeout = 10 * time.Minute
+
+// ErrNotPending is returned when deciding a request that is not pending,
+// because it does not exist or was already decided, expired or cancelled.
+var ErrNotPending = errors.New("approval: request is not pending")
+
+// Kind is where a request comes from.
+type Kind string
+
+const (
+	// KindToolPermission is a CanUseTool permission request
+	KindToolPermission Kind = "can_use_tool"
+	// KindPreToolUse is a PreToolUse hook
+	KindPreToolUse Kind = "pre_tool_use"
+)
+
+// Outcome is how a request left the pending list.
+type Outcome string
+
+const (
+	OutcomeApproved  Outcome = "approved"
+	OutcomeDenied    Outcome = "denied"
+	OutcomeExpired   Outcome = "expired"
+	OutcomeCancelled Outcome = "cancelled"
+)
+
+// Request is a tool use waiting for a decision.
+type Request struct {
+	ID          string                    `json:"id"`
+	Kind        Kind                      `json:"kind"`
+	ToolName    string                    `json:"tool_name"`
+	Input       map[string]interface{}    `json:"input"`
+	ToolUseID   string                    `json:"tool_use_id,omitempty"` // PreToolUse only
+	SessionID   string                    `json:"session_id,omitempty"`  // PreToolUse only
+	Cwd         string                    `json:"cwd,omitempty"`         // PreToolUse only
+	Suggestions []claude.PermissionUpdate `json:"suggestions,omitempty"` // CanUseTool only
+	CreatedAt   time.Time                 `json:"created_at"`
+	Deadline    time.Time                 `json:"deadline"`
+}
+
+// Decision is a reviewer's answer to a request.
+type Decision struct {
+	// Approve allows the tool use; otherwise it is denied
+	Approve bool `json:"approve"`
+	// Message explains the decision to the model
+	Message string `json:"message,omitempty"`
+	// Interrupt stops the turn along with a denial
+	Interrupt bool `json:"interrupt,omitempty"`
+	// UpdatedInput replaces the tool input of an approval
+	UpdatedInput map[string]interface{} `json:"updated_input,omitempty"`
+}
+
+// Resolution is a request leaving the pending list.
+type Resolution struct {
+	ID      string  `json:"id"`
+	Outcome Outcome `json:"outcome"`
+}
+
+// Options configures a Service.
+type Options struct {
+	// Timeout is how long a request waits before it is denied as if a
+	// reviewer had (default: DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Service holds the requests waiting for a reviewer. It is an http.Handler
+// serving the review API; see the package documentation.
+type Service struct {
+	timeout time.Duration
+	mux     *http.ServeMux
+
+	mu          sync.Mutex
+	pending     map[string]*pendingRequest
+	subscribers map[chan event]struct{}
+}
+
+type pendingRequest struct {
+	request  Request
+	decision chan Decision
+}
+
+// New creates a Service. options may be nil.
+func New(options *Options) *Service {
+	s := &Service{
+		timeout:     DefaultTimeout,
+		pending:     make(map[string]*pendingRequest),
+		subscribers: make(map[chan event]struct{}),
+	}
+	if options != nil && options.Timeout > 0 {
+		s.timeout = options.Timeout
+	}
+	s.mux = s.routes()
+	return s
+}
+
+// CanUseTool implements claude.CanUseTool, waiting for a reviewer.
+func (s *Service) CanUseTool(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+	decision, err := s.await(ctx, Request{
+		Kind:        KindToolPermission,
+		ToolName:    toolName,
+		Input:       input,
+		Suggestions: permCtx.Suggestions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if decision.Approve {
+		return claude.PermissionResultAllow{Behavior: "allow", UpdatedInput: decision.UpdatedInput}, nil
+	}
+	return claude.PermissionResultDeny{Behavior: "deny", Message: decision.Message, Interrupt: decision.Interrupt}, nil
+}
+
+// PreToolUse is a claude.HookCallback for PreToolUse hooks, waiting for a
+// reviewer. Register it with HookMatcher, which raises the hook timeout to
+// the review timeout.
+func (s *Service) PreToolUse(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+	request := Request{Kind: KindPreToolUse}
+	request.ToolName, _ = input["tool_name"].(string)
+	request.Input, _ = input["tool_input"].(map[string]interface{})
+	request.SessionID, _ = input["session_id"].(string)
+	request.Cwd, _ = input["cwd"].(string)
+	if toolUseID != nil {
+		request.ToolUseID = *toolUseID
+	}
+
+	decision, err := s.await(ctx, request)
+	if err != nil {
+		return claude.HookJSONOutput{}, err
+	}
+
+	output := map[string]interface{}{
+		"hookEventName":            "PreToolUse",
+		"permissionDecision":       "deny",
+		"permissionDecisionReason": decision.Message,
+	}
+	result := claude.HookJSONOutput{HookSpecificOutput: output}
+	if decision.Approve {
+		output["permissionDecision"] = "allow"
+		if decision.UpdatedInput != nil {
+			output["updatedInput"] = decision.UpdatedInput
+		}
+	} else if decision.Interrupt {
+		stop := false
+		result.Continue = &stop
+		result.StopReason = &decision.Message
+	}
+	return result, nil
+}
+
+// HookMatcher returns a PreToolUse hook matcher sending the tools matched by
+// matcher (such as "Bash|Write", or "" for all) for review. Its timeout is
+// a minute longer than the review timeout, so the CLI does not give up on
+// the hook first.
+func (s *Service) HookMatcher(matcher string) claude.HookMatcher {
+	timeout := (s.timeout + time.Minute).Seconds()
+	return claude.HookMatcher{
+		Matcher: matcher,
+		Hooks:   []claude.HookCallback{s.PreToolUse},
+		Timeout: &timeout,
+	}
+}
+
+// Pending returns the pending requests, oldest first.
+func (s *Service) Pending() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pendingLocked()
+}
+
+func (s *Service) pendingLocked() []Request {
+	requests := make([]Request, 0, len(s.pending))
+	for _, p := range s.pending {
+		requests = append(requests, p.request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+// Get returns the pending request id.
+func (s *Service) Get(id string) (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[id]
+	if !ok {
+		return Request{}, false
+	}
+	return p.request, true
+}
+
+// Decide answers the pending request id. It returns ErrNotPending if the
+// request was already decided, expired or cancelled.
+func (s *Service) Decide(id string, decision Decision) error {
+	outcome := OutcomeDenied
+	if decision.Approve {
+		outcome = OutcomeApproved
+	} else if decision.Message == "" {
+		decision.Message = "A reviewer denied this tool use"
+	}
+
+	p, ok := s.remove(id, outcome)
+	if !ok {
+		return ErrNotPending
+	}
+	p.decision <- decision
+	return nil
+}
+
+// await adds request to the pending list and waits for its decision. The
+// timeout and the end of ctx both withdraw the request; a request can only
+// leave the list once, so whichever comes first decides. Expiry is a denial,
+// not an error: only a cancelled request returns ctx.Err().
+func (s *Service) await(ctx context.Context, request Request) (Decision, error) {
+	request.ID = newID()
+	request.CreatedAt = time.Now()
+	request.Deadline = request.CreatedAt.Add(s.timeout)
+	p := &pendingRequest{request: request, decision: make(chan Decision, 1)}
+
+	s.mu.Lock()
+	s.pending[request.ID] = p
+	s.publishLocked(requestEvent(request))
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case decision := <-p.decision:
+		return decision, nil
+	case <-timer.C:
+		if _, ok := s.remove(request.ID, OutcomeExpired); ok {
+			return Decision{Message: fmt.Sprintf("No reviewer decided within %v", s.timeout)}, nil
+		}
+	case <-ctx.Done():
+		if _, ok := s.remove(request.ID, OutcomeCancelled); ok {
+			return Decision{}, ctx.Err()
+		}
+	}
+	// A reviewer decided at the same moment
+	return <-p.decision, nil
+}
+
+// remove takes request id off the pending list, telling subscribers.
+func (s *Service) remove(id string, outcome Outcome) (*pendingRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[id]
+	if !ok {
+		return nil, false
+	}
+	delete(s.pending, id)
+	s.publishLocked(resolutionEvent(Resolution{ID: id, Outcome: outcome}))
+	return p, true
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,175 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// heartbeatInterval is how often an idle event stream sends a comment, so
+// proxies keep the connection open.
+const heartbeatInterval = 30 * time.Second
+
+// subscriberBuffer is how many events a slow event stream may fall behind
+// before it is closed; the reviewer reconnects and gets the pending list
+// again.
+const subscriberBuffer = 64
+
+// event is a server-sent event.
+type event struct {
+	name string
+	id   string
+	data interface{}
+}
+
+func requestEvent(request Request) event {
+	return event{name: "request", id: request.ID, data: request}
+}
+
+func resolutionEvent(resolution Resolution) event {
+	return event{name: "resolved", id: resolution.ID, data: resolution}
+}
+
+// publishLocked sends e to every subscriber. s.mu must be held.
+func (s *Service) publishLocked(e event) {
+	for ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// routes builds the review API:
+//
+//	GET  /requests              pending requests, oldest first
+//	GET  /requests/{id}         one pending request
+//	POST /requests/{id}/approve approve, with an optional body of
+//	                            {"message": ..., "updated_input": {...}}
+//	POST /requests/{id}/deny    deny, with an optional body of
+//	                            {"message": ..., "interrupt": true}
+//	GET  /events                server-sent "request" and "resolved" events
+//
+// Deciding a request that is not pending is a 404.
+func (s *Service) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /requests", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Pending())
+	})
+	mux.HandleFunc("GET /requests/{id}", func(w http.ResponseWriter, r *http.Request) {
+		request, ok := s.Get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, ErrNotPending)
+			return
+		}
+		writeJSON(w, http.StatusOK, request)
+	})
+	mux.HandleFunc("POST /requests/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		s.serveDecision(w, r, true)
+	})
+	mux.HandleFunc("POST /requests/{id}/deny", func(w http.ResponseWriter, r *http.Request) {
+		s.serveDecision(w, r, false)
+	})
+	mux.HandleFunc("GET /events", s.serveEvents)
+	return mux
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Service) serveDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	var decision Decision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid decision: %w", err))
+		return
+	}
+	decision.Approve = approve
+	if approve {
+		decision.Interrupt = false
+	} else {
+		decision.UpdatedInput = nil
+	}
+
+	id := r.PathValue("id")
+	if err := s.Decide(id, decision); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	outcome := OutcomeDenied
+	if approve {
+		outcome = OutcomeApproved
+	}
+	writeJSON(w, http.StatusOK, Resolution{ID: id, Outcome: outcome})
+}
+
+// serveEvents streams events, starting with a "request" event for every
+// pending request.
+func (s *Service) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("approval: streaming is not supported"))
+		return
+	}
+
+	// Subscribe and snapshot together, so no request is missed or repeated
+	ch := make(chan event, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	pending := s.pendingLocked()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, request := range pending {
+		writeEvent(w, requestEvent(request))
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, e event) {
+	data, _ := json.Marshal(e.data)
+	fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", e.name, e.id, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
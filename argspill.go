@@ -0,0 +1,247 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Command line size limits. POSIX systems share ARG_MAX between argv and the
+// environment, and Linux additionally caps every single argument at
+// MAX_ARG_STRLEN (32 pages). The totals are kept well below the real limits
+// to leave room for launchers that wrap the command.
+const (
+	posixCommandLineLimit   = 100000
+	windowsCommandLineLimit = 8000
+	linuxMaxArgLength       = 128*1024 - 1
+)
+
+// spillableFlags maps CLI flags whose values may be large to the flag that
+// reads the same value from a file, and the file name used for it.
+var spillableFlags = map[string]struct {
+	fileFlag string
+	fileName string
+}{
+	"--system-prompt":        {"--system-prompt-file", "system-prompt.txt"},
+	"--append-system-prompt": {"--append-system-prompt-file", "append-system-prompt.txt"},
+	"--mcp-config":           {"--mcp-config", "mcp-config.json"},
+	"--settings":             {"--settings", "settings.json"},
+}
+
+// commandLineLimit returns the maximum command line size for this platform.
+func commandLineLimit() int {
+	if runtime.GOOS == "windows" {
+		return windowsCommandLineLimit
+	}
+	return posixCommandLineLimit
+}
+
+// commandLineLength returns the size of the command line in bytes. On POSIX
+// systems the environment counts towards the same limit.
+func commandLineLength(path string, args, env []string) int {
+	n := len(path) + 1
+	for _, arg := range args {
+		n += len(arg) + 1
+	}
+	if runtime.GOOS != "windows" {
+		for _, entry := range env {
+			n += len(entry) + 1
+		}
+	}
+	return n
+}
+
+// commandLineFits reports whether the command can be executed without E2BIG.
+func commandLineFits(path string, args, env []string, limit int) bool {
+	if commandLineLength(path, args, env) > limit {
+		return false
+	}
+	if runtime.GOOS == "linux" {
+		for _, arg := range args {
+			if len(arg) > linuxMaxArgLength {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// permissionListFlags maps CLI flags listing tool rules to the settings
+// "permissions" list holding the same rules, so long lists can move into the
+// settings file.
+var permissionListFlags = map[string]string{
+	"--allowedTools":    "allow",
+	"--disallowedTools": "deny",
+}
+
+// argSpill holds the private directory that oversized argument values were
+// written to. It is removed when the transport closes.
+type argSpill struct {
+	dir   string
+	files []string
+}
+
+// spillLargeArgs moves the largest spillable flag values in args into files
+// until the command line fits within limit. Tool rule lists are merged into
+// the "permissions" section of the settings file. It returns the rewritten
+// args and the spill directory, or a nil spill if the command already fits.
+//
+// Files are created in a private temp directory (0700, files 0600). When the
+// CLI runs as another OS user, ownership is handed to that user.
+func spillLargeArgs(path string, args, env []string, limit int, user *osUser) ([]string, *argSpill, error) {
+	if commandLineFits(path, args, env, limit) {
+		return args, nil, nil
+	}
+
+	args = append([]string(nil), args...)
+	spill := &argSpill{}
+	for !commandLineFits(path, args, env, limit) {
+		// Pick the largest value that has not been spilled yet
+		largest := -1
+		for i := 0; i < len(args)-1; i++ {
+			_, spillable := spillableFlags[args[i]]
+			_, list := permissionListFlags[args[i]]
+			if !spillable && !list || args[i+1] == "" || spill.owns(args[i+1]) {
+				continue
+			}
+			if largest < 0 || len(args[i+1]) > len(args[largest+1]) {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			spill.remove()
+			return nil, nil, NewCLIConnectionError(fmt.Sprintf(
+				"command line is %d bytes and exceeds the %d byte limit after moving large values to files; reduce ExtraArgs, AddDirs or Env",
+				commandLineLength(path, args, env), limit), nil)
+		}
+
+		var err error
+		if list, ok := permissionListFlags[args[largest]]; ok {
+			args, err = spill.mergePermissions(args, largest, list, user)
+		} else {
+			var file string
+			file, err = spill.write(spillableFlags[args[largest]].fileName, args[largest+1], user)
+			args[largest] = spillableFlags[args[largest]].fileFlag
+			args[largest+1] = file
+		}
+		if err != nil {
+			spill.remove()
+			return nil, nil, NewCLIConnectionError("failed to write oversized argument to file", err)
+		}
+	}
+
+	return args, spill, nil
+}
+
+// mergePermissions removes the tool rule list at args[i] and adds its rules
+// to the permissions list of the settings, which are written to the spilled
+// settings file.
+func (s *argSpill) mergePermissions(args []string, i int, list string, user *osUser) ([]string, error) {
+	var rules []string
+	for _, rule := range strings.Split(args[i+1], ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	args = append(args[:i], args[i+2:]...)
+
+	// Start from the settings already passed, inline or in a file
+	settings := make(map[string]interface{})
+	at := -1
+	for j := 0; j < len(args)-1; j++ {
+		if args[j] == "--settings" {
+			at = j
+			break
+		}
+	}
+	if at >= 0 {
+		value := strings.TrimSpace(args[at+1])
+		data := []byte(value)
+		if !strings.HasPrefix(value, "{") {
+			var err error
+			if data, err = os.ReadFile(value); err != nil {
+				return nil, fmt.Errorf("reading settings to merge tool rules into: %w", err)
+			}
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("parsing settings to merge tool rules into: %w", err)
+		}
+	}
+
+	permissions, _ := settings["permissions"].(map[string]interface{})
+	if permissions == nil {
+		permissions = make(map[string]interface{})
+	}
+	existing, _ := permissions[list].([]interface{})
+	for _, rule := range rules {
+		existing = append(existing, rule)
+	}
+	permissions[list] = existing
+	settings["permissions"] = permissions
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.write(spillableFlags["--settings"].fileName, string(data), user)
+	if err != nil {
+		return nil, err
+	}
+	if at >= 0 {
+		args[at+1] = file
+	} else {
+		args = append(args, "--settings", file)
+	}
+	return args, nil
+}
+
+// owns reports whether path is a file in the spill directory.
+func (s *argSpill) owns(path string) bool {
+	for _, file := range s.files {
+		if file == path {
+			return true
+		}
+	}
+	return false
+}
+
+// write stores value in a new file in the spill directory.
+func (s *argSpill) write(name, value string, user *osUser) (string, error) {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "claude-sdk-args-")
+		if err != nil {
+			return "", err
+		}
+		s.dir = dir
+		if user != nil {
+			if err := os.Chown(dir, int(user.uid), int(user.gid)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		return "", err
+	}
+	if user != nil {
+		if err := os.Chown(path, int(user.uid), int(user.gid)); err != nil {
+			return "", err
+		}
+	}
+	if !s.owns(path) {
+		s.files = append(s.files, path)
+	}
+	return path, nil
+}
+
+// remove deletes the spill directory. It is safe to call on a nil spill.
+func (s *argSpill) remove() {
+	if s == nil || s.dir == "" {
+		return
+	}
+	os.RemoveAll(s.dir)
+}
@@ -0,0 +1,189 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AuditEntryType is what an audit entry records.
+type AuditEntryType string
+
+const (
+	// AuditSessionStart is the CLI's system init message
+	AuditSessionStart AuditEntryType = "session_start"
+	// AuditPermission is a can_use_tool request and the decision sent back
+	AuditPermission AuditEntryType = "permission"
+	// AuditHook is a hook callback's input and output
+	AuditHook AuditEntryType = "hook"
+	// AuditToolUse is a ToolUseBlock of an assistant message
+	AuditToolUse AuditEntryType = "tool_use"
+	// AuditToolResult is a ToolResultBlock of a user message
+	AuditToolResult AuditEntryType = "tool_result"
+	// AuditResult is the result message ending a turn
+	AuditResult AuditEntryType = "result"
+)
+
+// AuditEntry is one record of what an agent did.
+//
+// Data depends on Type:
+//   - session_start and result: the CLI's message
+//   - permission: "input", "suggestions", and the "response" sent to the
+//     CLI or the callback's "error"
+//   - hook: "callback_id", "event", "input", and the "output" sent to the
+//     CLI or the callback's "error"
+//   - tool_use: "input" and "parent_tool_use_id"
+//   - tool_result: "content", "is_error" and "parent_tool_use_id"
+type AuditEntry struct {
+	Time      time.Time              `json:"time"`
+	Type      AuditEntryType         `json:"type"`
+	SessionID string                 `json:"session_id,omitempty"`
+	ToolName  string                 `json:"tool_name,omitempty"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Auditor records audit entries. Record is called from the router and from
+// control request handlers, so it must be safe for concurrent use.
+//
+// Permission decisions and hook outputs are recorded before they are sent
+// to the CLI. If recording fails, the CLI gets an error response instead,
+// so no decision takes effect unrecorded. Errors recording messages are
+// logged.
+//
+// See FileAuditor for a tamper-evident JSONL file.
+type Auditor interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// auditRun feeds the auditor of one CLI process. The router observes
+// messages; control request handlers record decisions concurrently. A nil
+// auditRun does nothing.
+type auditRun struct {
+	auditor Auditor
+	log     func() *slog.Logger
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func newAuditRun(auditor Auditor, log func() *slog.Logger) *auditRun {
+	if auditor == nil {
+		return nil
+	}
+	return &auditRun{auditor: auditor, log: log}
+}
+
+// record stamps entry with the time and session and records it. The entry
+// is recorded even when ctx is cancelled, as a cancelled request is worth
+// auditing too.
+func (a *auditRun) record(ctx context.Context, entry AuditEntry) error {
+	a.mu.Lock()
+	if entry.SessionID == "" {
+		entry.SessionID = a.sessionID
+	}
+	a.mu.Unlock()
+	entry.Time = time.Now().UTC()
+	return a.auditor.Record(context.WithoutCancel(ctx), entry)
+}
+
+// observe records the session start, tool uses, tool results and results
+// of a message from the CLI.
+func (a *auditRun) observe(ctx context.Context, msg map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	msgType, _ := msg["type"].(string)
+	sessionID, _ := msg["session_id"].(string)
+	if sessionID != "" {
+		a.mu.Lock()
+		a.sessionID = sessionID
+		a.mu.Unlock()
+	}
+	parentToolUseID := msg["parent_tool_use_id"]
+
+	var entries []AuditEntry
+	switch msgType {
+	case "system":
+		if subtype, _ := msg["subtype"].(string); subtype == "init" {
+			entries = append(entries, AuditEntry{Type: AuditSessionStart, Data: msg})
+		}
+	case "result":
+		entries = append(entries, AuditEntry{Type: AuditResult, Data: msg})
+	case "assistant", "user":
+		message, _ := msg["message"].(map[string]interface{})
+		content, _ := message["content"].([]interface{})
+		for _, b := range content {
+			block, _ := b.(map[string]interface{})
+			switch block["type"] {
+			case "tool_use":
+				name, _ := block["name"].(string)
+				id, _ := block["id"].(string)
+				entries = append(entries, AuditEntry{Type: AuditToolUse, ToolName: name, ToolUseID: id, Data: map[string]interface{}{
+					"input":              block["input"],
+					"parent_tool_use_id": parentToolUseID,
+				}})
+			case "tool_result":
+				id, _ := block["tool_use_id"].(string)
+				entries = append(entries, AuditEntry{Type: AuditToolResult, ToolUseID: id, Data: map[string]interface{}{
+					"content":            block["content"],
+					"is_error":           block["is_error"],
+					"parent_tool_use_id": parentToolUseID,
+				}})
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if err := a.record(ctx, entry); err != nil {
+			a.log().Error("claude: failed to record audit entry", "type", entry.Type, "error", err)
+		}
+	}
+}
+
+// control records a can_use_tool or hook_callback request with the response
+// about to be sent, or the handler's error.
+func (a *auditRun) control(ctx context.Context, subtype string, request, response map[string]interface{}, handlerErr error) error {
+	if a == nil {
+		return nil
+	}
+
+	var entry AuditEntry
+	switch subtype {
+	case "can_use_tool":
+		entry.Type = AuditPermission
+		entry.ToolName, _ = request["tool_name"].(string)
+		entry.ToolUseID, _ = request["tool_use_id"].(string)
+		entry.Data = map[string]interface{}{
+			"input":       request["input"],
+			"suggestions": request["permission_suggestions"],
+		}
+	case "hook_callback":
+		input, _ := request["input"].(map[string]interface{})
+		entry.Type = AuditHook
+		entry.ToolName, _ = input["tool_name"].(string)
+		entry.ToolUseID, _ = request["tool_use_id"].(string)
+		entry.SessionID, _ = input["session_id"].(string)
+		entry.Data = map[string]interface{}{
+			"callback_id": request["callback_id"],
+			"event":       input["hook_event_name"],
+			"input":       input,
+		}
+	default:
+		return nil
+	}
+
+	if handlerErr != nil {
+		entry.Data["error"] = handlerErr.Error()
+	} else if entry.Type == AuditPermission {
+		entry.Data["response"] = response
+	} else {
+		entry.Data["output"] = response
+	}
+	if err := a.record(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
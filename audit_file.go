@@ -0,0 +1,170 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// AuditHead identifies the last entry of an audit log. Keeping a copy of
+// the head elsewhere (a database, a ticket, a signed message) also detects
+// entries removed from the end of the log, which the chain alone cannot.
+type AuditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditChainError reports an audit log that fails verification.
+type AuditChainError struct {
+	*ClaudeSDKError
+	Line int // Line number of the first entry that fails
+}
+
+// NewAuditChainError creates a new AuditChainError.
+func NewAuditChainError(line int, reason string) *AuditChainError {
+	return &AuditChainError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fmt.Sprintf("audit log line %d: %s", line, reason)},
+		Line:           line,
+	}
+}
+
+// auditLine is one line of an audit log file. Entry keeps the exact bytes
+// that were hashed.
+type auditLine struct {
+	Seq      int64           `json:"seq"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+	Entry    json.RawMessage `json:"entry"`
+}
+
+// hash returns the hex SHA-256 of the sequence number, the previous hash
+// and the entry, chaining each line to the one before it.
+func (l auditLine) hash() string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(l.Seq, 10) + "\n" + l.PrevHash + "\n"))
+	h.Write(l.Entry)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileAuditor is an Auditor appending hash-chained entries to a JSONL file.
+// Each line holds the entry, its sequence number, the hash of the previous
+// line and its own hash, so editing, inserting, reordering or removing a
+// line breaks the chain; see VerifyAuditLog.
+//
+// Entries are synced to disk before Record returns. A FileAuditor is safe
+// for concurrent use, but only one may write a file at a time.
+type FileAuditor struct {
+	mu   sync.Mutex
+	file *os.File
+	head AuditHead
+}
+
+// NewFileAuditor opens or creates the audit log at path. An existing log is
+// verified and the chain continues from its last entry; a log that fails
+// verification is an *AuditChainError and is not appended to.
+func NewFileAuditor(path string) (*FileAuditor, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	head, err := VerifyAuditLog(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileAuditor{file: file, head: head}, nil
+}
+
+// Record implements Auditor.
+func (f *FileAuditor) Record(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	line := auditLine{Seq: f.head.Seq + 1, PrevHash: f.head.Hash, Entry: data}
+	line.Hash = line.hash()
+	out, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := f.file.Write(append(out, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	f.head = AuditHead{Seq: line.Seq, Hash: line.Hash}
+	return nil
+}
+
+// Head returns the last entry written.
+func (f *FileAuditor) Head() AuditHead {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.head
+}
+
+// Close closes the file. Later Records fail.
+func (f *FileAuditor) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// VerifyAuditLog checks the hash chain of an audit log written by a
+// FileAuditor and returns its head. The first line that was edited,
+// inserted, reordered or removed is reported as an *AuditChainError. An
+// empty log has a zero head.
+func VerifyAuditLog(r io.Reader) (AuditHead, error) {
+	var head AuditHead
+	reader := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(data) == 0 {
+			return head, nil
+		}
+		if err != nil && err != io.EOF {
+			return head, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if err == io.EOF {
+			return head, NewAuditChainError(n, "incomplete last line")
+		}
+
+		var line auditLine
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&line); err != nil {
+			return head, NewAuditChainError(n, fmt.Sprintf("invalid entry: %v", err))
+		}
+		switch {
+		case line.Seq != head.Seq+1:
+			return head, NewAuditChainError(n, fmt.Sprintf("sequence %d follows %d", line.Seq, head.Seq))
+		case line.PrevHash != head.Hash:
+			return head, NewAuditChainError(n, "previous hash does not match the line before")
+		case line.Hash != line.hash():
+			return head, NewAuditChainError(n, "hash does not match the entry")
+		}
+		head = AuditHead{Seq: line.Seq, Hash: line.Hash}
+	}
+}
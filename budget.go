@@ -0,0 +1,462 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// BudgetLimit caps what a ledger key may spend. Zero fields are unlimited.
+type BudgetLimit struct {
+	MaxCostUSD float64
+	MaxTokens  int64 // Input, output and cache tokens together
+}
+
+// reachedBy reports whether usage has reached the limit.
+func (l BudgetLimit) reachedBy(usage BudgetUsage) bool {
+	return (l.MaxCostUSD > 0 && usage.CostUSD >= l.MaxCostUSD) ||
+		(l.MaxTokens > 0 && usage.Tokens() >= l.MaxTokens)
+}
+
+// BudgetUsage is what a ledger key has spent.
+type BudgetUsage struct {
+	CostUSD             float64 `json:"cost_usd"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	Turns               int64   `json:"turns"`
+}
+
+// Tokens returns the input, output and cache tokens together.
+func (u BudgetUsage) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheCreationTokens
+}
+
+// Add returns the sum of u and other.
+func (u BudgetUsage) Add(other BudgetUsage) BudgetUsage {
+	return BudgetUsage{
+		CostUSD:             u.CostUSD + other.CostUSD,
+		InputTokens:         u.InputTokens + other.InputTokens,
+		OutputTokens:        u.OutputTokens + other.OutputTokens,
+		CacheReadTokens:     u.CacheReadTokens + other.CacheReadTokens,
+		CacheCreationTokens: u.CacheCreationTokens + other.CacheCreationTokens,
+		Turns:               u.Turns + other.Turns,
+	}
+}
+
+// sub returns u minus other.
+func (u BudgetUsage) sub(other BudgetUsage) BudgetUsage {
+	return u.Add(BudgetUsage{
+		CostUSD:             -other.CostUSD,
+		InputTokens:         -other.InputTokens,
+		OutputTokens:        -other.OutputTokens,
+		CacheReadTokens:     -other.CacheReadTokens,
+		CacheCreationTokens: -other.CacheCreationTokens,
+		Turns:               -other.Turns,
+	})
+}
+
+// usageFromMap reads the token fields of an API usage object.
+func usageFromMap(usage map[string]interface{}) BudgetUsage {
+	get := func(field string) int64 {
+		v, _ := usage[field].(float64)
+		return int64(v)
+	}
+	return BudgetUsage{
+		InputTokens:         get("input_tokens"),
+		OutputTokens:        get("output_tokens"),
+		CacheReadTokens:     get("cache_read_input_tokens"),
+		CacheCreationTokens: get("cache_creation_input_tokens"),
+	}
+}
+
+// modelUsageFromMap reads an entry of a result's modelUsage.
+func modelUsageFromMap(usage map[string]interface{}) BudgetUsage {
+	get := func(field string) int64 {
+		v, _ := usage[field].(float64)
+		return int64(v)
+	}
+	cost, _ := usage["costUSD"].(float64)
+	return BudgetUsage{
+		CostUSD:             cost,
+		InputTokens:         get("inputTokens"),
+		OutputTokens:        get("outputTokens"),
+		CacheReadTokens:     get("cacheReadInputTokens"),
+		CacheCreationTokens: get("cacheCreationInputTokens"),
+	}
+}
+
+// resultTotals turns the usage a result reports into the usage added since
+// the previous result of the same CLI process. The CLI's total_cost_usd and
+// modelUsage are totals for the session, so every result repeats the usage
+// of the turns before it. Results without modelUsage fall back to usage,
+// which is counted as the turn's own, with the cost from total_cost_usd.
+type resultTotals struct {
+	cost   float64                // total_cost_usd at the last result
+	models map[string]BudgetUsage // modelUsage at the last result
+}
+
+// next returns the usage by model added by result. model names the usage
+// of results without modelUsage.
+func (r *resultTotals) next(result map[string]interface{}, model string) map[string]BudgetUsage {
+	added := make(map[string]BudgetUsage)
+	if modelUsage, ok := result["modelUsage"].(map[string]interface{}); ok && len(modelUsage) > 0 {
+		if r.models == nil {
+			r.models = make(map[string]BudgetUsage)
+		}
+		for name, u := range modelUsage {
+			entry, _ := u.(map[string]interface{})
+			total := modelUsageFromMap(entry)
+			added[name] = total.since(r.models[name])
+			r.models[name] = total
+		}
+		if cost, ok := result["total_cost_usd"].(float64); ok {
+			r.cost = cost
+		}
+		return added
+	}
+
+	usage, _ := result["usage"].(map[string]interface{})
+	turn := usageFromMap(usage)
+	if cost, ok := result["total_cost_usd"].(float64); ok {
+		turn.CostUSD = BudgetUsage{CostUSD: cost}.since(BudgetUsage{CostUSD: r.cost}).CostUSD
+		r.cost = cost
+	}
+	added[model] = turn
+	return added
+}
+
+// since returns the usage added to the total u since the total last. A
+// total lower than last means the CLI started counting again, for example
+// in a new session, so all of u is new.
+func (u BudgetUsage) since(last BudgetUsage) BudgetUsage {
+	d := u.sub(last)
+	if d.CostUSD < 0 || d.InputTokens < 0 || d.OutputTokens < 0 || d.CacheReadTokens < 0 || d.CacheCreationTokens < 0 {
+		return u
+	}
+	return d
+}
+
+// ModelPricing is the price of a model in US dollars per million tokens. It
+// is used to estimate the cost of a turn before the CLI reports it.
+type ModelPricing struct {
+	InputPerMTok         float64
+	OutputPerMTok        float64
+	CacheReadPerMTok     float64
+	CacheCreationPerMTok float64
+}
+
+func (p ModelPricing) cost(usage BudgetUsage) float64 {
+	return (float64(usage.InputTokens)*p.InputPerMTok +
+		float64(usage.OutputTokens)*p.OutputPerMTok +
+		float64(usage.CacheReadTokens)*p.CacheReadPerMTok +
+		float64(usage.CacheCreationTokens)*p.CacheCreationPerMTok) / 1e6
+}
+
+// BudgetExceededError is returned when a query is refused because a ledger
+// key reached its limit, and by a query interrupted because its estimated
+// usage would cross it.
+type BudgetExceededError struct {
+	*ClaudeSDKError
+	Key   string
+	Usage BudgetUsage // Spent, including estimates of turns in progress
+	Limit BudgetLimit
+}
+
+// NewBudgetExceededError creates a new BudgetExceededError.
+func NewBudgetExceededError(key string, usage BudgetUsage, limit BudgetLimit) *BudgetExceededError {
+	return &BudgetExceededError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fmt.Sprintf(
+			"budget exceeded for %q: spent $%.4f and %d tokens of $%.4f and %d tokens",
+			key, usage.CostUSD, usage.Tokens(), limit.MaxCostUSD, limit.MaxTokens)},
+		Key:   key,
+		Usage: usage,
+		Limit: limit,
+	}
+}
+
+// BudgetLedgerOptions configures a BudgetLedger.
+type BudgetLedgerOptions struct {
+	// DefaultLimit applies to keys without a limit from SetLimit
+	DefaultLimit BudgetLimit
+	// Pricing by model name is used to estimate the cost of turns in
+	// progress. Without it only MaxTokens is enforced before a turn ends.
+	Pricing map[string]ModelPricing
+}
+
+// BudgetLedger accumulates cost and token usage per key, such as a tenant,
+// project or user, across queries, clients and sessions. Usage reported in
+// each ResultMessage is committed to a BudgetStore.
+//
+// Set ClaudeAgentOptions.Budget to an Account of the ledger to enforce it:
+// Query, Pool.Query and ClaudeSDKClient.QueryWithSession are refused once
+// a key reached its limit, and a running turn is interrupted when usage
+// estimated from its assistant messages would cross it.
+type BudgetLedger struct {
+	store   BudgetStore
+	options BudgetLedgerOptions
+
+	mu        sync.Mutex
+	limits    map[string]BudgetLimit
+	committed map[string]BudgetUsage // Last usage read from or added to store
+	live      map[string]BudgetUsage // Estimates of turns in progress
+}
+
+// NewBudgetLedger creates a ledger persisting usage in store, or in memory
+// if store is nil. options may be nil.
+func NewBudgetLedger(store BudgetStore, options *BudgetLedgerOptions) *BudgetLedger {
+	if store == nil {
+		store = NewMemoryBudgetStore()
+	}
+	l := &BudgetLedger{
+		store:     store,
+		limits:    make(map[string]BudgetLimit),
+		committed: make(map[string]BudgetUsage),
+		live:      make(map[string]BudgetUsage),
+	}
+	if options != nil {
+		l.options = *options
+	}
+	return l
+}
+
+// SetLimit sets the limit of key, replacing DefaultLimit for it.
+func (l *BudgetLedger) SetLimit(key string, limit BudgetLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[key] = limit
+}
+
+// Limit returns the limit of key.
+func (l *BudgetLedger) Limit(key string) BudgetLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit(key)
+}
+
+func (l *BudgetLedger) limit(key string) BudgetLimit {
+	if limit, ok := l.limits[key]; ok {
+		return limit
+	}
+	return l.options.DefaultLimit
+}
+
+// Usage returns the usage committed for key, without turns in progress.
+func (l *BudgetLedger) Usage(ctx context.Context, key string) (BudgetUsage, error) {
+	usage, err := l.store.Load(ctx, key)
+	if err != nil {
+		return BudgetUsage{}, err
+	}
+	l.mu.Lock()
+	l.committed[key] = usage
+	l.mu.Unlock()
+	return usage, nil
+}
+
+// Check returns a BudgetExceededError if any of keys reached its limit,
+// counting turns in progress. Usage is read from the store, so limits hold
+// across processes sharing it.
+func (l *BudgetLedger) Check(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		usage, err := l.Usage(ctx, key)
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		usage = usage.Add(l.live[key])
+		limit := l.limit(key)
+		l.mu.Unlock()
+		if limit.reachedBy(usage) {
+			return NewBudgetExceededError(key, usage, limit)
+		}
+	}
+	return nil
+}
+
+// Record commits usage to each of keys, for spending outside the SDK.
+func (l *BudgetLedger) Record(ctx context.Context, usage BudgetUsage, keys ...string) error {
+	for _, key := range keys {
+		total, err := l.store.Add(ctx, key, usage)
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		l.committed[key] = total
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// Account returns the account charging every one of keys, for
+// ClaudeAgentOptions.Budget. Queries are refused when any key is over its
+// limit, so keys can be nested, for example a tenant and one of its users.
+func (l *BudgetLedger) Account(keys ...string) *BudgetAccount {
+	return &BudgetAccount{ledger: l, keys: keys}
+}
+
+// adjustLive adds delta to the estimates of turns in progress of keys and
+// returns the error of the first key whose committed and estimated usage
+// reached its limit.
+func (l *BudgetLedger) adjustLive(keys []string, delta BudgetUsage) *BudgetExceededError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var exceeded *BudgetExceededError
+	for _, key := range keys {
+		l.live[key] = l.live[key].Add(delta)
+		if l.live[key] == (BudgetUsage{}) {
+			delete(l.live, key)
+		}
+		usage := l.committed[key].Add(l.live[key])
+		if limit := l.limit(key); exceeded == nil && limit.reachedBy(usage) {
+			exceeded = NewBudgetExceededError(key, usage, limit)
+		}
+	}
+	return exceeded
+}
+
+// BudgetAccount charges queries to one or more keys of a BudgetLedger.
+type BudgetAccount struct {
+	ledger *BudgetLedger
+	keys   []string
+}
+
+// Keys returns the keys the account charges.
+func (a *BudgetAccount) Keys() []string {
+	return append([]string(nil), a.keys...)
+}
+
+// Check returns a BudgetExceededError if any key of the account reached its
+// limit. A nil account is never exceeded.
+func (a *BudgetAccount) Check(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	return a.ledger.Check(ctx, a.keys...)
+}
+
+// budgetRun charges the turns of one CLI process to an account. The router
+// observes messages; finish may run concurrently when the query closes. A
+// nil budgetRun does nothing.
+type budgetRun struct {
+	account *BudgetAccount
+	log     func() *slog.Logger
+
+	mu          sync.Mutex
+	model       string
+	messages    map[string]BudgetUsage // Assistant message usage by message ID
+	estimate    BudgetUsage            // Of the turn in progress, counted as live
+	totals      resultTotals           // Session totals at the last result
+	exceeded    *BudgetExceededError
+	interrupted bool // The turn in progress was interrupted
+}
+
+func newBudgetRun(account *BudgetAccount, log func() *slog.Logger) *budgetRun {
+	if account == nil {
+		return nil
+	}
+	return &budgetRun{account: account, log: log, messages: make(map[string]BudgetUsage)}
+}
+
+// observe updates the estimate of the turn in progress from an assistant
+// message or commits a result's usage. It returns an error when the turn
+// should be interrupted, once per turn.
+func (b *budgetRun) observe(ctx context.Context, msg map[string]interface{}) *BudgetExceededError {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch msg["type"] {
+	case "system":
+		if model, ok := msg["model"].(string); ok {
+			b.model = model
+		}
+	case "assistant":
+		message, _ := msg["message"].(map[string]interface{})
+		usage, ok := message["usage"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		model, _ := message["model"].(string)
+		if model == "" {
+			model = b.model
+		}
+		estimate := usageFromMap(usage)
+		if pricing, ok := b.account.ledger.options.Pricing[model]; ok {
+			estimate.CostUSD = pricing.cost(estimate)
+		}
+		// Each content block of a streamed message repeats its usage, so
+		// the latest report for a message ID replaces earlier ones
+		id, _ := message["id"].(string)
+		if id == "" {
+			id = fmt.Sprintf("message_%d", len(b.messages))
+		}
+		delta := estimate.sub(b.messages[id])
+		b.messages[id] = estimate
+		b.estimate = b.estimate.Add(delta)
+
+		exceeded := b.account.ledger.adjustLive(b.account.keys, delta)
+		if exceeded == nil || b.interrupted {
+			return nil
+		}
+		b.interrupted = true
+		b.exceeded = exceeded
+		return exceeded
+	case "result":
+		// Cost and tokens both come from the session totals the result
+		// reports, less those of the previous result
+		var actual BudgetUsage
+		for _, usage := range b.totals.next(msg, b.model) {
+			actual = actual.Add(usage)
+		}
+		actual.Turns = 1
+		b.commit(ctx, actual)
+	}
+	return nil
+}
+
+// commit replaces the estimate of the turn in progress with usage. Called
+// with mu held.
+func (b *budgetRun) commit(ctx context.Context, usage BudgetUsage) {
+	b.account.ledger.adjustLive(b.account.keys, BudgetUsage{}.sub(b.estimate))
+	b.estimate = BudgetUsage{}
+	b.messages = make(map[string]BudgetUsage)
+	b.interrupted = false
+
+	if err := b.account.ledger.Record(context.WithoutCancel(ctx), usage, b.account.keys...); err != nil {
+		b.log().Error("claude: failed to record budget usage", "keys", b.account.keys, "error", err)
+	}
+}
+
+// finish commits the estimate of a turn that ended without a result, for
+// example because the CLI exited, so its usage is not lost.
+func (b *budgetRun) finish() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.estimate != (BudgetUsage{}) {
+		estimate := b.estimate
+		estimate.Turns = 1
+		b.commit(context.Background(), estimate)
+	}
+}
+
+// exceededError returns the error of the last turn interrupted because of
+// the budget, or nil.
+func (b *budgetRun) exceededError() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exceeded == nil {
+		return nil
+	}
+	return b.exceeded
+}
@@ -0,0 +1,143 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BudgetStore persists the usage of BudgetLedger keys. Implementations must
+// be safe for concurrent use.
+type BudgetStore interface {
+	// Load returns the usage of key, or zero usage for an unknown key.
+	Load(ctx context.Context, key string) (BudgetUsage, error)
+	// Add adds delta to the usage of key and returns the new total.
+	Add(ctx context.Context, key string, delta BudgetUsage) (BudgetUsage, error)
+}
+
+// MemoryBudgetStore keeps usage in memory, for one process.
+type MemoryBudgetStore struct {
+	mu    sync.Mutex
+	usage map[string]BudgetUsage
+}
+
+// NewMemoryBudgetStore creates an empty MemoryBudgetStore.
+func NewMemoryBudgetStore() *MemoryBudgetStore {
+	return &MemoryBudgetStore{usage: make(map[string]BudgetUsage)}
+}
+
+// Load implements BudgetStore.
+func (s *MemoryBudgetStore) Load(ctx context.Context, key string) (BudgetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[key], nil
+}
+
+// Add implements BudgetStore.
+func (s *MemoryBudgetStore) Add(ctx context.Context, key string, delta BudgetUsage) (BudgetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[key] = s.usage[key].Add(delta)
+	return s.usage[key], nil
+}
+
+// FileBudgetStore keeps usage in a JSON file mapping keys to usage. Every
+// Add rewrites the file atomically under a lock file next to it, so several
+// processes can share one store.
+type FileBudgetStore struct {
+	path string
+	mu   sync.Mutex // Serializes this process; the lock file serializes others
+}
+
+// NewFileBudgetStore creates a store in the file at path, which is created
+// on the first Add. Its directory must exist.
+func NewFileBudgetStore(path string) (*FileBudgetStore, error) {
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("budget store directory: %w", err)
+	}
+	return &FileBudgetStore{path: path}, nil
+}
+
+// Load implements BudgetStore.
+func (s *FileBudgetStore) Load(ctx context.Context, key string) (BudgetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage, err := s.read()
+	if err != nil {
+		return BudgetUsage{}, err
+	}
+	return usage[key], nil
+}
+
+// Add implements BudgetStore.
+func (s *FileBudgetStore) Add(ctx context.Context, key string, delta BudgetUsage) (BudgetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return BudgetUsage{}, err
+	}
+	defer unlock()
+
+	usage, err := s.read()
+	if err != nil {
+		return BudgetUsage{}, err
+	}
+	usage[key] = usage[key].Add(delta)
+	if err := s.write(usage); err != nil {
+		return BudgetUsage{}, err
+	}
+	return usage[key], nil
+}
+
+// read returns the usage in the file, which may not exist yet.
+func (s *FileBudgetStore) read() (map[string]BudgetUsage, error) {
+	usage := make(map[string]BudgetUsage)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget store: %w", err)
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("failed to parse budget store %s: %w", s.path, err)
+	}
+	return usage, nil
+}
+
+// write replaces the file through a temporary file, so readers never see a
+// partial write.
+func (s *FileBudgetStore) write(usage map[string]BudgetUsage) error {
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write budget store: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write budget store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write budget store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write budget store: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to write budget store: %w", err)
+	}
+	return nil
+}
@@ -1,12 +1,19 @@
 package claude
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Embed bundled CLI binaries for different platforms
@@ -16,88 +23,273 @@ import (
 //go:embed _bundled/*
 var bundledCLI embed.FS
 
-// getBundledCLIPath returns the path to the bundled CLI binary for the current platform.
-// If the binary doesn't exist in the embedded filesystem, returns an empty string.
-func getBundledCLIPath() (string, error) {
-	// Determine the binary name for the current platform
-	var binaryName string
+// bundledManifestName is the file scripts/download_cli.go writes next to the
+// binaries, recording the CLI version and the SHA-256 of each binary.
+const bundledManifestName = "manifest.json"
+
+// bundledManifest is the content of _bundled/manifest.json.
+type bundledManifest struct {
+	Version  string            `json:"version"`
+	Binaries map[string]string `json:"binaries"` // Binary name -> hex SHA-256
+}
+
+// bundledBinaryName returns the name of the bundled CLI binary for the
+// current platform, or "" if no binary is built for it.
+func bundledBinaryName() string {
 	switch runtime.GOOS {
 	case "darwin":
 		switch runtime.GOARCH {
 		case "amd64":
-			binaryName = "claude-darwin-amd64"
+			return "claude-darwin-amd64"
 		case "arm64":
-			binaryName = "claude-darwin-arm64"
-		default:
-			return "", nil // Unsupported architecture
+			return "claude-darwin-arm64"
 		}
 	case "linux":
 		switch runtime.GOARCH {
 		case "amd64":
-			binaryName = "claude-linux-amd64"
+			return "claude-linux-amd64"
 		case "arm64":
-			binaryName = "claude-linux-arm64"
-		default:
-			return "", nil // Unsupported architecture
+			return "claude-linux-arm64"
 		}
 	case "windows":
-		switch runtime.GOARCH {
-		case "amd64":
-			binaryName = "claude-windows-amd64.exe"
-		default:
-			return "", nil // Unsupported architecture
+		if runtime.GOARCH == "amd64" {
+			return "claude-windows-amd64.exe"
 		}
-	default:
-		return "", nil // Unsupported OS
 	}
+	return "" // Unsupported platform
+}
 
-	embeddedPath := "_bundled/" + binaryName
+// readBundledManifest reads the manifest from fsys. It returns nil if there
+// is none.
+func readBundledManifest(fsys fs.FS) (*bundledManifest, error) {
+	data, err := fs.ReadFile(fsys, bundledManifestName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var manifest bundledManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundled CLI manifest: %w", err)
+	}
+	return &manifest, nil
+}
 
-	// Check if the file exists in the embedded filesystem
-	if _, err := bundledCLI.Open(embeddedPath); err != nil {
+// getBundledCLIPath returns the path to the bundled CLI binary for the current platform.
+// If the binary doesn't exist in the embedded filesystem, returns an empty string.
+func getBundledCLIPath() (string, error) {
+	name := bundledBinaryName()
+	if name == "" {
+		return "", nil
+	}
+	fsys, _ := fs.Sub(bundledCLI, "_bundled")
+	if _, err := fs.Stat(fsys, name); err != nil {
 		// Binary not embedded (possibly development mode)
 		return "", nil
 	}
 
-	// Extract the binary to a temporary location
-	tempDir := filepath.Join(os.TempDir(), "claude-agent-sdk-go")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	cacheDir, err := bundledCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return ExtractBundledCLI(fsys, name, cacheDir)
+}
+
+// bundledCacheDir returns the per-user directory bundled binaries are
+// extracted under.
+func bundledCacheDir() (string, error) {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "claude-agent-sdk-go"), nil
+	}
+	// No home directory: fall back to a directory only this user can own
+	return filepath.Join(os.TempDir(), fmt.Sprintf("claude-agent-sdk-go-%d", os.Getuid())), nil
+}
+
+// verifiedBundledCLI remembers extracted binaries verified by this process,
+// so the checksum is computed once and not on every discovery.
+var verifiedBundledCLI = struct {
+	sync.Mutex
+	files map[string]fileStamp
+}{files: make(map[string]fileStamp)}
+
+// fileStamp identifies a version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// ExtractBundledCLI extracts the binary name from fsys into a private
+// directory under cacheDir and returns its path. fsys must contain the
+// manifest written by scripts/download_cli.go; the binary is only used if
+// its SHA-256 matches the one recorded there.
+//
+// An already extracted binary is reused only if its checksum matches, and a
+// new one is written to a temporary file and renamed into place while
+// holding a lock, so concurrent processes never run a partially written or
+// replaced binary. Exported for testing purposes.
+func ExtractBundledCLI(fsys fs.FS, name, cacheDir string) (string, error) {
+	manifest, err := readBundledManifest(fsys)
+	if err != nil {
+		return "", err
+	}
+	if manifest == nil || manifest.Binaries[name] == "" {
+		return "", fmt.Errorf("bundled CLI %s has no recorded checksum; rerun scripts/download_cli.go", name)
+	}
+	want := strings.ToLower(manifest.Binaries[name])
+
+	// The checksum in the directory name keeps different builds apart
+	version := manifest.Version
+	if version == "" {
+		version = "unknown"
+	}
+	dir := filepath.Join(cacheDir, version+"-"+want[:min(12, len(want))])
+	if err := makePrivateDir(cacheDir); err != nil {
+		return "", err
+	}
+	if err := makePrivateDir(dir); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, name)
+
+	if ok, err := verifyBundledFile(target, want); ok || err != nil {
+		return target, err
 	}
 
-	tempFile := filepath.Join(tempDir, binaryName)
+	unlock, err := lockFile(filepath.Join(dir, name+".lock"))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	// Another process may have extracted it while we waited for the lock
+	if ok, err := verifyBundledFile(target, want); ok || err != nil {
+		return target, err
+	}
 
-	// Check if we already extracted this binary
-	if info, err := os.Stat(tempFile); err == nil {
-		// File exists, verify it's not corrupted by checking size
-		embeddedFile, err := bundledCLI.Open(embeddedPath)
+	if err := extractVerified(fsys, name, target, want); err != nil {
+		return "", err
+	}
+	if ok, err := verifyBundledFile(target, want); !ok {
 		if err == nil {
-			defer embeddedFile.Close()
-			if stat, err := embeddedFile.Stat(); err == nil && stat.Size() == info.Size() {
-				// File exists and has correct size, use it
-				return tempFile, nil
-			}
+			err = fmt.Errorf("extracted bundled CLI %s failed verification", target)
 		}
+		return "", err
 	}
+	return target, nil
+}
 
-	// Extract the binary from embedded filesystem
-	embeddedFile, err := bundledCLI.Open(embeddedPath)
+// makePrivateDir creates dir readable only by the current user, and
+// tightens its permissions if it already exists.
+func makePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create bundled CLI directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to open embedded CLI: %w", err)
+		return fmt.Errorf("failed to create bundled CLI directory: %w", err)
 	}
-	defer embeddedFile.Close()
+	if !info.IsDir() {
+		return fmt.Errorf("bundled CLI directory %s is not a directory", dir)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0700 {
+		// Fails unless the directory is ours
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("bundled CLI directory %s is not private: %w", dir, err)
+		}
+	}
+	return nil
+}
 
-	// Create the output file
-	outFile, err := os.OpenFile(tempFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+// verifyBundledFile reports whether path exists and has the checksum want.
+// A regular file with a different checksum is removed; a missing file is
+// not an error.
+func verifyBundledFile(path, want string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return false, err
 	}
-	defer outFile.Close()
+	if !info.Mode().IsRegular() {
+		return false, fmt.Errorf("bundled CLI %s is not a regular file", path)
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
 
-	// Copy the binary
-	if _, err := io.Copy(outFile, embeddedFile); err != nil {
-		return "", fmt.Errorf("failed to extract CLI binary: %w", err)
+	verifiedBundledCLI.Lock()
+	verified, ok := verifiedBundledCLI.files[path]
+	verifiedBundledCLI.Unlock()
+	if ok && verified == stamp {
+		return true, nil
 	}
 
-	return tempFile, nil
+	got, err := fileSHA256(path)
+	if err != nil {
+		return false, err
+	}
+	if got != want {
+		// Tampered with or partially written by an older SDK: replace it
+		os.Remove(path)
+		return false, nil
+	}
+
+	verifiedBundledCLI.Lock()
+	verifiedBundledCLI.files[path] = stamp
+	verifiedBundledCLI.Unlock()
+	return true, nil
+}
+
+// extractVerified copies name from fsys to a temporary file next to target,
+// checks its checksum and renames it over target.
+func extractVerified(fsys fs.FS, name, target, want string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open embedded CLI: %w", err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to extract CLI binary: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to extract CLI binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to extract CLI binary: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("embedded CLI %s has SHA-256 %s, expected %s", name, got, want)
+	}
+	if err := os.Chmod(tmpPath, 0700); err != nil {
+		return fmt.Errorf("failed to make CLI executable: %w", err)
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to install CLI binary: %w", err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	lockRetry = 50 * time.Millisecond
+	lockStale = 2 * time.Minute
+)
+
+// lockFile takes an exclusive lock on path by creating it, blocking until
+// other processes holding it remove it. A lock older than lockStale is
+// assumed to belong to a process that died.
+func lockFile(path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(lockRetry)
+	}
+}
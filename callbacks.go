@@ -0,0 +1,144 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// defaultCallbackMaxWait is how long a callback waits for a free slot by
+// default.
+const defaultCallbackMaxWait = 30 * time.Second
+
+// CallbackLimits bounds the CanUseTool, hook and SDK MCP tool callbacks of a
+// query or client. Panics in callbacks are recovered whether or not limits
+// are set.
+type CallbackLimits struct {
+	// MaxConcurrent bounds how many callbacks run at once (default:
+	// unlimited)
+	MaxConcurrent int
+	// MaxWait is how long a callback waits for one of the MaxConcurrent
+	// slots before it is rejected with a CallbackRejectedError (default:
+	// 30s)
+	MaxWait time.Duration
+	// Timeout bounds each CanUseTool and SDK MCP tool call, and hooks whose
+	// HookMatcher has no Timeout (default: none)
+	Timeout time.Duration
+}
+
+// callbackGuard runs user callbacks on behalf of control request handlers.
+type callbackGuard struct {
+	slots   chan struct{} // nil when unlimited
+	maxWait time.Duration
+	timeout time.Duration
+	log     func() *slog.Logger
+}
+
+func newCallbackGuard(limits *CallbackLimits, log func() *slog.Logger) *callbackGuard {
+	g := &callbackGuard{maxWait: defaultCallbackMaxWait, log: log}
+	if limits == nil {
+		return g
+	}
+	if limits.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	if limits.MaxWait > 0 {
+		g.maxWait = limits.MaxWait
+	}
+	g.timeout = limits.Timeout
+	return g
+}
+
+// run calls fn in its own goroutine. A panic becomes a CallbackPanicError,
+// running past timeout (the default timeout when zero) a
+// CallbackTimeoutError, and waiting too long for a slot a
+// CallbackRejectedError. fn keeps its slot until it returns, even after
+// run gave up on it, so a stuck callback still counts against the limit.
+func (g *callbackGuard) run(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if err := g.acquire(ctx, name); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = g.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, NewCallbackTimeoutError(name, timeout))
+		defer cancel()
+	}
+
+	type outcome struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer g.release()
+		defer func() {
+			if r := recover(); r != nil {
+				stack := string(debug.Stack())
+				g.log().Error("claude: callback panicked", "callback", name, "panic", fmt.Sprint(r), "stack", stack)
+				done <- outcome{err: NewCallbackPanicError(name, r, stack)}
+			}
+		}()
+		value, err := fn(ctx)
+		done <- outcome{value: value, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && errors.Is(o.err, context.DeadlineExceeded) {
+			// The callback gave up on its deadline itself
+			if timeoutErr := timeoutCause(ctx); timeoutErr != nil {
+				return nil, timeoutErr
+			}
+		}
+		return o.value, o.err
+	case <-ctx.Done():
+		if timeoutErr := timeoutCause(ctx); timeoutErr != nil {
+			return nil, timeoutErr
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// timeoutCause returns the CallbackTimeoutError that ended ctx, if any.
+func timeoutCause(ctx context.Context) error {
+	var timeoutErr *CallbackTimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return nil
+}
+
+// acquire takes a slot, waiting up to maxWait.
+func (g *callbackGuard) acquire(ctx context.Context, name string) error {
+	if g.slots == nil {
+		return nil
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(g.maxWait)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return NewCallbackRejectedError(name, cap(g.slots))
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *callbackGuard) release() {
+	if g.slots != nil {
+		<-g.slots
+	}
+}
@@ -0,0 +1,110 @@
+// Package claudemetrics exports SDK metrics through expvar or in the
+// Prometheus text format, without further dependencies.
+//
+// Example:
+//
+//	prom := claudemetrics.NewPrometheus(nil)
+//	http.Handle("/metrics", prom)
+//
+//	options := &claude.ClaudeAgentOptions{Metrics: prom}
+//
+// Both implementations can be combined with Multi.
+package claudemetrics
+
+import (
+	"expvar"
+	"sort"
+	"strings"
+	"sync"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// Expvar publishes each metric as an expvar.Map keyed by its labels, for
+// example claude_tool_calls_total: {"tool=Bash": 3}. Histograms map labels
+// to their count, sum and max. Variables appear on /debug/vars once
+// net/http/expvar handlers are registered.
+type Expvar struct {
+	prefix string
+	vars   map[string]*expvar.Map // Guarded by expvarMu
+}
+
+// expvarMu guards publishing variables and creating histogram entries, which
+// Expvar values with the same prefix share.
+var expvarMu sync.Mutex
+
+// NewExpvar creates an Expvar publishing variables named prefix followed by
+// the metric name. Variables already published under a name are reused, so
+// several Expvar values with the same prefix share them.
+func NewExpvar(prefix string) *Expvar {
+	return &Expvar{prefix: prefix, vars: make(map[string]*expvar.Map)}
+}
+
+// Add implements claude.Metrics.
+func (e *Expvar) Add(name string, delta float64, labels claude.Labels) {
+	e.get(name).AddFloat(labelKey(labels), delta)
+}
+
+// Observe implements claude.Metrics.
+func (e *Expvar) Observe(name string, value float64, labels claude.Labels) {
+	m := e.get(name)
+	key := labelKey(labels)
+
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	h, _ := m.Get(key).(*expvar.Map)
+	if h == nil {
+		h = new(expvar.Map).Init()
+		h.Set("max", new(expvar.Float))
+		m.Set(key, h)
+	}
+	h.AddFloat("count", 1)
+	h.AddFloat("sum", value)
+	if max := h.Get("max").(*expvar.Float); value > max.Value() {
+		max.Set(value)
+	}
+}
+
+func (e *Expvar) get(name string) *expvar.Map {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if m, ok := e.vars[name]; ok {
+		return m
+	}
+	fullName := e.prefix + name
+	m, ok := expvar.Get(fullName).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(fullName)
+	}
+	e.vars[name] = m
+	return m
+}
+
+// labelKey formats labels as sorted name=value pairs separated by commas.
+func labelKey(labels claude.Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Multi returns a claude.Metrics recording to every one of metrics.
+func Multi(metrics ...claude.Metrics) claude.Metrics {
+	return multi(metrics)
+}
+
+type multi []claude.Metrics
+
+func (m multi) Add(name string, delta float64, labels claude.Labels) {
+	for _, metrics := range m {
+		metrics.Add(name, delta, labels)
+	}
+}
+
+func (m multi) Observe(name string, value float64, labels claude.Labels) {
+	for _, metrics := range m {
+		metrics.Observe(name, value, labels)
+	}
+}
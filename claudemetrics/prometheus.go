@@ -0,0 +1,259 @@
+package claudemetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds, in seconds, used
+// when PrometheusOptions.Buckets is empty. They span fast hooks to long
+// agent turns.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// PrometheusOptions configures a Prometheus.
+type PrometheusOptions struct {
+	// Buckets are histogram upper bounds in increasing order (default:
+	// DefaultBuckets)
+	Buckets []float64
+	// ConstLabels are added to every sample, for example the service name
+	ConstLabels claude.Labels
+}
+
+// Prometheus keeps metrics in memory and serves them in the Prometheus text
+// exposition format (version 0.0.4).
+type Prometheus struct {
+	buckets     []float64
+	constLabels claude.Labels
+
+	mu      sync.Mutex
+	metrics map[string]*promMetric
+}
+
+type promMetric struct {
+	histogram bool
+	series    map[string]*promSeries // By rendered label set
+}
+
+type promSeries struct {
+	value  float64  // Counter value
+	counts []uint64 // Histogram count per bucket, not cumulative
+	count  uint64   // Histogram observations
+	sum    float64  // Histogram sum
+}
+
+// descriptions are the HELP texts of the SDK's metrics.
+var descriptions = map[string]string{
+	claude.MetricTurns:               "Agent turns completed, by model and result subtype.",
+	claude.MetricTurnDuration:        "Turn duration reported by the CLI in seconds.",
+	claude.MetricTurnAPIDuration:     "Time spent in API calls per turn in seconds.",
+	claude.MetricCost:                "Cost reported by the CLI in US dollars.",
+	claude.MetricTokens:              "Tokens used, by model and type.",
+	claude.MetricToolCalls:           "Tool uses requested by the model, by tool.",
+	claude.MetricPermissionDecisions: "CanUseTool decisions, by tool and behavior.",
+	claude.MetricHookDuration:        "Hook callback duration in seconds, by event.",
+	claude.MetricControlTimeouts:     "Control requests to the CLI that timed out, by subtype.",
+	claude.MetricCLIStarts:           "CLI processes started.",
+	claude.MetricCLIFailures:         "CLI processes that exited with an error, by kind.",
+	claude.MetricParseErrors:         "Messages from the CLI that failed to parse.",
+}
+
+// NewPrometheus creates an empty Prometheus. options may be nil.
+func NewPrometheus(options *PrometheusOptions) *Prometheus {
+	p := &Prometheus{buckets: DefaultBuckets, metrics: make(map[string]*promMetric)}
+	if options != nil {
+		if len(options.Buckets) > 0 {
+			p.buckets = append([]float64(nil), options.Buckets...)
+			sort.Float64s(p.buckets)
+		}
+		p.constLabels = options.ConstLabels
+	}
+	return p
+}
+
+// Add implements claude.Metrics.
+func (p *Prometheus) Add(name string, delta float64, labels claude.Labels) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series(name, false, labels).value += delta
+}
+
+// Observe implements claude.Metrics.
+func (p *Prometheus) Observe(name string, value float64, labels claude.Labels) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series(name, true, labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(p.buckets))
+	}
+	if i := sort.SearchFloat64s(p.buckets, value); i < len(p.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// series returns the series of name for labels, creating it. Called with mu
+// held.
+func (p *Prometheus) series(name string, histogram bool, labels claude.Labels) *promSeries {
+	m, ok := p.metrics[name]
+	if !ok {
+		m = &promMetric{histogram: histogram, series: make(map[string]*promSeries)}
+		p.metrics[name] = m
+	}
+	key := p.renderLabels(labels)
+	s, ok := m.series[key]
+	if !ok {
+		s = &promSeries{}
+		m.series[key] = s
+	}
+	return s
+}
+
+// renderLabels formats labels and the constant labels as name="value"
+// pairs sorted by name, without braces.
+func (p *Prometheus) renderLabels(labels claude.Labels) string {
+	merged := make(map[string]string, len(labels)+len(p.constLabels))
+	for name, value := range p.constLabels {
+		merged[name] = value
+	}
+	for name, value := range labels {
+		merged[name] = value
+	}
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = sanitizeName(name) + `="` + escapeLabelValue(merged[name]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	names := make([]string, 0, len(p.metrics))
+	for name := range p.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := p.metrics[name]
+		metricName := sanitizeName(name)
+		if help, ok := descriptions[name]; ok {
+			fmt.Fprintf(cw, "# HELP %s %s\n", metricName, help)
+		}
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		if !m.histogram {
+			fmt.Fprintf(cw, "# TYPE %s counter\n", metricName)
+			for _, key := range keys {
+				fmt.Fprintf(cw, "%s%s %s\n", metricName, braces(key), formatFloat(m.series[key].value))
+			}
+			continue
+		}
+
+		fmt.Fprintf(cw, "# TYPE %s histogram\n", metricName)
+		for _, key := range keys {
+			s := m.series[key]
+			var cumulative uint64
+			for i, bound := range p.buckets {
+				if s.counts != nil {
+					cumulative += s.counts[i]
+				}
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", metricName, braces(joinLabels(key, `le="`+formatFloat(bound)+`"`)), cumulative)
+			}
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", metricName, braces(joinLabels(key, `le="+Inf"`)), s.count)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", metricName, braces(key), formatFloat(s.sum))
+			fmt.Fprintf(cw, "%s_count%s %d\n", metricName, braces(key), s.count)
+		}
+	}
+
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sanitizeName replaces characters Prometheus does not allow in metric and
+// label names with underscores.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,89 @@
+// Package claudeotel traces agent runs with OpenTelemetry.
+//
+// NewTracer adapts an OpenTelemetry TracerProvider to claude.Tracer. Each
+// Query or ClaudeSDKClient turn becomes a span with child spans for every
+// tool use (from its ToolUseBlock to the matching ToolResultBlock), every
+// CanUseTool and hook callback, every SDK MCP tool call and every control
+// request round trip. Query and turn spans carry the model, session ID,
+// cost and token usage of the ResultMessage.
+//
+// Example:
+//
+//	options := &claude.ClaudeAgentOptions{
+//	    Tracer: claudeotel.NewTracer(otel.GetTracerProvider()),
+//	}
+//	msgCh, errCh, err := claude.Query(ctx, "Fix the failing test", options, nil)
+package claudeotel
+
+import (
+	"context"
+	"fmt"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer spans are
+// created with.
+const InstrumentationName = "github.com/Facets-cloud/claude-agent-sdk-go"
+
+// NewTracer returns a claude.Tracer creating spans with provider, or with the
+// global TracerProvider if provider is nil.
+func NewTracer(provider trace.TracerProvider) claude.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &tracer{
+		tracer: provider.Tracer(InstrumentationName, trace.WithInstrumentationVersion(claude.SDKVersion)),
+	}
+}
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...claude.Attribute) (context.Context, claude.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+	return ctx, &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetAttributes(attrs ...claude.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// convert maps SDK attributes to OpenTelemetry attributes.
+func convert(attrs []claude.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(attr.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
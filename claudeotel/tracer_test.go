@@ -0,0 +1,257 @@
+package claudeotel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudeotel"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+	"github.com/Facets-cloud/claude-agent-sdk-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer(t *testing.T) (claude.Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return claudeotel.NewTracer(provider), exporter
+}
+
+// spansNamed returns the ended spans called name.
+func collectQuery(t *testing.T, prompt string, options *claude.ClaudeAgentOptions, transport claude.Transport) ([]claude.Message, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	msgCh, errCh, err := claude.Query(ctx, prompt, options, transport)
+	if err != nil {
+		return nil, err
+	}
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	return messages, <-errCh
+}
+
+func allowBash(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+	if toolName == "Bash" {
+		return claude.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	return claude.PermissionResultDeny{Behavior: "deny", Message: "only Bash"}, nil
+}
+
+func spansNamed(exporter *tracetest.InMemoryExporter, name string) []tracetest.SpanStub {
+	var spans []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func spanAttr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func onlySpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	spans := spansNamed(exporter, name)
+	if len(spans) != 1 {
+		t.Fatalf("Expected one %s span, got %d", name, len(spans))
+	}
+	return spans[0]
+}
+
+func assertChildOf(t *testing.T, child, parent tracetest.SpanStub) {
+	t.Helper()
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("Expected %s to be a child of %s", child.Name, parent.Name)
+	}
+}
+
+// resultWithUsage is a result message reporting token usage.
+func resultWithUsage(sessionID string) map[string]interface{} {
+	result := claudetest.Result(sessionID)
+	result["usage"] = map[string]interface{}{
+		"input_tokens":            120,
+		"output_tokens":           45,
+		"cache_read_input_tokens": 300,
+	}
+	return result
+}
+
+func TestTracerSpansForQuery(t *testing.T) {
+	tracer, exporter := newTestTracer(t)
+	input := map[string]interface{}{"command": "ls"}
+	add := mcp.Tool("add", "Add two numbers", map[string]string{"a": "number", "b": "number"},
+		func(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+			return mcp.TextContent("3"), nil
+		})
+
+	scenario := claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		Emit(claudetest.ToolUse("tu_1", "Bash", input)).
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{"tool_name": "Bash", "tool_input": input, "tool_use_id": "tu_1"}, claudetest.ExpectSuccess()).
+		SendControlRequest(map[string]interface{}{
+			"subtype":     "can_use_tool",
+			"tool_name":   "Bash",
+			"input":       input,
+			"tool_use_id": "tu_1",
+		}, claudetest.ExpectAllow()).
+		Emit(claudetest.ToolResult("tu_1", "main.go")).
+		CallMcpTool("calc", "add", map[string]interface{}{"a": 1, "b": 2}, claudetest.ExpectContains("3")).
+		Emit(resultWithUsage("s1"))
+
+	options := &claude.ClaudeAgentOptions{
+		Tracer:     tracer,
+		CanUseTool: allowBash,
+		McpServers: map[string]claude.McpServerConfig{"calc": mcp.CreateSdkMcpServer("calc", "1.0.0", []*mcp.SdkMcpTool{add}).ToConfig()},
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{
+				Matcher: "Bash",
+				Hooks: []claude.HookCallback{
+					func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+						return claude.HookJSONOutput{}, nil
+					},
+				},
+			}},
+		},
+	}
+	if _, err := collectQuery(t, "List the files", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	query := onlySpan(t, exporter, claude.SpanQuery)
+	if query.Parent.IsValid() {
+		t.Error("Query span should be a root span")
+	}
+	for key, want := range map[string]interface{}{
+		claude.AttrModel:           "claude-sonnet-4-5",
+		claude.AttrSessionID:       "s1",
+		claude.AttrCostUSD:         0.001,
+		claude.AttrInputTokens:     int64(120),
+		claude.AttrOutputTokens:    int64(45),
+		claude.AttrCacheReadTokens: int64(300),
+	} {
+		if got := spanAttr(query, key).AsInterface(); got != want {
+			t.Errorf("Query span %s = %v, want %v", key, got, want)
+		}
+	}
+
+	initialize := onlySpan(t, exporter, claude.SpanControlRequest)
+	assertChildOf(t, initialize, query)
+	if spanAttr(initialize, claude.AttrControlSubtype).AsString() != "initialize" {
+		t.Errorf("Expected an initialize control request span, got %v", initialize.Attributes)
+	}
+
+	tool := onlySpan(t, exporter, claude.SpanToolUse)
+	assertChildOf(t, tool, query)
+	if spanAttr(tool, claude.AttrToolName).AsString() != "Bash" || spanAttr(tool, claude.AttrToolUseID).AsString() != "tu_1" {
+		t.Errorf("Unexpected tool span attributes: %v", tool.Attributes)
+	}
+
+	// Callbacks for a tool use are nested under its span
+	hook := onlySpan(t, exporter, claude.SpanHook)
+	assertChildOf(t, hook, tool)
+	if spanAttr(hook, claude.AttrHookEvent).AsString() != "PreToolUse" {
+		t.Errorf("Unexpected hook span attributes: %v", hook.Attributes)
+	}
+	permission := onlySpan(t, exporter, claude.SpanCanUseTool)
+	assertChildOf(t, permission, tool)
+	if spanAttr(permission, claude.AttrPermissionBehavior).AsString() != "allow" {
+		t.Errorf("Expected an allow decision, got %v", permission.Attributes)
+	}
+
+	mcpCall := onlySpan(t, exporter, claude.SpanMCPToolCall)
+	assertChildOf(t, mcpCall, query)
+	if spanAttr(mcpCall, claude.AttrMCPServer).AsString() != "calc" || spanAttr(mcpCall, claude.AttrToolName).AsString() != "add" {
+		t.Errorf("Unexpected MCP span attributes: %v", mcpCall.Attributes)
+	}
+}
+
+func TestTracerRecordsErrors(t *testing.T) {
+	tracer, exporter := newTestTracer(t)
+	failed := claudetest.ToolResult("tu_1", "command not found")
+	failed["message"].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})["is_error"] = true
+
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Run it").
+		Emit(claudetest.ToolUse("tu_1", "Bash", map[string]interface{}{"command": "nope"})).
+		RequestPermission("Write", map[string]interface{}{"path": "x"}, claudetest.ExpectDeny()).
+		Emit(failed).
+		Emit(claudetest.Result("s1"))
+
+	options := &claude.ClaudeAgentOptions{Tracer: tracer, CanUseTool: allowBash}
+	if _, err := collectQuery(t, "Run it", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if tool := onlySpan(t, exporter, claude.SpanToolUse); tool.Status.Code != codes.Error {
+		t.Errorf("Expected a failed tool result to mark the span as an error, got %v", tool.Status)
+	}
+	if permission := onlySpan(t, exporter, claude.SpanCanUseTool); spanAttr(permission, claude.AttrPermissionBehavior).AsString() != "deny" {
+		t.Errorf("Expected a deny decision, got %v", permission.Attributes)
+	}
+	if query := onlySpan(t, exporter, claude.SpanQuery); query.Status.Code == codes.Error {
+		t.Errorf("A failed tool must not fail the query span, got %v", query.Status)
+	}
+}
+
+func TestTracerSpanPerClientTurn(t *testing.T) {
+	tracer, exporter := newTestTracer(t)
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("one").
+		Emit(claudetest.AssistantText("first")).
+		Emit(claudetest.Result("s1")).
+		ExpectUserMessage("two").
+		Emit(claudetest.AssistantText("second")).
+		Emit(resultWithUsage("s1"))
+
+	client := claude.NewClaudeSDKClientWithTransport(&claude.ClaudeAgentOptions{Tracer: tracer}, claudetest.NewTransport(t, scenario))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, prompt := range []string{"one", "two"} {
+		msgCh, errCh := client.Query(ctx, prompt)
+		for range msgCh {
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("Turn %q failed: %v", prompt, err)
+		}
+	}
+
+	turns := spansNamed(exporter, claude.SpanTurn)
+	if len(turns) != 2 {
+		t.Fatalf("Expected two turn spans, got %d", len(turns))
+	}
+	for _, turn := range turns {
+		if spanAttr(turn, claude.AttrSessionID).AsString() != "s1" || spanAttr(turn, claude.AttrModel).AsString() != "claude-sonnet-4-5" {
+			t.Errorf("Unexpected turn attributes: %v", turn.Attributes)
+		}
+	}
+	if spanAttr(turns[1], claude.AttrOutputTokens).AsInt64() != 45 {
+		t.Errorf("Expected usage on the second turn, got %v", turns[1].Attributes)
+	}
+	if len(spansNamed(exporter, claude.SpanQuery)) != 0 {
+		t.Error("Client turns must not create query spans")
+	}
+}
@@ -0,0 +1,14 @@
+// Command fake-claude is the fake Claude Code CLI built by
+// claudetest.BuildFakeCLI. It plays the scenario stored next to its
+// executable.
+package main
+
+import (
+	"os"
+
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+func main() {
+	os.Exit(claudetest.FakeCLIMain())
+}
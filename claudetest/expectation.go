@@ -0,0 +1,112 @@
+package claudetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Expectation describes the response the SDK must give to a control
+// request. The zero value accepts any successful response.
+type Expectation struct {
+	// Error expects an error response instead of success.
+	Error bool `json:"error,omitempty"`
+
+	// Behavior is the expected permission behavior ("allow" or "deny").
+	Behavior string `json:"behavior,omitempty"`
+
+	// UpdatedInput is the expected updatedInput of an allow decision.
+	UpdatedInput map[string]interface{} `json:"updated_input,omitempty"`
+
+	// Fields are top-level response fields that must have these values.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Contains is a substring the JSON-encoded response must contain.
+	Contains string `json:"contains,omitempty"`
+}
+
+// ExpectSuccess accepts any successful response.
+func ExpectSuccess() Expectation {
+	return Expectation{}
+}
+
+// ExpectError expects the SDK to answer with an error.
+func ExpectError() Expectation {
+	return Expectation{Error: true}
+}
+
+// ExpectAllow expects a permission response that allows the tool.
+func ExpectAllow() Expectation {
+	return Expectation{Behavior: "allow"}
+}
+
+// ExpectAllowWithInput expects a permission response that allows the tool
+// with the given (possibly modified) input.
+func ExpectAllowWithInput(input map[string]interface{}) Expectation {
+	return Expectation{Behavior: "allow", UpdatedInput: input}
+}
+
+// ExpectDeny expects a permission response that denies the tool.
+func ExpectDeny() Expectation {
+	return Expectation{Behavior: "deny"}
+}
+
+// ExpectFields expects a successful response with these top-level fields.
+func ExpectFields(fields map[string]interface{}) Expectation {
+	return Expectation{Fields: fields}
+}
+
+// ExpectContains expects a successful response whose JSON contains text.
+func ExpectContains(text string) Expectation {
+	return Expectation{Contains: text}
+}
+
+// check verifies the "response" object of a control_response frame.
+func (e Expectation) check(response map[string]interface{}) error {
+	subtype, _ := response["subtype"].(string)
+	if subtype == "error" {
+		if e.Error {
+			return nil
+		}
+		return fmt.Errorf("SDK returned error: %v", response["error"])
+	}
+	if e.Error {
+		return fmt.Errorf("expected error response, got success: %s", encode(response["response"]))
+	}
+
+	data, _ := response["response"].(map[string]interface{})
+	if e.Behavior != "" && data["behavior"] != e.Behavior {
+		return fmt.Errorf("expected behavior %q, got %q", e.Behavior, data["behavior"])
+	}
+	if e.UpdatedInput != nil && !jsonEqual(e.UpdatedInput, data["updatedInput"]) {
+		return fmt.Errorf("expected updatedInput %s, got %s", encode(e.UpdatedInput), encode(data["updatedInput"]))
+	}
+	for key, expected := range e.Fields {
+		if !jsonEqual(expected, data[key]) {
+			return fmt.Errorf("expected %s=%s, got %s", key, encode(expected), encode(data[key]))
+		}
+	}
+	if e.Contains != "" && !strings.Contains(encode(data), e.Contains) {
+		return fmt.Errorf("expected response to contain %q, got %s", e.Contains, encode(data))
+	}
+	return nil
+}
+
+// encode returns v as compact JSON for messages.
+func encode(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// jsonEqual compares two values after a JSON round trip, so Go values
+// compare equal to their decoded form (e.g. int and float64).
+func jsonEqual(a, b interface{}) bool {
+	var na, nb interface{}
+	json.Unmarshal([]byte(encode(a)), &na)
+	json.Unmarshal([]byte(encode(b)), &nb)
+	return reflect.DeepEqual(na, nb)
+}
@@ -0,0 +1,232 @@
+package claudetest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// fakeCLIPackage is the main package built by BuildFakeCLI.
+const fakeCLIPackage = "github.com/Facets-cloud/claude-agent-sdk-go/claudetest/cmd/fake-claude"
+
+// Files the fake CLI binary reads and writes next to its executable.
+const (
+	scenarioSuffix   = ".scenario.json"
+	invocationSuffix = ".invocation.json"
+)
+
+// invocation records how the fake CLI binary was started and how the
+// scenario ended.
+type invocation struct {
+	Args  []string `json:"args"`
+	Dir   string   `json:"dir"`
+	Error string   `json:"error,omitempty"`
+}
+
+// FakeCLI is a standalone fake claude binary built by BuildFakeCLI.
+type FakeCLI struct {
+	// Path is the executable, suitable for ClaudeAgentOptions.CliPath.
+	Path string
+}
+
+// BuildFakeCLI builds a fake claude binary that plays scenario and speaks
+// the full control protocol over stdin/stdout. Use it with
+// ClaudeAgentOptions.CliPath to test SubprocessCLITransport end to end,
+// including argument building (see Scenario.ExpectFlag and FakeCLI.Args).
+//
+// The binary is compiled with the go command, so tests using it need a Go
+// toolchain. Scenario failures are reported to tb when the test finishes;
+// the binary also prints them to stderr and exits with status 1.
+func BuildFakeCLI(tb testing.TB, scenario *Scenario) *FakeCLI {
+	tb.Helper()
+
+	name := "claude"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	path := filepath.Join(tb.TempDir(), name)
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		goTool = filepath.Join(runtime.GOROOT(), "bin", "go")
+	}
+	if output, err := exec.Command(goTool, "build", "-o", path, fakeCLIPackage).CombinedOutput(); err != nil {
+		tb.Fatalf("claudetest: failed to build fake CLI: %v\n%s", err, output)
+	}
+
+	data, err := json.Marshal(scenario.data)
+	if err != nil {
+		tb.Fatalf("claudetest: failed to encode scenario: %v", err)
+	}
+	if err := os.WriteFile(path+scenarioSuffix, data, 0600); err != nil {
+		tb.Fatalf("claudetest: failed to write scenario: %v", err)
+	}
+
+	f := &FakeCLI{Path: path}
+	tb.Cleanup(func() {
+		if err := f.Err(); err != nil {
+			tb.Errorf("claudetest: fake CLI: %v", err)
+		}
+	})
+	return f
+}
+
+// Args returns the arguments of the last session the binary ran, or nil if
+// it has not been started. Version checks ("-v") are not recorded.
+func (f *FakeCLI) Args() []string {
+	inv, err := f.invocation()
+	if err != nil {
+		return nil
+	}
+	return inv.Args
+}
+
+// FlagValue returns the value following flag in Args.
+func (f *FakeCLI) FlagValue(flag string) (string, bool) {
+	args := f.Args()
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// Err returns the scenario failure reported by the binary, if any.
+func (f *FakeCLI) Err() error {
+	inv, err := f.invocation()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if inv.Error != "" {
+		return errors.New(inv.Error)
+	}
+	return nil
+}
+
+func (f *FakeCLI) invocation() (invocation, error) {
+	var inv invocation
+	data, err := os.ReadFile(f.Path + invocationSuffix)
+	if err != nil {
+		return inv, err
+	}
+	err = json.Unmarshal(data, &inv)
+	return inv, err
+}
+
+// FakeCLIMain runs the fake CLI binary built by BuildFakeCLI and returns its
+// exit code. It loads the scenario stored next to the executable.
+func FakeCLIMain() int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "claudetest:", err)
+		return 1
+	}
+	raw, err := os.ReadFile(exe + scenarioSuffix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "claudetest: failed to read scenario:", err)
+		return 1
+	}
+	var data scenarioData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		fmt.Fprintln(os.Stderr, "claudetest: failed to parse scenario:", err)
+		return 1
+	}
+
+	args := os.Args[1:]
+	if len(args) == 1 && (args[0] == "-v" || args[0] == "--version") {
+		version := data.CLIVersion
+		if version == "" {
+			version = claude.MinimumCLIVersion
+		}
+		fmt.Printf("%s (Claude Code)\n", version)
+		return 0
+	}
+
+	dir, _ := os.Getwd()
+	inv := invocation{Args: args, Dir: dir}
+	writeInvocation(exe, inv)
+
+	if err := runFakeCLI(data, args, os.Stdin, os.Stdout); err != nil {
+		inv.Error = err.Error()
+		writeInvocation(exe, inv)
+		fmt.Fprintln(os.Stderr, "claudetest:", err)
+		return 1
+	}
+	return 0
+}
+
+func writeInvocation(exe string, inv invocation) {
+	data, _ := json.Marshal(inv)
+	os.WriteFile(exe+invocationSuffix, data, 0600)
+}
+
+// runFakeCLI checks the command line and plays the scenario over stdin and
+// stdout.
+func runFakeCLI(data scenarioData, args []string, stdin io.Reader, stdout io.Writer) error {
+	for _, flag := range data.Flags {
+		if err := checkFlag(args, flag); err != nil {
+			return err
+		}
+	}
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(stdout)
+	s := newSession(data, func(frame map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return encoder.Encode(frame)
+	})
+
+	go func() {
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var frame map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &frame); err == nil {
+				s.receive(frame)
+			}
+		}
+		s.closeInput()
+	}()
+
+	return s.run(context.Background())
+}
+
+// checkFlag verifies that args contain an expected flag. Repeated flags
+// (e.g. --add-dir) match if any occurrence has the expected value.
+func checkFlag(args []string, flag flagExpectation) error {
+	var values []string
+	for i, arg := range args {
+		if arg != flag.Flag {
+			continue
+		}
+		if !flag.HasValue {
+			return nil
+		}
+		if i+1 < len(args) {
+			if args[i+1] == flag.Value {
+				return nil
+			}
+			values = append(values, args[i+1])
+		}
+	}
+	if len(values) > 0 {
+		return fmt.Errorf("expected %s %q, got %q", flag.Flag, flag.Value, values)
+	}
+	return fmt.Errorf("expected flag %s in arguments %q", flag.Flag, args)
+}
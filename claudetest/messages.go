@@ -0,0 +1,71 @@
+package claudetest
+
+// SystemInit returns the system init message the CLI sends at the start of
+// a session.
+func SystemInit(sessionID string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "system",
+		"subtype":    "init",
+		"session_id": sessionID,
+		"tools":      []interface{}{},
+		"model":      "claude-sonnet-4-5",
+	}
+}
+
+// AssistantText returns an assistant message with a single text block.
+func AssistantText(text string) map[string]interface{} {
+	return assistant(map[string]interface{}{"type": "text", "text": text})
+}
+
+// ToolUse returns an assistant message that calls a tool.
+func ToolUse(id, name string, input map[string]interface{}) map[string]interface{} {
+	return assistant(map[string]interface{}{
+		"type":  "tool_use",
+		"id":    id,
+		"name":  name,
+		"input": input,
+	})
+}
+
+// ToolResult returns the user message carrying a tool's output.
+func ToolResult(toolUseID, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "user",
+		"message": map[string]interface{}{
+			"role": "user",
+			"content": []interface{}{
+				map[string]interface{}{
+					"type":        "tool_result",
+					"tool_use_id": toolUseID,
+					"content":     content,
+				},
+			},
+		},
+	}
+}
+
+// Result returns a successful result message ending a turn.
+func Result(sessionID string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":            "result",
+		"subtype":         "success",
+		"duration_ms":     100,
+		"duration_api_ms": 80,
+		"is_error":        false,
+		"num_turns":       1,
+		"session_id":      sessionID,
+		"total_cost_usd":  0.001,
+	}
+}
+
+// assistant wraps a content block in an assistant message.
+func assistant(block map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "assistant",
+		"message": map[string]interface{}{
+			"role":    "assistant",
+			"model":   "claude-sonnet-4-5",
+			"content": []interface{}{block},
+		},
+	}
+}
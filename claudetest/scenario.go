@@ -0,0 +1,206 @@
+// Package claudetest provides a scriptable fake Claude Code CLI for testing
+// code built on the SDK.
+//
+// A Scenario describes what the fake CLI does and what it expects from the
+// SDK: emit messages, wait for user messages, and issue control requests
+// (can_use_tool, hook_callback, mcp_message) whose responses are checked.
+// Scenarios run either in-process through NewTransport, or as a standalone
+// fake claude binary through BuildFakeCLI for end-to-end tests of
+// SubprocessCLITransport, including argument building.
+//
+// Example:
+//
+//	scenario := claudetest.NewScenario().
+//	    Emit(claudetest.SystemInit("session-1")).
+//	    ExpectUserMessage("List the files").
+//	    RequestPermission("Bash", map[string]interface{}{"command": "ls"}, claudetest.ExpectAllow()).
+//	    Emit(claudetest.ToolResult("tool-1", "main.go")).
+//	    Emit(claudetest.Result("session-1"))
+//
+//	transport := claudetest.NewTransport(t, scenario)
+//	msgCh, errCh, err := claude.Query(ctx, "List the files", options, transport)
+package claudetest
+
+import (
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+const defaultStepTimeout = 10 * time.Second
+
+// stepKind identifies a scenario step.
+type stepKind string
+
+const (
+	stepEmit                 stepKind = "emit"
+	stepExpectUserMessage    stepKind = "expect_user_message"
+	stepExpectControlRequest stepKind = "expect_control_request"
+	stepControlRequest       stepKind = "control_request"
+	stepCancelControlRequest stepKind = "cancel_control_request"
+	stepCallHook             stepKind = "call_hook"
+	stepWaitEndInput         stepKind = "wait_end_input"
+)
+
+// step is one scenario step. Steps are plain data so scenarios can be
+// handed to the fake CLI binary as JSON.
+type step struct {
+	Kind    stepKind               `json:"kind"`
+	Message map[string]interface{} `json:"message,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Subtype string                 `json:"subtype,omitempty"`
+	Request map[string]interface{} `json:"request,omitempty"`
+	Event   string                 `json:"event,omitempty"`
+	Input   map[string]interface{} `json:"input,omitempty"`
+	Expect  *Expectation           `json:"expect,omitempty"`
+	Delay   time.Duration          `json:"delay,omitempty"`
+}
+
+// flagExpectation is a command line flag the fake CLI binary must receive.
+type flagExpectation struct {
+	Flag     string `json:"flag"`
+	Value    string `json:"value,omitempty"`
+	HasValue bool   `json:"has_value,omitempty"`
+}
+
+// scenarioData is the serialized form of a Scenario.
+type scenarioData struct {
+	Steps              []step                 `json:"steps"`
+	Flags              []flagExpectation      `json:"flags,omitempty"`
+	CLIVersion         string                 `json:"cli_version,omitempty"`
+	InitializeResponse map[string]interface{} `json:"initialize_response,omitempty"`
+	Timeout            time.Duration          `json:"timeout,omitempty"`
+}
+
+// Scenario is a script for the fake CLI. Steps run in order; each method
+// appends a step and returns the scenario for chaining.
+//
+// Control requests sent by the SDK (initialize, interrupt, set_model, ...)
+// are answered automatically with success at any point in the scenario.
+type Scenario struct {
+	data scenarioData
+}
+
+// NewScenario creates an empty scenario.
+func NewScenario() *Scenario {
+	return &Scenario{}
+}
+
+// Emit sends a message to the SDK as if the CLI printed it on stdout.
+// See SystemInit, AssistantText, ToolUse, ToolResult and Result.
+func (s *Scenario) Emit(message map[string]interface{}) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepEmit, Message: message})
+	return s
+}
+
+// ExpectUserMessage waits for the SDK to send a user message. If text is
+// not empty, the message content must equal it.
+func (s *Scenario) ExpectUserMessage(text string) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepExpectUserMessage, Text: text})
+	return s
+}
+
+// ExpectControlRequest waits for the SDK to send a control request with the
+// given subtype (e.g. "interrupt" or "set_model"). Requests received
+// earlier in the scenario count.
+func (s *Scenario) ExpectControlRequest(subtype string) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepExpectControlRequest, Subtype: subtype})
+	return s
+}
+
+// RequestPermission asks the SDK whether tool may run with input
+// (can_use_tool) and checks the response.
+func (s *Scenario) RequestPermission(tool string, input map[string]interface{}, expect Expectation) *Scenario {
+	return s.SendControlRequest(map[string]interface{}{
+		"subtype":                "can_use_tool",
+		"tool_name":              tool,
+		"input":                  input,
+		"permission_suggestions": []interface{}{},
+	}, expect)
+}
+
+// CancelPermissionRequest asks the SDK whether tool may run with input, then
+// after delay cancels the request with a control_cancel_request, as the CLI
+// does when the turn it belongs to is interrupted. Any response is ignored.
+func (s *Scenario) CancelPermissionRequest(tool string, input map[string]interface{}, delay time.Duration) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepCancelControlRequest, Request: map[string]interface{}{
+		"subtype":                "can_use_tool",
+		"tool_name":              tool,
+		"input":                  input,
+		"permission_suggestions": []interface{}{},
+	}, Delay: delay})
+	return s
+}
+
+// CallHook invokes every hook callback the SDK registered for event whose
+// matcher matches input["tool_name"], and checks each response. The step
+// fails if the SDK registered no matching callback.
+func (s *Scenario) CallHook(event claude.HookEvent, input map[string]interface{}, expect Expectation) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepCallHook, Event: string(event), Input: input, Expect: &expect})
+	return s
+}
+
+// CallMcpTool calls tool on the SDK MCP server named server (mcp_message
+// with a JSON-RPC tools/call request) and checks the response.
+func (s *Scenario) CallMcpTool(server, tool string, args map[string]interface{}, expect Expectation) *Scenario {
+	return s.SendControlRequest(map[string]interface{}{
+		"subtype":     "mcp_message",
+		"server_name": server,
+		"message": map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      len(s.data.Steps) + 1,
+			"method":  "tools/call",
+			"params": map[string]interface{}{
+				"name":      tool,
+				"arguments": args,
+			},
+		},
+	}, expect)
+}
+
+// SendControlRequest sends an arbitrary control request to the SDK and
+// checks the response.
+func (s *Scenario) SendControlRequest(request map[string]interface{}, expect Expectation) *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepControlRequest, Request: request, Expect: &expect})
+	return s
+}
+
+// WaitForEndInput waits until the SDK closes its input (EndInput or Close).
+func (s *Scenario) WaitForEndInput() *Scenario {
+	s.data.Steps = append(s.data.Steps, step{Kind: stepWaitEndInput})
+	return s
+}
+
+// ExpectFlag requires the fake CLI binary to be started with flag. It is
+// checked by BuildFakeCLI binaries only; NewTransport has no command line.
+func (s *Scenario) ExpectFlag(flag string) *Scenario {
+	s.data.Flags = append(s.data.Flags, flagExpectation{Flag: flag})
+	return s
+}
+
+// ExpectFlagValue requires the fake CLI binary to be started with flag
+// followed by value. It is checked by BuildFakeCLI binaries only.
+func (s *Scenario) ExpectFlagValue(flag, value string) *Scenario {
+	s.data.Flags = append(s.data.Flags, flagExpectation{Flag: flag, Value: value, HasValue: true})
+	return s
+}
+
+// CLIVersion sets the version the fake CLI binary reports for "-v"
+// (default: the SDK's MinimumCLIVersion).
+func (s *Scenario) CLIVersion(version string) *Scenario {
+	s.data.CLIVersion = version
+	return s
+}
+
+// InitializeResponse sets the response to the SDK's initialize request
+// (default: an empty object).
+func (s *Scenario) InitializeResponse(response map[string]interface{}) *Scenario {
+	s.data.InitializeResponse = response
+	return s
+}
+
+// Timeout sets how long a step waits for the SDK (default: 10s).
+func (s *Scenario) Timeout(timeout time.Duration) *Scenario {
+	s.data.Timeout = timeout
+	return s
+}
@@ -0,0 +1,341 @@
+package claudetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hookRegistration is a hook matcher the SDK registered in its initialize
+// request.
+type hookRegistration struct {
+	matcher     string
+	callbackIDs []string
+}
+
+// session runs a scenario against frames written by the SDK. It is shared by
+// the in-process Transport and the fake CLI binary.
+type session struct {
+	data scenarioData
+	send func(frame map[string]interface{}) error
+
+	mu          sync.Mutex
+	pending     []map[string]interface{} // Frames from the SDK not yet consumed by a step
+	signal      chan struct{}
+	eof         bool
+	initialized bool
+	hooks       map[string][]hookRegistration
+	nextID      int
+}
+
+// newSession creates a session that emits frames through send.
+func newSession(data scenarioData, send func(frame map[string]interface{}) error) *session {
+	if data.Timeout <= 0 {
+		data.Timeout = defaultStepTimeout
+	}
+	return &session{
+		data:   data,
+		send:   send,
+		signal: make(chan struct{}, 1),
+		hooks:  make(map[string][]hookRegistration),
+	}
+}
+
+// receive handles a frame written by the SDK. Control requests from the SDK
+// are answered immediately so the SDK never blocks on the scenario.
+func (s *session) receive(frame map[string]interface{}) {
+	if frame["type"] == "control_request" {
+		s.answer(frame)
+	}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, frame)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// closeInput records that the SDK closed its input.
+func (s *session) closeInput() {
+	s.mu.Lock()
+	s.eof = true
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *session) notify() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// answer responds to a control request sent by the SDK.
+func (s *session) answer(frame map[string]interface{}) {
+	requestID, _ := frame["request_id"].(string)
+	request, _ := frame["request"].(map[string]interface{})
+
+	response := map[string]interface{}{}
+	if request["subtype"] == "initialize" {
+		s.registerHooks(request["hooks"])
+		if s.data.InitializeResponse != nil {
+			response = s.data.InitializeResponse
+		}
+	}
+
+	s.send(map[string]interface{}{
+		"type": "control_response",
+		"response": map[string]interface{}{
+			"subtype":    "success",
+			"request_id": requestID,
+			"response":   response,
+		},
+	})
+}
+
+// registerHooks stores the hook callback IDs from an initialize request.
+func (s *session) registerHooks(config interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.initialized = true
+	events, _ := config.(map[string]interface{})
+	for event, matchers := range events {
+		list, _ := matchers.([]interface{})
+		for _, m := range list {
+			matcher, _ := m.(map[string]interface{})
+			pattern, _ := matcher["matcher"].(string)
+			ids, _ := matcher["hookCallbackIds"].([]interface{})
+			reg := hookRegistration{matcher: pattern}
+			for _, id := range ids {
+				if idStr, ok := id.(string); ok {
+					reg.callbackIDs = append(reg.callbackIDs, idStr)
+				}
+			}
+			s.hooks[event] = append(s.hooks[event], reg)
+		}
+	}
+}
+
+// run executes the scenario steps in order.
+func (s *session) run(ctx context.Context) error {
+	for i, st := range s.data.Steps {
+		if err := s.runStep(ctx, st); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, st.Kind, err)
+		}
+	}
+	return nil
+}
+
+func (s *session) runStep(ctx context.Context, st step) error {
+	switch st.Kind {
+	case stepEmit:
+		return s.send(st.Message)
+	case stepExpectUserMessage:
+		return s.expectUserMessage(ctx, st.Text)
+	case stepExpectControlRequest:
+		_, err := s.take(ctx, fmt.Sprintf("%s control request", st.Subtype), func(frame map[string]interface{}) bool {
+			request, _ := frame["request"].(map[string]interface{})
+			return frame["type"] == "control_request" && request["subtype"] == st.Subtype
+		})
+		return err
+	case stepControlRequest:
+		return s.controlRequest(ctx, st.Request, *st.Expect)
+	case stepCancelControlRequest:
+		return s.cancelControlRequest(ctx, st.Request, st.Delay)
+	case stepCallHook:
+		return s.callHook(ctx, st.Event, st.Input, *st.Expect)
+	case stepWaitEndInput:
+		return s.wait(ctx, "end of input", func() bool { return s.eof })
+	default:
+		return fmt.Errorf("unknown step kind %q", st.Kind)
+	}
+}
+
+// expectUserMessage consumes the next data frame and checks that it is a
+// user message with the expected text.
+func (s *session) expectUserMessage(ctx context.Context, text string) error {
+	frame, err := s.take(ctx, "user message", func(frame map[string]interface{}) bool {
+		return frame["type"] != "control_request" && frame["type"] != "control_response"
+	})
+	if err != nil {
+		return err
+	}
+	if frame["type"] != "user" {
+		return fmt.Errorf("expected user message, got %s", encode(frame))
+	}
+	if text != "" {
+		if got := messageText(frame); got != text {
+			return fmt.Errorf("expected user message %q, got %q", text, got)
+		}
+	}
+	return nil
+}
+
+// sendControlRequest sends a control request to the SDK and returns its ID.
+func (s *session) sendControlRequest(request map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	s.nextID++
+	requestID := fmt.Sprintf("claudetest_%d", s.nextID)
+	s.mu.Unlock()
+
+	return requestID, s.send(map[string]interface{}{
+		"type":       "control_request",
+		"request_id": requestID,
+		"request":    request,
+	})
+}
+
+// cancelControlRequest sends a control request and cancels it after delay.
+func (s *session) cancelControlRequest(ctx context.Context, request map[string]interface{}, delay time.Duration) error {
+	requestID, err := s.sendControlRequest(request)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.send(map[string]interface{}{
+		"type":       "control_cancel_request",
+		"request_id": requestID,
+	})
+}
+
+// controlRequest sends a control request to the SDK and checks its response.
+func (s *session) controlRequest(ctx context.Context, request map[string]interface{}, expect Expectation) error {
+	requestID, err := s.sendControlRequest(request)
+	if err != nil {
+		return err
+	}
+
+	frame, err := s.take(ctx, fmt.Sprintf("response to %s", request["subtype"]), func(frame map[string]interface{}) bool {
+		response, _ := frame["response"].(map[string]interface{})
+		return frame["type"] == "control_response" && response["request_id"] == requestID
+	})
+	if err != nil {
+		return err
+	}
+	response, _ := frame["response"].(map[string]interface{})
+	return expect.check(response)
+}
+
+// callHook invokes the SDK's hook callbacks registered for event.
+func (s *session) callHook(ctx context.Context, event string, input map[string]interface{}, expect Expectation) error {
+	if err := s.wait(ctx, "initialize request", func() bool { return s.initialized }); err != nil {
+		return err
+	}
+
+	hookInput := map[string]interface{}{"hook_event_name": event}
+	for k, v := range input {
+		hookInput[k] = v
+	}
+	toolName, _ := hookInput["tool_name"].(string)
+
+	s.mu.Lock()
+	var callbackIDs []string
+	for _, reg := range s.hooks[event] {
+		if matchesTool(reg.matcher, toolName) {
+			callbackIDs = append(callbackIDs, reg.callbackIDs...)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(callbackIDs) == 0 {
+		return fmt.Errorf("SDK registered no %s hook matching %q", event, toolName)
+	}
+	for _, id := range callbackIDs {
+		request := map[string]interface{}{
+			"subtype":     "hook_callback",
+			"callback_id": id,
+			"input":       hookInput,
+		}
+		if toolUseID, ok := hookInput["tool_use_id"]; ok {
+			request["tool_use_id"] = toolUseID
+		}
+		if err := s.controlRequest(ctx, request, expect); err != nil {
+			return fmt.Errorf("hook %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// take waits for the first pending frame accepted by match and removes it.
+func (s *session) take(ctx context.Context, what string, match func(map[string]interface{}) bool) (map[string]interface{}, error) {
+	var found map[string]interface{}
+	err := s.wait(ctx, what, func() bool {
+		for i, frame := range s.pending {
+			if match(frame) {
+				found = frame
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+	return found, err
+}
+
+// wait blocks until cond, called with the lock held, returns true.
+func (s *session) wait(ctx context.Context, what string, cond func() bool) error {
+	timer := time.NewTimer(s.data.Timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		ok := cond()
+		eof := s.eof
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+		if eof {
+			return fmt.Errorf("input closed while waiting for %s", what)
+		}
+
+		select {
+		case <-s.signal:
+		case <-timer.C:
+			return fmt.Errorf("timed out after %v waiting for %s", s.data.Timeout, what)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// matchesTool reports whether a hook matcher applies to toolName. An empty
+// or "*" matcher matches everything; otherwise it is a "|" separated list
+// of tool names.
+func matchesTool(matcher, toolName string) bool {
+	if matcher == "" || matcher == "*" || toolName == "" {
+		return true
+	}
+	for _, name := range strings.Split(matcher, "|") {
+		if name == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// messageText returns the text of a user message whose content is either a
+// string or a list of text blocks.
+func messageText(frame map[string]interface{}) string {
+	message, _ := frame["message"].(map[string]interface{})
+	switch content := message["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		var parts []string
+		for _, block := range content {
+			if b, ok := block.(map[string]interface{}); ok && b["type"] == "text" {
+				text, _ := b["text"].(string)
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "")
+	}
+	return ""
+}
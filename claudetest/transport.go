@@ -0,0 +1,189 @@
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// Transport runs a Scenario in-process as a claude.Transport.
+//
+// A failing step is reported on the ReadMessages error channel, returned by
+// Err, and reported to the test when it finishes. Closing the transport
+// before the last step counts as a failure.
+type Transport struct {
+	session *session
+	msgCh   chan map[string]interface{}
+	done    chan struct{}
+
+	mu        sync.Mutex
+	ready     bool
+	started   bool
+	closed    bool // No more frames may be sent to msgCh
+	senders   sync.WaitGroup
+	err       error
+	closeOnce sync.Once
+}
+
+var _ claude.Transport = (*Transport)(nil)
+
+// NewTransport creates a transport that plays scenario. Failures are
+// reported to tb when the test finishes.
+func NewTransport(tb testing.TB, scenario *Scenario) *Transport {
+	t := &Transport{
+		msgCh: make(chan map[string]interface{}),
+		done:  make(chan struct{}),
+	}
+	t.session = newSession(scenario.data, t.emit)
+
+	tb.Cleanup(func() {
+		t.Close()
+		if err := t.Err(); err != nil {
+			tb.Errorf("claudetest: %v", err)
+		}
+	})
+	return t
+}
+
+// emit sends a frame to the SDK. Frames are round-tripped through JSON so
+// the SDK sees the same types (e.g. float64 numbers) as from the real CLI.
+func (t *Transport) emit(frame map[string]interface{}) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	frame = nil
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return fmt.Errorf("failed to decode frame: %w", err)
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return fmt.Errorf("transport closed")
+	}
+	t.senders.Add(1)
+	t.mu.Unlock()
+	defer t.senders.Done()
+
+	select {
+	case t.msgCh <- frame:
+		return nil
+	case <-t.done:
+		return fmt.Errorf("transport closed")
+	}
+}
+
+// Err returns the first scenario failure, if any.
+func (t *Transport) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Connect marks the transport ready.
+func (t *Transport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ready = true
+	return nil
+}
+
+// Write delivers frames written by the SDK to the scenario.
+func (t *Transport) Write(ctx context.Context, data string) error {
+	if !t.IsReady() {
+		return claude.NewCLIConnectionError("transport is not ready for writing", nil)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var frame map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			return fmt.Errorf("claudetest: SDK wrote invalid JSON: %w", err)
+		}
+		t.session.receive(frame)
+	}
+	return nil
+}
+
+// ReadMessages runs the scenario and returns the frames it emits. The
+// message channel closes when the scenario completes.
+func (t *Transport) ReadMessages(ctx context.Context) (<-chan map[string]interface{}, <-chan error) {
+	errCh := make(chan error, 1)
+
+	t.mu.Lock()
+	started := t.started
+	t.started = true
+	t.mu.Unlock()
+	if started {
+		errCh <- fmt.Errorf("claudetest: ReadMessages called more than once")
+		close(errCh)
+		ch := make(chan map[string]interface{})
+		close(ch)
+		return ch, errCh
+	}
+
+	go func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-t.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		err := t.session.run(ctx)
+
+		// Stop auto-responses before closing the message channel. Any error,
+		// including Close before the last step, means the scenario did not
+		// complete.
+		t.mu.Lock()
+		t.closed = true
+		if err != nil && t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+		t.senders.Wait()
+
+		if err != nil {
+			errCh <- err
+		}
+		close(errCh)
+		close(t.msgCh)
+	}()
+
+	return t.msgCh, errCh
+}
+
+// EndInput signals the end of the SDK's input to the scenario.
+func (t *Transport) EndInput() error {
+	t.session.closeInput()
+	return nil
+}
+
+// IsReady reports whether the transport is connected and not closed.
+func (t *Transport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready
+}
+
+// Close stops the scenario.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	t.ready = false
+	t.mu.Unlock()
+
+	t.session.closeInput()
+	t.closeOnce.Do(func() { close(t.done) })
+	return nil
+}
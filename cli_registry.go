@@ -0,0 +1,246 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Oldest CLI versions the SDK has used features with. Each is the CLI the SDK
+// first bundled alongside the feature (see CHANGELOG.md), so it is an upper
+// bound: the feature may work with somewhat older CLIs. Features every CLI
+// from MinimumCLIVersion supports, such as structured output, are not listed.
+const (
+	// SDK 0.1.15 added EnableFileCheckpointing, bundling CLI 2.0.62
+	fileCheckpointingCLIVersion = "2.0.62"
+	// SDK 0.1.31 added extendedHookEvents, moving from CLI 2.0.76 to 2.1.33
+	extendedHookEventsCLIVersion = "2.1.33"
+)
+
+var cliVersionPattern = regexp.MustCompile(`([0-9]+\.[0-9]+\.[0-9]+)`)
+
+// baseHookEvents are supported by every CLI version the SDK accepts.
+var baseHookEvents = []HookEvent{
+	HookEventPreToolUse,
+	HookEventPostToolUse,
+	HookEventUserPromptSubmit,
+	HookEventStop,
+	HookEventSubagentStop,
+	HookEventPreCompact,
+}
+
+// extendedHookEvents require extendedHookEventsCLIVersion.
+var extendedHookEvents = []HookEvent{
+	HookEventPostToolUseFailure,
+	HookEventSubagentStart,
+	HookEventNotification,
+	HookEventPermissionRequest,
+}
+
+// Capabilities reports which SDK features a CLI version supports.
+type Capabilities struct {
+	FileCheckpointing bool        // EnableFileCheckpointing and RewindFiles
+	HookEvents        []HookEvent // Hook events the CLI fires
+}
+
+// SupportsHookEvent reports whether the CLI fires event.
+func (c Capabilities) SupportsHookEvent(event HookEvent) bool {
+	for _, e := range c.HookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilitiesForVersion returns the capabilities of a CLI version. An empty
+// version is unknown and assumed to support everything.
+func CapabilitiesForVersion(version string) Capabilities {
+	atLeast := func(minimum string) bool {
+		return version == "" || compareVersions(version, minimum) >= 0
+	}
+
+	caps := Capabilities{
+		FileCheckpointing: atLeast(fileCheckpointingCLIVersion),
+		HookEvents:        append([]HookEvent(nil), baseHookEvents...),
+	}
+	if atLeast(extendedHookEventsCLIVersion) {
+		caps.HookEvents = append(caps.HookEvents, extendedHookEvents...)
+	}
+	return caps
+}
+
+// CLIInfo describes a resolved Claude Code CLI binary.
+type CLIInfo struct {
+	Path         string
+	Version      string    // Empty if "claude -v" failed or printed no version
+	ModTime      time.Time // Modification time of the binary when it was probed
+	Capabilities Capabilities
+}
+
+// cliCacheEntry is a version probe result, valid while the binary's
+// modification time and size are unchanged.
+type cliCacheEntry struct {
+	modTime time.Time
+	size    int64
+	info    *CLIInfo
+	warned  map[string]bool // Warnings already printed for this binary
+}
+
+// cliRegistry caches CLI discovery and version probes for the process.
+type cliRegistry struct {
+	mu         sync.Mutex
+	discovered map[string]string // PATH value -> discovered CLI path
+	probes     map[string]*cliCacheEntry
+}
+
+var defaultCLIRegistry = newCLIRegistry()
+
+func newCLIRegistry() *cliRegistry {
+	return &cliRegistry{
+		discovered: make(map[string]string),
+		probes:     make(map[string]*cliCacheEntry),
+	}
+}
+
+// find returns the discovered CLI path, searching again when PATH changed
+// or the cached binary disappeared.
+func (r *cliRegistry) find() (string, error) {
+	key := os.Getenv("PATH")
+
+	r.mu.Lock()
+	path, ok := r.discovered[key]
+	r.mu.Unlock()
+	if ok {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	path, err := findCLI()
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.discovered[key] = path
+	r.mu.Unlock()
+	return path, nil
+}
+
+// info returns the version and capabilities of the binary at path, running
+// probe only when the binary is new or changed on disk. Results are not
+// cached when cacheable is false (e.g. when a launcher decides what runs).
+func (r *cliRegistry) info(ctx context.Context, path string, cacheable bool, probe func(context.Context) string) (*CLIInfo, *cliCacheEntry) {
+	stat, statErr := os.Stat(path)
+	cacheable = cacheable && statErr == nil
+
+	if cacheable {
+		r.mu.Lock()
+		entry, ok := r.probes[path]
+		r.mu.Unlock()
+		if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+			return entry.info, entry
+		}
+	}
+
+	version := probe(ctx)
+	info := &CLIInfo{
+		Path:         path,
+		Version:      version,
+		Capabilities: CapabilitiesForVersion(version),
+	}
+	entry := &cliCacheEntry{info: info, warned: make(map[string]bool)}
+	if statErr == nil {
+		info.ModTime = stat.ModTime()
+		entry.modTime = stat.ModTime()
+		entry.size = stat.Size()
+	}
+
+	if cacheable {
+		r.mu.Lock()
+		r.probes[path] = entry
+		r.mu.Unlock()
+	}
+	return info, entry
+}
+
+// warnOnce reports whether message has not yet been printed for entry.
+func (r *cliRegistry) warnOnce(entry *cliCacheEntry, message string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry.warned[message] {
+		return false
+	}
+	entry.warned[message] = true
+	return true
+}
+
+// ResolveCLI returns the CLI options would run, with its version and
+// capabilities. Discovery and version probes are cached for the process by
+// binary path, modification time and size, so repeated calls are cheap.
+func ResolveCLI(ctx context.Context, options *ClaudeAgentOptions) (*CLIInfo, error) {
+	t, err := NewSubprocessCLITransport("", options, "")
+	if err != nil {
+		return nil, err
+	}
+	info, _ := defaultCLIRegistry.info(ctx, t.cliPath, t.options.CommandLauncher == nil, t.probeVersion)
+	return info, nil
+}
+
+// ResetCLICache forgets cached CLI discovery and version probes, e.g. after
+// installing a different CLI at the same path with a preserved mtime.
+func ResetCLICache() {
+	defaultCLIRegistry.mu.Lock()
+	defer defaultCLIRegistry.mu.Unlock()
+	defaultCLIRegistry.discovered = make(map[string]string)
+	defaultCLIRegistry.probes = make(map[string]*cliCacheEntry)
+}
+
+// probeVersion runs "claude -v", through the launcher if one is configured,
+// and returns the version it prints, or "" if that fails. It gets the same
+// environment as the CLI itself, so EnvPolicy applies to it too.
+func (t *SubprocessCLITransport) probeVersion(ctx context.Context) string {
+	checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	spec := LaunchSpec{Path: t.cliPath, Args: []string{"-v"}, Dir: t.cwd, Env: t.buildEnv()}
+	if t.options.CommandLauncher != nil {
+		var err error
+		spec, err = t.options.CommandLauncher(checkCtx, spec)
+		if err != nil {
+			return ""
+		}
+	}
+	cmd := exec.CommandContext(checkCtx, spec.Path, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = spec.Env
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	match := cliVersionPattern.FindStringSubmatch(strings.TrimSpace(string(output)))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// missingCapabilities lists features options use that caps lacks.
+func missingCapabilities(caps Capabilities, options *ClaudeAgentOptions) []string {
+	var missing []string
+	if options.EnableFileCheckpointing && !caps.FileCheckpointing {
+		missing = append(missing, "file checkpointing")
+	}
+	for _, event := range sortedKeys(options.Hooks) {
+		if len(options.Hooks[event]) > 0 && !caps.SupportsHookEvent(event) {
+			missing = append(missing, fmt.Sprintf("%s hooks", event))
+		}
+	}
+	return missing
+}
@@ -1,9 +1,38 @@
 package claude
 
+import "io/fs"
+
 // BundledCLIVersion is the version of the Claude Code CLI bundled with this SDK.
 // The SDK will use this bundled version if no other CLI installation is found.
 const BundledCLIVersion = "2.1.33"
 
+// BundledCLIInfo describes the CLI binary embedded in this build.
+type BundledCLIInfo struct {
+	Name    string // Binary name, e.g. "claude-linux-amd64"
+	Version string // Version recorded by scripts/download_cli.go
+	SHA256  string // Checksum the extracted binary is verified against
+}
+
+// BundledCLI returns the CLI binary embedded for the current platform, or
+// nil if this build has none. Version normally equals BundledCLIVersion; a
+// mismatch means the binaries were downloaded for a different release.
+func BundledCLI() *BundledCLIInfo {
+	name := bundledBinaryName()
+	if name == "" {
+		return nil
+	}
+	fsys, _ := fs.Sub(bundledCLI, "_bundled")
+	if _, err := fs.Stat(fsys, name); err != nil {
+		return nil
+	}
+	info := &BundledCLIInfo{Name: name}
+	if manifest, err := readBundledManifest(fsys); err == nil && manifest != nil {
+		info.Version = manifest.Version
+		info.SHA256 = manifest.Binaries[name]
+	}
+	return info
+}
+
 // RecommendedCLIVersion is the recommended version of the Claude Code CLI to use with this SDK.
 // This version has been tested and is known to work well with the current SDK features.
 //
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 )
 
 // ClaudeSDKClient provides bidirectional, interactive conversations with Claude Code.
@@ -102,8 +101,6 @@ func (c *ClaudeSDKClient) Connect(ctx context.Context) error {
 //
 // For most cases, use Connect() and then Query() instead.
 func (c *ClaudeSDKClient) ConnectWithPrompt(ctx context.Context, prompt interface{}) error {
-	os.Setenv("CLAUDE_CODE_ENTRYPOINT", "sdk-go-client")
-
 	// Create cancellable context
 	c.ctx, c.cancel = context.WithCancel(ctx)
 
@@ -127,39 +124,25 @@ func (c *ClaudeSDKClient) ConnectWithPrompt(ctx context.Context, prompt interfac
 	if c.customTransport != nil {
 		c.transport = c.customTransport
 	} else {
+		// Identify the client on the child's environment only
+		clientOptions := *options
+		clientOptions.entrypoint = "sdk-go-client"
+
 		var err error
-		c.transport, err = NewSubprocessCLITransport(actualPrompt, options, "")
+		c.transport, err = NewSubprocessCLITransport(actualPrompt, &clientOptions, "")
 		if err != nil {
 			return err
 		}
 	}
 
+	c.transport = applyTransportMiddleware(c.transport, options.TransportMiddleware)
+
 	if err := c.transport.Connect(c.ctx); err != nil {
 		return err
 	}
 
-	// Extract SDK MCP servers using helper function
-	sdkMcpServers := extractSdkMcpServers(c.options.McpServers)
-
-	// Convert agents to dict format for initialize request
-	agents := convertAgentsToDicts(c.options.Agents)
-
-	// Determine buffer size
-	bufferSize := 100 // default
-	if options.MessageChannelBufferSize != nil && *options.MessageChannelBufferSize > 0 {
-		bufferSize = *options.MessageChannelBufferSize
-	}
-
 	// Create queryHandler - ClaudeSDKClient always uses streaming mode
-	c.queryHandler = newQueryHandler(
-		c.transport,
-		true, // Always streaming mode
-		options.CanUseTool,
-		options.Hooks,
-		sdkMcpServers,
-		agents,
-		bufferSize,
-	)
+	c.queryHandler = newQueryHandler(c.transport, options, newRunTracer(options.Tracer))
 
 	// Start reading messages
 	if err := c.queryHandler.Start(c.ctx); err != nil {
@@ -201,7 +184,7 @@ func (c *ClaudeSDKClient) ReceiveMessages(ctx context.Context) <-chan Message {
 				return
 			case err := <-c.queryHandler.ReceiveErrors():
 				if err != nil {
-					// Errors are logged but we continue to receive messages
+					// The query handler has logged the transport error
 					return
 				}
 			case data, ok := <-c.queryHandler.ReceiveMessages():
@@ -209,8 +192,9 @@ func (c *ClaudeSDKClient) ReceiveMessages(ctx context.Context) <-chan Message {
 					return
 				}
 
-				msg, err := parseMessage(data)
+				msg, err := c.queryHandler.parse(data)
 				if err != nil {
+					// parse logged the error; the stream cannot continue past it
 					return
 				}
 
@@ -316,6 +300,12 @@ func (c *ClaudeSDKClient) QueryWithSession(ctx context.Context, prompt interface
 	if c.queryHandler == nil || c.transport == nil {
 		return NewCLIConnectionError("not connected. Call Connect() first", nil)
 	}
+	if err := c.options.Budget.Check(ctx); err != nil {
+		return err
+	}
+
+	// The turn span ends with its ResultMessage
+	ctx = c.queryHandler.tracer.begin(ctx, SpanTurn)
 
 	// Handle string prompts
 	if promptStr, ok := prompt.(string); ok {
@@ -329,18 +319,29 @@ func (c *ClaudeSDKClient) QueryWithSession(ctx context.Context, prompt interface
 			"session_id":         sessionID,
 		}
 		data, _ := json.Marshal(message)
-		return c.transport.Write(ctx, string(data)+"\n")
+		if err := c.transport.Write(ctx, string(data)+"\n"); err != nil {
+			c.queryHandler.tracer.end(err)
+			return err
+		}
+		return nil
 	}
 
 	// Handle channel prompts
 	if promptChan, ok := prompt.(<-chan map[string]interface{}); ok {
+		logger := c.queryHandler.log()
 		go func() {
 			for msg := range promptChan {
 				if msg["session_id"] == nil {
 					msg["session_id"] = sessionID
 				}
-				data, _ := json.Marshal(msg)
-				c.transport.Write(ctx, string(data)+"\n")
+				data, err := json.Marshal(msg)
+				if err != nil {
+					logger.Error("claude: failed to encode streamed message", "error", err)
+					continue
+				}
+				if err := c.transport.Write(ctx, string(data)+"\n"); err != nil {
+					logger.Error("claude: failed to send streamed message", "error", err)
+				}
 			}
 		}()
 		return nil
@@ -508,13 +509,17 @@ func (c *ClaudeSDKClient) Close() error {
 //
 // Prefer using Close() for consistency with Python SDK.
 func (c *ClaudeSDKClient) Disconnect() error {
-	if c.cancel != nil {
-		c.cancel()
+	// Close the transport before cancelling the context so the CLI gets a
+	// graceful shutdown instead of being killed by context cancellation
+	var err error
+	if c.queryHandler != nil {
+		err = c.queryHandler.Close()
+		c.queryHandler.tracer.end(nil)
 	}
 
-	if c.queryHandler != nil {
-		return c.queryHandler.Close()
+	if c.cancel != nil {
+		c.cancel()
 	}
 
-	return nil
+	return err
 }
@@ -0,0 +1,122 @@
+package claude
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvPolicy controls which variables from the SDK's own environment are
+// passed to the CLI subprocess.
+type EnvPolicy string
+
+const (
+	// EnvPolicyInherit passes the SDK's entire environment (default).
+	EnvPolicyInherit EnvPolicy = "inherit"
+
+	// EnvPolicyAllowlist passes only variables named in EnvAllowlist
+	// (DefaultEnvAllowlist if EnvAllowlist is nil).
+	EnvPolicyAllowlist EnvPolicy = "allowlist"
+
+	// EnvPolicyClean passes nothing from the SDK's environment. Only Env,
+	// SecretEnv and the SDK's own variables reach the CLI, so PATH and HOME
+	// usually need to be set explicitly.
+	EnvPolicyClean EnvPolicy = "clean"
+)
+
+// DefaultEnvAllowlist is the allowlist used by EnvPolicyAllowlist when
+// EnvAllowlist is nil. It covers what the CLI needs to locate its runtime and
+// configuration without exposing service credentials.
+var DefaultEnvAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"TERM",
+	"TMPDIR",
+	"TZ",
+	"LANG",
+	"LC_*",
+}
+
+// redactedSecret is shown instead of secret values.
+const redactedSecret = "[REDACTED]"
+
+// Secret is an environment variable value that must not appear in logs.
+// Its String, GoString and MarshalJSON methods return a redacted placeholder.
+type Secret string
+
+// String returns a redacted placeholder.
+func (Secret) String() string { return redactedSecret }
+
+// GoString returns a redacted placeholder.
+func (Secret) GoString() string { return redactedSecret }
+
+// MarshalJSON returns a redacted placeholder.
+func (Secret) MarshalJSON() ([]byte, error) { return []byte(`"` + redactedSecret + `"`), nil }
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string { return string(s) }
+
+// envAllowed reports whether name matches an allowlist entry. Entries ending
+// in "*" match by prefix.
+func envAllowed(name string, allowlist []string) bool {
+	for _, pattern := range allowlist {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// baseEnv returns the part of the SDK's environment allowed by the policy.
+func baseEnv(options *ClaudeAgentOptions) []string {
+	switch options.EnvPolicy {
+	case EnvPolicyClean:
+		return nil
+	case EnvPolicyAllowlist:
+		allowlist := options.EnvAllowlist
+		if allowlist == nil {
+			allowlist = DefaultEnvAllowlist
+		}
+		var env []string
+		for _, entry := range os.Environ() {
+			name, _, _ := strings.Cut(entry, "=")
+			if envAllowed(name, allowlist) {
+				env = append(env, entry)
+			}
+		}
+		return env
+	default:
+		return os.Environ()
+	}
+}
+
+// redactEnv returns a copy of env with the values of secret keys replaced.
+func redactEnv(env []string, secretKeys map[string]bool) []string {
+	redacted := make([]string, len(env))
+	for i, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if secretKeys[name] {
+			entry = name + "=" + redactedSecret
+		}
+		redacted[i] = entry
+	}
+	return redacted
+}
+
+// sortedKeys returns the keys of m in sorted order so generated
+// environments, arguments and IDs are deterministic.
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -1,6 +1,10 @@
 package claude
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // ClaudeSDKError is the base error type for all Claude SDK errors.
 type ClaudeSDKError struct {
@@ -36,6 +40,28 @@ func NewCLINotFoundError(message string, cliPath string) *CLINotFoundError {
 	}
 }
 
+// CLIVersionError is returned by Connect when StrictVersionCheck is set and
+// the CLI is older than MinimumCLIVersion, its version cannot be determined,
+// or it lacks a capability the options use.
+type CLIVersionError struct {
+	*ClaudeSDKError
+	CLIPath string
+	Version string   // Empty if the version could not be determined
+	Minimum string   // MinimumCLIVersion
+	Missing []string // Features the options use that the CLI lacks
+}
+
+// NewCLIVersionError creates a new CLIVersionError.
+func NewCLIVersionError(message string, cliPath, version string, missing []string) *CLIVersionError {
+	return &CLIVersionError{
+		ClaudeSDKError: &ClaudeSDKError{Message: message},
+		CLIPath:        cliPath,
+		Version:        version,
+		Minimum:        MinimumCLIVersion,
+		Missing:        missing,
+	}
+}
+
 // CLIConnectionError is returned when unable to connect to Claude Code.
 type CLIConnectionError struct {
 	*ClaudeSDKError
@@ -48,11 +74,23 @@ func NewCLIConnectionError(message string, err error) *CLIConnectionError {
 	}
 }
 
+// ProcessErrorKind classifies common CLI process failures.
+type ProcessErrorKind string
+
+const (
+	ProcessErrorKindUnknown         ProcessErrorKind = ""
+	ProcessErrorKindNotLoggedIn     ProcessErrorKind = "not_logged_in"
+	ProcessErrorKindUnsupportedFlag ProcessErrorKind = "unsupported_flag"
+	ProcessErrorKindNodeCrash       ProcessErrorKind = "node_crash"
+)
+
 // ProcessError is returned when the CLI process fails.
 type ProcessError struct {
 	*ClaudeSDKError
 	ExitCode int
-	Stderr   string
+	Stderr   string           // Last lines of stderr captured from the process
+	Signal   string           // Name of the terminating signal, if the process was killed by one
+	Kind     ProcessErrorKind // Classification of the failure based on stderr and signal
 }
 
 // NewProcessError creates a new ProcessError.
@@ -71,6 +109,111 @@ func NewProcessError(message string, exitCode int, stderr string) *ProcessError
 	}
 }
 
+// newProcessExitError creates a ProcessError for a CLI process that exited
+// unsuccessfully, classifying the failure from its stderr tail and signal.
+func newProcessExitError(exitCode int, signal string, stderr string) *ProcessError {
+	kind := classifyProcessFailure(stderr, signal)
+
+	message := "command failed"
+	if signal != "" {
+		message = fmt.Sprintf("command terminated by signal %s", signal)
+	}
+	switch kind {
+	case ProcessErrorKindNotLoggedIn:
+		message += ": Claude Code is not logged in (run 'claude login' or set ANTHROPIC_API_KEY)"
+	case ProcessErrorKindUnsupportedFlag:
+		message += ": the CLI rejected a flag (the installed Claude Code version may be too old)"
+	case ProcessErrorKindNodeCrash:
+		message += ": the CLI runtime crashed"
+	}
+
+	err := NewProcessError(message, exitCode, stderr)
+	err.Signal = signal
+	err.Kind = kind
+	return err
+}
+
+// classifyProcessFailure inspects stderr output and the terminating signal to
+// recognize common CLI failure modes.
+func classifyProcessFailure(stderr string, signal string) ProcessErrorKind {
+	lower := strings.ToLower(stderr)
+
+	for _, pattern := range []string{
+		"not logged in",
+		"please run /login",
+		"invalid api key",
+		"authentication_error",
+		"oauth token has expired",
+	} {
+		if strings.Contains(lower, pattern) {
+			return ProcessErrorKindNotLoggedIn
+		}
+	}
+
+	for _, pattern := range []string{
+		"unknown option",
+		"unrecognized option",
+		"unknown argument",
+	} {
+		if strings.Contains(lower, pattern) {
+			return ProcessErrorKindUnsupportedFlag
+		}
+	}
+
+	for _, pattern := range []string{
+		"fatal error:",
+		"javascript heap out of memory",
+		"segmentation fault",
+		"node:internal",
+		"uncaught exception",
+	} {
+		if strings.Contains(lower, pattern) {
+			return ProcessErrorKindNodeCrash
+		}
+	}
+
+	switch signal {
+	case "SIGSEGV", "SIGABRT", "SIGBUS", "SIGILL":
+		return ProcessErrorKindNodeCrash
+	}
+
+	return ProcessErrorKindUnknown
+}
+
+// ResourceLimitKind identifies which resource limit the CLI process exceeded.
+type ResourceLimitKind string
+
+const (
+	ResourceLimitAddressSpace ResourceLimitKind = "address_space"
+	ResourceLimitCPUTime      ResourceLimitKind = "cpu_time"
+	ResourceLimitOpenFiles    ResourceLimitKind = "open_files"
+	ResourceLimitProcesses    ResourceLimitKind = "processes"
+	ResourceLimitCgroupMemory ResourceLimitKind = "cgroup_memory"
+	ResourceLimitCgroupPids   ResourceLimitKind = "cgroup_pids"
+)
+
+// ResourceLimitError is returned when the CLI process exits because it
+// exceeded a limit configured via ResourceLimits. It wraps the *ProcessError
+// describing the exit.
+type ResourceLimitError struct {
+	*ClaudeSDKError
+	Resource ResourceLimitKind
+	Limit    uint64 // Configured limit, or 0 if not known (e.g. a cgroup limit set externally)
+}
+
+// NewResourceLimitError creates a new ResourceLimitError.
+func NewResourceLimitError(resource ResourceLimitKind, limit uint64, cause error) *ResourceLimitError {
+	message := fmt.Sprintf("Claude Code exceeded resource limit %s", resource)
+	if limit > 0 {
+		message = fmt.Sprintf("%s (limit: %d)", message, limit)
+	}
+	return &ResourceLimitError{
+		ClaudeSDKError: &ClaudeSDKError{Message: message, Err: cause},
+		Resource:       resource,
+		Limit:          limit,
+	}
+}
+
 // CLIJSONDecodeError is returned when unable to decode JSON from CLI output.
 type CLIJSONDecodeError struct {
 	*ClaudeSDKError
@@ -107,3 +250,84 @@ func NewMessageParseError(message string, data map[string]interface{}) *MessageP
 		Data:           data,
 	}
 }
+
+// ReplayMismatchError is returned by ReplayTransport when the SDK's writes
+// diverge from the recording.
+type ReplayMismatchError struct {
+	*ClaudeSDKError
+	Index    int    // Index of the recorded frame that was expected
+	Expected string // Recorded frame (JSON), empty for unexpected writes
+	Actual   string // Frame written by the SDK (JSON), empty if none arrived
+}
+
+// NewReplayMismatchError creates a new ReplayMismatchError.
+func NewReplayMismatchError(message string, index int, expected, actual string) *ReplayMismatchError {
+	fullMessage := fmt.Sprintf("%s (frame %d)", message, index)
+	if expected != "" {
+		fullMessage = fmt.Sprintf("%s\nExpected: %s", fullMessage, expected)
+	}
+	if actual != "" {
+		fullMessage = fmt.Sprintf("%s\nActual: %s", fullMessage, actual)
+	}
+	return &ReplayMismatchError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fullMessage},
+		Index:          index,
+		Expected:       expected,
+		Actual:         actual,
+	}
+}
+
+// CallbackPanicError is returned to the CLI when a CanUseTool, hook or SDK
+// MCP tool handler panics. The panic is recovered so it does not crash the
+// process; the stack is logged.
+type CallbackPanicError struct {
+	*ClaudeSDKError
+	Callback string      // Which callback panicked, such as "can_use_tool Bash"
+	Value    interface{} // Value passed to panic
+	Stack    string      // Stack trace of the panicking goroutine
+}
+
+// NewCallbackPanicError creates a new CallbackPanicError.
+func NewCallbackPanicError(callback string, value interface{}, stack string) *CallbackPanicError {
+	return &CallbackPanicError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fmt.Sprintf("%s panicked: %v", callback, value)},
+		Callback:       callback,
+		Value:          value,
+		Stack:          stack,
+	}
+}
+
+// CallbackTimeoutError is returned to the CLI when a callback runs past its
+// deadline: HookMatcher.Timeout for hooks, CallbackLimits.Timeout otherwise.
+type CallbackTimeoutError struct {
+	*ClaudeSDKError
+	Callback string
+	Timeout  time.Duration
+}
+
+// NewCallbackTimeoutError creates a new CallbackTimeoutError.
+func NewCallbackTimeoutError(callback string, timeout time.Duration) *CallbackTimeoutError {
+	return &CallbackTimeoutError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fmt.Sprintf("%s did not finish within %v", callback, timeout)},
+		Callback:       callback,
+		Timeout:        timeout,
+	}
+}
+
+// CallbackRejectedError is returned to the CLI when a callback could not
+// start because CallbackLimits.MaxConcurrent callbacks were running for
+// longer than CallbackLimits.MaxWait.
+type CallbackRejectedError struct {
+	*ClaudeSDKError
+	Callback      string
+	MaxConcurrent int
+}
+
+// NewCallbackRejectedError creates a new CallbackRejectedError.
+func NewCallbackRejectedError(callback string, maxConcurrent int) *CallbackRejectedError {
+	return &CallbackRejectedError{
+		ClaudeSDKError: &ClaudeSDKError{Message: fmt.Sprintf("%s rejected: %d callbacks are already running", callback, maxConcurrent)},
+		Callback:       callback,
+		MaxConcurrent:  maxConcurrent,
+	}
+}
@@ -270,7 +270,7 @@ func bufferedChannels() {
 
 	ctx := context.Background()
 
-	// Use custom buffer size for better performance with high message volume
+	// Let more unread messages wait before reading from the CLI pauses
 	bufferSize := 500
 	options := &claude.ClaudeAgentOptions{
 		MessageChannelBufferSize: &bufferSize,
@@ -1,3 +1,3 @@
 module github.com/Facets-cloud/claude-agent-sdk-go
 
-go 1.25
+go 1.25.0
@@ -61,8 +61,10 @@ func convertAgentsToDicts(agents map[string]AgentDefinition) []map[string]interf
 		return nil
 	}
 
+	// Sort by name so the initialize request is deterministic
 	result := make([]map[string]interface{}, 0, len(agents))
-	for name, def := range agents {
+	for _, name := range sortedKeys(agents) {
+		def := agents[name]
 		agentDict := map[string]interface{}{
 			"name":        name,
 			"description": def.Description,
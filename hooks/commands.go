@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// DangerousCommand is a Bash command pattern BlockDangerousCommands denies.
+type DangerousCommand struct {
+	// Name describes the command to the model, such as "force push"
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultDangerousCommands are the commands BlockDangerousCommands denies
+// when given none.
+var DefaultDangerousCommands = []DangerousCommand{
+	{"recursive delete of the root, home or current directory",
+		regexp.MustCompile(`\brm\s+(?:-\S+\s+)*-\S*[rR]\S*\s+(?:-\S+\s+)*(?:/|/\*|~/?|\$HOME/?|\*|\./?|\.\./?)(?:\s|$|[;&|])`)},
+	{"downloaded script piped to a shell",
+		regexp.MustCompile(`\b(?:curl|wget)\b[^;&|\n]*\|\s*(?:sudo\s+)?(?:ba|z|k|da)?sh\b`)},
+	{"downloaded script run by a shell",
+		regexp.MustCompile(`\b(?:ba|z|k|da)?sh\s+<\(\s*(?:curl|wget)\b`)},
+	{"force push",
+		regexp.MustCompile(`\bgit\s+(?:[^;&|\n]*\s)?push\b[^;&|\n]*?(?:\s--force(?:\s|$)|\s-[a-zA-Z]*f[a-zA-Z]*(?:\s|$)|\s\+\S)`)},
+	{"filesystem format",
+		regexp.MustCompile(`\bmkfs(?:\.\w+)?\b`)},
+	{"raw write to a disk device",
+		regexp.MustCompile(`\bdd\b[^;&|\n]*\bof=/dev/(?:sd|hd|vd|xvd|nvme|disk|mmcblk)`)},
+	{"fork bomb",
+		regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`)},
+	{"recursive permission change of the root directory",
+		regexp.MustCompile(`\bch(?:mod|own)\s+(?:-\S+\s+)*-\S*R\S*\s+(?:-\S+\s+)*\S+\s+/(?:\s|$|[;&|])`)},
+}
+
+// BlockDangerousCommands returns a PreToolUse matcher denying Bash commands
+// that match any of commands, or DefaultDangerousCommands when none are
+// given. The model is told which pattern matched.
+func BlockDangerousCommands(commands ...DangerousCommand) claude.HookMatcher {
+	if len(commands) == 0 {
+		commands = DefaultDangerousCommands
+	}
+	return matcher("Bash", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		command := str(toolInput(input), "command")
+		for _, dangerous := range commands {
+			if dangerous.Pattern.MatchString(command) {
+				return denyToolUse(fmt.Sprintf("Blocked a dangerous command (%s). Do not retry it; ask the user to run it if it is really needed.", dangerous.Name)), nil
+			}
+		}
+		return claude.HookJSONOutput{}, nil
+	})
+}
@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// InjectContext returns a UserPromptSubmit matcher adding the text provide
+// returns for each prompt to the model's context. Empty text adds nothing,
+// and an error fails the hook.
+func InjectContext(provide func(ctx context.Context, prompt string) (string, error)) claude.HookMatcher {
+	return matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		text, err := provide(ctx, str(input, "prompt"))
+		if err != nil || text == "" {
+			return claude.HookJSONOutput{}, err
+		}
+		return claude.HookJSONOutput{HookSpecificOutput: map[string]interface{}{
+			"hookEventName":     "UserPromptSubmit",
+			"additionalContext": text,
+		}}, nil
+	})
+}
+
+// InjectFiles returns a UserPromptSubmit matcher adding the contents of
+// paths to the model's context with every prompt. Relative paths are read
+// from the session's working directory, and missing files are skipped.
+func InjectFiles(paths ...string) claude.HookMatcher {
+	return matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		var sections []string
+		for _, path := range paths {
+			file := path
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(str(input, "cwd"), file)
+			}
+			data, err := os.ReadFile(file)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return claude.HookJSONOutput{}, err
+			}
+			sections = append(sections, "Contents of "+path+":\n\n"+strings.TrimSpace(string(data)))
+		}
+		if len(sections) == 0 {
+			return claude.HookJSONOutput{}, nil
+		}
+		return claude.HookJSONOutput{HookSpecificOutput: map[string]interface{}{
+			"hookEventName":     "UserPromptSubmit",
+			"additionalContext": strings.Join(sections, "\n\n"),
+		}}, nil
+	})
+}
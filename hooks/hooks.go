@@ -0,0 +1,68 @@
+// Package hooks provides ready-made hook callbacks for common guardrails:
+// blocking dangerous Bash commands, protecting paths from edits, redacting
+// secrets from tool output, injecting project context into prompts,
+// limiting tool calls per turn and logging every hook event.
+//
+// Guards for a single event return a claude.HookMatcher to list under that
+// event; guards spanning several events return a map to Merge:
+//
+//	protect, err := hooks.ProtectPaths(".env", "**/*.pem", ".git/**")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	options.Hooks = hooks.Merge(
+//	    map[claude.HookEvent][]claude.HookMatcher{
+//	        claude.HookEventPreToolUse:       {hooks.BlockDangerousCommands(), protect},
+//	        claude.HookEventPostToolUse:      {hooks.RedactSecrets()},
+//	        claude.HookEventUserPromptSubmit: {hooks.InjectFiles("CONVENTIONS.md")},
+//	    },
+//	    hooks.MaxToolCallsPerTurn(50).Hooks(),
+//	    hooks.Log(os.Stderr),
+//	)
+package hooks
+
+import (
+	"context"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// Merge combines hook maps, keeping the order of the matchers of each event.
+func Merge(sets ...map[claude.HookEvent][]claude.HookMatcher) map[claude.HookEvent][]claude.HookMatcher {
+	merged := make(map[claude.HookEvent][]claude.HookMatcher)
+	for _, set := range sets {
+		for event, matchers := range set {
+			merged[event] = append(merged[event], matchers...)
+		}
+	}
+	return merged
+}
+
+// callback is the signature of claude.HookCallback, for brevity.
+type callback = func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error)
+
+func matcher(pattern string, fn callback) claude.HookMatcher {
+	return claude.HookMatcher{Matcher: pattern, Hooks: []claude.HookCallback{fn}}
+}
+
+// denyToolUse is the PreToolUse output denying the tool use with reason,
+// which is shown to the model.
+func denyToolUse(reason string) claude.HookJSONOutput {
+	return claude.HookJSONOutput{HookSpecificOutput: map[string]interface{}{
+		"hookEventName":            "PreToolUse",
+		"permissionDecision":       "deny",
+		"permissionDecisionReason": reason,
+	}}
+}
+
+// str returns the string field key of m.
+func str(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// toolInput returns the tool_input of a PreToolUse or PostToolUse input.
+func toolInput(input map[string]interface{}) map[string]interface{} {
+	m, _ := input["tool_input"].(map[string]interface{})
+	return m
+}
@@ -0,0 +1,148 @@
+package hooks
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+func TestMergeKeepsMatcherOrder(t *testing.T) {
+	first, second, third := matcher("A", nil), matcher("B", nil), matcher("C", nil)
+	merged := Merge(
+		map[claude.HookEvent][]claude.HookMatcher{claude.HookEventPreToolUse: {first}},
+		nil,
+		map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {second},
+			claude.HookEventStop:       {third},
+		},
+	)
+
+	var patterns []string
+	for _, m := range merged[claude.HookEventPreToolUse] {
+		patterns = append(patterns, m.Matcher)
+	}
+	if !reflect.DeepEqual(patterns, []string{"A", "B"}) {
+		t.Errorf("Expected PreToolUse matchers [A B], got %v", patterns)
+	}
+	if len(merged[claude.HookEventStop]) != 1 || len(merged) != 2 {
+		t.Errorf("Unexpected merged events %v", merged)
+	}
+}
+
+func TestRedactString(t *testing.T) {
+	patterns := []SecretPattern{
+		{"token", regexp.MustCompile(`tok_[a-z0-9]{6}`)},
+		{"credential", regexp.MustCompile(`password=(?P<secret>\S+)`)},
+	}
+
+	for _, tc := range []struct {
+		in, want string
+		found    []string
+	}{
+		{"nothing here", "nothing here", nil},
+		{"a tok_abc123 b tok_def456", "a [REDACTED token] b [REDACTED token]", []string{"token"}},
+		// Only the secret group is replaced, keeping the key
+		{"password=hunter22 rest", "password=[REDACTED credential] rest", []string{"credential"}},
+		{"tok_abc123 password=x", "[REDACTED token] password=[REDACTED credential]", []string{"credential", "token"}},
+	} {
+		found := map[string]bool{}
+		if got := redactString(tc.in, patterns, found); got != tc.want {
+			t.Errorf("redactString(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+		if len(found) != len(tc.found) {
+			t.Errorf("redactString(%q) found %v, want %v", tc.in, found, tc.found)
+		}
+		for _, name := range tc.found {
+			if !found[name] {
+				t.Errorf("redactString(%q) did not report %s", tc.in, name)
+			}
+		}
+	}
+}
+
+func TestRedactValueCopiesNestedValues(t *testing.T) {
+	patterns := []SecretPattern{{"token", regexp.MustCompile(`tok_[a-z0-9]{6}`)}}
+	original := map[string]interface{}{
+		"stdout": "tok_abc123",
+		"lines":  []interface{}{"ok", "tok_def456", 3.0},
+		"exit":   0.0,
+	}
+
+	found := map[string]bool{}
+	redacted := redactValue(original, patterns, found).(map[string]interface{})
+
+	want := map[string]interface{}{
+		"stdout": "[REDACTED token]",
+		"lines":  []interface{}{"ok", "[REDACTED token]", 3.0},
+		"exit":   0.0,
+	}
+	if !reflect.DeepEqual(redacted, want) {
+		t.Errorf("Unexpected redacted value %v", redacted)
+	}
+	if original["stdout"] != "tok_abc123" || original["lines"].([]interface{})[1] != "tok_def456" {
+		t.Errorf("redactValue modified its input: %v", original)
+	}
+	if !found["token"] {
+		t.Error("Expected the token to be reported")
+	}
+}
+
+func TestDefaultSecretPatternsHaveNames(t *testing.T) {
+	for _, secret := range DefaultSecretPatterns {
+		if secret.Name == "" || secret.Pattern == nil {
+			t.Errorf("Incomplete secret pattern %+v", secret)
+		}
+		if group := secret.Pattern.SubexpIndex("secret"); group == -1 && secret.Pattern.NumSubexp() > 0 {
+			t.Errorf("%s has groups but none named secret, so the whole match is redacted", secret.Name)
+		}
+	}
+}
+
+func TestProtectPathsWithoutCwd(t *testing.T) {
+	protect, err := ProtectPaths(".env", "/etc/**")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tool, field, path string
+		denied            bool
+	}{
+		// Without a cwd only relative paths can match relative globs
+		{"Write", "file_path", ".env", true},
+		{"Write", "file_path", "/srv/app/.env", false},
+		{"Edit", "file_path", "/etc/passwd", true},
+		{"NotebookEdit", "notebook_path", "/etc/nb.ipynb", true},
+		// Tools that do not edit files are ignored
+		{"Read", "file_path", "/etc/passwd", false},
+		{"Write", "file_path", "", false},
+	} {
+		input := map[string]interface{}{
+			"tool_name":  tc.tool,
+			"tool_input": map[string]interface{}{tc.field: tc.path},
+		}
+		output, err := protect.Hooks[0](context.Background(), input, nil, claude.HookContext{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		denied := output.HookSpecificOutput["permissionDecision"] == "deny"
+		if denied != tc.denied {
+			t.Errorf("%s %q: denied = %v, want %v", tc.tool, tc.path, denied, tc.denied)
+		}
+	}
+}
+
+func TestDenyToolUse(t *testing.T) {
+	output := denyToolUse("no")
+	want := map[string]interface{}{
+		"hookEventName":            "PreToolUse",
+		"permissionDecision":       "deny",
+		"permissionDecisionReason": "no",
+	}
+	if !reflect.DeepEqual(output.HookSpecificOutput, want) {
+		t.Errorf("Unexpected output %v", output.HookSpecificOutput)
+	}
+}
@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// ToolCallLimit denies tool calls beyond a maximum per turn, counting each
+// session separately. Create it with MaxToolCallsPerTurn.
+type ToolCallLimit struct {
+	max    int
+	mu     sync.Mutex
+	counts map[string]int // By session ID
+}
+
+// MaxToolCallsPerTurn returns a limit of max tool calls per turn. A turn
+// starts with the user's prompt and ends when the model stops.
+func MaxToolCallsPerTurn(max int) *ToolCallLimit {
+	return &ToolCallLimit{max: max, counts: make(map[string]int)}
+}
+
+// Hooks returns the PreToolUse matcher counting and denying tool calls, and
+// the UserPromptSubmit and Stop matchers resetting the count.
+func (l *ToolCallLimit) Hooks() map[claude.HookEvent][]claude.HookMatcher {
+	reset := matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		l.mu.Lock()
+		delete(l.counts, str(input, "session_id"))
+		l.mu.Unlock()
+		return claude.HookJSONOutput{}, nil
+	})
+	count := matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		session := str(input, "session_id")
+		if l.counts[session] >= l.max {
+			return denyToolUse(fmt.Sprintf("Tool call limit of %d per turn reached. Finish the turn with what you have, or ask the user to continue.", l.max)), nil
+		}
+		l.counts[session]++
+		return claude.HookJSONOutput{}, nil
+	})
+	return map[claude.HookEvent][]claude.HookMatcher{
+		claude.HookEventPreToolUse:       {count},
+		claude.HookEventUserPromptSubmit: {reset},
+		claude.HookEventStop:             {reset},
+	}
+}
@@ -0,0 +1,68 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// events are the hook events Log registers for.
+var events = []claude.HookEvent{
+	claude.HookEventPreToolUse,
+	claude.HookEventPostToolUse,
+	claude.HookEventPostToolUseFailure,
+	claude.HookEventUserPromptSubmit,
+	claude.HookEventStop,
+	claude.HookEventSubagentStart,
+	claude.HookEventSubagentStop,
+	claude.HookEventPreCompact,
+	claude.HookEventNotification,
+	claude.HookEventPermissionRequest,
+}
+
+// logLine is a line written by Log.
+type logLine struct {
+	Time      time.Time              `json:"time"`
+	Event     string                 `json:"event"`
+	SessionID string                 `json:"session_id,omitempty"`
+	ToolName  string                 `json:"tool_name,omitempty"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+	Input     map[string]interface{} `json:"input"`
+}
+
+// Log returns matchers for every hook event writing each hook input to w as
+// a JSON line, without changing what the CLI does. Writes are serialized, and
+// a failed write fails the hook.
+func Log(w io.Writer) map[claude.HookEvent][]claude.HookMatcher {
+	var mu sync.Mutex
+	write := matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		line := logLine{
+			Time:      time.Now().UTC(),
+			Event:     str(input, "hook_event_name"),
+			SessionID: str(input, "session_id"),
+			ToolName:  str(input, "tool_name"),
+			Input:     input,
+		}
+		if toolUseID != nil {
+			line.ToolUseID = *toolUseID
+		}
+		data, err := json.Marshal(line)
+		if err != nil {
+			return claude.HookJSONOutput{}, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(data, '\n'))
+		return claude.HookJSONOutput{}, err
+	})
+
+	set := make(map[claude.HookEvent][]claude.HookMatcher, len(events))
+	for _, event := range events {
+		set[event] = []claude.HookMatcher{write}
+	}
+	return set
+}
@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/glob"
+)
+
+// editTools are the tools ProtectPaths guards, with their path field.
+var editTools = map[string]string{
+	"Edit":         "file_path",
+	"MultiEdit":    "file_path",
+	"Write":        "file_path",
+	"NotebookEdit": "notebook_path",
+}
+
+// ProtectPaths returns a PreToolUse matcher denying Edit, MultiEdit, Write
+// and NotebookEdit on paths matching any of globs. "*" and "?" do not match
+// "/", "**" matches any number of directories, and "dir/**" also matches
+// dir. Relative globs apply under the session's working directory, so ".env"
+// protects only the top-level file and "**/.env" every one.
+func ProtectPaths(globs ...string) (claude.HookMatcher, error) {
+	var absolute, relative []*regexp.Regexp
+	for _, pattern := range globs {
+		pattern = filepath.ToSlash(pattern)
+		re, err := glob.Compile(pattern)
+		if err != nil {
+			return claude.HookMatcher{}, err
+		}
+		if strings.HasPrefix(pattern, "/") {
+			absolute = append(absolute, re)
+		} else {
+			relative = append(relative, re)
+		}
+	}
+
+	return matcher("Edit|MultiEdit|Write|NotebookEdit", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		field, ok := editTools[str(input, "tool_name")]
+		if !ok {
+			return claude.HookJSONOutput{}, nil
+		}
+		path := str(toolInput(input), field)
+		if path == "" {
+			return claude.HookJSONOutput{}, nil
+		}
+
+		// Paths outside the working directory only match absolute globs
+		cwd := str(input, "cwd")
+		abs, rel := filepath.Clean(path), ""
+		if !filepath.IsAbs(path) {
+			abs, rel = filepath.Join(cwd, path), abs
+		} else if cwd != "" {
+			rel, _ = filepath.Rel(cwd, abs)
+		}
+		abs, rel = filepath.ToSlash(abs), filepath.ToSlash(rel)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			rel = ""
+		}
+
+		if matchAny(absolute, abs) || (rel != "" && matchAny(relative, rel)) {
+			return denyToolUse(fmt.Sprintf("%s is protected and must not be modified.", path)), nil
+		}
+		return claude.HookJSONOutput{}, nil
+	}), nil
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// SecretPattern is a secret RedactSecrets finds in tool output. When Pattern
+// has a group named "secret" only that group is redacted, keeping the key of
+// an assignment such as "password=hunter22".
+type SecretPattern struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultSecretPatterns are the secrets RedactSecrets finds when given none.
+var DefaultSecretPatterns = []SecretPattern{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Anthropic API key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"credential", regexp.MustCompile(`(?i)(?:password|passwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;]{8,})`)},
+}
+
+// RedactSecrets returns a PostToolUse matcher finding patterns, or
+// DefaultSecretPatterns when none are given, in tool output.
+//
+// The CLI only lets hooks replace the output of MCP tools, which is returned
+// with every secret replaced by "[REDACTED <name>]". The output of built-in
+// tools such as Bash and Read has already been produced, so for those the
+// hook blocks with a reason telling the model which kinds of secret the
+// output contains and not to repeat or use them. Keep secrets out of reach
+// with ProtectPaths and permission rules where possible.
+func RedactSecrets(patterns ...SecretPattern) claude.HookMatcher {
+	if len(patterns) == 0 {
+		patterns = DefaultSecretPatterns
+	}
+	return matcher("", func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		found := make(map[string]bool)
+		redacted := redactValue(input["tool_response"], patterns, found)
+		if len(found) == 0 {
+			return claude.HookJSONOutput{}, nil
+		}
+		names := make([]string, 0, len(found))
+		for name := range found {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		toolName := str(input, "tool_name")
+		if strings.HasPrefix(toolName, "mcp__") {
+			return claude.HookJSONOutput{HookSpecificOutput: map[string]interface{}{
+				"hookEventName":        "PostToolUse",
+				"updatedMCPToolOutput": redacted,
+			}}, nil
+		}
+		decision := "block"
+		reason := fmt.Sprintf("The %s output contains secrets (%s). Do not repeat, store or use them.", toolName, strings.Join(names, ", "))
+		return claude.HookJSONOutput{Decision: &decision, Reason: &reason}, nil
+	})
+}
+
+// redactValue returns a copy of v with the secrets in its strings redacted,
+// adding the names of the secrets to found.
+func redactValue(v interface{}, patterns []SecretPattern, found map[string]bool) interface{} {
+	switch v := v.(type) {
+	case string:
+		return redactString(v, patterns, found)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			redacted[key] = redactValue(value, patterns, found)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = redactValue(value, patterns, found)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+func redactString(s string, patterns []SecretPattern, found map[string]bool) string {
+	for _, secret := range patterns {
+		group := secret.Pattern.SubexpIndex("secret")
+		matches := secret.Pattern.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		found[secret.Name] = true
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if group > 0 && m[2*group] >= 0 {
+				start, end = m[2*group], m[2*group+1]
+			}
+			b.WriteString(s[last:start])
+			b.WriteString("[REDACTED " + secret.Name + "]")
+			last = end
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
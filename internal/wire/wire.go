@@ -0,0 +1,241 @@
+// Package wire implements the protocol RemoteTransport and the agenthost
+// server speak: stream-json frames wrapped in sequenced envelopes, carried
+// as newline-delimited JSON over TCP or as text messages over WebSocket.
+//
+// Both peers number the data they send and keep it until the other side
+// acknowledges it, so a dropped connection can be resumed without losing or
+// duplicating frames.
+package wire
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Envelope types.
+const (
+	TypeHello    = "hello"     // Client: authenticate and open or resume a session
+	TypeWelcome  = "welcome"   // Server: session accepted
+	TypeReject   = "reject"    // Server: session refused, connection closes
+	TypeData     = "data"      // Sequenced stream-json frame
+	TypeEndInput = "end_input" // Client, sequenced: close the CLI's stdin
+	TypeError    = "error"     // Server, sequenced: the CLI transport failed
+	TypeEOF      = "eof"       // Server, sequenced: the CLI's output ended
+	TypeAck      = "ack"       // Acknowledge sequenced envelopes up to Ack
+	TypePing     = "ping"      // Client heartbeat
+	TypePong     = "pong"      // Server heartbeat reply
+	TypeClose    = "close"     // Client: end the session
+)
+
+// Envelope is one protocol message.
+type Envelope struct {
+	Type     string            `json:"type"`
+	Seq      uint64            `json:"seq,omitempty"`
+	Ack      uint64            `json:"ack,omitempty"`
+	Frame    json.RawMessage   `json:"frame,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Session  string            `json:"session,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Sequenced reports whether the envelope carries a sequence number and must
+// be delivered exactly once.
+func (e *Envelope) Sequenced() bool {
+	switch e.Type {
+	case TypeData, TypeEndInput, TypeError, TypeEOF:
+		return true
+	}
+	return false
+}
+
+// Conn carries whole frames.
+type Conn interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(data []byte) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// ReadEnvelope reads and decodes the next envelope from c.
+func ReadEnvelope(c Conn) (*Envelope, error) {
+	data, err := c.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	return &env, nil
+}
+
+// WriteEnvelope encodes and writes env to c.
+func WriteEnvelope(c Conn, env *Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(data)
+}
+
+// ErrFrameTooLarge is returned when a peer sends a frame above the limit.
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// lineConn frames messages as newline-delimited JSON.
+type lineConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	maxSize int
+	wmu     sync.Mutex
+}
+
+// NewLineConn returns a Conn that reads and writes one frame per line of
+// conn. Frames must not contain newlines, which encoded JSON never does.
+func NewLineConn(conn net.Conn, maxSize int) Conn {
+	return &lineConn{conn: conn, r: bufio.NewReaderSize(conn, 64*1024), maxSize: maxSize}
+}
+
+func (c *lineConn) ReadFrame() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		if len(line)+len(chunk) > c.maxSize+1 {
+			return nil, ErrFrameTooLarge
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return line[:len(line)-1], nil
+	}
+}
+
+func (c *lineConn) WriteFrame(data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (c *lineConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *lineConn) Close() error {
+	return c.conn.Close()
+}
+
+// Outbox numbers outgoing sequenced envelopes and keeps them until the peer
+// acknowledges them, so they can be resent after a reconnect.
+type Outbox struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending []*Envelope
+	size    int // Payload bytes of pending
+}
+
+// Add assigns the next sequence number to env and keeps it for resending.
+func (o *Outbox) Add(env *Envelope) *Envelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	env.Seq = o.seq
+	o.pending = append(o.pending, env)
+	o.size += payloadSize(env)
+	return env
+}
+
+// Ack drops envelopes up to and including seq.
+func (o *Outbox) Ack(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for n < len(o.pending) && o.pending[n].Seq <= seq {
+		o.size -= payloadSize(o.pending[n])
+		n++
+	}
+	o.pending = o.pending[n:]
+}
+
+// Size returns the payload bytes of the envelopes not yet acknowledged.
+func (o *Outbox) Size() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+func payloadSize(env *Envelope) int {
+	return len(env.Frame) + len(env.Error)
+}
+
+// Pending returns the envelopes not yet acknowledged.
+func (o *Outbox) Pending() []*Envelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*Envelope(nil), o.pending...)
+}
+
+// Inbox tracks the last sequenced envelope received, to drop duplicates
+// resent after a reconnect.
+type Inbox struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+// Accept reports whether seq is new and records it.
+func (in *Inbox) Accept(seq uint64) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if seq <= in.last {
+		return false
+	}
+	in.last = seq
+	return true
+}
+
+// Last returns the last sequence number accepted.
+func (in *Inbox) Last() uint64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.last
+}
+
+// Dial connects to address, which is "tcp://host:port", "ws://host:port/path"
+// or "wss://host:port/path". tlsConfig, if set, enables TLS for tcp
+// addresses and configures it for wss.
+func Dial(ctx context.Context, address string, tlsConfig *tls.Config, maxSize int) (Conn, error) {
+	scheme, rest, ok := strings.Cut(address, "://")
+	if !ok {
+		return nil, fmt.Errorf("address %q has no scheme (tcp://, ws:// or wss://)", address)
+	}
+	switch scheme {
+	case "tcp":
+		var dialer net.Dialer
+		var conn net.Conn
+		var err error
+		if tlsConfig != nil {
+			conn, err = (&tls.Dialer{NetDialer: &dialer, Config: tlsConfig}).DialContext(ctx, "tcp", rest)
+		} else {
+			conn, err = dialer.DialContext(ctx, "tcp", rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewLineConn(conn, maxSize), nil
+	case "ws", "wss":
+		return DialWebSocket(ctx, address, nil, tlsConfig, maxSize)
+	}
+	return nil, fmt.Errorf("unsupported address scheme %q", scheme)
+}
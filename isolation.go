@@ -0,0 +1,243 @@
+package claude
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// osUser is the resolved identity the CLI runs as when ClaudeAgentOptions.User is set.
+type osUser struct {
+	username string
+	homeDir  string
+	uid      uint32
+	gid      uint32
+	groups   []uint32
+}
+
+// lookupOSUser resolves a user name or numeric uid.
+func lookupOSUser(name string) (*osUser, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		var idErr error
+		u, idErr = user.LookupId(name)
+		if idErr != nil {
+			return nil, fmt.Errorf("unknown user %q: %w", name, err)
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric uid %q", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric gid %q", name, u.Gid)
+	}
+
+	result := &osUser{
+		username: u.Username,
+		homeDir:  u.HomeDir,
+		uid:      uint32(uid),
+		gid:      uint32(gid),
+	}
+
+	groupIDs, err := u.GroupIds()
+	if err == nil {
+		for _, g := range groupIDs {
+			if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+				result.groups = append(result.groups, uint32(id))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// isolationState tracks what is needed to apply and later diagnose
+// OS-level isolation for one CLI process.
+type isolationState struct {
+	user   *osUser
+	limits *ResourceLimits
+
+	// cgroup event counters captured before start, used to attribute a
+	// SIGKILL to the cgroup OOM killer or pids controller
+	oomKillsBefore uint64
+	pidsMaxBefore  uint64
+
+	cgroupDir *os.File
+}
+
+// newIsolationState resolves the configured user and validates that the
+// requested limits are supported on this platform.
+func newIsolationState(options *ClaudeAgentOptions) (*isolationState, error) {
+	state := &isolationState{limits: options.ResourceLimits}
+
+	if options.User != nil && *options.User != "" {
+		u, err := lookupOSUser(*options.User)
+		if err != nil {
+			return nil, err
+		}
+		state.user = u
+	}
+
+	if state.limits != nil && state.limits.hasRlimits() && !rlimitsSupported {
+		return nil, fmt.Errorf("resource limits are not supported on this platform")
+	}
+
+	return state, nil
+}
+
+// apply configures cmd to start as the resolved user, with the configured
+// rlimits and inside the configured cgroup. Call release once it has started
+// (successfully or not).
+func (s *isolationState) apply(cmd *exec.Cmd) error {
+	if s.user != nil {
+		if err := setProcessCredential(cmd, s.user); err != nil {
+			return err
+		}
+	}
+
+	if s.limits != nil && s.limits.hasRlimits() {
+		if err := applyRlimits(cmd, s.limits); err != nil {
+			return err
+		}
+	}
+
+	if s.limits == nil || s.limits.CgroupPath == "" {
+		return nil
+	}
+	limits := s.limits
+
+	dir, err := joinCgroup(cmd, limits.CgroupPath)
+	if err != nil {
+		return err
+	}
+	s.cgroupDir = dir
+
+	if err := configureCgroupLimits(limits); err != nil {
+		s.release()
+		return err
+	}
+	s.oomKillsBefore = readCgroupEventCount(limits.CgroupPath, "memory.events", "oom_kill")
+	s.pidsMaxBefore = readCgroupEventCount(limits.CgroupPath, "pids.events", "max")
+
+	return nil
+}
+
+// release frees resources held while starting the process.
+func (s *isolationState) release() {
+	if s.cgroupDir != nil {
+		s.cgroupDir.Close()
+		s.cgroupDir = nil
+	}
+}
+
+// env returns identity variables for the target user so the CLI reads its
+// configuration from the right home directory.
+func (s *isolationState) env() []string {
+	if s == nil || s.user == nil {
+		return nil
+	}
+	env := []string{"USER=" + s.user.username, "LOGNAME=" + s.user.username}
+	if s.user.homeDir != "" {
+		env = append(env, "HOME="+s.user.homeDir)
+	}
+	return env
+}
+
+// detectLimitViolation reports whether a failed CLI exit was caused by one of
+// the configured resource limits, returning a ResourceLimitError if so.
+func (s *isolationState) detectLimitViolation(procErr *ProcessError) error {
+	if s == nil || s.limits == nil || procErr == nil {
+		return nil
+	}
+	limits := s.limits
+	stderr := strings.ToLower(procErr.Stderr)
+
+	if limits.CgroupPath != "" {
+		if readCgroupEventCount(limits.CgroupPath, "memory.events", "oom_kill") > s.oomKillsBefore {
+			return NewResourceLimitError(ResourceLimitCgroupMemory, limits.CgroupMemoryMax, procErr)
+		}
+		if readCgroupEventCount(limits.CgroupPath, "pids.events", "max") > s.pidsMaxBefore {
+			return NewResourceLimitError(ResourceLimitCgroupPids, 0, procErr)
+		}
+	}
+
+	if limits.CPUSeconds > 0 && procErr.Signal == "SIGXCPU" {
+		return NewResourceLimitError(ResourceLimitCPUTime, limits.CPUSeconds, procErr)
+	}
+
+	if limits.OpenFiles > 0 && (strings.Contains(stderr, "emfile") || strings.Contains(stderr, "too many open files")) {
+		return NewResourceLimitError(ResourceLimitOpenFiles, limits.OpenFiles, procErr)
+	}
+
+	if limits.Processes > 0 && strings.Contains(stderr, "eagain") &&
+		(strings.Contains(stderr, "spawn") || strings.Contains(stderr, "fork")) {
+		return NewResourceLimitError(ResourceLimitProcesses, limits.Processes, procErr)
+	}
+
+	if limits.AddressSpaceBytes > 0 && (strings.Contains(stderr, "out of memory") ||
+		strings.Contains(stderr, "enomem") ||
+		strings.Contains(stderr, "cannot allocate memory")) {
+		return NewResourceLimitError(ResourceLimitAddressSpace, limits.AddressSpaceBytes, procErr)
+	}
+
+	return nil
+}
+
+// hasRlimits reports whether any rlimit is configured.
+func (l *ResourceLimits) hasRlimits() bool {
+	return l.AddressSpaceBytes > 0 || l.CPUSeconds > 0 || l.OpenFiles > 0 || l.Processes > 0
+}
+
+// configureCgroupLimits writes memory.max and cpu.max for the configured cgroup.
+func configureCgroupLimits(limits *ResourceLimits) error {
+	if limits.CgroupMemoryMax > 0 {
+		value := strconv.FormatUint(limits.CgroupMemoryMax, 10)
+		if err := writeCgroupFile(limits.CgroupPath, "memory.max", value); err != nil {
+			return err
+		}
+	}
+	if limits.CgroupCPUs > 0 {
+		const period = 100000
+		value := fmt.Sprintf("%d %d", int64(limits.CgroupCPUs*period), period)
+		if err := writeCgroupFile(limits.CgroupPath, "cpu.max", value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCgroupFile(cgroupPath, name, value string) error {
+	path := filepath.Join(cgroupPath, name)
+	if err := os.WriteFile(path, []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to write cgroup file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readCgroupEventCount reads a counter such as "oom_kill" from a cgroup v2
+// events file, returning 0 if it cannot be read.
+func readCgroupEventCount(cgroupPath, file, key string) uint64 {
+	f, err := os.Open(filepath.Join(cgroupPath, file))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			count, _ := strconv.ParseUint(fields[1], 10, 64)
+			return count
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package claude
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const rlimitsSupported = true
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package does not export.
+var rlimitNproc = func() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 8
+	}
+	return 6
+}()
+
+// rlimit64 matches the kernel's struct rlimit64 used by prlimit64(2).
+type rlimit64 struct {
+	Cur uint64
+	Max uint64
+}
+
+type rlimitSetting struct {
+	name     string
+	option   string // prlimit(1) option
+	resource int
+	limit    rlimit64
+}
+
+func rlimitSettings(limits *ResourceLimits) []rlimitSetting {
+	var settings []rlimitSetting
+	if limits.AddressSpaceBytes > 0 {
+		settings = append(settings, rlimitSetting{"RLIMIT_AS", "--as", syscall.RLIMIT_AS,
+			rlimit64{limits.AddressSpaceBytes, limits.AddressSpaceBytes}})
+	}
+	if limits.CPUSeconds > 0 {
+		// Soft limit delivers SIGXCPU so the violation can be recognized;
+		// the hard limit kills the process if SIGXCPU is ignored
+		settings = append(settings, rlimitSetting{"RLIMIT_CPU", "--cpu", syscall.RLIMIT_CPU,
+			rlimit64{limits.CPUSeconds, limits.CPUSeconds + 5}})
+	}
+	if limits.OpenFiles > 0 {
+		settings = append(settings, rlimitSetting{"RLIMIT_NOFILE", "--nofile", syscall.RLIMIT_NOFILE,
+			rlimit64{limits.OpenFiles, limits.OpenFiles}})
+	}
+	if limits.Processes > 0 {
+		settings = append(settings, rlimitSetting{"RLIMIT_NPROC", "--nproc", rlimitNproc,
+			rlimit64{limits.Processes, limits.Processes}})
+	}
+	return settings
+}
+
+// getrlimit returns the limit of this process for resource.
+func getrlimit(resource int) (rlimit64, error) {
+	var old rlimit64
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		0, uintptr(resource), 0, uintptr(unsafe.Pointer(&old)), 0, 0)
+	if errno != 0 {
+		return old, errno
+	}
+	return old, nil
+}
+
+// applyRlimits configures cmd to start through prlimit(1), which sets the
+// limits on itself and execs the command. Limits set before exec are
+// inherited by every process the CLI spawns; setting them with prlimit(2)
+// after start would race with its first forks.
+func applyRlimits(cmd *exec.Cmd, limits *ResourceLimits) error {
+	helper := limits.PrlimitPath
+	if helper == "" {
+		helper = "prlimit"
+	}
+	helperPath, err := exec.LookPath(helper)
+	if err != nil {
+		return fmt.Errorf("resource limits need prlimit from util-linux: %w", err)
+	}
+
+	// Fail here rather than in prlimit when a hard limit cannot be raised
+	args := []string{helperPath}
+	for _, s := range rlimitSettings(limits) {
+		current, err := getrlimit(s.resource)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.name, err)
+		}
+		if s.limit.Max > current.Max && os.Geteuid() != 0 {
+			return fmt.Errorf("%s of %d exceeds the hard limit %d", s.name, s.limit.Max, current.Max)
+		}
+		args = append(args, fmt.Sprintf("%s=%d:%d", s.option, s.limit.Cur, s.limit.Max))
+	}
+
+	cmd.Args = append(append(args, "--", cmd.Path), cmd.Args[1:]...)
+	cmd.Path = helperPath
+	return nil
+}
+
+// joinCgroup configures cmd to start inside the cgroup v2 directory at path.
+// The returned directory handle must stay open until the process has started.
+func joinCgroup(cmd *exec.Cmd, path string) (*os.File, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", path, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return dir, nil
+}
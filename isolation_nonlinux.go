@@ -0,0 +1,21 @@
+//go:build !linux
+
+package claude
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+const rlimitsSupported = false
+
+// applyRlimits is not supported outside Linux.
+func applyRlimits(cmd *exec.Cmd, limits *ResourceLimits) error {
+	return fmt.Errorf("resource limits are not supported on this platform")
+}
+
+// joinCgroup is not supported outside Linux.
+func joinCgroup(cmd *exec.Cmd, path string) (*os.File, error) {
+	return nil, fmt.Errorf("cgroups are not supported on this platform")
+}
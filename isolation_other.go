@@ -0,0 +1,13 @@
+//go:build !unix
+
+package claude
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setProcessCredential is not supported on platforms without POSIX credentials.
+func setProcessCredential(cmd *exec.Cmd, u *osUser) error {
+	return fmt.Errorf("running the CLI as another user is not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package claude
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessCredential starts the CLI as the given user. The SDK's process
+// needs CAP_SETUID and CAP_SETGID (usually root) for this to succeed.
+func setProcessCredential(cmd *exec.Cmd, u *osUser) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    u.uid,
+		Gid:    u.gid,
+		Groups: u.groups,
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PrefixLauncher returns a CommandLauncher that runs the CLI through a
+// prefix command, e.g. PrefixLauncher("nice", "-n", "10") or
+// PrefixLauncher("firejail", "--quiet").
+//
+// The environment and working directory are passed through unchanged.
+func PrefixLauncher(command string, args ...string) CommandLauncher {
+	return func(ctx context.Context, spec LaunchSpec) (LaunchSpec, error) {
+		if command == "" {
+			return spec, fmt.Errorf("prefix launcher requires a command")
+		}
+		wrapped := make([]string, 0, len(args)+1+len(spec.Args))
+		wrapped = append(wrapped, args...)
+		wrapped = append(wrapped, spec.Path)
+		wrapped = append(wrapped, spec.Args...)
+		return LaunchSpec{
+			Path:  command,
+			Args:  wrapped,
+			Env:   spec.Env,
+			Dir:   spec.Dir,
+			Files: spec.Files,
+		}, nil
+	}
+}
+
+// BubblewrapOptions configures BubblewrapLauncher.
+type BubblewrapOptions struct {
+	// BwrapPath is the bubblewrap executable (default: "bwrap" from PATH).
+	BwrapPath string
+
+	// WritablePaths are bound read-write in addition to the working directory,
+	// e.g. the CLI's config directory (~/.claude).
+	WritablePaths []string
+
+	// ReadOnlyPaths are hidden by a tmpfs by default (e.g. /tmp) but should be
+	// visible read-only inside the sandbox.
+	ReadOnlyPaths []string
+
+	// IsolateNetwork unshares the network namespace. The CLI then cannot reach
+	// the Anthropic API unless a proxy is reachable, so it is off by default.
+	IsolateNetwork bool
+
+	// ExtraArgs are appended to the bwrap arguments before the CLI command.
+	ExtraArgs []string
+}
+
+// BubblewrapLauncher returns a CommandLauncher that runs the CLI inside
+// bubblewrap (bwrap) with a read-only root filesystem, a private /tmp, fresh
+// /dev and /proc, and a writable working directory. Files the SDK created for
+// the CLI (LaunchSpec.Files) are bound read-only.
+//
+// The sandbox unshares every namespace except the network (unless
+// IsolateNetwork is set) and dies with its parent.
+//
+// Example:
+//
+//	home, _ := os.UserHomeDir()
+//	options := &ClaudeAgentOptions{
+//	    Cwd: stringPtr("/srv/workspaces/job-42"),
+//	    CommandLauncher: BubblewrapLauncher(BubblewrapOptions{
+//	        WritablePaths: []string{filepath.Join(home, ".claude")},
+//	    }),
+//	}
+func BubblewrapLauncher(opts BubblewrapOptions) CommandLauncher {
+	return func(ctx context.Context, spec LaunchSpec) (LaunchSpec, error) {
+		bwrap := opts.BwrapPath
+		if bwrap == "" {
+			bwrap = "bwrap"
+		}
+
+		cwd := spec.Dir
+		if cwd == "" {
+			var err error
+			cwd, err = os.Getwd()
+			if err != nil {
+				return spec, fmt.Errorf("failed to determine working directory: %w", err)
+			}
+		}
+		cwd, err := filepath.Abs(cwd)
+		if err != nil {
+			return spec, fmt.Errorf("failed to resolve working directory: %w", err)
+		}
+
+		args := []string{
+			"--ro-bind", "/", "/",
+			"--dev", "/dev",
+			"--proc", "/proc",
+			"--tmpfs", "/tmp",
+			"--unshare-all",
+			"--die-with-parent",
+		}
+		if !opts.IsolateNetwork {
+			args = append(args, "--share-net")
+		}
+		for _, path := range opts.ReadOnlyPaths {
+			args = append(args, "--ro-bind", path, path)
+		}
+		for _, path := range spec.Files {
+			args = append(args, "--ro-bind", path, path)
+		}
+		for _, path := range opts.WritablePaths {
+			args = append(args, "--bind", path, path)
+		}
+		args = append(args, "--bind", cwd, cwd, "--chdir", cwd)
+		args = append(args, opts.ExtraArgs...)
+		args = append(args, "--", spec.Path)
+		args = append(args, spec.Args...)
+
+		return LaunchSpec{
+			Path:  bwrap,
+			Args:  args,
+			Env:   spec.Env,
+			Dir:   cwd,
+			Files: spec.Files,
+		}, nil
+	}
+}
@@ -0,0 +1,15 @@
+package claude
+
+import "log/slog"
+
+// discardLogger is used when ClaudeAgentOptions.Logger is nil.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// optionsLogger returns the logger options configure, or one that discards
+// everything.
+func optionsLogger(options *ClaudeAgentOptions) *slog.Logger {
+	if options == nil || options.Logger == nil {
+		return discardLogger
+	}
+	return options.Logger
+}
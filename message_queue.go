@@ -0,0 +1,245 @@
+package claude
+
+import (
+	"context"
+	"sync"
+)
+
+// OverflowPolicy decides what happens to partial StreamEvents when the
+// consumer of a query falls behind.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock delivers every StreamEvent. The backlog grows until the
+	// consumer catches up; reading from the CLI pauses only at
+	// messageBacklogFactor times the buffer size.
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowDropOldest drops the oldest queued StreamEvent to make room for
+	// a new one once the buffer is full.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+
+	// OverflowCoalesce merges a text, thinking or tool input delta into the
+	// queued delta for the same content block once the buffer is full, so
+	// the consumer receives fewer, larger deltas and no text is lost.
+	OverflowCoalesce OverflowPolicy = "coalesce"
+)
+
+// messageBacklogFactor bounds the backlog, in multiples of the buffer size,
+// before the router stops reading from the CLI. Until then control requests
+// keep flowing however slow the consumer is.
+const messageBacklogFactor = 16
+
+// PipelineStats is a snapshot of PipelineMetrics.
+type PipelineStats struct {
+	StreamEventsDropped   uint64 // StreamEvents discarded by OverflowDropOldest
+	StreamEventsCoalesced uint64 // StreamEvents merged into a queued one by OverflowCoalesce
+	MaxBacklog            int    // Most messages waiting for the consumer at once
+	Stalls                uint64 // Times reading from the CLI paused for a full backlog
+}
+
+// PipelineMetrics counts what the message pipeline did to keep up with slow
+// consumers. One PipelineMetrics may be shared by several queries.
+type PipelineMetrics struct {
+	mu    sync.Mutex
+	stats PipelineStats
+}
+
+// NewPipelineMetrics creates an empty PipelineMetrics.
+func NewPipelineMetrics() *PipelineMetrics {
+	return &PipelineMetrics{}
+}
+
+// Stats returns a snapshot of the counters.
+func (m *PipelineMetrics) Stats() PipelineStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+func (m *PipelineMetrics) record(update func(*PipelineStats)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	update(&m.stats)
+	m.mu.Unlock()
+}
+
+// messageQueue holds regular messages between the router, which must never
+// wait for the consumer while control traffic is pending, and the
+// goroutine delivering them.
+type messageQueue struct {
+	capacity int
+	limit    int
+	policy   OverflowPolicy
+	metrics  *PipelineMetrics
+
+	mu     sync.Mutex
+	items  []map[string]interface{}
+	held   int // Popped but not yet handed to the consumer
+	closed bool
+	ready  chan struct{} // Signaled when items were added or the queue closed
+	space  chan struct{} // Signaled when items were removed
+}
+
+func newMessageQueue(capacity int, policy OverflowPolicy, metrics *PipelineMetrics) *messageQueue {
+	if policy == "" {
+		policy = OverflowBlock
+	}
+	return &messageQueue{
+		capacity: capacity,
+		limit:    capacity * messageBacklogFactor,
+		policy:   policy,
+		metrics:  metrics,
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push queues msg, applying the overflow policy to StreamEvents. It waits
+// only when the backlog reaches its limit.
+func (mq *messageQueue) push(ctx context.Context, msg map[string]interface{}) error {
+	stalled := false
+	for {
+		mq.mu.Lock()
+		if len(mq.items) >= mq.capacity && msg["type"] == "stream_event" && mq.overflow(msg) {
+			mq.mu.Unlock()
+			return nil
+		}
+		if len(mq.items) < mq.limit {
+			mq.items = append(mq.items, msg)
+			backlog := len(mq.items)
+			mq.mu.Unlock()
+			mq.metrics.record(func(s *PipelineStats) { s.MaxBacklog = max(s.MaxBacklog, backlog) })
+			notify(mq.ready)
+			return nil
+		}
+		mq.mu.Unlock()
+
+		if !stalled {
+			stalled = true
+			mq.metrics.record(func(s *PipelineStats) { s.Stalls++ })
+		}
+		select {
+		case <-mq.space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// overflow applies the policy to a StreamEvent arriving at a full queue and
+// reports whether msg was absorbed. Called with mu held.
+func (mq *messageQueue) overflow(msg map[string]interface{}) bool {
+	switch mq.policy {
+	case OverflowDropOldest:
+		for i, queued := range mq.items {
+			if queued["type"] == "stream_event" {
+				mq.items = append(mq.items[:i], mq.items[i+1:]...)
+				mq.metrics.record(func(s *PipelineStats) { s.StreamEventsDropped++ })
+				return false // Queue msg in the freed slot
+			}
+		}
+	case OverflowCoalesce:
+		if last := mq.items[len(mq.items)-1]; coalesceDelta(last, msg) {
+			mq.metrics.record(func(s *PipelineStats) { s.StreamEventsCoalesced++ })
+			return true
+		}
+	}
+	return false
+}
+
+// coalescibleDeltas maps delta types to the field holding their text.
+var coalescibleDeltas = map[string]string{
+	"text_delta":       "text",
+	"thinking_delta":   "thinking",
+	"input_json_delta": "partial_json",
+}
+
+// coalesceDelta appends the delta of next to queued if both are deltas of
+// the same kind for the same content block, and reports whether it did.
+func coalesceDelta(queued, next map[string]interface{}) bool {
+	if queued["type"] != "stream_event" || queued["parent_tool_use_id"] != next["parent_tool_use_id"] {
+		return false
+	}
+	queuedEvent, _ := queued["event"].(map[string]interface{})
+	nextEvent, _ := next["event"].(map[string]interface{})
+	if queuedEvent["type"] != "content_block_delta" || nextEvent["type"] != "content_block_delta" ||
+		queuedEvent["index"] != nextEvent["index"] {
+		return false
+	}
+	queuedDelta, _ := queuedEvent["delta"].(map[string]interface{})
+	nextDelta, _ := nextEvent["delta"].(map[string]interface{})
+	deltaType, _ := nextDelta["type"].(string)
+	field, ok := coalescibleDeltas[deltaType]
+	if !ok || queuedDelta["type"] != deltaType {
+		return false
+	}
+	queuedText, ok1 := queuedDelta[field].(string)
+	nextText, ok2 := nextDelta[field].(string)
+	if !ok1 || !ok2 {
+		return false
+	}
+	queuedDelta[field] = queuedText + nextText
+	return true
+}
+
+// pop returns the next message, waiting for one. It returns false once the
+// queue is closed and empty, or when ctx is done.
+func (mq *messageQueue) pop(ctx context.Context) (map[string]interface{}, bool) {
+	for {
+		mq.mu.Lock()
+		if len(mq.items) > 0 {
+			msg := mq.items[0]
+			mq.items[0] = nil
+			mq.items = mq.items[1:]
+			mq.held++
+			mq.mu.Unlock()
+			notify(mq.space)
+			return msg, true
+		}
+		closed := mq.closed
+		mq.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-mq.ready:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// delivered records that a message returned by pop reached the consumer
+// or was dropped.
+func (mq *messageQueue) delivered() {
+	mq.mu.Lock()
+	mq.held--
+	mq.mu.Unlock()
+}
+
+// pending returns the number of messages queued or popped but not yet
+// delivered.
+func (mq *messageQueue) pending() int {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	return len(mq.items) + mq.held
+}
+
+// close lets pop return false once the remaining messages are delivered.
+func (mq *messageQueue) close() {
+	mq.mu.Lock()
+	mq.closed = true
+	mq.mu.Unlock()
+	notify(mq.ready)
+}
@@ -0,0 +1,121 @@
+package claude
+
+import "time"
+
+// Metrics receives counters and histogram observations from the SDK. Set
+// ClaudeAgentOptions.Metrics to export them; package claudemetrics provides
+// expvar and Prometheus implementations. Implementations must be safe for
+// concurrent use.
+type Metrics interface {
+	// Add increments the counter name by delta.
+	Add(name string, delta float64, labels Labels)
+	// Observe records value in the histogram name.
+	Observe(name string, value float64, labels Labels)
+}
+
+// Labels qualify a metric, such as the model or tool it refers to.
+type Labels map[string]string
+
+// NopMetrics discards everything. It is used when no Metrics is set.
+var NopMetrics Metrics = nopMetrics{}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, float64, Labels)     {}
+func (nopMetrics) Observe(string, float64, Labels) {}
+
+// Metric names recorded by the SDK. Durations are in seconds.
+const (
+	MetricTurns               = "claude_turns_total"                    // Counter by model and outcome (the result subtype)
+	MetricTurnDuration        = "claude_turn_duration_seconds"          // Histogram by model, from DurationMS
+	MetricTurnAPIDuration     = "claude_turn_api_duration_seconds"      // Histogram by model, from DurationAPIMS
+	MetricCost                = "claude_cost_usd_total"                 // Counter by model
+	MetricTokens              = "claude_tokens_total"                   // Counter by model and type: input, output, cache_read, cache_creation
+	MetricToolCalls           = "claude_tool_calls_total"               // Counter by tool
+	MetricPermissionDecisions = "claude_permission_decisions_total"     // Counter by tool and behavior: allow, deny, ask, error
+	MetricHookDuration        = "claude_hook_duration_seconds"          // Histogram by event
+	MetricControlTimeouts     = "claude_control_request_timeouts_total" // Counter by subtype
+	MetricCLIStarts           = "claude_cli_starts_total"               // Counter of CLI processes started
+	MetricCLIFailures         = "claude_cli_failures_total"             // Counter by kind of CLI processes that exited with an error
+	MetricParseErrors         = "claude_parse_errors_total"             // Counter of messages from the CLI that failed to parse
+	MetricPoolQueries         = "claude_pool_queries_total"             // Counter by outcome: hit (served by a ready process) or miss
+)
+
+// Metric label names.
+const (
+	LabelModel    = "model"
+	LabelOutcome  = "outcome"
+	LabelType     = "type"
+	LabelTool     = "tool"
+	LabelBehavior = "behavior"
+	LabelEvent    = "event"
+	LabelSubtype  = "subtype"
+	LabelKind     = "kind"
+)
+
+// messageMetrics records metrics for regular messages as the router sees
+// them. It remembers the model of the session for results, which do not
+// name it, and the session totals of the last result. Only the router
+// goroutine uses it.
+type messageMetrics struct {
+	metrics Metrics
+	model   string
+	totals  resultTotals
+}
+
+func (mm *messageMetrics) observe(msg map[string]interface{}) {
+	switch msg["type"] {
+	case "system":
+		if model, ok := msg["model"].(string); ok {
+			mm.model = model
+		}
+	case "assistant":
+		message, _ := msg["message"].(map[string]interface{})
+		if model, ok := message["model"].(string); ok {
+			mm.model = model
+		}
+		for _, block := range contentBlocks(message) {
+			if block["type"] == "tool_use" {
+				name, _ := block["name"].(string)
+				mm.metrics.Add(MetricToolCalls, 1, Labels{LabelTool: name})
+			}
+		}
+	case "result":
+		mm.observeResult(msg)
+	}
+}
+
+func (mm *messageMetrics) observeResult(msg map[string]interface{}) {
+	model := Labels{LabelModel: mm.model}
+	subtype, _ := msg["subtype"].(string)
+	mm.metrics.Add(MetricTurns, 1, Labels{LabelModel: mm.model, LabelOutcome: subtype})
+	if v, ok := msg["duration_ms"].(float64); ok {
+		mm.metrics.Observe(MetricTurnDuration, v/1000, model)
+	}
+	if v, ok := msg["duration_api_ms"].(float64); ok {
+		mm.metrics.Observe(MetricTurnAPIDuration, v/1000, model)
+	}
+
+	// Results report session totals; count what this turn added
+	for name, usage := range mm.totals.next(msg, mm.model) {
+		labels := Labels{LabelModel: name}
+		if usage.CostUSD > 0 {
+			mm.metrics.Add(MetricCost, usage.CostUSD, labels)
+		}
+		for tokenType, v := range map[string]int64{
+			"input":          usage.InputTokens,
+			"output":         usage.OutputTokens,
+			"cache_read":     usage.CacheReadTokens,
+			"cache_creation": usage.CacheCreationTokens,
+		} {
+			if v > 0 {
+				mm.metrics.Add(MetricTokens, float64(v), Labels{LabelModel: name, LabelType: tokenType})
+			}
+		}
+	}
+}
+
+// since returns the seconds elapsed since start.
+func since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -23,20 +23,29 @@ func parseMessage(data map[string]interface{}) (Message, error) {
 
 	switch msgType {
 	case "user":
-		return parseUserMessage(data)
+		return asMessage(parseUserMessage(data))
 	case "assistant":
-		return parseAssistantMessage(data)
+		return asMessage(parseAssistantMessage(data))
 	case "system":
-		return parseSystemMessage(data)
+		return asMessage(parseSystemMessage(data))
 	case "result":
-		return parseResultMessage(data)
+		return asMessage(parseResultMessage(data))
 	case "stream_event":
-		return parseStreamEvent(data)
+		return asMessage(parseStreamEvent(data))
 	default:
 		return nil, NewMessageParseError(fmt.Sprintf("unknown message type: %s", msgType), data)
 	}
 }
 
+// asMessage converts a parser result to a Message, returning a nil interface
+// rather than a typed nil pointer on error.
+func asMessage[M Message](msg M, err error) (Message, error) {
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
 func parseUserMessage(data map[string]interface{}) (*UserMessage, error) {
 	message, ok := data["message"].(map[string]interface{})
 	if !ok {
@@ -139,6 +148,12 @@ func parseAssistantMessage(data map[string]interface{}) (*AssistantMessage, erro
 	}, nil
 }
 
+// ParseContentBlock parses a raw content block into a typed ContentBlock.
+// This is exported for testing purposes.
+func ParseContentBlock(item interface{}) (ContentBlock, error) {
+	return parseContentBlock(item)
+}
+
 func parseContentBlock(item interface{}) (ContentBlock, error) {
 	block, ok := item.(map[string]interface{})
 	if !ok {
@@ -199,6 +214,18 @@ func parseContentBlock(item interface{}) (ContentBlock, error) {
 		return result, nil
 
 	case "image":
+		// Messages API images carry their data in a base64 source
+		if source, ok := block["source"].(map[string]interface{}); ok {
+			data, ok := source["data"].(string)
+			if !ok {
+				return nil, fmt.Errorf("image block source missing 'data' field")
+			}
+			mediaType, ok := source["media_type"].(string)
+			if !ok {
+				return nil, fmt.Errorf("image block source missing 'media_type' field")
+			}
+			return ImageBlock{Data: data, MimeType: mediaType}, nil
+		}
 		data, ok := block["data"].(string)
 		if !ok {
 			return nil, fmt.Errorf("image block missing 'data' field")
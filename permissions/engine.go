@@ -0,0 +1,366 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// Result is the evaluation of one tool use.
+type Result struct {
+	Decision Decision
+	// Rule names the deciding rule; empty for the default decision and
+	// rate limits
+	Rule string
+	// Reason explains the decision
+	Reason string
+	// UpdatedInput is the input after rewrites, or nil if none applied
+	UpdatedInput map[string]interface{}
+}
+
+// Engine evaluates tool uses against a compiled Policy. It is safe for
+// concurrent use.
+type Engine struct {
+	// Asker decides the tool uses the policy asks about, for example
+	// TerminalPrompter.CanUseTool or approval.Service.CanUseTool. Without
+	// one, CanUseTool returns claude.PermissionResultAsk, which the SDK
+	// answers as a denial telling Claude to ask the user. Set it before use.
+	Asker claude.CanUseTool
+
+	defaultDecision Decision
+	cwd             string
+	rules           []*compiledRule
+	rewrites        []*compiledRewrite
+	limits          []*compiledLimit
+
+	mu  sync.Mutex // Guards rate limit windows
+	now func() time.Time
+}
+
+type compiledRule struct {
+	Rule
+	name         string
+	tools        []*regexp.Regexp
+	patterns     []*regexp.Regexp
+	readPaths    []*regexp.Regexp
+	writePaths   []*regexp.Regexp
+	matchesTools bool // The rule has a tool condition
+}
+
+type compiledRewrite struct {
+	Rewrite
+	tools []*regexp.Regexp
+}
+
+type compiledLimit struct {
+	RateLimit
+	tools []*regexp.Regexp
+	uses  []time.Time // Within the last Per, oldest first
+}
+
+// Compile validates policy and compiles it. Relative path globs apply
+// under options.Cwd (default: the current directory) and each of
+// options.AddDirs. options may be nil.
+func Compile(policy *Policy, options *claude.ClaudeAgentOptions) (*Engine, error) {
+	if policy == nil {
+		policy = &Policy{}
+	}
+
+	cwd := ""
+	var addDirs []string
+	if options != nil {
+		if options.Cwd != nil {
+			cwd = *options.Cwd
+		}
+		addDirs = options.AddDirs
+	}
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, err
+	}
+	// Roots are resolved like the paths matched against them
+	roots := []string{resolvePath(cwd)}
+	for _, dir := range addDirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+		roots = append(roots, resolvePath(filepath.Clean(dir)))
+	}
+
+	e := &Engine{defaultDecision: policy.Default, cwd: cwd, now: time.Now}
+	if e.defaultDecision == "" {
+		e.defaultDecision = Deny
+	}
+	if !validDecision(e.defaultDecision) {
+		return nil, fmt.Errorf("invalid default decision %q", policy.Default)
+	}
+
+	for i, rule := range policy.Rules {
+		cr := &compiledRule{Rule: rule, name: rule.Name}
+		if cr.name == "" {
+			cr.name = fmt.Sprintf("rule %d", i+1)
+		}
+		if !validDecision(rule.Decision) {
+			return nil, fmt.Errorf("%s: invalid decision %q", cr.name, rule.Decision)
+		}
+		cr.matchesTools = len(rule.Tools) > 0 || len(rule.ToolPrefixes) > 0
+		if cr.tools, err = compileGlobs(rule.Tools); err != nil {
+			return nil, fmt.Errorf("%s: %w", cr.name, err)
+		}
+		for _, pattern := range rule.CommandPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid command pattern: %w", cr.name, err)
+			}
+			cr.patterns = append(cr.patterns, re)
+		}
+		if cr.readPaths, err = compilePathGlobs(rule.ReadPaths, roots); err != nil {
+			return nil, fmt.Errorf("%s: %w", cr.name, err)
+		}
+		if cr.writePaths, err = compilePathGlobs(rule.WritePaths, roots); err != nil {
+			return nil, fmt.Errorf("%s: %w", cr.name, err)
+		}
+		e.rules = append(e.rules, cr)
+	}
+
+	for i, rewrite := range policy.Rewrites {
+		tools, err := compileGlobs(rewrite.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %d: %w", i+1, err)
+		}
+		e.rewrites = append(e.rewrites, &compiledRewrite{Rewrite: rewrite, tools: tools})
+	}
+
+	for i, limit := range policy.RateLimits {
+		if limit.Max <= 0 || limit.Per <= 0 {
+			return nil, fmt.Errorf("rate limit %d: max and per must be positive", i+1)
+		}
+		tools, err := compileGlobs(limit.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %d: %w", i+1, err)
+		}
+		e.limits = append(e.limits, &compiledLimit{RateLimit: limit, tools: tools})
+	}
+	return e, nil
+}
+
+func validDecision(d Decision) bool {
+	return d == Allow || d == Deny || d == Ask
+}
+
+// restrictiveness orders decisions: deny wins over ask, ask over allow.
+var restrictiveness = map[Decision]int{Allow: 0, Ask: 1, Deny: 2}
+
+// Evaluate decides a tool use. Allowed and asked uses count toward rate
+// limits.
+func (e *Engine) Evaluate(toolName string, input map[string]interface{}) Result {
+	var decided *compiledRule
+	for _, rule := range e.rules {
+		if !e.matches(rule, toolName, input) {
+			continue
+		}
+		if decided == nil || restrictiveness[rule.Decision] > restrictiveness[decided.Decision] {
+			decided = rule
+		}
+	}
+
+	result := Result{Decision: e.defaultDecision}
+	if decided != nil {
+		result.Decision = decided.Decision
+		result.Rule = decided.name
+		result.Reason = decided.Message
+		if result.Reason == "" {
+			result.Reason = fmt.Sprintf("%s: %s %s", decided.name, verb(decided.Decision), toolName)
+		}
+	} else {
+		result.Reason = fmt.Sprintf("no rule matches %s; the default is %s", toolName, e.defaultDecision)
+	}
+	if result.Decision == Deny {
+		return result
+	}
+
+	if reason := e.takeRate(toolName); reason != "" {
+		return Result{Decision: Deny, Reason: reason}
+	}
+	result.UpdatedInput = e.rewrite(toolName, input)
+	return result
+}
+
+func verb(d Decision) string {
+	switch d {
+	case Allow:
+		return "allows"
+	case Ask:
+		return "asks before"
+	}
+	return "denies"
+}
+
+// CanUseTool implements claude.CanUseTool.
+func (e *Engine) CanUseTool(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+	result := e.Evaluate(toolName, input)
+	switch result.Decision {
+	case Allow:
+		return claude.PermissionResultAllow{Behavior: "allow", UpdatedInput: result.UpdatedInput}, nil
+	case Ask:
+		if e.Asker == nil {
+			return claude.PermissionResultAsk{Behavior: "ask", Message: result.Reason, UpdatedInput: result.UpdatedInput}, nil
+		}
+		if result.UpdatedInput != nil {
+			input = result.UpdatedInput
+		}
+		decision, err := e.Asker(ctx, toolName, input, permCtx)
+		if allow, ok := decision.(claude.PermissionResultAllow); ok && allow.UpdatedInput == nil {
+			allow.UpdatedInput = result.UpdatedInput
+			decision = allow
+		}
+		return decision, err
+	}
+	return claude.PermissionResultDeny{Behavior: "deny", Message: result.Reason}, nil
+}
+
+// matches reports whether every condition of rule holds for the tool use.
+func (e *Engine) matches(rule *compiledRule, toolName string, input map[string]interface{}) bool {
+	if rule.matchesTools && !matchAny(rule.tools, toolName) && !hasAnyPrefix(toolName, rule.ToolPrefixes) {
+		return false
+	}
+
+	if len(rule.Commands) > 0 || len(rule.patterns) > 0 {
+		command, ok := input["command"].(string)
+		if toolName != "Bash" || !ok || !matchCommand(rule, command) {
+			return false
+		}
+	}
+
+	if len(rule.readPaths) > 0 || len(rule.writePaths) > 0 {
+		if field, ok := readTools[toolName]; ok && len(rule.readPaths) > 0 {
+			return matchAny(rule.readPaths, toolPath(field, input, e.cwd))
+		}
+		if field, ok := writeTools[toolName]; ok && len(rule.writePaths) > 0 {
+			return matchAny(rule.writePaths, toolPath(field, input, e.cwd))
+		}
+		return false
+	}
+	return true
+}
+
+// matchCommand matches a Bash command line. A deny or ask rule matches when
+// any command in the line does, so "ls && rm -rf /" is caught by a rule for
+// "rm". An allow rule matches only when every command does and nothing is
+// hidden in a substitution.
+func matchCommand(rule *compiledRule, command string) bool {
+	commands := splitCommand(command)
+	if rule.Decision != Allow {
+		if matchAny(rule.patterns, command) {
+			return true
+		}
+		for _, c := range commands {
+			if matchCommandRule(rule, c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if hasSubstitution(command) || len(commands) == 0 {
+		return false
+	}
+	for _, c := range commands {
+		if !matchCommandRule(rule, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCommandRule(rule *compiledRule, command string) bool {
+	for _, prefix := range rule.Commands {
+		if hasCommandPrefix(command, prefix) {
+			return true
+		}
+	}
+	return matchAny(rule.patterns, command)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// takeRate records a use of toolName against every matching rate limit, or
+// returns why a limit is exhausted without recording anything.
+func (e *Engine) takeRate(toolName string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	var matched []*compiledLimit
+	for _, limit := range e.limits {
+		if !matchAny(limit.tools, toolName) {
+			continue
+		}
+		// Forget uses that left the window
+		cutoff := now.Add(-limit.Per)
+		kept := 0
+		for kept < len(limit.uses) && !limit.uses[kept].After(cutoff) {
+			kept++
+		}
+		limit.uses = limit.uses[kept:]
+		if len(limit.uses) >= limit.Max {
+			return fmt.Sprintf("rate limit exceeded: at most %d uses of %s per %s",
+				limit.Max, strings.Join(limit.Tools, ", "), limit.Per)
+		}
+		matched = append(matched, limit)
+	}
+	for _, limit := range matched {
+		limit.uses = append(limit.uses, now)
+	}
+	return ""
+}
+
+// rewrite applies the matching rewrites to a copy of input, or returns nil
+// if none matches.
+func (e *Engine) rewrite(toolName string, input map[string]interface{}) map[string]interface{} {
+	var updated map[string]interface{}
+	for _, rw := range e.rewrites {
+		if !matchAny(rw.tools, toolName) {
+			continue
+		}
+		if updated == nil {
+			updated = make(map[string]interface{}, len(input))
+			for k, v := range input {
+				updated[k] = v
+			}
+		}
+		for k, v := range rw.Defaults {
+			if _, ok := updated[k]; !ok {
+				updated[k] = v
+			}
+		}
+		for k, v := range rw.Set {
+			updated[k] = v
+		}
+		if command, ok := updated["command"].(string); ok && toolName == "Bash" && rw.CommandPrefix != "" &&
+			!strings.HasPrefix(command, rw.CommandPrefix) {
+			updated["command"] = rw.CommandPrefix + command
+		}
+	}
+	return updated
+}
@@ -0,0 +1,129 @@
+package permissions
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/glob"
+)
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(globs))
+	for i, pattern := range globs {
+		re, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// compilePathGlobs compiles path globs, applying relative ones under each
+// of roots. Roots are matched literally, so a directory named "src*" or
+// "[old]" only matches itself.
+func compilePathGlobs(globs, roots []string) ([]*regexp.Regexp, error) {
+	var expanded []string
+	for _, pattern := range globs {
+		pattern = filepath.ToSlash(pattern)
+		if strings.HasPrefix(pattern, "/") {
+			expanded = append(expanded, pattern)
+			continue
+		}
+		for _, root := range roots {
+			expanded = append(expanded, glob.Escape(strings.TrimSuffix(filepath.ToSlash(root), "/"))+"/"+pattern)
+		}
+	}
+	return compileGlobs(expanded)
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandSeparator splits a shell command line into the commands it runs.
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// splitCommand returns the commands of a shell command line.
+func splitCommand(command string) []string {
+	var commands []string
+	for _, part := range commandSeparator.Split(command, -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			commands = append(commands, part)
+		}
+	}
+	return commands
+}
+
+// hasSubstitution reports whether command runs commands a prefix cannot
+// see, through command or process substitution.
+func hasSubstitution(command string) bool {
+	return strings.Contains(command, "$(") || strings.Contains(command, "`") ||
+		strings.Contains(command, "<(") || strings.Contains(command, ">(")
+}
+
+// hasCommandPrefix reports whether command starts with prefix followed by
+// the end of the command or whitespace.
+func hasCommandPrefix(command, prefix string) bool {
+	command = strings.Join(strings.Fields(command), " ")
+	prefix = strings.Join(strings.Fields(prefix), " ")
+	if !strings.HasPrefix(command, prefix) {
+		return false
+	}
+	return len(command) == len(prefix) || command[len(prefix)] == ' '
+}
+
+// Tools whose paths ReadPaths and WritePaths match, and the input field
+// holding the path.
+var (
+	readTools = map[string]string{
+		"Read":         "file_path",
+		"Glob":         "path",
+		"Grep":         "path",
+		"LS":           "path",
+		"NotebookRead": "notebook_path",
+	}
+	writeTools = map[string]string{
+		"Write":        "file_path",
+		"Edit":         "file_path",
+		"MultiEdit":    "file_path",
+		"NotebookEdit": "notebook_path",
+	}
+)
+
+// toolPath returns the absolute path a file tool operates on, with the
+// symlinks in it resolved. A missing path means the working directory, as
+// for Glob and Grep.
+func toolPath(field string, input map[string]interface{}, cwd string) string {
+	path, _ := input[field].(string)
+	if path == "" {
+		path = cwd
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return filepath.ToSlash(resolvePath(filepath.Clean(path)))
+}
+
+// resolvePath resolves the symlinks in the longest existing prefix of the
+// clean absolute path, so that a link inside an allowed directory matches
+// where it points. The rest of the path, which does not exist yet, is kept
+// as it is.
+func resolvePath(path string) string {
+	var rest []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
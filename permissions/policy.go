@@ -0,0 +1,173 @@
+// Package permissions compiles a declarative tool policy into a
+// claude.CanUseTool callback, so every service enforces permissions the same
+// way instead of hand-writing callbacks.
+//
+// A policy is a list of rules matching tools by name, Bash commands by
+// prefix or regular expression, and file paths by glob, each deciding to
+// allow, deny or ask. Policies can be written as Go structs or loaded from
+// JSON:
+//
+//	{
+//	  "default": "deny",
+//	  "rules": [
+//	    {"name": "read-workspace", "decision": "allow", "tools": ["Read", "Glob", "Grep"], "read_paths": ["**"]},
+//	    {"name": "git", "decision": "allow", "commands": ["git status", "git diff", "git log"]},
+//	    {"name": "github", "decision": "ask", "tool_prefixes": ["mcp__github__"]}
+//	  ],
+//	  "rate_limits": [{"tools": ["Bash"], "max": 30, "per": "1m"}]
+//	}
+//
+// Then:
+//
+//	policy, err := permissions.Load("policy.json")
+//	engine, err := permissions.Compile(policy, options)
+//	options.CanUseTool = engine.CanUseTool
+//
+// Package permissions/yamlpolicy, a separate module so this one needs no
+// YAML library, loads the same policy from YAML.
+//
+// For local tools, TerminalPrompter is a CanUseTool that asks the user on
+// the terminal instead.
+package permissions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Decision is the outcome of evaluating a tool use.
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Deny  Decision = "deny"
+	Ask   Decision = "ask"
+)
+
+// Policy is a declarative tool permission policy.
+//
+// Every rule matching a tool use is considered and the most restrictive
+// decision wins: deny over ask over allow, whatever the order of the rules.
+// When no rule matches, Default applies.
+type Policy struct {
+	// Default is the decision when no rule matches (default: deny)
+	Default Decision `yaml:"default,omitempty" json:"default,omitempty"`
+	// Rules decide tool uses
+	Rules []Rule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	// Rewrites change the input of allowed tool uses, in order
+	Rewrites []Rewrite `yaml:"rewrites,omitempty" json:"rewrites,omitempty"`
+	// RateLimits deny tool uses beyond a number per period
+	RateLimits []RateLimit `yaml:"rate_limits,omitempty" json:"rate_limits,omitempty"`
+}
+
+// Rule matches tool uses and decides them. A rule matches when every one of
+// its non-empty conditions does; a rule without conditions matches every
+// tool use.
+type Rule struct {
+	// Name identifies the rule in explanations
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Decision is allow, deny or ask
+	Decision Decision `yaml:"decision" json:"decision"`
+	// Message explains the decision to the model
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+
+	// Tools are tool name globs, such as "Bash" or "mcp__*__search"
+	Tools []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+	// ToolPrefixes match tool names by prefix, typically an MCP server's
+	// tools such as "mcp__github__"
+	ToolPrefixes []string `yaml:"tool_prefixes,omitempty" json:"tool_prefixes,omitempty"`
+
+	// Commands are Bash command prefixes, matched on whole words: "git
+	// status" matches "git status -s" but not "git statusx"
+	Commands []string `yaml:"commands,omitempty" json:"commands,omitempty"`
+	// CommandPatterns are regular expressions matched against Bash commands
+	CommandPatterns []string `yaml:"command_patterns,omitempty" json:"command_patterns,omitempty"`
+
+	// ReadPaths are globs for the paths of read-only file tools (Read,
+	// Glob, Grep, LS, NotebookRead). Relative globs apply under Cwd and
+	// each of AddDirs; "**" matches any number of directories. Paths are
+	// matched after resolving symlinks, so a link cannot lead out of a
+	// directory a glob allows.
+	ReadPaths []string `yaml:"read_paths,omitempty" json:"read_paths,omitempty"`
+	// WritePaths are globs for the paths of file editing tools (Write,
+	// Edit, MultiEdit, NotebookEdit), relative like ReadPaths
+	WritePaths []string `yaml:"write_paths,omitempty" json:"write_paths,omitempty"`
+}
+
+// Rewrite changes the input of matching tool uses that are allowed or
+// asked, which the CLI then runs instead of the model's input.
+type Rewrite struct {
+	// Tools are tool name globs the rewrite applies to
+	Tools []string `yaml:"tools" json:"tools"`
+	// Set overrides input fields
+	Set map[string]interface{} `yaml:"set,omitempty" json:"set,omitempty"`
+	// Defaults sets input fields the model left out
+	Defaults map[string]interface{} `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// CommandPrefix is prepended to Bash commands, such as "nice -n 10 "
+	CommandPrefix string `yaml:"command_prefix,omitempty" json:"command_prefix,omitempty"`
+}
+
+// RateLimit caps how often matching tools may be used. Uses beyond Max
+// within any Per period are denied.
+type RateLimit struct {
+	// Tools are tool name globs sharing the limit
+	Tools []string      `yaml:"tools" json:"tools"`
+	Max   int           `yaml:"max" json:"max"`
+	Per   time.Duration `yaml:"per" json:"per"`
+}
+
+// UnmarshalJSON accepts Per as a duration string such as "1m", or as
+// nanoseconds.
+func (r *RateLimit) UnmarshalJSON(data []byte) error {
+	type rateLimit RateLimit
+	var raw struct {
+		rateLimit
+		Per json.RawMessage `json:"per"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	*r = RateLimit(raw.rateLimit)
+	if len(raw.Per) == 0 {
+		return nil
+	}
+	var per string
+	if err := json.Unmarshal(raw.Per, &per); err != nil {
+		return json.Unmarshal(raw.Per, &r.Per)
+	}
+	var err error
+	if r.Per, err = time.ParseDuration(per); err != nil {
+		return fmt.Errorf("rate limit per: %w", err)
+	}
+	return nil
+}
+
+// Parse parses a JSON policy. Unknown fields are an error, so a misspelled
+// condition does not silently widen a rule.
+func Parse(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid permission policy: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid permission policy: unexpected data after the policy")
+	}
+	return &policy, nil
+}
+
+// Load reads and parses the policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permission policy: %w", err)
+	}
+	return Parse(data)
+}
@@ -0,0 +1,299 @@
+package permissions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// ErrPrompterClosed is returned by a TerminalPrompter's CanUseTool after
+// Close.
+var ErrPrompterClosed = errors.New("permissions: terminal prompter closed")
+
+// DefaultMaxPromptLines bounds how many lines of tool input a
+// TerminalPrompter shows.
+const DefaultMaxPromptLines = 200
+
+// TerminalOptions configures a TerminalPrompter.
+type TerminalOptions struct {
+	// In and Out are the terminal. When both are nil the controlling
+	// terminal (/dev/tty) is opened, falling back to stdin and stderr.
+	In  io.Reader
+	Out io.Writer
+	// Cwd resolves relative paths of Write tool uses, to diff against the
+	// existing file (default: the current directory)
+	Cwd string
+	// MaxLines bounds the lines of tool input shown (default:
+	// DefaultMaxPromptLines)
+	MaxLines int
+}
+
+// TerminalPrompter is a CanUseTool for local developer tools that asks the
+// user on a terminal. It shows the tool and its input (the command for
+// Bash, a diff for Edit and Write) and offers to allow once, allow always
+// for the session or the project, deny with a message, or deny and
+// interrupt. Requests arriving together are asked one at a time. Control
+// characters in the tool input are shown escaped, so the model cannot move
+// the cursor or rewrite what the prompt shows.
+type TerminalPrompter struct {
+	out      io.Writer
+	cwd      string
+	maxLines int
+	tty      *os.File // Opened by NewTerminalPrompter, closed by Close
+
+	lines     chan string // Lines read from the terminal; closed at EOF
+	turn      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTerminalPrompter creates a prompter. options may be nil. Call Close
+// when done with it.
+func NewTerminalPrompter(options *TerminalOptions) (*TerminalPrompter, error) {
+	var opts TerminalOptions
+	if options != nil {
+		opts = *options
+	}
+	var tty *os.File
+	if opts.In == nil && opts.Out == nil {
+		var err error
+		if tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+			opts.In, opts.Out = tty, tty
+		} else {
+			opts.In, opts.Out = os.Stdin, os.Stderr
+		}
+	}
+	if opts.In == nil || opts.Out == nil {
+		return nil, fmt.Errorf("TerminalOptions needs both In and Out")
+	}
+	if opts.MaxLines <= 0 {
+		opts.MaxLines = DefaultMaxPromptLines
+	}
+
+	p := &TerminalPrompter{
+		out:      opts.Out,
+		cwd:      opts.Cwd,
+		maxLines: opts.MaxLines,
+		tty:      tty,
+		lines:    make(chan string),
+		turn:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go p.readLines(opts.In)
+	return p, nil
+}
+
+// Close fails pending and later prompts with ErrPrompterClosed and closes
+// the terminal NewTerminalPrompter opened. An injected TerminalOptions.In is
+// not closed; reading from it stops once its pending read returns.
+func (p *TerminalPrompter) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if p.tty != nil {
+			err = p.tty.Close()
+		}
+	})
+	return err
+}
+
+// readLines feeds terminal input to prompts, so a prompt can give up when
+// its context ends without leaving a read behind.
+func (p *TerminalPrompter) readLines(in io.Reader) {
+	defer close(p.lines)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		select {
+		case p.lines <- strings.TrimSpace(scanner.Text()):
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// CanUseTool implements claude.CanUseTool.
+func (p *TerminalPrompter) CanUseTool(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+	// One prompt at a time
+	select {
+	case p.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.done:
+		return nil, ErrPrompterClosed
+	}
+	defer func() { <-p.turn }()
+
+	fmt.Fprintf(p.out, "\nClaude wants to use %s\n", printable(toolName))
+	for _, line := range p.describe(toolName, input) {
+		fmt.Fprintf(p.out, "  %s\n", printable(line))
+	}
+
+	for {
+		fmt.Fprint(p.out, "Allow? [y] once, [a] always this session, [p] always in this project, [n] deny, [x] deny and interrupt: ")
+		answer, err := p.readLine(ctx)
+		if err != nil {
+			return nil, err
+		}
+		choice := strings.ToLower(answer)
+		switch choice {
+		case "y", "yes":
+			return claude.PermissionResultAllow{Behavior: "allow"}, nil
+		case "a", "always":
+			return claude.PermissionResultAllow{
+				Behavior:           "allow",
+				UpdatedPermissions: alwaysAllow(toolName, input, permCtx, claude.PermissionUpdateDestinationSession),
+			}, nil
+		case "p", "project":
+			return claude.PermissionResultAllow{
+				Behavior:           "allow",
+				UpdatedPermissions: alwaysAllow(toolName, input, permCtx, claude.PermissionUpdateDestinationProjectSettings),
+			}, nil
+		case "n", "no", "x":
+			fmt.Fprint(p.out, "Message for Claude (optional): ")
+			message, err := p.readLine(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if message == "" {
+				message = "The user denied this tool use"
+			}
+			return claude.PermissionResultDeny{Behavior: "deny", Message: message, Interrupt: choice == "x"}, nil
+		}
+		fmt.Fprintf(p.out, "Unknown choice %q\n", answer)
+	}
+}
+
+// readLine waits for the next line of input.
+func (p *TerminalPrompter) readLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			fmt.Fprintln(p.out)
+			return "", io.ErrUnexpectedEOF
+		}
+		return line, nil
+	case <-ctx.Done():
+		fmt.Fprintln(p.out)
+		return "", ctx.Err()
+	case <-p.done:
+		fmt.Fprintln(p.out)
+		return "", ErrPrompterClosed
+	}
+}
+
+// printable escapes the characters strconv.Quote escapes, other than tab,
+// such as ESC starting ANSI sequences, carriage returns and bidirectional
+// overrides.
+func printable(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\t' || strconv.IsPrint(r) {
+			b.WriteRune(r)
+			continue
+		}
+		quoted := strconv.QuoteRune(r)
+		b.WriteString(quoted[1 : len(quoted)-1])
+	}
+	return b.String()
+}
+
+// alwaysAllow returns the permission updates for allowing a tool use from
+// now on: the CLI's suggestions when it made some, otherwise a rule for the
+// tool (and the exact command for Bash).
+func alwaysAllow(toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext, destination claude.PermissionUpdateDestination) []claude.PermissionUpdate {
+	if len(permCtx.Suggestions) > 0 {
+		updates := make([]claude.PermissionUpdate, len(permCtx.Suggestions))
+		for i, suggestion := range permCtx.Suggestions {
+			suggestion.Destination = &destination
+			updates[i] = suggestion
+		}
+		return updates
+	}
+
+	rule := claude.PermissionRuleValue{ToolName: toolName}
+	if command, ok := input["command"].(string); ok && toolName == "Bash" {
+		rule.RuleContent = &command
+	}
+	behavior := claude.PermissionBehaviorAllow
+	return []claude.PermissionUpdate{{
+		Type:        "addRules",
+		Rules:       []claude.PermissionRuleValue{rule},
+		Behavior:    &behavior,
+		Destination: &destination,
+	}}
+}
+
+// describe renders the tool input for the prompt.
+func (p *TerminalPrompter) describe(toolName string, input map[string]interface{}) []string {
+	var lines []string
+	str := func(key string) string {
+		s, _ := input[key].(string)
+		return s
+	}
+
+	switch toolName {
+	case "Bash":
+		if description := str("description"); description != "" {
+			lines = append(lines, "# "+description)
+		}
+		for i, line := range splitLines(str("command")) {
+			if i == 0 {
+				lines = append(lines, "$ "+line)
+			} else {
+				lines = append(lines, "  "+line)
+			}
+		}
+	case "Edit":
+		lines = append(lines, str("file_path"))
+		lines = append(lines, lineDiff(str("old_string"), str("new_string"))...)
+	case "MultiEdit":
+		lines = append(lines, str("file_path"))
+		edits, _ := input["edits"].([]interface{})
+		for i, e := range edits {
+			edit, _ := e.(map[string]interface{})
+			oldString, _ := edit["old_string"].(string)
+			newString, _ := edit["new_string"].(string)
+			lines = append(lines, fmt.Sprintf("@@ edit %d", i+1))
+			lines = append(lines, lineDiff(oldString, newString)...)
+		}
+	case "Write":
+		path := str("file_path")
+		existing := ""
+		if data, err := os.ReadFile(p.resolve(path)); err == nil {
+			existing = string(data)
+			lines = append(lines, path)
+		} else {
+			lines = append(lines, path+" (new file)")
+		}
+		lines = append(lines, lineDiff(existing, str("content"))...)
+	default:
+		data, err := json.MarshalIndent(input, "", "  ")
+		if err != nil {
+			data = []byte(fmt.Sprint(input))
+		}
+		lines = splitLines(string(data))
+	}
+
+	if len(lines) > p.maxLines {
+		omitted := len(lines) - p.maxLines
+		lines = append(lines[:p.maxLines], fmt.Sprintf("... %d more lines", omitted))
+	}
+	return lines
+}
+
+func (p *TerminalPrompter) resolve(path string) string {
+	if filepath.IsAbs(path) || p.cwd == "" {
+		return path
+	}
+	return filepath.Join(p.cwd, path)
+}
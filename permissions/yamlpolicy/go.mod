@@ -0,0 +1,12 @@
+module github.com/Facets-cloud/claude-agent-sdk-go/permissions/yamlpolicy
+
+go 1.25.0
+
+require (
+	github.com/Facets-cloud/claude-agent-sdk-go v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/kr/text v0.2.0 // indirect
+
+replace github.com/Facets-cloud/claude-agent-sdk-go => ../../
@@ -0,0 +1,58 @@
+// Package yamlpolicy loads permission policies written in YAML. It is a
+// separate module so the SDK itself does not depend on a YAML library.
+//
+// Example:
+//
+//	default: deny
+//	rules:
+//	  - name: read-workspace
+//	    decision: allow
+//	    tools: [Read, Glob, Grep]
+//	    read_paths: ["**"]
+//	  - name: git
+//	    decision: allow
+//	    commands: ["git status", "git diff", "git log"]
+//	  - name: github
+//	    decision: ask
+//	    tool_prefixes: [mcp__github__]
+//	rate_limits:
+//	  - tools: [Bash]
+//	    max: 30
+//	    per: 1m
+//
+// Then:
+//
+//	policy, err := yamlpolicy.Load("policy.yaml")
+//	engine, err := permissions.Compile(policy, options)
+//	options.CanUseTool = engine.CanUseTool
+package yamlpolicy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/Facets-cloud/claude-agent-sdk-go/permissions"
+	"gopkg.in/yaml.v3"
+)
+
+// Parse parses a YAML policy. Unknown fields are an error, so a misspelled
+// condition does not silently widen a rule.
+func Parse(data []byte) (*permissions.Policy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var policy permissions.Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid permission policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// Load reads and parses the YAML policy file at path.
+func Load(path string) (*permissions.Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permission policy: %w", err)
+	}
+	return Parse(data)
+}
@@ -0,0 +1,75 @@
+package yamlpolicy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/permissions"
+	"github.com/Facets-cloud/claude-agent-sdk-go/permissions/yamlpolicy"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: read-workspace
+    decision: allow
+    tools: [Read, Glob, Grep]
+    read_paths: ["**"]
+  - name: destructive
+    decision: deny
+    message: Destructive commands are not allowed
+    command_patterns: ['\brm\s+-[a-z]*r', '\bsudo\b']
+  - name: git
+    decision: allow
+    commands: ["git status", "git diff", "git log"]
+rewrites:
+  - tools: [Bash]
+    command_prefix: "nice -n 10 "
+rate_limits:
+  - tools: [Bash]
+    max: 30
+    per: 1m
+`
+
+func TestLoadCompilesPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := yamlpolicy.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(policy.RateLimits) != 1 || policy.RateLimits[0].Per != time.Minute {
+		t.Errorf("Expected a rate limit per minute, got %#v", policy.RateLimits)
+	}
+
+	cwd := "/work/repo"
+	engine, err := permissions.Compile(policy, &claude.ClaudeAgentOptions{Cwd: &cwd})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, tc := range []struct {
+		tool  string
+		input map[string]interface{}
+		want  permissions.Decision
+	}{
+		{"Read", map[string]interface{}{"file_path": "/work/repo/main.go"}, permissions.Allow},
+		{"Bash", map[string]interface{}{"command": "git status"}, permissions.Allow},
+		{"Bash", map[string]interface{}{"command": "sudo reboot"}, permissions.Deny},
+		{"Write", map[string]interface{}{"file_path": "/work/repo/main.go"}, permissions.Deny},
+	} {
+		if result := engine.Evaluate(tc.tool, tc.input); result.Decision != tc.want {
+			t.Errorf("%s %v: expected %s, got %s (%s)", tc.tool, tc.input, tc.want, result.Decision, result.Reason)
+		}
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	if _, err := yamlpolicy.Parse([]byte("rules:\n  - decision: allow\n    tool: [Bash]\n")); err == nil {
+		t.Error("Expected an error for a misspelled field")
+	}
+}
@@ -0,0 +1,433 @@
+package claude
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolSize                = 2
+	defaultPoolMaxIdle             = 5 * time.Minute
+	defaultPoolHealthCheckInterval = 30 * time.Second
+	poolHealthCheckTimeout         = 10 * time.Second
+)
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	// Size is the number of initialized CLI processes kept ready (default: 2)
+	Size int
+	// MaxIdle discards a ready process that has waited longer than this
+	// (default: 5 minutes)
+	MaxIdle time.Duration
+	// HealthCheckInterval is how often ready processes are checked and the
+	// pool is refilled (default: 30 seconds)
+	HealthCheckInterval time.Duration
+}
+
+// PoolStats reports pool activity since the pool was created. Hits and
+// misses are also counted as MetricPoolQueries.
+type PoolStats struct {
+	Hits      uint64 // Queries served by a ready process
+	Misses    uint64 // Queries that had to start their own process
+	Started   uint64 // Processes started and initialized for the pool
+	Discarded uint64 // Ready processes dropped as unhealthy or idle too long
+	Failures  uint64 // Processes that failed to start or initialize
+	Ready     int    // Processes ready now
+	Warming   int    // Processes starting now
+}
+
+// pooledQuery is a CLI process that is started and initialized but has not
+// received a prompt.
+type pooledQuery struct {
+	q          *queryHandler
+	readySince time.Time
+}
+
+// alive reports whether the process is still running and has not produced
+// output nobody asked for.
+func (pq *pooledQuery) alive() bool {
+	select {
+	case <-pq.q.done:
+		return false
+	default:
+	}
+	return pq.q.transport.IsReady() && pq.q.pendingMessages() == 0
+}
+
+// Pool keeps CLI processes started and initialized ahead of time so one-shot
+// queries skip process startup, the version check and the initialize round
+// trip.
+//
+// Every process in a pool uses the same options, including callbacks, hooks
+// and SDK MCP servers. A process serves exactly one query and is then
+// discarded, because it holds that conversation; the pool starts a
+// replacement in the background. When no process is ready, Query starts one
+// itself, just like the package-level Query.
+//
+// Example:
+//
+//	pool, err := claude.NewPool(options, &claude.PoolOptions{Size: 4})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer pool.Close()
+//
+//	msgCh, errCh, err := pool.Query(ctx, "What is 2+2?")
+type Pool struct {
+	options     *ClaudeAgentOptions
+	poolOptions PoolOptions
+	fingerprint string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	ready    []*pooledQuery
+	borrowed map[*queryHandler]struct{} // Serving queries, hits and misses
+	warming  int
+	closed   bool
+	stats    PoolStats
+}
+
+// NewPool creates a pool for options and starts filling it in the
+// background. poolOptions may be nil to use the defaults.
+func NewPool(options *ClaudeAgentOptions, poolOptions *PoolOptions) (*Pool, error) {
+	if options == nil {
+		options = &ClaudeAgentOptions{}
+	}
+	configuredOptions, err := validateAndConfigurePermissions(options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the CLI now so a missing binary fails here, not in the background
+	fingerprint, err := OptionsFingerprint(configuredOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var po PoolOptions
+	if poolOptions != nil {
+		po = *poolOptions
+	}
+	if po.Size <= 0 {
+		po.Size = defaultPoolSize
+	}
+	if po.MaxIdle <= 0 {
+		po.MaxIdle = defaultPoolMaxIdle
+	}
+	if po.HealthCheckInterval <= 0 {
+		po.HealthCheckInterval = defaultPoolHealthCheckInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		options:     configuredOptions,
+		poolOptions: po,
+		fingerprint: fingerprint,
+		ctx:         ctx,
+		cancel:      cancel,
+		borrowed:    make(map[*queryHandler]struct{}),
+	}
+
+	p.fill()
+	p.wg.Add(1)
+	go p.maintain()
+	return p, nil
+}
+
+// Fingerprint returns the OptionsFingerprint of the pool's options.
+func (p *Pool) Fingerprint() string {
+	return p.fingerprint
+}
+
+// Query runs a one-shot query on a ready process, or on a new one if none
+// is ready. It behaves like the package-level Query with the pool's options.
+func (p *Pool) Query(ctx context.Context, prompt string) (<-chan Message, <-chan error, error) {
+	if err := p.options.Budget.Check(ctx); err != nil {
+		return nil, nil, err
+	}
+	q, err := p.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx = q.tracer.begin(ctx, SpanQuery)
+	return runQuery(ctx, q, prompt, p.options)
+}
+
+// acquire returns a healthy ready process, or starts one bound to ctx.
+func (p *Pool) acquire(ctx context.Context) (*queryHandler, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, NewCLIConnectionError("pool is closed", nil)
+	}
+	var found *pooledQuery
+	var stale []*pooledQuery
+	for len(p.ready) > 0 {
+		// Oldest first, so no process sits idle until MaxIdle
+		pq := p.ready[0]
+		p.ready = p.ready[1:]
+		if pq.alive() && time.Since(pq.readySince) < p.poolOptions.MaxIdle {
+			found = pq
+			break
+		}
+		stale = append(stale, pq)
+	}
+	p.stats.Discarded += uint64(len(stale))
+	outcome := "miss"
+	if found != nil {
+		p.stats.Hits++
+		outcome = "hit"
+		p.borrow(found.q)
+	} else {
+		p.stats.Misses++
+	}
+	p.mu.Unlock()
+
+	// Closing waits for the process to exit, which must not hold up the pool
+	for _, pq := range stale {
+		pq.q.log().Info("claude: discarding pooled CLI process", "reason", "exited or idle")
+		pq.q.Close()
+	}
+	if p.options.Metrics != nil {
+		p.options.Metrics.Add(MetricPoolQueries, 1, Labels{LabelOutcome: outcome})
+	}
+	p.fill()
+	if found != nil {
+		return found.q, nil
+	}
+
+	trans, err := NewSubprocessCLITransport("", p.options, "")
+	if err != nil {
+		return nil, err
+	}
+	q, err := startQuery(ctx, trans, p.options, newRunTracer(p.options.Tracer))
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		q.Close()
+		return nil, NewCLIConnectionError("pool is closed", nil)
+	}
+	p.borrow(q)
+	p.mu.Unlock()
+	return q, nil
+}
+
+// borrow tracks q until its query ends, so Close can stop it. Called with
+// mu held and the pool open.
+func (p *Pool) borrow(q *queryHandler) {
+	p.borrowed[q] = struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		<-q.done
+		p.mu.Lock()
+		delete(p.borrowed, q)
+		p.mu.Unlock()
+	}()
+}
+
+// fill starts processes until ready and warming ones reach the pool size.
+func (p *Pool) fill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	for n := p.poolOptions.Size - len(p.ready) - p.warming; n > 0; n-- {
+		p.warming++
+		p.wg.Add(1)
+		go p.warm()
+	}
+}
+
+// warm starts and initializes one process and adds it to the ready list.
+func (p *Pool) warm() {
+	defer p.wg.Done()
+
+	var q *queryHandler
+	trans, err := NewSubprocessCLITransport("", p.options, "")
+	if err == nil {
+		q, err = startQuery(p.ctx, trans, p.options, newRunTracer(p.options.Tracer))
+	}
+
+	p.mu.Lock()
+	p.warming--
+	if err != nil {
+		p.stats.Failures++
+		p.mu.Unlock()
+		if p.ctx.Err() == nil {
+			optionsLogger(p.options).Warn("claude: failed to warm pooled CLI process", "error", err)
+		}
+		return
+	}
+	p.stats.Started++
+	if p.closed {
+		p.mu.Unlock()
+		q.Close()
+		return
+	}
+	p.ready = append(p.ready, &pooledQuery{q: q, readySince: time.Now()})
+	p.mu.Unlock()
+}
+
+// maintain periodically health checks ready processes and refills the pool.
+func (p *Pool) maintain() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.poolOptions.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkReady()
+			p.fill()
+		}
+	}
+}
+
+// checkReady discards ready processes that exited, idled past MaxIdle or do
+// not answer a control request.
+func (p *Pool) checkReady() {
+	p.mu.Lock()
+	snapshot := append([]*pooledQuery(nil), p.ready...)
+	p.mu.Unlock()
+
+	for _, pq := range snapshot {
+		// Take the process out while probing so no query borrows it
+		p.mu.Lock()
+		found := false
+		for i, candidate := range p.ready {
+			if candidate == pq {
+				p.ready = append(p.ready[:i], p.ready[i+1:]...)
+				found = true
+				break
+			}
+		}
+		p.mu.Unlock()
+		if !found {
+			continue
+		}
+
+		healthy := pq.alive() && time.Since(pq.readySince) < p.poolOptions.MaxIdle
+		if healthy {
+			ctx, cancel := context.WithTimeout(p.ctx, poolHealthCheckTimeout)
+			_, err := pq.q.GetMcpStatus(ctx)
+			cancel()
+			healthy = err == nil && pq.alive()
+		}
+
+		p.mu.Lock()
+		if healthy && !p.closed {
+			p.ready = append(p.ready, pq)
+			p.mu.Unlock()
+			continue
+		}
+		if !healthy {
+			p.stats.Discarded++
+			pq.q.log().Info("claude: discarding pooled CLI process", "reason", "failed health check")
+		}
+		p.mu.Unlock()
+		pq.q.Close()
+	}
+}
+
+// Stats returns a snapshot of the pool's counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Ready = len(p.ready)
+	stats.Warming = p.warming
+	return stats
+}
+
+// Close stops every ready process and every process still serving a query,
+// including those Query started itself on a miss, and waits for them and
+// for background work to stop. The message streams of unfinished queries
+// end early.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	processes := make([]*queryHandler, 0, len(p.ready)+len(p.borrowed))
+	for _, pq := range p.ready {
+		processes = append(processes, pq.q)
+	}
+	for q := range p.borrowed {
+		processes = append(processes, q)
+	}
+	p.ready = nil
+	p.mu.Unlock()
+
+	for _, q := range processes {
+		q.Close()
+	}
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
+
+// OptionsFingerprint returns a stable hash of the CLI command, environment
+// and working directory options produce, together with the shape of their
+// hooks, agents and permission callback. Options with equal fingerprints can
+// share a Pool; callback functions themselves are only compared by presence.
+func OptionsFingerprint(options *ClaudeAgentOptions) (string, error) {
+	t, err := NewSubprocessCLITransport("", options, "")
+	if err != nil {
+		return "", err
+	}
+	args, err := t.buildCommand()
+	if err != nil {
+		return "", err
+	}
+	options = t.options
+
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+	write(t.cliPath, t.cwd)
+	write(args...)
+	write(t.buildEnv()...)
+	if options.User != nil {
+		write("user", *options.User)
+	}
+	limits, _ := json.Marshal(options.ResourceLimits)
+	agents, _ := json.Marshal(convertAgentsToDicts(options.Agents))
+	write(string(limits), string(agents))
+	write(
+		strconv.FormatBool(options.CanUseTool != nil),
+		strconv.FormatBool(options.CommandLauncher != nil),
+		strconv.Itoa(len(options.TransportMiddleware)),
+	)
+	for _, event := range sortedKeys(options.Hooks) {
+		for _, matcher := range options.Hooks[event] {
+			write(string(event), matcher.Matcher, strconv.Itoa(len(matcher.Hooks)))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
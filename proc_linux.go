@@ -0,0 +1,22 @@
+//go:build linux
+
+package claude
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessAttributes places the CLI in its own process group so the
+// whole tree (MCP stdio servers, Bash tool processes) can be signaled at once,
+// and asks the kernel to kill the CLI if the SDK's process dies.
+//
+// Pdeathsig fires when the OS thread that started the child exits, not the
+// whole process, so it is a safety net rather than a guarantee.
+func configureProcessAttributes(cmd *exec.Cmd, newProcessGroup bool) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = newProcessGroup
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package claude
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessAttributes is a no-op on platforms without process groups.
+func configureProcessAttributes(cmd *exec.Cmd, newProcessGroup bool) {}
+
+// signalProcessTree terminates the CLI. Platforms without POSIX signals
+// cannot deliver SIGTERM, so every signal results in Process.Kill.
+func signalProcessTree(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	err := cmd.Process.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// platformSignalName falls back to the signal's description.
+func platformSignalName(sig syscall.Signal) string {
+	return sig.String()
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package claude
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// signalProcessTree sends sig to the CLI and, when it leads its own process
+// group, to every process in that group. A group that no longer exists is not
+// an error.
+func signalProcessTree(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		err := syscall.Kill(-cmd.Process.Pid, sig)
+		if err == nil || errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		// Fall back to signaling the leader only
+	}
+
+	err := cmd.Process.Signal(sig)
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// platformSignalName names Unix-only signals not handled by signalName.
+func platformSignalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGXCPU:
+		return "SIGXCPU"
+	case syscall.SIGXFSZ:
+		return "SIGXFSZ"
+	case syscall.SIGUSR1:
+		return "SIGUSR1"
+	case syscall.SIGUSR2:
+		return "SIGUSR2"
+	default:
+		return sig.String()
+	}
+}
@@ -0,0 +1,17 @@
+//go:build unix && !linux
+
+package claude
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessAttributes places the CLI in its own process group so the
+// whole tree (MCP stdio servers, Bash tool processes) can be signaled at once.
+func configureProcessAttributes(cmd *exec.Cmd, newProcessGroup bool) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = newProcessGroup
+}
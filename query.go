@@ -3,7 +3,6 @@ package claude
 import (
 	"context"
 	"encoding/json"
-	"os"
 )
 
 // Query performs a one-shot or unidirectional streaming query to Claude Code.
@@ -45,7 +44,6 @@ func Query(
 	options *ClaudeAgentOptions,
 	trans Transport,
 ) (<-chan Message, <-chan error, error) {
-	os.Setenv("CLAUDE_CODE_ENTRYPOINT", "sdk-go")
 	return processQuery(ctx, prompt, options, trans)
 }
 
@@ -74,7 +72,6 @@ func QueryStream(
 	options *ClaudeAgentOptions,
 	trans Transport,
 ) (<-chan Message, <-chan error, error) {
-	os.Setenv("CLAUDE_CODE_ENTRYPOINT", "sdk-go")
 	return processQuery(ctx, prompts, options, trans)
 }
 
@@ -95,6 +92,10 @@ func processQuery(
 		return nil, nil, err
 	}
 
+	if err := configuredOptions.Budget.Check(ctx); err != nil {
+		return nil, nil, err
+	}
+
 	// Use provided transport or create subprocess transport
 	chosenTransport := trans
 	if chosenTransport == nil {
@@ -105,44 +106,52 @@ func processQuery(
 		}
 	}
 
-	// Connect transport
-	if err := chosenTransport.Connect(ctx); err != nil {
+	tracer := newRunTracer(configuredOptions.Tracer)
+	ctx = tracer.begin(ctx, SpanQuery)
+
+	q, err := startQuery(ctx, chosenTransport, configuredOptions, tracer)
+	if err != nil {
+		tracer.end(err)
 		return nil, nil, err
 	}
+	return runQuery(ctx, q, prompt, configuredOptions)
+}
 
-	// Extract SDK MCP servers using helper function
-	sdkMcpServers := extractSdkMcpServers(configuredOptions.McpServers)
-
-	// Convert agents to dict format for initialize request
-	agents := convertAgentsToDicts(configuredOptions.Agents)
+// startQuery connects the transport, starts routing its messages and
+// initializes the control protocol. The transport is closed on failure.
+func startQuery(ctx context.Context, trans Transport, configuredOptions *ClaudeAgentOptions, tracer *runTracer) (*queryHandler, error) {
+	trans = applyTransportMiddleware(trans, configuredOptions.TransportMiddleware)
 
-	// Determine buffer size
-	bufferSize := 100 // default
-	if configuredOptions.MessageChannelBufferSize != nil && *configuredOptions.MessageChannelBufferSize > 0 {
-		bufferSize = *configuredOptions.MessageChannelBufferSize
+	// Connect transport
+	if err := trans.Connect(ctx); err != nil {
+		return nil, err
 	}
 
 	// Create queryHandler to handle control protocol (always streaming)
-	q := newQueryHandler(
-		chosenTransport,
-		true, // Always streaming mode
-		configuredOptions.CanUseTool,
-		configuredOptions.Hooks,
-		sdkMcpServers,
-		agents,
-		bufferSize,
-	)
+	q := newQueryHandler(trans, configuredOptions, tracer)
 
 	// Start reading messages
 	if err := q.Start(ctx); err != nil {
-		return nil, nil, err
+		q.Close()
+		return nil, err
 	}
 
 	// Initialize via control protocol
 	if _, err := q.Initialize(ctx); err != nil {
-		return nil, nil, err
+		q.Close()
+		return nil, err
 	}
+	return q, nil
+}
 
+// runQuery sends prompt over an initialized query and streams the parsed
+// messages. The query is closed when the stream ends.
+func runQuery(
+	ctx context.Context,
+	q *queryHandler,
+	prompt interface{}, // string or <-chan map[string]interface{}
+	configuredOptions *ClaudeAgentOptions,
+) (<-chan Message, <-chan error, error) {
 	// Handle input based on prompt type
 	if promptChan, ok := prompt.(<-chan map[string]interface{}); ok {
 		// Channel prompt: stream messages in background
@@ -161,21 +170,24 @@ func processQuery(
 			"session_id":         "default",
 		}
 		data, _ := json.Marshal(message)
-		if err := chosenTransport.Write(ctx, string(data)+"\n"); err != nil {
+		if err := q.transport.Write(ctx, string(data)+"\n"); err != nil {
+			q.Close()
+			q.tracer.end(err)
 			return nil, nil, err
 		}
 		// For string prompts, we need to wait for result before ending input
-		// if there are hooks or MCP servers that need bidirectional communication
+		// if there are hooks, MCP servers or a permission callback that need
+		// bidirectional communication, or a budget that may interrupt
 		go func() {
 			hasHooks := len(configuredOptions.Hooks) > 0
-			if len(sdkMcpServers) > 0 || hasHooks {
+			if len(q.sdkMcpServers) > 0 || hasHooks || configuredOptions.CanUseTool != nil || configuredOptions.Budget != nil {
 				select {
 				case <-q.firstResultChan:
 				case <-ctx.Done():
 					return
 				}
 			}
-			chosenTransport.EndInput()
+			q.transport.EndInput()
 		}()
 	}
 
@@ -185,33 +197,47 @@ func processQuery(
 
 	// Parse and yield messages
 	go func() {
+		var runErr error
+		fail := func(err error) {
+			runErr = err
+			errCh <- err
+		}
 		defer close(msgCh)
 		defer close(errCh)
+		defer func() { q.tracer.end(runErr) }()
 		defer q.Close()
 
 		for {
 			select {
 			case <-ctx.Done():
-				errCh <- ctx.Err()
+				fail(ctx.Err())
 				return
 			case err := <-q.ReceiveErrors():
 				if err != nil {
-					errCh <- err
+					fail(err)
 					return
 				}
 			case data, ok := <-q.ReceiveMessages():
 				if !ok {
+					// Routing stopped; the error channel is closed by now
+					// and holds the reason if it failed
+					if err := <-q.ReceiveErrors(); err != nil {
+						fail(err)
+					} else if err := q.budget.exceededError(); err != nil {
+						// The turn was interrupted to stay within budget
+						fail(err)
+					}
 					return
 				}
-				msg, err := parseMessage(data)
+				msg, err := q.parse(data)
 				if err != nil {
-					errCh <- err
+					fail(err)
 					return
 				}
 				select {
 				case msgCh <- msg:
 				case <-ctx.Done():
-					errCh <- ctx.Err()
+					fail(ctx.Err())
 					return
 				}
 			}
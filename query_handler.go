@@ -5,8 +5,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,18 +18,31 @@ type queryHandler struct {
 	transport       Transport
 	isStreamingMode bool
 	canUseTool      CanUseTool
+	tracer          *runTracer
+	metrics         Metrics
+	messageMetrics  *messageMetrics
+	budget          *budgetRun
+	audit           *auditRun
+	callbacks       *callbackGuard
+	baseLogger      *slog.Logger
+	logger          atomic.Pointer[slog.Logger] // baseLogger with the session ID once known
+	sessionID       string                      // Last session ID seen by the router
 	hooks           map[string][]hookMatcherInternal
 	sdkMcpServers   map[string]interface{} // Map of server name to MCP server instance
 	agents          []map[string]interface{} // Agent definitions for initialize request
 
 	// Control protocol state
 	pendingControlResponses map[string]chan controlResult
+	incomingRequests        map[string]context.CancelCauseFunc // CLI requests being handled
 	hookCallbacks           map[string]HookCallback
+	hookTimeouts            map[string]time.Duration // From HookMatcher.Timeout
 	nextCallbackID          int
 	requestCounter          int
 	mu                      sync.Mutex
 
-	// Message streaming
+	// Message streaming. Regular messages wait in queue so the router keeps
+	// handling control traffic while the consumer is slow.
+	queue       *messageQueue
 	messageChan chan map[string]interface{}
 	errorChan   chan error
 	cancelFunc  context.CancelFunc
@@ -36,6 +52,9 @@ type queryHandler struct {
 	// Track first result for proper stream closure with SDK MCP servers
 	firstResultChan chan struct{}
 	firstResultOnce sync.Once
+
+	// Closed when message routing stops (transport finished or failed)
+	done chan struct{}
 }
 
 type controlResult struct {
@@ -43,37 +62,66 @@ type controlResult struct {
 	err      error
 }
 
-// New creates a new queryHandler instance.
-func newQueryHandler(
-	transport Transport,
-	isStreamingMode bool,
-	canUseTool CanUseTool,
-	hooks map[HookEvent][]HookMatcher,
-	sdkMcpServers map[string]interface{},
-	agents []map[string]interface{},
-	bufferSize int,
-) *queryHandler {
-	// Convert hooks to internal format using helper function
-	internalHooks := convertHooksToInternal(hooks)
+// newQueryHandler creates a queryHandler speaking the control protocol over
+// transport, configured by options. tracer may be nil.
+func newQueryHandler(transport Transport, options *ClaudeAgentOptions, tracer *runTracer) *queryHandler {
+	metrics := options.Metrics
+	if metrics == nil {
+		metrics = NopMetrics
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = discardLogger
+	}
 
 	// Use default buffer size if not specified or invalid
-	if bufferSize <= 0 {
-		bufferSize = 100
+	bufferSize := 100
+	if options.MessageChannelBufferSize != nil && *options.MessageChannelBufferSize > 0 {
+		bufferSize = *options.MessageChannelBufferSize
 	}
 
-	return &queryHandler{
+	q := &queryHandler{
 		transport:               transport,
-		isStreamingMode:         isStreamingMode,
-		canUseTool:              canUseTool,
-		hooks:                   internalHooks,
-		sdkMcpServers:           sdkMcpServers,
-		agents:                  agents,
+		isStreamingMode:         true, // Query and ClaudeSDKClient always stream
+		canUseTool:              options.CanUseTool,
+		tracer:                  tracer,
+		metrics:                 metrics,
+		messageMetrics:          &messageMetrics{metrics: metrics},
+		baseLogger:              logger,
+		hooks:                   convertHooksToInternal(options.Hooks),
+		sdkMcpServers:           extractSdkMcpServers(options.McpServers),
+		agents:                  convertAgentsToDicts(options.Agents),
 		pendingControlResponses: make(map[string]chan controlResult),
+		incomingRequests:        make(map[string]context.CancelCauseFunc),
 		hookCallbacks:           make(map[string]HookCallback),
-		messageChan:             make(chan map[string]interface{}, bufferSize),
+		hookTimeouts:            make(map[string]time.Duration),
+		queue:                   newMessageQueue(bufferSize, options.StreamEventOverflow, options.PipelineMetrics),
+		messageChan:             make(chan map[string]interface{}),
 		errorChan:               make(chan error, 1),
 		firstResultChan:         make(chan struct{}),
+		done:                    make(chan struct{}),
+	}
+	q.logger.Store(logger)
+	q.budget = newBudgetRun(options.Budget, q.log)
+	q.audit = newAuditRun(options.Auditor, q.log)
+	q.callbacks = newCallbackGuard(options.CallbackLimits, q.log)
+	return q
+}
+
+// log returns the logger, carrying the session ID once the CLI reported it.
+func (q *queryHandler) log() *slog.Logger {
+	return q.logger.Load()
+}
+
+// observeSession adds the session ID of msg to the logger when it changes.
+// Only the router goroutine calls it.
+func (q *queryHandler) observeSession(msg map[string]interface{}) {
+	sessionID, _ := msg["session_id"].(string)
+	if sessionID == "" || sessionID == q.sessionID {
+		return
 	}
+	q.sessionID = sessionID
+	q.logger.Store(q.baseLogger.With("session_id", sessionID))
 }
 
 // Start begins reading messages from transport.
@@ -83,15 +131,19 @@ func (q *queryHandler) Start(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	q.cancelFunc = cancel
 
-	// Start message router
+	// Start message router and delivery to the consumer
 	go q.routeMessages(ctx, msgCh, errCh)
+	go q.deliverMessages(ctx)
 
 	return nil
 }
 
 // routeMessages reads from transport and routes control vs regular messages.
+// It never waits for the consumer, unless the backlog reaches its limit, so
+// control requests are answered however slowly messages are received.
 func (q *queryHandler) routeMessages(ctx context.Context, msgCh <-chan map[string]interface{}, errCh <-chan error) {
-	defer close(q.messageChan)
+	defer close(q.done)
+	defer q.queue.close()
 	defer close(q.errorChan)
 
 	for {
@@ -99,21 +151,28 @@ func (q *queryHandler) routeMessages(ctx context.Context, msgCh <-chan map[strin
 		case <-ctx.Done():
 			return
 		case err := <-errCh:
-			if err != nil {
-				// Signal all pending control requests so they fail fast instead of timing out
-				q.mu.Lock()
-				for _, resultChan := range q.pendingControlResponses {
-					select {
-					case resultChan <- controlResult{err: err}:
-						// Successfully sent error to this pending request
-					default:
-						// Channel already has a result, skip
-					}
-				}
-				q.mu.Unlock()
+			if err == nil {
+				// The transport finished cleanly; keep routing until every
+				// buffered message has been delivered
+				errCh = nil
+				continue
+			}
+
+			q.log().Error("claude: transport failed", "error", err)
 
-				q.errorChan <- err
+			// Signal all pending control requests so they fail fast instead of timing out
+			q.mu.Lock()
+			for _, resultChan := range q.pendingControlResponses {
+				select {
+				case resultChan <- controlResult{err: err}:
+					// Successfully sent error to this pending request
+				default:
+					// Channel already has a result, skip
+				}
 			}
+			q.mu.Unlock()
+
+			q.errorChan <- err
 			return
 		case msg, ok := <-msgCh:
 			if !ok {
@@ -121,14 +180,17 @@ func (q *queryHandler) routeMessages(ctx context.Context, msgCh <-chan map[strin
 			}
 
 			msgType, _ := msg["type"].(string)
+			q.observeSession(msg)
 
 			switch msgType {
 			case "control_response":
 				q.handleControlResponse(msg)
 			case "control_request":
-				go q.handleControlRequest(ctx, msg)
+				requestID, _ := msg["request_id"].(string)
+				go q.handleControlRequest(q.trackRequest(ctx, requestID), msg)
 			case "control_cancel_request":
-				// TODO: Implement cancellation
+				requestID, _ := msg["request_id"].(string)
+				q.cancelRequest(requestID)
 			default:
 				// Track results for proper stream closure
 				if msgType == "result" {
@@ -138,9 +200,19 @@ func (q *queryHandler) routeMessages(ctx context.Context, msgCh <-chan map[strin
 				}
 
 				// Regular SDK message
-				select {
-				case q.messageChan <- msg:
-				case <-ctx.Done():
+				q.tracer.observe(msg)
+				q.messageMetrics.observe(msg)
+				q.audit.observe(ctx, msg)
+				if exceeded := q.budget.observe(ctx, msg); exceeded != nil {
+					q.log().Warn("claude: budget would be exceeded, interrupting turn",
+						"key", exceeded.Key, "cost_usd", exceeded.Usage.CostUSD, "tokens", exceeded.Usage.Tokens())
+					go func() {
+						if err := q.Interrupt(ctx); err != nil {
+							q.log().Error("claude: failed to interrupt turn over budget", "error", err)
+						}
+					}()
+				}
+				if err := q.queue.push(ctx, msg); err != nil {
 					return
 				}
 			}
@@ -148,6 +220,33 @@ func (q *queryHandler) routeMessages(ctx context.Context, msgCh <-chan map[strin
 	}
 }
 
+// deliverMessages hands queued messages to the consumer until routing stops
+// and the queue is drained.
+func (q *queryHandler) deliverMessages(ctx context.Context) {
+	defer close(q.messageChan)
+
+	for {
+		msg, ok := q.queue.pop(ctx)
+		if !ok {
+			return
+		}
+		select {
+		case q.messageChan <- msg:
+			q.queue.delivered()
+		case <-ctx.Done():
+			q.queue.delivered()
+			return
+		}
+	}
+}
+
+// pendingMessages returns the number of messages the consumer has not
+// received yet. messageChan is unbuffered, so they are all in the queue or
+// held by deliverMessages.
+func (q *queryHandler) pendingMessages() int {
+	return q.queue.pending()
+}
+
 // Initialize sends initialization request (streaming mode only).
 func (q *queryHandler) Initialize(ctx context.Context) (map[string]interface{}, error) {
 	if !q.isStreamingMode {
@@ -157,7 +256,9 @@ func (q *queryHandler) Initialize(ctx context.Context) (map[string]interface{},
 	// Build hooks configuration
 	hooksConfig := make(map[string]interface{})
 	if len(q.hooks) > 0 {
-		for event, matchers := range q.hooks {
+		// Sort events so callback IDs are stable across runs
+		for _, event := range sortedKeys(q.hooks) {
+			matchers := q.hooks[event]
 			if len(matchers) == 0 {
 				continue
 			}
@@ -169,6 +270,9 @@ func (q *queryHandler) Initialize(ctx context.Context) (map[string]interface{},
 					callbackID := fmt.Sprintf("hook_%d", q.nextCallbackID)
 					q.nextCallbackID++
 					q.hookCallbacks[callbackID] = callback
+					if matcher.Timeout != nil {
+						q.hookTimeouts[callbackID] = time.Duration(*matcher.Timeout * float64(time.Second))
+					}
 					callbackIDs[j] = callbackID
 				}
 
@@ -206,11 +310,15 @@ func (q *queryHandler) Initialize(ctx context.Context) (map[string]interface{},
 }
 
 // sendControlRequest sends a control request and waits for response.
-func (q *queryHandler) sendControlRequest(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
+func (q *queryHandler) sendControlRequest(ctx context.Context, request map[string]interface{}) (response map[string]interface{}, err error) {
 	if !q.isStreamingMode {
 		return nil, fmt.Errorf("control requests require streaming mode")
 	}
 
+	subtype, _ := request["subtype"].(string)
+	ctx, span := q.tracer.start(ctx, SpanControlRequest, "", Attribute{AttrControlSubtype, subtype})
+	defer func() { finishSpan(span, err) }()
+
 	q.mu.Lock()
 	q.requestCounter++
 	requestID := fmt.Sprintf("req_%d_%s", q.requestCounter, randomHex(4))
@@ -231,12 +339,16 @@ func (q *queryHandler) sendControlRequest(ctx context.Context, request map[strin
 		"request":    request,
 	}
 
+	logger := q.log().With("request_id", requestID, "subtype", subtype)
 	data, err := json.Marshal(controlRequest)
 	if err != nil {
+		logger.Error("claude: failed to encode control request", "error", err)
 		return nil, err
 	}
 
+	logger.Debug("claude: sending control request")
 	if err := q.transport.Write(ctx, string(data)+"\n"); err != nil {
+		logger.Error("claude: failed to send control request", "error", err)
 		return nil, err
 	}
 
@@ -247,10 +359,16 @@ func (q *queryHandler) sendControlRequest(ctx context.Context, request map[strin
 	select {
 	case result := <-resultChan:
 		if result.err != nil {
+			logger.Warn("claude: control request failed", "error", result.err)
 			return nil, result.err
 		}
+		logger.Debug("claude: control request succeeded")
 		return result.response, nil
 	case <-timeoutCtx.Done():
+		if ctx.Err() == nil {
+			q.metrics.Add(MetricControlTimeouts, 1, Labels{LabelSubtype: subtype})
+			logger.Warn("claude: control request timed out")
+		}
 		return nil, fmt.Errorf("control request timeout: %s", request["subtype"])
 	}
 }
@@ -264,6 +382,7 @@ func (q *queryHandler) handleControlResponse(msg map[string]interface{}) {
 
 	requestID, ok := response["request_id"].(string)
 	if !ok {
+		q.log().Warn("claude: control response without a request ID")
 		return
 	}
 
@@ -272,6 +391,7 @@ func (q *queryHandler) handleControlResponse(msg map[string]interface{}) {
 	q.mu.Unlock()
 
 	if !exists {
+		q.log().Debug("claude: control response for an unknown request", "request_id", requestID)
 		return
 	}
 
@@ -290,6 +410,10 @@ func (q *queryHandler) handleControlRequest(ctx context.Context, msg map[string]
 	requestID, _ := msg["request_id"].(string)
 	request, _ := msg["request"].(map[string]interface{})
 	subtype, _ := request["subtype"].(string)
+	defer q.untrackRequest(requestID)
+
+	logger := q.log().With("request_id", requestID, "subtype", subtype)
+	logger.Debug("claude: received control request")
 
 	var responseData map[string]interface{}
 	var err error
@@ -305,9 +429,22 @@ func (q *queryHandler) handleControlRequest(ctx context.Context, msg map[string]
 		err = fmt.Errorf("unsupported control request subtype: %s", subtype)
 	}
 
+	// Record the decision before the CLI acts on it
+	if auditErr := q.audit.control(ctx, subtype, request, responseData, err); auditErr != nil {
+		logger.Error("claude: failed to record audit entry", "error", auditErr)
+		responseData, err = nil, auditErr
+	}
+
+	// The CLI no longer waits for a response to a cancelled request
+	if context.Cause(ctx) == errControlRequestCancelled {
+		logger.Debug("claude: control request cancelled by the CLI")
+		return
+	}
+
 	// Send response
 	var controlResponse map[string]interface{}
 	if err != nil {
+		logger.Warn("claude: control request handler failed", "error", err)
 		controlResponse = map[string]interface{}{
 			"type": "control_response",
 			"response": map[string]interface{}{
@@ -327,8 +464,55 @@ func (q *queryHandler) handleControlRequest(ctx context.Context, msg map[string]
 		}
 	}
 
-	data, _ := json.Marshal(controlResponse)
-	q.transport.Write(ctx, string(data)+"\n")
+	data, err := json.Marshal(controlResponse)
+	if err != nil {
+		logger.Error("claude: failed to encode control response", "error", err)
+		return
+	}
+	if err := q.transport.Write(ctx, string(data)+"\n"); err != nil {
+		logger.Error("claude: failed to send control response", "error", err)
+	}
+}
+
+// errControlRequestCancelled is the cancellation cause of a control request
+// the CLI cancelled.
+var errControlRequestCancelled = errors.New("control request cancelled by the CLI")
+
+// trackRequest returns the context for handling the CLI's control request
+// requestID, cancelled if the CLI sends a control_cancel_request for it.
+// Only the router goroutine calls it, so a cancel request always finds the
+// request it follows.
+func (q *queryHandler) trackRequest(ctx context.Context, requestID string) context.Context {
+	ctx, cancel := context.WithCancelCause(ctx)
+	q.mu.Lock()
+	q.incomingRequests[requestID] = cancel
+	q.mu.Unlock()
+	return ctx
+}
+
+// untrackRequest forgets a handled control request.
+func (q *queryHandler) untrackRequest(requestID string) {
+	q.mu.Lock()
+	cancel, ok := q.incomingRequests[requestID]
+	delete(q.incomingRequests, requestID)
+	q.mu.Unlock()
+	if ok {
+		cancel(nil)
+	}
+}
+
+// cancelRequest cancels the context of the control request the CLI gave up
+// on, such as a permission prompt for an interrupted turn.
+func (q *queryHandler) cancelRequest(requestID string) {
+	q.mu.Lock()
+	cancel, ok := q.incomingRequests[requestID]
+	q.mu.Unlock()
+	if !ok {
+		q.log().Debug("claude: control cancel request for unknown request", "request_id", requestID)
+		return
+	}
+	q.log().Debug("claude: cancelling control request", "request_id", requestID)
+	cancel(errControlRequestCancelled)
 }
 
 // handleCanUseTool processes tool permission requests.
@@ -338,6 +522,7 @@ func (q *queryHandler) handleCanUseTool(ctx context.Context, request map[string]
 	}
 
 	toolName, _ := request["tool_name"].(string)
+	toolUseID, _ := request["tool_use_id"].(string)
 	originalInput, _ := request["input"].(map[string]interface{})
 	suggestions, _ := request["permission_suggestions"].([]interface{})
 
@@ -354,10 +539,30 @@ func (q *queryHandler) handleCanUseTool(ctx context.Context, request map[string]
 		Suggestions: permSuggestions,
 	}
 
-	result, err := q.canUseTool(ctx, toolName, originalInput, permCtx)
+	ctx, span := q.tracer.start(ctx, SpanCanUseTool, toolUseID, Attribute{AttrToolName, toolName})
+	value, err := q.callbacks.run(ctx, "can_use_tool "+toolName, 0, func(ctx context.Context) (interface{}, error) {
+		return q.canUseTool(ctx, toolName, originalInput, permCtx)
+	})
+	result, _ := value.(PermissionResult)
 	if err != nil {
+		q.metrics.Add(MetricPermissionDecisions, 1, Labels{LabelTool: toolName, LabelBehavior: "error"})
+		finishSpan(span, err)
 		return nil, err
 	}
+	behavior := "error"
+	switch result.(type) {
+	case PermissionResultAllow:
+		behavior = "allow"
+	case PermissionResultDeny:
+		behavior = "deny"
+	case PermissionResultAsk:
+		behavior = "ask"
+	}
+	q.metrics.Add(MetricPermissionDecisions, 1, Labels{LabelTool: toolName, LabelBehavior: behavior})
+	if span != nil {
+		span.SetAttributes(Attribute{AttrPermissionBehavior, behavior})
+		span.End(nil)
+	}
 
 	// Convert result to response format matching Python SDK
 	switch r := result.(type) {
@@ -385,6 +590,16 @@ func (q *queryHandler) handleCanUseTool(ctx context.Context, request map[string]
 			response["interrupt"] = r.Interrupt
 		}
 		return response, nil
+	case PermissionResultAsk:
+		// The CLI has no ask response; Claude asks the user in the conversation
+		message := "This tool use needs the user's confirmation. Ask the user before retrying."
+		if r.Message != "" {
+			message = r.Message + "\n\n" + message
+		}
+		return map[string]interface{}{
+			"behavior": "deny",
+			"message":  message,
+		}, nil
 	default:
 		return nil, fmt.Errorf("invalid permission result type")
 	}
@@ -405,8 +620,22 @@ func (q *queryHandler) handleHookCallback(ctx context.Context, request map[strin
 		return nil, fmt.Errorf("no hook callback found for ID: %s", callbackID)
 	}
 
+	hookEvent, _ := input["hook_event_name"].(string)
+	spanToolUseID := ""
+	if toolUseID != nil {
+		spanToolUseID = *toolUseID
+	}
+	ctx, span := q.tracer.start(ctx, SpanHook, spanToolUseID,
+		Attribute{AttrHookEvent, hookEvent}, Attribute{AttrHookCallbackID, callbackID})
+
 	hookCtx := HookContext{}
-	result, err := callback(ctx, input, toolUseID, hookCtx)
+	start := time.Now()
+	value, err := q.callbacks.run(ctx, fmt.Sprintf("%s hook %s", hookEvent, callbackID), q.hookTimeouts[callbackID], func(ctx context.Context) (interface{}, error) {
+		return callback(ctx, input, toolUseID, hookCtx)
+	})
+	result, _ := value.(HookJSONOutput)
+	q.metrics.Observe(MetricHookDuration, since(start), Labels{LabelEvent: hookEvent})
+	finishSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -448,11 +677,40 @@ func (q *queryHandler) handleMcpMessage(ctx context.Context, request map[string]
 		}, nil
 	}
 
-	// Route MCP request to server
-	response := q.routeMcpRequest(ctx, server, message)
+	// Route MCP request to server, tracing tool calls and guarding the
+	// tool's handler
+	if message["method"] != "tools/call" {
+		return map[string]interface{}{"mcp_response": q.routeMcpRequest(ctx, server, message)}, nil
+	}
+	params, _ := message["params"].(map[string]interface{})
+	toolName, _ := params["name"].(string)
+	ctx, span := q.tracer.start(ctx, SpanMCPToolCall, "",
+		Attribute{AttrMCPServer, serverName}, Attribute{AttrToolName, toolName})
+	value, err := q.callbacks.run(ctx, fmt.Sprintf("mcp tool %s/%s", serverName, toolName), 0, func(ctx context.Context) (interface{}, error) {
+		return q.routeMcpRequest(ctx, server, message), nil
+	})
+	if err != nil {
+		finishSpan(span, err)
+		return nil, err
+	}
+	response, _ := value.(map[string]interface{})
+	finishSpan(span, mcpToolCallError(response))
 	return map[string]interface{}{"mcp_response": response}, nil
 }
 
+// mcpToolCallError returns the error a tools/call response reports, if any.
+func mcpToolCallError(response map[string]interface{}) error {
+	if rpcErr, ok := response["error"].(map[string]interface{}); ok {
+		return fmt.Errorf("%v", rpcErr["message"])
+	}
+	if result, ok := response["result"].(map[string]interface{}); ok {
+		if isError, _ := result["isError"].(bool); isError {
+			return fmt.Errorf("tool returned an error")
+		}
+	}
+	return nil
+}
+
 // routeMcpRequest routes JSONRPC requests to MCP server.
 func (q *queryHandler) routeMcpRequest(ctx context.Context, server interface{}, message map[string]interface{}) map[string]interface{} {
 	// Check if it's an SDK MCP server
@@ -572,6 +830,17 @@ func (q *queryHandler) ReceiveMessages() <-chan map[string]interface{} {
 	return q.messageChan
 }
 
+// parse parses a message received from ReceiveMessages, counting failures.
+func (q *queryHandler) parse(data map[string]interface{}) (Message, error) {
+	msg, err := parseMessage(data)
+	if err != nil {
+		q.metrics.Add(MetricParseErrors, 1, nil)
+		msgType, _ := data["type"].(string)
+		q.log().Error("claude: failed to parse message", "type", msgType, "error", err)
+	}
+	return msg, err
+}
+
 // ReceiveErrors returns a channel for receiving errors.
 func (q *queryHandler) ReceiveErrors() <-chan error {
 	return q.errorChan
@@ -584,6 +853,7 @@ func (q *queryHandler) GetInitResult() map[string]interface{} {
 
 // Close closes the query and transport.
 func (q *queryHandler) Close() error {
+	q.budget.finish()
 	if q.cancelFunc != nil {
 		q.cancelFunc()
 	}
@@ -1,22 +1,41 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"time"
 )
 
-const (
-	cliVersion = "2.0.56"
-	installURL = "https://claude.ai/install.sh"
-)
+const installURL = "https://claude.ai/install.sh"
+
+// cliVersion is read from BundledCLIVersion in cli_version.go so the two
+// cannot drift apart.
+var cliVersion string
+
+// manifest is written to _bundled/manifest.json. The SDK only runs a bundled
+// binary whose SHA-256 matches the one recorded here.
+type manifest struct {
+	Version  string            `json:"version"`
+	Binaries map[string]string `json:"binaries"`
+}
 
 func main() {
+	version, err := readBundledVersion(filepath.Join("..", "cli_version.go"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading BundledCLIVersion: %v\n", err)
+		os.Exit(1)
+	}
+	cliVersion = version
+
 	fmt.Println("=" + string(make([]byte, 60)))
 	fmt.Println("Claude Code CLI Download Script")
 	fmt.Printf("Downloading CLI version: %s\n", cliVersion)
@@ -43,7 +62,7 @@ func main() {
 	fmt.Println("\nNote: For a complete multi-platform build, you need to:")
 	fmt.Println("1. Run this script on each target platform (macOS, Linux, Windows)")
 	fmt.Println("2. Or use a CI/CD system to build binaries for all platforms")
-	fmt.Println("3. Copy all binaries to the _bundled/ directory")
+	fmt.Println("3. Copy all binaries and a merged manifest.json to the _bundled/ directory")
 }
 
 func downloadForCurrentPlatform(bundledDir string) error {
@@ -149,6 +168,10 @@ func downloadForCurrentPlatform(bundledDir string) error {
 		return fmt.Errorf("failed to copy CLI: %w", err)
 	}
 
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to write CLI: %w", err)
+	}
+
 	// Print size info
 	info, err := os.Stat(targetPath)
 	if err == nil {
@@ -156,9 +179,66 @@ func downloadForCurrentPlatform(bundledDir string) error {
 		fmt.Printf("Binary size: %.2f MB\n", sizeMB)
 	}
 
+	// Record the checksum the SDK verifies before running the binary
+	sum, err := fileSHA256(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum CLI: %w", err)
+	}
+	fmt.Printf("SHA-256: %s\n", sum)
+	return recordChecksum(bundledDir, binaryName, sum)
+}
+
+// readBundledVersion extracts BundledCLIVersion from cli_version.go.
+func readBundledVersion(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	match := regexp.MustCompile(`BundledCLIVersion = "([^"]+)"`).FindSubmatch(data)
+	if match == nil {
+		return "", fmt.Errorf("BundledCLIVersion not found in %s", path)
+	}
+	return string(match[1]), nil
+}
+
+// recordChecksum adds binaryName to the manifest, keeping checksums of other
+// platforms recorded for the same version.
+func recordChecksum(bundledDir, binaryName, sum string) error {
+	path := filepath.Join(bundledDir, "manifest.json")
+
+	m := manifest{Version: cliVersion, Binaries: map[string]string{}}
+	if data, err := os.ReadFile(path); err == nil {
+		var existing manifest
+		if json.Unmarshal(data, &existing) == nil && existing.Version == cliVersion && existing.Binaries != nil {
+			m.Binaries = existing.Binaries
+		}
+	}
+	m.Binaries[binaryName] = sum
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	fmt.Printf("Recorded checksum in: %s\n", path)
 	return nil
 }
 
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func findInstalledCLI() (string, error) {
 	// Check common installation locations
 	locations := []string{
@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	defaultStderrTailLines = 50
+	maxStderrLineLength    = 4096
+)
+
+// stderrRingBuffer keeps the last N lines of CLI stderr output.
+// It is safe for concurrent use.
+type stderrRingBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// newStderrRingBuffer creates a ring buffer holding up to size lines.
+func newStderrRingBuffer(size int) *stderrRingBuffer {
+	if size <= 0 {
+		size = defaultStderrTailLines
+	}
+	return &stderrRingBuffer{lines: make([]string, size)}
+}
+
+// Add appends a line, evicting the oldest line when the buffer is full.
+// Lines longer than maxStderrLineLength are truncated.
+func (b *stderrRingBuffer) Add(line string) {
+	if len(line) > maxStderrLineLength {
+		line = line[:maxStderrLineLength] + "..."
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns the buffered lines, oldest first.
+func (b *stderrRingBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	result := make([]string, 0, len(b.lines))
+	result = append(result, b.lines[b.next:]...)
+	result = append(result, b.lines[:b.next]...)
+	return result
+}
+
+// String returns the buffered lines joined by newlines.
+func (b *stderrRingBuffer) String() string {
+	return strings.Join(b.Lines(), "\n")
+}
+
+// signalName returns the conventional name of a signal (e.g. "SIGKILL").
+func signalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGHUP:
+		return "SIGHUP"
+	case syscall.SIGINT:
+		return "SIGINT"
+	case syscall.SIGQUIT:
+		return "SIGQUIT"
+	case syscall.SIGILL:
+		return "SIGILL"
+	case syscall.SIGABRT:
+		return "SIGABRT"
+	case syscall.SIGBUS:
+		return "SIGBUS"
+	case syscall.SIGKILL:
+		return "SIGKILL"
+	case syscall.SIGSEGV:
+		return "SIGSEGV"
+	case syscall.SIGPIPE:
+		return "SIGPIPE"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	default:
+		return platformSignalName(sig)
+	}
+}
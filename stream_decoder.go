@@ -0,0 +1,82 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// streamDecoder accumulates lines of CLI stdout into JSON objects. A JSON
+// object may be split across several lines; lines are concatenated until
+// they parse.
+type streamDecoder struct {
+	maxBufferSize int
+	buffer        strings.Builder
+}
+
+func newStreamDecoder(maxBufferSize int) *streamDecoder {
+	return &streamDecoder{maxBufferSize: maxBufferSize}
+}
+
+// decodeLine adds a line of stdout and returns the objects it completed.
+func (d *streamDecoder) decodeLine(line string) ([]map[string]interface{}, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, nil
+	}
+
+	var messages []map[string]interface{}
+
+	// Split by newlines (in case multiple JSON objects on one line)
+	for _, jsonLine := range strings.Split(line, "\n") {
+		jsonLine = strings.TrimSpace(jsonLine)
+		if jsonLine == "" {
+			continue
+		}
+
+		// Accumulate partial JSON using strings.Builder for efficiency
+		d.buffer.WriteString(jsonLine)
+
+		if d.buffer.Len() > d.maxBufferSize {
+			return messages, NewCLIJSONDecodeError(
+				fmt.Sprintf("JSON message exceeded maximum buffer size of %d bytes", d.maxBufferSize),
+				fmt.Errorf("buffer size %d exceeds limit %d", d.buffer.Len(), d.maxBufferSize),
+			)
+		}
+
+		// Try to parse
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(d.buffer.String()), &data); err == nil {
+			// Successfully parsed; a bare null carries no message
+			d.buffer.Reset()
+			if data != nil {
+				messages = append(messages, data)
+			}
+		}
+		// If parse fails, keep accumulating
+	}
+	return messages, nil
+}
+
+// DecodeStreamJSON decodes CLI stdout the way SubprocessCLITransport does.
+// This is exported for testing purposes.
+func DecodeStreamJSON(r io.Reader, maxBufferSize int) ([]map[string]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBufferSize)
+
+	decoder := newStreamDecoder(maxBufferSize)
+	var messages []map[string]interface{}
+	for scanner.Scan() {
+		decoded, err := decoder.decodeLine(scanner.Text())
+		messages = append(messages, decoded...)
+		if err != nil {
+			return messages, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return messages, NewCLIConnectionError("error reading from stdout", err)
+	}
+	return messages, nil
+}
@@ -0,0 +1,424 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// recordEnv opts in to the recording tests. They make API calls and rewrite
+// files under tests/unit/testdata, so they never run as part of the normal
+// e2e suite:
+//
+//	CLAUDE_SDK_RECORD=1 go test ./tests/e2e/ -run TestRecord -v
+const recordEnv = "CLAUDE_SDK_RECORD"
+
+// RequireRecording skips the test unless recording was requested and the CLI
+// is available.
+func RequireRecording(t *testing.T) {
+	t.Helper()
+	RequireClaudeCode(t)
+	if os.Getenv(recordEnv) != "1" {
+		t.Skipf("Set %s=1 to record fixtures from the CLI", recordEnv)
+	}
+}
+
+// cliVersion returns the version of the claude on PATH, used to name
+// recordings.
+func cliVersion(t *testing.T) string {
+	t.Helper()
+	out, err := exec.Command("claude", "-v").Output()
+	if err != nil {
+		t.Fatalf("Failed to get CLI version: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		t.Fatalf("Unexpected CLI version output %q", out)
+	}
+	return fields[0]
+}
+
+// scrubber replaces values that identify the machine, the account or the
+// session with placeholders. A value always maps to the same placeholder, so
+// references between frames (session_id, tool_use_id, request_id) still line
+// up after scrubbing.
+type scrubber struct {
+	paths  [][2]string // real path, placeholder; longest first
+	ids    map[string]string
+	counts map[string]int
+}
+
+// Keys whose values are identifiers, and the placeholder kind for each.
+// Values that carry a type prefix (toolu_, msg_, req_) keep it.
+var scrubbedIDs = map[string]string{
+	"session_id":         "uuid",
+	"uuid":               "uuid",
+	"parent_uuid":        "uuid",
+	"request_id":         "uuid",
+	"id":                 "uuid",
+	"tool_use_id":        "uuid",
+	"parent_tool_use_id": "uuid",
+	"agent_id":           "uuid",
+}
+
+// Keys whose values are replaced outright.
+var scrubbedValues = map[string]interface{}{
+	"signature":       "scrubbed-signature",
+	"email":           "dev@example.com",
+	"account_uuid":    "00000000-0000-4000-8000-000000000000",
+	"organization":    "example-org",
+	"hostname":        "devbox",
+	"user_name":       "dev",
+	"transcript_path": "/home/dev/.claude/projects/-home-dev-project/00000000-0000-4000-8000-000000000001.jsonl",
+}
+
+// newScrubber returns a scrubber that maps cwd to /home/dev/project and the
+// user's home directory to /home/dev.
+func newScrubber(cwd string) *scrubber {
+	s := &scrubber{ids: map[string]string{}, counts: map[string]int{}}
+	add := func(real, placeholder string) {
+		if real == "" || real == "/" {
+			return
+		}
+		s.paths = append(s.paths, [2]string{real, placeholder})
+		// macOS reports temp directories through /private
+		if resolved, err := filepath.EvalSymlinks(real); err == nil && resolved != real {
+			s.paths = append(s.paths, [2]string{resolved, placeholder})
+		}
+	}
+	add(cwd, "/home/dev/project")
+	// The CLI names its project directories after the cwd with / replaced by -
+	add(strings.ReplaceAll(cwd, "/", "-"), "-home-dev-project")
+	if home, err := os.UserHomeDir(); err == nil {
+		add(home, "/home/dev")
+	}
+	add(os.TempDir(), "/tmp")
+	if host, err := os.Hostname(); err == nil {
+		add(host, "devbox")
+	}
+	sort.SliceStable(s.paths, func(i, j int) bool { return len(s.paths[i][0]) > len(s.paths[j][0]) })
+	return s
+}
+
+// scrub returns a copy of v with identifiers and paths replaced.
+func (s *scrubber) scrub(key string, v interface{}) interface{} {
+	if replacement, ok := scrubbedValues[key]; ok {
+		if _, isString := v.(string); isString {
+			return replacement
+		}
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = s.scrub(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = s.scrub(key, item)
+		}
+		return out
+	case string:
+		if kind, ok := scrubbedIDs[key]; ok && v != "" {
+			return s.id(kind, v)
+		}
+		for _, p := range s.paths {
+			v = strings.ReplaceAll(v, p[0], p[1])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// id returns the placeholder for an identifier.
+func (s *scrubber) id(kind, value string) string {
+	if placeholder, ok := s.ids[value]; ok {
+		return placeholder
+	}
+	if i := strings.Index(value, "_"); i > 0 && i < 8 && !strings.Contains(value[:i], "-") {
+		kind = value[:i+1]
+	}
+	s.counts[kind]++
+	n := s.counts[kind]
+	placeholder := fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+	if kind != "uuid" {
+		placeholder = fmt.Sprintf("%s%024d", kind, n)
+	}
+	s.ids[value] = placeholder
+	return placeholder
+}
+
+// writeRecordedFrames scrubs the frames the CLI sent in a recording and
+// writes them, one per line, to path.
+func writeRecordedFrames(t *testing.T, recording []byte, s *scrubber, path string) {
+	t.Helper()
+	frames, err := claude.ReadRecording(bytes.NewReader(recording))
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+
+	var out bytes.Buffer
+	for _, frame := range frames {
+		if frame.Direction != claude.FrameReceived {
+			continue
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(frame.Frame, &v); err != nil {
+			t.Fatalf("Recorded frame is not an object: %v", err)
+		}
+		line, err := json.Marshal(s.scrub("", v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write(append(line, '\n'))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Wrote %s; review it for private data before committing", path)
+}
+
+// TestRecordStreamJSONTranscripts records the CLI's stream-json output for
+// the cases the conformance corpus covers and writes scrubbed transcripts to
+// tests/unit/testdata/stream-json/recorded. Run the unit tests with -update
+// afterwards to create their golden files.
+func TestRecordStreamJSONTranscripts(t *testing.T) {
+	RequireRecording(t)
+
+	version := cliVersion(t)
+	model := "claude-sonnet-4-5"
+	allow := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+		return claude.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	maxTurns := func(n int) *int { return &n }
+	thinking := 2048
+
+	cases := []struct {
+		name    string
+		prompt  string
+		options claude.ClaudeAgentOptions
+	}{
+		{
+			// Tool use and tool results, with can_use_tool and hook_callback
+			// control requests
+			name:   "tool_use",
+			prompt: "Create a file named notes.txt containing 'hello' with the Write tool, then run `ls` with the Bash tool.",
+			options: claude.ClaudeAgentOptions{
+				CanUseTool: allow,
+				Hooks: map[claude.HookEvent][]claude.HookMatcher{
+					claude.HookEventPreToolUse: {{
+						Matcher: "Bash",
+						Hooks: []claude.HookCallback{func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+							return claude.HookJSONOutput{}, nil
+						}},
+					}},
+				},
+			},
+		},
+		{
+			name:    "thinking",
+			prompt:  "Think it through step by step: what is 17 * 23?",
+			options: claude.ClaudeAgentOptions{MaxThinkingTokens: &thinking},
+		},
+		{
+			name:    "stream_events",
+			prompt:  "Say hello in five words.",
+			options: claude.ClaudeAgentOptions{IncludePartialMessages: true},
+		},
+		{
+			name:    "error_max_turns",
+			prompt:  "Run `ls` with the Bash tool, then run `pwd`.",
+			options: claude.ClaudeAgentOptions{CanUseTool: allow, MaxTurns: maxTurns(1)},
+		},
+		{
+			name:   "structured_output",
+			prompt: "What is the capital of France?",
+			options: claude.ClaudeAgentOptions{OutputFormat: map[string]interface{}{
+				"type": "json_schema",
+				"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"capital": map[string]interface{}{"type": "string"}},
+					"required":   []string{"capital"},
+				},
+			}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A scratch directory, so the transcript holds no project files
+			cwd := t.TempDir()
+			options := tc.options
+			options.Model = &model
+			options.Cwd = &cwd
+
+			inner, err := claude.NewSubprocessCLITransport("", &options, "")
+			if err != nil {
+				t.Fatalf("Failed to create transport: %v", err)
+			}
+			var recording bytes.Buffer
+			rec := claude.NewRecordingTransport(inner, &recording)
+
+			msgCh, errCh, err := claude.Query(context.Background(), tc.prompt, &options, rec)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if _, err := CollectMessages(msgCh, errCh); err != nil {
+				t.Fatalf("Query error: %v", err)
+			}
+			if err := rec.Err(); err != nil {
+				t.Fatalf("Recording failed: %v", err)
+			}
+
+			path := filepath.Join("..", "unit", "testdata", "stream-json", "recorded", tc.name+"-"+version+".jsonl")
+			writeRecordedFrames(t, recording.Bytes(), newScrubber(cwd), path)
+		})
+	}
+}
+
+// TestRecordHookInputs records the inputs the CLI passes to PreToolUse,
+// PostToolUse, UserPromptSubmit and Stop hooks and writes them, scrubbed, to
+// tests/unit/testdata/hooks/recorded.
+func TestRecordHookInputs(t *testing.T) {
+	RequireRecording(t)
+
+	version := cliVersion(t)
+	model := "claude-sonnet-4-5"
+	cwd := t.TempDir()
+
+	var mu sync.Mutex
+	inputs := map[string]map[string]interface{}{}
+	record := func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		event, _ := input["hook_event_name"].(string)
+		name := snakeCase(event)
+		if tool, _ := input["tool_name"].(string); tool != "" {
+			name += "_" + snakeCase(tool)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// Keep the first input of each kind
+		if _, ok := inputs[name]; !ok {
+			inputs[name] = input
+		}
+		return claude.HookJSONOutput{}, nil
+	}
+	matchers := []claude.HookMatcher{{Hooks: []claude.HookCallback{record}}}
+
+	options := &claude.ClaudeAgentOptions{
+		Model: &model,
+		Cwd:   &cwd,
+		CanUseTool: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+			return claude.PermissionResultAllow{Behavior: "allow"}, nil
+		},
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse:       matchers,
+			claude.HookEventPostToolUse:      matchers,
+			claude.HookEventUserPromptSubmit: matchers,
+			claude.HookEventStop:             matchers,
+		},
+	}
+
+	msgCh, errCh, err := claude.Query(context.Background(),
+		"Create a file named notes.txt containing 'hello' with the Write tool, then run `cat notes.txt` with the Bash tool.", options, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if _, err := CollectMessages(msgCh, errCh); err != nil {
+		t.Fatalf("Query error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"pre_tool_use_write", "pre_tool_use_bash", "post_tool_use_write", "post_tool_use_bash", "user_prompt_submit", "stop"} {
+		if _, ok := inputs[name]; !ok {
+			t.Errorf("No %s input was recorded", name)
+		}
+	}
+
+	// One scrubber for all inputs, so they share the session placeholder
+	s := newScrubber(cwd)
+	dir := filepath.Join("..", "unit", "testdata", "hooks", "recorded")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, input := range inputs {
+		data, err := json.MarshalIndent(s.scrub("", input), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name+"-"+version+".json")
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Wrote %s; review it for private data before committing", path)
+	}
+}
+
+// snakeCase turns a hook event or tool name such as PreToolUse into
+// pre_tool_use.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// TestScrubberReplacesIdentifiers runs without the CLI, so the scrubbing the
+// recorders rely on is checked in every test run.
+func TestScrubberReplacesIdentifiers(t *testing.T) {
+	cwd := t.TempDir()
+	s := newScrubber(cwd)
+
+	frame := map[string]interface{}{
+		"type":       "system",
+		"session_id": "3f9b2c1e-7a44-4d2e-9c61-0b8e5d2a7f10",
+		"cwd":        cwd,
+		"message": map[string]interface{}{
+			"id": "msg_01AbC",
+			"content": []interface{}{
+				map[string]interface{}{"type": "tool_use", "id": "toolu_01XyZ", "input": map[string]interface{}{"file_path": cwd + "/notes.txt"}},
+				map[string]interface{}{"type": "thinking", "thinking": "17 * 23 = 391", "signature": "EqQBCkgIBxABGAIiQ"},
+			},
+		},
+	}
+	result := map[string]interface{}{
+		"type":        "user",
+		"session_id":  "3f9b2c1e-7a44-4d2e-9c61-0b8e5d2a7f10",
+		"tool_use_id": "toolu_01XyZ",
+	}
+
+	got, _ := json.Marshal([]interface{}{s.scrub("", frame), s.scrub("", result)})
+	want := `[{"cwd":"/home/dev/project","message":{"content":[` +
+		`{"id":"toolu_000000000000000000000001","input":{"file_path":"/home/dev/project/notes.txt"},"type":"tool_use"},` +
+		`{"signature":"scrubbed-signature","thinking":"17 * 23 = 391","type":"thinking"}],` +
+		`"id":"msg_000000000000000000000001"},"session_id":"00000000-0000-4000-8000-000000000001","type":"system"},` +
+		`{"session_id":"00000000-0000-4000-8000-000000000001","tool_use_id":"toolu_000000000000000000000001","type":"user"}]`
+	if string(got) != want {
+		t.Errorf("Unexpected scrubbed frames:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/approval"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+// askAsync runs CanUseTool in the background and returns its result.
+func askAsync(ctx context.Context, reviews *approval.Service, tool string, input map[string]interface{}) <-chan claude.PermissionResult {
+	results := make(chan claude.PermissionResult, 1)
+	go func() {
+		result, _ := reviews.CanUseTool(ctx, tool, input, claude.ToolPermissionContext{})
+		results <- result
+	}()
+	return results
+}
+
+// pendingOver lists the pending requests through the HTTP API.
+func pendingOver(t *testing.T, server *httptest.Server) []approval.Request {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var requests []approval.Request
+	if err := json.NewDecoder(resp.Body).Decode(&requests); err != nil {
+		t.Fatal(err)
+	}
+	return requests
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestApprovalHTTPDecisions(t *testing.T) {
+	reviews := approval.New(nil)
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+	ctx := context.Background()
+
+	results := askAsync(ctx, reviews, "Bash", map[string]interface{}{"command": "make deploy"})
+	waitFor(t, func() bool { return len(reviews.Pending()) == 1 })
+	requests := pendingOver(t, server)
+	if len(requests) != 1 || requests[0].Kind != approval.KindToolPermission || requests[0].ToolName != "Bash" ||
+		requests[0].Input["command"] != "make deploy" || requests[0].Deadline.IsZero() {
+		t.Fatalf("Unexpected pending requests %+v", requests)
+	}
+
+	resp := post(t, server.URL+"/requests/"+requests[0].ID+"/approve", `{"updated_input": {"command": "make deploy-staging"}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Approve returned %s", resp.Status)
+	}
+	allow, ok := (<-results).(claude.PermissionResultAllow)
+	if !ok || allow.UpdatedInput["command"] != "make deploy-staging" {
+		t.Errorf("Expected an approval with the reviewer's input, got %#v", allow)
+	}
+
+	// A second decision finds nothing pending
+	if resp := post(t, server.URL+"/requests/"+requests[0].ID+"/deny", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a decided request, got %s", resp.Status)
+	}
+
+	results = askAsync(ctx, reviews, "Write", map[string]interface{}{"file_path": "/etc/hosts"})
+	waitFor(t, func() bool { return len(reviews.Pending()) == 1 })
+	id := reviews.Pending()[0].ID
+	if resp := post(t, server.URL+"/requests/"+id+"/deny", `{"message": "Not on prod", "interrupt": true}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Deny returned %s", resp.Status)
+	}
+	if deny, ok := (<-results).(claude.PermissionResultDeny); !ok || deny.Message != "Not on prod" || !deny.Interrupt {
+		t.Errorf("Expected a denial that interrupts, got %#v", deny)
+	}
+	if resp := post(t, server.URL+"/requests/"+id+"/approve", "{"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid body, got %s", resp.Status)
+	}
+}
+
+func TestApprovalEventsReplayPending(t *testing.T) {
+	reviews := approval.New(nil)
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := askAsync(ctx, reviews, "Bash", map[string]interface{}{"command": "ls"})
+	waitFor(t, func() bool { return len(reviews.Pending()) == 1 })
+
+	readEvents := func(n int) []string {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Unexpected content type %q", ct)
+		}
+		var events []string
+		scanner := bufio.NewScanner(resp.Body)
+		for len(events) < n && scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				events = append(events, name)
+				if len(events) == 1 && n > 1 {
+					// Once the replay is read, a new request and a decision arrive
+					oldest := reviews.Pending()[0].ID
+					askAsync(ctx, reviews, "Read", map[string]interface{}{"file_path": "a"})
+					go func() {
+						for len(reviews.Pending()) < 2 {
+							time.Sleep(5 * time.Millisecond)
+						}
+						reviews.Decide(oldest, approval.Decision{Approve: true})
+					}()
+				}
+			}
+		}
+		return events
+	}
+
+	if events := readEvents(3); strings.Join(events, ",") != "request,request,resolved" {
+		t.Errorf("Expected the pending request, a new one and a resolution, got %v", events)
+	}
+	if _, ok := (<-first).(claude.PermissionResultAllow); !ok {
+		t.Error("Expected the oldest request approved")
+	}
+	// A refreshed page gets the request still pending
+	if events := readEvents(1); len(events) != 1 || reviews.Pending()[0].ToolName != "Read" {
+		t.Errorf("Expected the remaining request replayed, got %v", events)
+	}
+}
+
+func TestApprovalTimeoutDenies(t *testing.T) {
+	reviews := approval.New(&approval.Options{Timeout: 50 * time.Millisecond})
+	result, err := reviews.CanUseTool(context.Background(), "Bash", map[string]interface{}{"command": "ls"}, claude.ToolPermissionContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deny, ok := result.(claude.PermissionResultDeny); !ok || !strings.Contains(deny.Message, "No reviewer decided") {
+		t.Errorf("Expected a denial on timeout, got %#v", result)
+	}
+	if len(reviews.Pending()) != 0 {
+		t.Error("Expired requests should leave the pending list")
+	}
+	if err := reviews.Decide("missing", approval.Decision{Approve: true}); !errors.Is(err, approval.ErrNotPending) {
+		t.Errorf("Expected ErrNotPending, got %v", err)
+	}
+}
+
+func TestApprovalWithQuery(t *testing.T) {
+	reviews := approval.New(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// The reviewer approves the hook; the cancelled request never needs a decision
+		for ctx.Err() == nil {
+			for _, request := range reviews.Pending() {
+				if request.Kind == approval.KindPreToolUse {
+					reviews.Decide(request.ID, approval.Decision{Approve: true, Message: "Looks fine"})
+					return
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Deploy").
+		CancelPermissionRequest("Bash", map[string]interface{}{"command": "make deploy"}, 50*time.Millisecond).
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{
+			"tool_name":   "Bash",
+			"tool_input":  map[string]interface{}{"command": "make test"},
+			"tool_use_id": "tu_1",
+		}, claudetest.ExpectFields(map[string]interface{}{
+			"hookSpecificOutput": map[string]interface{}{
+				"hookEventName":            "PreToolUse",
+				"permissionDecision":       "allow",
+				"permissionDecisionReason": "Looks fine",
+			},
+		})).
+		Emit(claudetest.Result("s1"))
+
+	options := &claude.ClaudeAgentOptions{
+		CanUseTool: reviews.CanUseTool,
+		Hooks:      map[claude.HookEvent][]claude.HookMatcher{claude.HookEventPreToolUse: {reviews.HookMatcher("Bash")}},
+	}
+	if _, err := collectQuery(t, "Deploy", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if pending := reviews.Pending(); len(pending) != 0 {
+		t.Errorf("Expected the cancelled request withdrawn, got %+v", pending)
+	}
+}
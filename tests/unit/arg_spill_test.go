@@ -0,0 +1,196 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// connectCapturingSpec connects to a fake CLI and returns the launch spec the
+// transport produced.
+func connectCapturingSpec(t *testing.T, options *claude.ClaudeAgentOptions) (*claude.SubprocessCLITransport, claude.LaunchSpec) {
+	t.Helper()
+
+	var spec claude.LaunchSpec
+	options.CommandLauncher = func(ctx context.Context, s claude.LaunchSpec) (claude.LaunchSpec, error) {
+		spec = s
+		return s, nil
+	}
+	transport := connectFakeCLI(t, writeFakeCLI(t, `cat > /dev/null`), options)
+	return transport, spec
+}
+
+// flagValue returns the value following flag in args.
+func flagValue(args []string, flag string) (string, bool) {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+func TestLargeSystemPromptIsSpilledToFile(t *testing.T) {
+	prompt := strings.Repeat("You are a careful reviewer. ", 10000)
+
+	transport, spec := connectCapturingSpec(t, &claude.ClaudeAgentOptions{SystemPrompt: prompt})
+
+	if _, ok := flagValue(spec.Args, "--system-prompt"); ok {
+		t.Error("Oversized --system-prompt should not be passed on argv")
+	}
+	path, ok := flagValue(spec.Args, "--system-prompt-file")
+	if !ok {
+		t.Fatalf("Expected --system-prompt-file, got %v", spec.Args)
+	}
+	if !containsString(spec.Files, path) {
+		t.Errorf("Expected spilled file in LaunchSpec.Files, got %v", spec.Files)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read spilled prompt: %v", err)
+	}
+	if string(data) != prompt {
+		t.Error("Spilled file should contain the full system prompt")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected spilled file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	transport.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Spilled file should be removed on Close, got %v", err)
+	}
+}
+
+func TestLargeMcpConfigIsSpilledToFile(t *testing.T) {
+	servers := make(map[string]claude.McpServerConfig)
+	for i := 0; i < 2000; i++ {
+		name := "workspace_server_" + strconv.Itoa(i)
+		servers[name] = claude.McpStdioServerConfig{Command: "/usr/local/bin/mcp-server", Args: []string{"--port", "0"}}
+	}
+
+	transport, spec := connectCapturingSpec(t, &claude.ClaudeAgentOptions{McpServers: servers})
+	defer transport.Close()
+
+	path, ok := flagValue(spec.Args, "--mcp-config")
+	if !ok {
+		t.Fatalf("Expected --mcp-config, got %v", spec.Args)
+	}
+	if strings.HasPrefix(path, "{") {
+		t.Fatal("Oversized MCP config should be passed as a file path")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read spilled MCP config: %v", err)
+	}
+	var config map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("Spilled MCP config is not valid JSON: %v", err)
+	}
+	if len(config["mcpServers"]) != len(servers) {
+		t.Errorf("Expected %d servers, got %d", len(servers), len(config["mcpServers"]))
+	}
+}
+
+func TestSmallArgumentsStayOnCommandLine(t *testing.T) {
+	transport, spec := connectCapturingSpec(t, &claude.ClaudeAgentOptions{
+		SystemPrompt: "Be brief.",
+		McpServers: map[string]claude.McpServerConfig{
+			"files": claude.McpStdioServerConfig{Command: "mcp-files"},
+		},
+	})
+	defer transport.Close()
+
+	if got, _ := flagValue(spec.Args, "--system-prompt"); got != "Be brief." {
+		t.Errorf("Expected inline system prompt, got %q", got)
+	}
+	if got, _ := flagValue(spec.Args, "--mcp-config"); !strings.HasPrefix(got, "{") {
+		t.Errorf("Expected inline MCP config, got %q", got)
+	}
+	if len(spec.Files) != 0 {
+		t.Errorf("Expected no spilled files, got %v", spec.Files)
+	}
+}
+
+func TestLongToolListsMoveIntoSettings(t *testing.T) {
+	allowed := generateLongToolList(20000)
+	settings := `{"permissions": {"allow": ["Read"]}, "model": "claude-sonnet-4-5"}`
+
+	transport, spec := connectCapturingSpec(t, &claude.ClaudeAgentOptions{
+		AllowedTools:    allowed,
+		DisallowedTools: []string{"WebFetch"},
+		Settings:        &settings,
+	})
+	defer transport.Close()
+
+	if _, ok := flagValue(spec.Args, "--allowedTools"); ok {
+		t.Error("Oversized --allowedTools should not be passed on argv")
+	}
+	if got, _ := flagValue(spec.Args, "--disallowedTools"); got != "WebFetch" {
+		t.Errorf("Short --disallowedTools should stay on argv, got %q", got)
+	}
+	path, ok := flagValue(spec.Args, "--settings")
+	if !ok || !containsString(spec.Files, path) {
+		t.Fatalf("Expected a spilled --settings file, got %v", spec.Args)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read spilled settings: %v", err)
+	}
+	var merged struct {
+		Model       string `json:"model"`
+		Permissions struct {
+			Allow []string `json:"allow"`
+		} `json:"permissions"`
+	}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		t.Fatalf("Spilled settings are not valid JSON: %v", err)
+	}
+	if merged.Model != "claude-sonnet-4-5" {
+		t.Errorf("Expected the caller's settings to be kept, got model %q", merged.Model)
+	}
+	if len(merged.Permissions.Allow) != len(allowed)+1 || merged.Permissions.Allow[0] != "Read" || merged.Permissions.Allow[1] != allowed[0] {
+		t.Errorf("Expected Read followed by %d allowed tools, got %d rules", len(allowed), len(merged.Permissions.Allow))
+	}
+}
+
+func TestUnspillableCommandLineFailsConnect(t *testing.T) {
+	huge := strings.Repeat("x", 200000)
+	settings := `{"env": {"NOTES": "` + strings.Repeat("n", 150000) + `"}}`
+	transport, err := claude.NewSubprocessCLITransport("", &claude.ClaudeAgentOptions{
+		// The settings are spilled first, then nothing is left to spill
+		Settings:  &settings,
+		ExtraArgs: map[string]*string{"debug-tag": &huge},
+	}, writeFakeCLI(t, `cat > /dev/null`))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- transport.Connect(context.Background()) }()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Connect did not return once nothing was left to spill")
+	}
+	var connErr *claude.CLIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("Expected CLIConnectionError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected error to explain the limit, got %v", err)
+	}
+}
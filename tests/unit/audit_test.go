@@ -0,0 +1,185 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+// recordingAuditor keeps audit entries in memory, optionally failing.
+type recordingAuditor struct {
+	mu      sync.Mutex
+	entries []claude.AuditEntry
+	err     error
+}
+
+func (a *recordingAuditor) Record(ctx context.Context, entry claude.AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	a.entries = append(a.entries, entry)
+	return nil
+}
+
+// teeAuditor records to several auditors.
+type teeAuditor []claude.Auditor
+
+func (t teeAuditor) Record(ctx context.Context, entry claude.AuditEntry) error {
+	for _, auditor := range t {
+		if err := auditor.Record(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func auditScenario() *claudetest.Scenario {
+	input := map[string]interface{}{"command": "ls"}
+	return claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		Emit(claudetest.ToolUse("tu_1", "Bash", input)).
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{
+			"tool_name": "Bash", "tool_input": input, "tool_use_id": "tu_1", "session_id": "s1",
+		}, claudetest.ExpectSuccess()).
+		RequestPermission("Bash", input, claudetest.ExpectAllow()).
+		Emit(claudetest.ToolResult("tu_1", "main.go")).
+		Emit(claudetest.Result("s1"))
+}
+
+func auditOptions(auditor claude.Auditor) *claude.ClaudeAgentOptions {
+	noteHook := func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		reason := "noted"
+		return claude.HookJSONOutput{Reason: &reason}, nil
+	}
+	return &claude.ClaudeAgentOptions{
+		CanUseTool: allowBash,
+		Hooks:      map[claude.HookEvent][]claude.HookMatcher{claude.HookEventPreToolUse: {{Matcher: "Bash", Hooks: []claude.HookCallback{noteHook}}}},
+		Auditor:    auditor,
+	}
+}
+
+func TestAuditRecordsQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := claude.NewFileAuditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	recorded := &recordingAuditor{}
+
+	if _, err := collectQuery(t, "List the files", auditOptions(teeAuditor{recorded, file}), claudetest.NewTransport(t, auditScenario())); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var types []string
+	for _, entry := range recorded.entries {
+		types = append(types, string(entry.Type))
+		if entry.SessionID != "s1" || entry.Time.IsZero() {
+			t.Errorf("Entry %s lacks session or time: %+v", entry.Type, entry)
+		}
+	}
+	want := "session_start,tool_use,hook,permission,tool_result,result"
+	if got := strings.Join(types, ","); got != want {
+		t.Fatalf("Expected entries %s, got %s", want, got)
+	}
+
+	toolUse, hook, permission, toolResult := recorded.entries[1], recorded.entries[2], recorded.entries[3], recorded.entries[4]
+	if toolUse.ToolName != "Bash" || toolUse.ToolUseID != "tu_1" {
+		t.Errorf("Unexpected tool use entry %+v", toolUse)
+	}
+	if output, _ := hook.Data["output"].(map[string]interface{}); hook.ToolUseID != "tu_1" || hook.Data["event"] != "PreToolUse" || output["reason"] != "noted" {
+		t.Errorf("Unexpected hook entry %+v", hook)
+	}
+	if response, _ := permission.Data["response"].(map[string]interface{}); permission.ToolName != "Bash" || response["behavior"] != "allow" {
+		t.Errorf("Unexpected permission entry %+v", permission)
+	}
+	if toolResult.ToolUseID != "tu_1" || toolResult.Data["content"] != "main.go" {
+		t.Errorf("Unexpected tool result entry %+v", toolResult)
+	}
+
+	// The file holds the same entries, chained
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := claude.VerifyAuditLog(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if head.Seq != 6 || head != file.Head() {
+		t.Errorf("Expected head at entry 6 matching the auditor, got %+v and %+v", head, file.Head())
+	}
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditor, err := claude.NewFileAuditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, command := range []string{"ls", "cat notes.txt", "rm -rf build"} {
+		entry := claude.AuditEntry{Type: claude.AuditToolUse, ToolName: "Bash", Data: map[string]interface{}{"input": map[string]interface{}{"command": command}}}
+		if err := auditor.Record(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auditor.Close()
+
+	// Reopening continues the chain
+	auditor, err = claude.NewFileAuditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditor.Record(ctx, claude.AuditEntry{Type: claude.AuditResult})
+	auditor.Close()
+	if auditor.Head().Seq != 4 {
+		t.Fatalf("Expected the chain to continue at 4, got %+v", auditor.Head())
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	for name, tc := range map[string]struct {
+		log  string
+		line int
+	}{
+		"edited entry":    {strings.Replace(string(data), "rm -rf build", "make build", 1), 3},
+		"removed line":    {lines[0] + lines[2] + lines[3], 2},
+		"reordered lines": {lines[1] + lines[0] + lines[2] + lines[3], 1},
+		"torn last line":  {strings.TrimSuffix(string(data), "\n"), 4},
+	} {
+		_, err := claude.VerifyAuditLog(strings.NewReader(tc.log))
+		var chainErr *claude.AuditChainError
+		if !errors.As(err, &chainErr) || chainErr.Line != tc.line {
+			t.Errorf("%s: expected a chain error at line %d, got %v", name, tc.line, err)
+		}
+	}
+
+	os.WriteFile(path, []byte(strings.Replace(string(data), "cat notes.txt", "cat README", 1)), 0600)
+	if _, err := claude.NewFileAuditor(path); err == nil {
+		t.Error("A tampered log should not be appended to")
+	}
+}
+
+func TestAuditFailureFailsClosed(t *testing.T) {
+	auditor := &recordingAuditor{err: errors.New("disk full")}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("List the files").
+		RequestPermission("Bash", map[string]interface{}{"command": "ls"}, claudetest.ExpectError()).
+		Emit(claudetest.Result("s1"))
+
+	if _, err := collectQuery(t, "List the files", auditOptions(auditor), claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+// assistantWithUsage returns an assistant message reporting API usage.
+func assistantWithUsage(id, text string, inputTokens, outputTokens int) map[string]interface{} {
+	msg := claudetest.AssistantText(text)
+	message := msg["message"].(map[string]interface{})
+	message["id"] = id
+	message["usage"] = map[string]interface{}{"input_tokens": inputTokens, "output_tokens": outputTokens}
+	return msg
+}
+
+func TestBudgetLedgerRefusesQueriesOverLimit(t *testing.T) {
+	ledger := claude.NewBudgetLedger(nil, nil)
+	ledger.SetLimit("tenant-a", claude.BudgetLimit{MaxCostUSD: 0.0015})
+	options := &claude.ClaudeAgentOptions{Budget: ledger.Account("tenant-a", "tenant-a/alice")}
+
+	for i := 0; i < 2; i++ {
+		result := claudetest.Result("s1")
+		result["usage"] = map[string]interface{}{"input_tokens": 100, "output_tokens": 20}
+		scenario := claudetest.NewScenario().
+			ExpectUserMessage("Hi").
+			Emit(claudetest.AssistantText("Hello")).
+			Emit(result)
+		if _, err := collectQuery(t, "Hi", options, claudetest.NewTransport(t, scenario)); err != nil {
+			t.Fatalf("Query %d failed: %v", i, err)
+		}
+	}
+
+	ctx := context.Background()
+	for _, key := range []string{"tenant-a", "tenant-a/alice"} {
+		usage, err := ledger.Usage(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.Turns != 2 || usage.CostUSD != 0.002 || usage.InputTokens != 200 || usage.Tokens() != 240 {
+			t.Errorf("Unexpected usage of %s: %+v", key, usage)
+		}
+	}
+
+	// The tenant's limit also stops its users
+	_, _, err := claude.Query(ctx, "Hi", &claude.ClaudeAgentOptions{Budget: ledger.Account("tenant-a/alice", "tenant-a")}, claudetest.NewTransport(t, claudetest.NewScenario()))
+	var budgetErr *claude.BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Expected BudgetExceededError, got %v", err)
+	}
+	if budgetErr.Key != "tenant-a" || budgetErr.Limit.MaxCostUSD != 0.0015 {
+		t.Errorf("Unexpected error fields: %+v", budgetErr)
+	}
+
+	// Other keys are unaffected
+	if err := ledger.Account("tenant-b").Check(ctx); err != nil {
+		t.Errorf("tenant-b should be within budget, got %v", err)
+	}
+}
+
+func TestBudgetInterruptsClientTurn(t *testing.T) {
+	ledger := claude.NewBudgetLedger(nil, &claude.BudgetLedgerOptions{
+		DefaultLimit: claude.BudgetLimit{MaxCostUSD: 0.05},
+		Pricing: map[string]claude.ModelPricing{
+			"claude-sonnet-4-5": {InputPerMTok: 3, OutputPerMTok: 15},
+		},
+	})
+
+	// The CLI reports the session's cumulative cost with each result
+	first := claudetest.Result("s1")
+	first["total_cost_usd"] = 0.01
+	second := claudetest.Result("s1")
+	second["subtype"] = "error_during_execution"
+	second["total_cost_usd"] = 0.06
+
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("one").
+		Emit(assistantWithUsage("msg_1", "first", 1000, 100)).
+		Emit(first).
+		ExpectUserMessage("two").
+		// Each block of a streamed message repeats its usage, so msg_2 is
+		// estimated at $0.0315 once; msg_3 adds $0.0105, which crosses
+		// $0.05 with the $0.01 committed
+		Emit(assistantWithUsage("msg_2", "thinking", 3000, 1500)).
+		Emit(assistantWithUsage("msg_2", "more", 3000, 1500)).
+		Emit(assistantWithUsage("msg_3", "still going", 2000, 300)).
+		ExpectControlRequest("interrupt").
+		Emit(second)
+
+	client := claude.NewClaudeSDKClientWithTransport(&claude.ClaudeAgentOptions{Budget: ledger.Account("tenant-a")}, claudetest.NewTransport(t, scenario))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, prompt := range []string{"one", "two"} {
+		msgCh, errCh := client.Query(ctx, prompt)
+		for range msgCh {
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("Turn %q failed: %v", prompt, err)
+		}
+	}
+
+	usage, err := ledger.Usage(ctx, "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Turns != 2 || usage.CostUSD < 0.0599 || usage.CostUSD > 0.0601 {
+		t.Errorf("Expected the reported $0.06 over two turns, got %+v", usage)
+	}
+
+	var budgetErr *claude.BudgetExceededError
+	if err := client.QueryWithSession(ctx, "three", "default"); !errors.As(err, &budgetErr) {
+		t.Errorf("Expected the next turn to be refused, got %v", err)
+	}
+}
+
+func TestBudgetChargesSessionTotalsOnce(t *testing.T) {
+	ledger := claude.NewBudgetLedger(nil, &claude.BudgetLedgerOptions{
+		DefaultLimit: claude.BudgetLimit{MaxTokens: 3000, MaxCostUSD: 0.04},
+	})
+
+	// Results report the session's cost and tokens so far; the second turn
+	// adds 1700 tokens and $0.02
+	first := claudetest.Result("s1")
+	first["total_cost_usd"] = 0.01
+	first["modelUsage"] = map[string]interface{}{
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 1000, "outputTokens": 100, "costUSD": 0.01},
+	}
+	second := claudetest.Result("s1")
+	second["total_cost_usd"] = 0.03
+	second["modelUsage"] = map[string]interface{}{
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 2500, "outputTokens": 300, "costUSD": 0.03},
+	}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("one").
+		Emit(assistantWithUsage("msg_1", "first", 1000, 100)).
+		Emit(first).
+		ExpectUserMessage("two").
+		Emit(assistantWithUsage("msg_2", "second", 1500, 200)).
+		Emit(second)
+
+	account := ledger.Account("tenant-a")
+	client := claude.NewClaudeSDKClientWithTransport(&claude.ClaudeAgentOptions{Budget: account}, claudetest.NewTransport(t, scenario))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, prompt := range []string{"one", "two"} {
+		msgCh, errCh := client.Query(ctx, prompt)
+		for range msgCh {
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("Turn %q failed: %v", prompt, err)
+		}
+	}
+
+	usage, err := ledger.Usage(ctx, "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Turns != 2 || usage.InputTokens != 2500 || usage.Tokens() != 2800 || usage.CostUSD < 0.0299 || usage.CostUSD > 0.0301 {
+		t.Errorf("Expected the session's 2800 tokens and $0.03 over two turns, got %+v", usage)
+	}
+	// Both limits see the same session, so neither is exceeded
+	if err := account.Check(ctx); err != nil {
+		t.Errorf("Expected the account to be within its limits, got %v", err)
+	}
+}
+
+func TestBudgetQueryReportsInterruption(t *testing.T) {
+	ledger := claude.NewBudgetLedger(nil, &claude.BudgetLedgerOptions{
+		DefaultLimit: claude.BudgetLimit{MaxTokens: 1000},
+	})
+	result := claudetest.Result("s1")
+	result["subtype"] = "error_during_execution"
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Hi").
+		Emit(assistantWithUsage("msg_1", "long answer", 800, 400)).
+		ExpectControlRequest("interrupt").
+		Emit(result)
+
+	_, err := collectQuery(t, "Hi", &claude.ClaudeAgentOptions{Budget: ledger.Account("u")}, claudetest.NewTransport(t, scenario))
+	var budgetErr *claude.BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Usage.Tokens() != 1200 {
+		t.Fatalf("Expected BudgetExceededError at 1200 tokens, got %v", err)
+	}
+
+	// The cost the result reports replaces the estimate
+	usage, _ := ledger.Usage(context.Background(), "u")
+	if usage.Turns != 1 || usage.CostUSD != 0.001 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
+
+func TestFileBudgetStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budget.json")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		store, err := claude.NewFileBudgetStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := store.Add(ctx, "tenant-a", claude.BudgetUsage{CostUSD: 0.5, OutputTokens: 10, Turns: 1}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	store, _ := claude.NewFileBudgetStore(path)
+	usage, err := store.Load(ctx, "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Turns != 20 || usage.CostUSD != 10 || usage.OutputTokens != 200 {
+		t.Errorf("Expected every Add to be kept, got %+v", usage)
+	}
+	if usage, _ := store.Load(ctx, "unknown"); usage != (claude.BudgetUsage{}) {
+		t.Errorf("Expected zero usage for an unknown key, got %+v", usage)
+	}
+
+	// A ledger over the same file sees the usage
+	ledger := claude.NewBudgetLedger(store, &claude.BudgetLedgerOptions{DefaultLimit: claude.BudgetLimit{MaxCostUSD: 10}})
+	if err := ledger.Account("tenant-a").Check(ctx); err == nil {
+		t.Error("Expected tenant-a to be over its limit")
+	}
+
+	if _, err := claude.NewFileBudgetStore(filepath.Join(t.TempDir(), "missing", "budget.json")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,146 @@
+package unit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// bundledFS returns an embedded filesystem with one binary and a manifest
+// recording checksum for it.
+func bundledFS(content, checksum string) fstest.MapFS {
+	return fstest.MapFS{
+		"claude-test":   {Data: []byte(content), Mode: 0755},
+		"manifest.json": {Data: []byte(`{"version":"2.1.33","binaries":{"claude-test":"` + checksum + `"}}`)},
+	}
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractBundledCLI(t *testing.T) {
+	const content = "#!/bin/sh\necho bundled\n"
+	fsys := bundledFS(content, sha256Hex(content))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	path, err := claude.ExtractBundledCLI(fsys, "claude-test", cacheDir)
+	if err != nil {
+		t.Fatalf("ExtractBundledCLI failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("Extracted binary has wrong content: %q", data)
+	}
+	if !strings.HasPrefix(filepath.Base(filepath.Dir(path)), "2.1.33-"+sha256Hex(content)[:12]) {
+		t.Errorf("Expected a version and checksum directory, got %s", path)
+	}
+	if runtime.GOOS != "windows" {
+		for _, dir := range []string{cacheDir, filepath.Dir(path)} {
+			if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+				t.Errorf("Expected %s to have mode 0700, got %v (%v)", dir, info.Mode().Perm(), err)
+			}
+		}
+	}
+
+	// A second extraction reuses the verified file
+	before, _ := os.Stat(path)
+	again, err := claude.ExtractBundledCLI(fsys, "claude-test", cacheDir)
+	if err != nil || again != path {
+		t.Fatalf("Expected %s, got %s (%v)", path, again, err)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Verified binary should not be rewritten")
+	}
+}
+
+func TestExtractBundledCLIReplacesTamperedFile(t *testing.T) {
+	const content = "#!/bin/sh\necho bundled\n"
+	fsys := bundledFS(content, sha256Hex(content))
+	cacheDir := t.TempDir()
+
+	path, err := claude.ExtractBundledCLI(fsys, "claude-test", cacheDir)
+	if err != nil {
+		t.Fatalf("ExtractBundledCLI failed: %v", err)
+	}
+
+	// Same size, different content: a size check alone would accept it
+	tampered := strings.Replace(content, "bundled", "evil!!!", 1)
+	if err := os.WriteFile(path, []byte(tampered), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := claude.ExtractBundledCLI(fsys, "claude-test", cacheDir); err != nil {
+		t.Fatalf("ExtractBundledCLI failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("Tampered binary was not replaced: %q", data)
+	}
+}
+
+func TestExtractBundledCLIRejectsChecksumMismatch(t *testing.T) {
+	cacheDir := t.TempDir()
+	fsys := bundledFS("#!/bin/sh\necho corrupted\n", sha256Hex("#!/bin/sh\necho bundled\n"))
+
+	if _, err := claude.ExtractBundledCLI(fsys, "claude-test", cacheDir); err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Fatalf("Expected a checksum error, got %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(cacheDir, "*", "claude-test*"))
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".lock") {
+			t.Errorf("Unverified binary left behind: %s", match)
+		}
+	}
+}
+
+func TestExtractBundledCLIRequiresManifest(t *testing.T) {
+	fsys := fstest.MapFS{"claude-test": {Data: []byte("binary"), Mode: 0755}}
+	if _, err := claude.ExtractBundledCLI(fsys, "claude-test", t.TempDir()); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("Expected an error without a manifest, got %v", err)
+	}
+}
+
+func TestExtractBundledCLIConcurrent(t *testing.T) {
+	content := strings.Repeat("bundled cli ", 100000)
+	fsys := bundledFS(content, sha256Hex(content))
+	cacheDir := t.TempDir()
+
+	var wg sync.WaitGroup
+	paths := make([]string, 8)
+	errs := make([]error, 8)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = claude.ExtractBundledCLI(fsys, "claude-test", cacheDir)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range paths {
+		if errs[i] != nil || paths[i] != paths[0] {
+			t.Fatalf("Extraction %d: %s, %v", i, paths[i], errs[i])
+		}
+	}
+	if data, _ := os.ReadFile(paths[0]); string(data) != content {
+		t.Error("Concurrent extraction produced a corrupt binary")
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(paths[0]), "*.tmp-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("Temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestBundledCLIWithoutEmbeddedBinary(t *testing.T) {
+	// Development trees embed no binary
+	if info := claude.BundledCLI(); info != nil && info.Version == "" {
+		t.Errorf("Embedded binary has no manifest: %+v", info)
+	}
+}
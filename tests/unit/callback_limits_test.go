@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+	"github.com/Facets-cloud/claude-agent-sdk-go/mcp"
+)
+
+// errorCapture is a slog.Handler keeping the errors logged and the
+// attributes of every record by message.
+type errorCapture struct {
+	mu      sync.Mutex
+	errs    []error
+	records map[string][]map[string]interface{}
+}
+
+func (c *errorCapture) Enabled(context.Context, slog.Level) bool { return true }
+func (c *errorCapture) WithAttrs([]slog.Attr) slog.Handler       { return c }
+func (c *errorCapture) WithGroup(string) slog.Handler            { return c }
+
+func (c *errorCapture) Handle(_ context.Context, r slog.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	attrs := make(map[string]interface{})
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Any()
+		if err, ok := a.Value.Any().(error); ok {
+			c.errs = append(c.errs, err)
+		}
+		return true
+	})
+	if c.records == nil {
+		c.records = make(map[string][]map[string]interface{})
+	}
+	c.records[r.Message] = append(c.records[r.Message], attrs)
+	return nil
+}
+
+// errorAs returns whether a logged error matches target.
+func (c *errorCapture) errorAs(target interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, err := range c.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCallbackPanicsAreRecovered(t *testing.T) {
+	logs := &errorCapture{}
+	explode := mcp.Tool("explode", "Panics", map[string]string{},
+		func(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+			panic("tool exploded")
+		})
+	options := &claude.ClaudeAgentOptions{
+		CanUseTool: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+			if toolName == "Write" {
+				panic("permission check exploded")
+			}
+			return claude.PermissionResultAllow{Behavior: "allow"}, nil
+		},
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{Matcher: "Bash", Hooks: []claude.HookCallback{
+				func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+					panic(errors.New("hook exploded"))
+				},
+			}}},
+		},
+		McpServers: map[string]claude.McpServerConfig{
+			"lab": mcp.CreateSdkMcpServer("lab", "1.0.0", []*mcp.SdkMcpTool{explode}).ToConfig(),
+		},
+		Logger: slog.New(logs),
+	}
+
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("").
+		RequestPermission("Write", map[string]interface{}{"path": "x"}, claudetest.ExpectError()).
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{"tool_name": "Bash", "tool_input": map[string]interface{}{}}, claudetest.ExpectError()).
+		CallMcpTool("lab", "explode", map[string]interface{}{}, claudetest.ExpectError()).
+		// The process survives and keeps answering
+		RequestPermission("Read", map[string]interface{}{"path": "x"}, claudetest.ExpectAllow()).
+		Emit(claudetest.Result("s1"))
+
+	if _, err := collectQuery(t, "Try", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var panicErr *claude.CallbackPanicError
+	if !logs.errorAs(&panicErr) {
+		t.Fatal("Expected a CallbackPanicError in the logs")
+	}
+	panics := logs.records["claude: callback panicked"]
+	if len(panics) != 3 {
+		t.Fatalf("Expected 3 logged panics, got %d", len(panics))
+	}
+	callbacks := []string{panics[0]["callback"].(string), panics[1]["callback"].(string), panics[2]["callback"].(string)}
+	if callbacks[0] != "can_use_tool Write" || !strings.HasPrefix(callbacks[1], "PreToolUse hook ") || callbacks[2] != "mcp tool lab/explode" {
+		t.Errorf("Unexpected callback names %v", callbacks)
+	}
+	if stack, _ := panics[0]["stack"].(string); !strings.Contains(stack, "TestCallbackPanicsAreRecovered") {
+		t.Errorf("Expected the stack of the panicking callback, got:\n%s", stack)
+	}
+}
+
+func TestCallbackTimeoutsAndConcurrencyLimit(t *testing.T) {
+	logs := &errorCapture{}
+	release := make(chan struct{})
+	defer close(release)
+	var calls int
+	var mu sync.Mutex
+	stuckOnce := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			<-release // Ignores its context
+		}
+		return claude.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	hookTimeout := 0.05
+	slowHook := func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+		<-ctx.Done()
+		return claude.HookJSONOutput{}, ctx.Err()
+	}
+
+	options := &claude.ClaudeAgentOptions{
+		CanUseTool:     stuckOnce,
+		CallbackLimits: &claude.CallbackLimits{MaxConcurrent: 1, MaxWait: 50 * time.Millisecond, Timeout: 50 * time.Millisecond},
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{Matcher: "Bash", Hooks: []claude.HookCallback{slowHook}, Timeout: &hookTimeout}},
+		},
+		Logger: slog.New(logs),
+	}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("").
+		// Times out, and keeps the only slot while it is stuck
+		RequestPermission("Bash", map[string]interface{}{"command": "ls"}, claudetest.ExpectError()).
+		// Finds no free slot
+		RequestPermission("Bash", map[string]interface{}{"command": "pwd"}, claudetest.ExpectError()).
+		Emit(claudetest.Result("s1"))
+
+	start := time.Now()
+	if _, err := collectQuery(t, "Try", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Callbacks were not cut off, took %v", elapsed)
+	}
+
+	var timeoutErr *claude.CallbackTimeoutError
+	if !logs.errorAs(&timeoutErr) || timeoutErr.Callback != "can_use_tool Bash" || timeoutErr.Timeout != 50*time.Millisecond {
+		t.Errorf("Expected a CallbackTimeoutError, got %+v", timeoutErr)
+	}
+	var rejectedErr *claude.CallbackRejectedError
+	if !logs.errorAs(&rejectedErr) || rejectedErr.MaxConcurrent != 1 {
+		t.Errorf("Expected a CallbackRejectedError, got %+v", rejectedErr)
+	}
+
+	// Hooks use their matcher's timeout
+	logs = &errorCapture{}
+	options.Logger = slog.New(logs)
+	options.CallbackLimits = nil
+	scenario = claudetest.NewScenario().
+		ExpectUserMessage("").
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{"tool_name": "Bash", "tool_input": map[string]interface{}{}}, claudetest.ExpectError()).
+		Emit(claudetest.Result("s1"))
+	if _, err := collectQuery(t, "Try", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !logs.errorAs(&timeoutErr) || !strings.HasPrefix(timeoutErr.Callback, "PreToolUse hook ") {
+		t.Errorf("Expected the hook to time out, got %+v", timeoutErr)
+	}
+}
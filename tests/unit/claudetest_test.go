@@ -0,0 +1,233 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+	"github.com/Facets-cloud/claude-agent-sdk-go/mcp"
+)
+
+// capturingTB records Errorf calls instead of failing the test, so scenario
+// failures can be asserted.
+type capturingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (c *capturingTB) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+// collectQuery runs a one-shot query and returns its messages and error.
+func collectQuery(t *testing.T, prompt string, options *claude.ClaudeAgentOptions, transport claude.Transport) ([]claude.Message, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	msgCh, errCh, err := claude.Query(ctx, prompt, options, transport)
+	if err != nil {
+		return nil, err
+	}
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	return messages, <-errCh
+}
+
+func allowBash(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+	if toolName == "Bash" {
+		return claude.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	return claude.PermissionResultDeny{Behavior: "deny", Message: "only Bash"}, nil
+}
+
+func TestClaudetestPermissionScenario(t *testing.T) {
+	input := map[string]interface{}{"command": "ls"}
+	scenario := claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		Emit(claudetest.ToolUse("tu_1", "Bash", input)).
+		RequestPermission("Bash", input, claudetest.ExpectAllowWithInput(input)).
+		RequestPermission("Write", map[string]interface{}{"path": "x"}, claudetest.ExpectDeny()).
+		Emit(claudetest.ToolResult("tu_1", "main.go")).
+		Emit(claudetest.AssistantText("There is one file.")).
+		Emit(claudetest.Result("s1"))
+
+	messages, err := collectQuery(t, "List the files", &claude.ClaudeAgentOptions{CanUseTool: allowBash},
+		claudetest.NewTransport(t, scenario))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("Expected 5 messages, got %d", len(messages))
+	}
+	if _, ok := messages[4].(*claude.ResultMessage); !ok {
+		t.Errorf("Expected result message last, got %T", messages[4])
+	}
+}
+
+func TestClaudetestHookAndMcpScenario(t *testing.T) {
+	var hookTools []string
+	add := mcp.Tool("add", "Add two numbers", map[string]string{"a": "number", "b": "number"},
+		func(ctx context.Context, args map[string]interface{}) (map[string]interface{}, error) {
+			return mcp.TextContent(fmt.Sprintf("%v", args["a"].(float64)+args["b"].(float64))), nil
+		})
+
+	options := &claude.ClaudeAgentOptions{
+		McpServers: map[string]claude.McpServerConfig{
+			"calc": mcp.CreateSdkMcpServer("calc", "1.0.0", []*mcp.SdkMcpTool{add}).ToConfig(),
+		},
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{
+				Matcher: "Bash",
+				Hooks: []claude.HookCallback{
+					func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+						hookTools = append(hookTools, input["tool_name"].(string))
+						reason := "blocked in tests"
+						return claude.HookJSONOutput{StopReason: &reason}, nil
+					},
+				},
+			}},
+		},
+	}
+
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("").
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{"tool_name": "Bash", "tool_input": map[string]interface{}{}},
+			claudetest.ExpectFields(map[string]interface{}{"stopReason": "blocked in tests"})).
+		CallMcpTool("calc", "add", map[string]interface{}{"a": 2, "b": 3}, claudetest.ExpectContains(`"text":"5"`)).
+		Emit(claudetest.Result("s1")).
+		WaitForEndInput()
+
+	if _, err := collectQuery(t, "Add numbers", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(hookTools) != 1 || hookTools[0] != "Bash" {
+		t.Errorf("Expected hook to run once for Bash, got %v", hookTools)
+	}
+}
+
+func TestClaudetestCancelledPermissionRequest(t *testing.T) {
+	logs := &logBuffer{}
+	causes := make(chan error, 1)
+	waitForCancel := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Deploy").
+		CancelPermissionRequest("Bash", map[string]interface{}{"command": "make deploy"}, 50*time.Millisecond).
+		Emit(claudetest.Result("s1"))
+
+	options := &claude.ClaudeAgentOptions{CanUseTool: waitForCancel, Logger: logs.logger()}
+	if _, err := collectQuery(t, "Deploy", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if cause := <-causes; cause == nil || !strings.Contains(cause.Error(), "cancelled by the CLI") {
+		t.Errorf("Expected the callback context cancelled by the CLI, got %v", cause)
+	}
+	waitFor(t, func() bool { return len(logs.records(t, "claude: control request cancelled by the CLI")) == 1 })
+	if failed := logs.records(t, "claude: control request handler failed"); len(failed) != 0 {
+		t.Errorf("A cancelled request should not be answered, got %v", failed)
+	}
+}
+
+func TestClaudetestReportsWrongResponse(t *testing.T) {
+	tb := &capturingTB{TB: t}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("").
+		RequestPermission("Write", map[string]interface{}{"path": "x"}, claudetest.ExpectAllow()).
+		Emit(claudetest.Result("s1"))
+	transport := claudetest.NewTransport(tb, scenario)
+
+	_, err := collectQuery(t, "Write a file", &claude.ClaudeAgentOptions{CanUseTool: allowBash}, transport)
+	if err == nil || !strings.Contains(err.Error(), `expected behavior "allow"`) {
+		t.Fatalf("Expected scenario failure on the error channel, got %v", err)
+	}
+	if transport.Err() == nil {
+		t.Error("Err should report the failing step")
+	}
+}
+
+func TestClaudetestReportsUnexpectedPrompt(t *testing.T) {
+	tb := &capturingTB{TB: t}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Hello").
+		Emit(claudetest.Result("s1")).
+		Timeout(time.Second)
+	transport := claudetest.NewTransport(tb, scenario)
+
+	_, err := collectQuery(t, "Goodbye", nil, transport)
+	if err == nil || !strings.Contains(err.Error(), `expected user message "Hello", got "Goodbye"`) {
+		t.Fatalf("Expected prompt mismatch, got %v", err)
+	}
+}
+
+func TestClaudetestFakeCLIBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+
+	input := map[string]interface{}{"command": "ls"}
+	scenario := claudetest.NewScenario().
+		ExpectFlagValue("--model", "claude-opus-4-1").
+		ExpectFlag("--include-partial-messages").
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		RequestPermission("Bash", input, claudetest.ExpectAllow()).
+		Emit(claudetest.AssistantText("Done.")).
+		Emit(claudetest.Result("s1"))
+	fake := claudetest.BuildFakeCLI(t, scenario)
+
+	messages, err := collectQuery(t, "List the files", &claude.ClaudeAgentOptions{
+		CliPath:                &fake.Path,
+		Model:                  stringPtr("claude-opus-4-1"),
+		IncludePartialMessages: true,
+		CanUseTool:             allowBash,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("Expected 3 messages, got %d: %#v", len(messages), messages)
+	}
+	if got, _ := fake.FlagValue("--input-format"); got != "stream-json" {
+		t.Errorf("Expected --input-format stream-json, got %q", got)
+	}
+	if got, _ := fake.FlagValue("--permission-prompt-tool"); got != "stdio" {
+		t.Errorf("Expected --permission-prompt-tool stdio, got %q", got)
+	}
+}
+
+func TestClaudetestFakeCLIBinaryReportsFlagMismatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+
+	tb := &capturingTB{TB: t}
+	fake := claudetest.BuildFakeCLI(tb, claudetest.NewScenario().
+		ExpectFlagValue("--model", "claude-opus-4-1").
+		Emit(claudetest.Result("s1")))
+
+	_, err := collectQuery(t, "Hi", &claude.ClaudeAgentOptions{
+		CliPath: &fake.Path,
+		Model:   stringPtr("claude-haiku-4-5"),
+	}, nil)
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) || !strings.Contains(procErr.Stderr, `expected --model "claude-opus-4-1"`) {
+		t.Fatalf("Expected ProcessError naming the flag, got %v", err)
+	}
+	if fake.Err() == nil {
+		t.Error("FakeCLI.Err should report the mismatch")
+	}
+}
@@ -0,0 +1,247 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// writeVersionedCLI writes a fake CLI reporting version for "-v" and
+// returns its path and the file counting version probes.
+func writeVersionedCLI(t *testing.T, version string) (string, string) {
+	t.Helper()
+
+	probes := filepath.Join(t.TempDir(), "probes")
+	path := writeFakeCLI(t, `
+if [ "$1" = "-v" ]; then
+	echo probe >> `+probes+`
+	echo "`+version+` (Claude Code)"
+	exit 0
+fi
+cat > /dev/null`)
+
+	// writeFakeCLI skips the version check; these tests exercise it
+	t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+	claude.ResetCLICache()
+	t.Cleanup(claude.ResetCLICache)
+	return path, probes
+}
+
+func connectVersioned(t *testing.T, options *claude.ClaudeAgentOptions) (*claude.SubprocessCLITransport, error) {
+	t.Helper()
+	transport, err := claude.NewSubprocessCLITransport("", options, "")
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	err = transport.Connect(context.Background())
+	t.Cleanup(func() { transport.Close() })
+	return transport, err
+}
+
+func TestCLIVersionProbeIsCached(t *testing.T) {
+	cliPath, probes := writeVersionedCLI(t, claude.RecommendedCLIVersion)
+
+	for i := 0; i < 3; i++ {
+		transport, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath})
+		if err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		if info := transport.CLIInfo(); info == nil || info.Version != claude.RecommendedCLIVersion {
+			t.Fatalf("Expected CLIInfo with version %s, got %+v", claude.RecommendedCLIVersion, info)
+		}
+	}
+	if n := countStarts(t, probes); n != 1 {
+		t.Errorf("Expected one version probe for three connections, got %d", n)
+	}
+
+	// Replacing the binary invalidates the cache
+	script, _ := os.ReadFile(cliPath)
+	future := time.Now().Add(time.Minute)
+	if err := os.WriteFile(cliPath, append(script, '\n'), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(cliPath, future, future)
+	if _, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath}); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if n := countStarts(t, probes); n != 2 {
+		t.Errorf("Expected a new probe after the binary changed, got %d probes", n)
+	}
+}
+
+func TestStrictVersionCheckRejectsOldCLI(t *testing.T) {
+	cliPath, _ := writeVersionedCLI(t, "2.0.10")
+
+	// Default: warn and connect
+	transport, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath})
+	if err != nil {
+		t.Fatalf("Connect without StrictVersionCheck should succeed, got %v", err)
+	}
+	if transport.CLIInfo().Version != "2.0.10" {
+		t.Errorf("Expected version 2.0.10, got %+v", transport.CLIInfo())
+	}
+
+	_, err = connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath, StrictVersionCheck: true})
+	var versionErr *claude.CLIVersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected CLIVersionError, got %v", err)
+	}
+	if versionErr.Version != "2.0.10" || versionErr.Minimum != claude.MinimumCLIVersion || versionErr.CLIPath != cliPath {
+		t.Errorf("Unexpected error fields: %+v", versionErr)
+	}
+}
+
+func TestVersionWarningGoesToLogger(t *testing.T) {
+	cliPath, _ := writeVersionedCLI(t, "2.0.10")
+	logs := &logBuffer{}
+
+	if _, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath, Logger: logs.logger()}); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if started := logs.records(t, "claude: CLI started"); len(started) != 1 || started[0]["cli_version"] != "2.0.10" || started[0]["pid"] == nil {
+		t.Errorf("Expected one start record with the version, got %v", started)
+	}
+	logs.mu.Lock()
+	out := logs.buf.String()
+	logs.mu.Unlock()
+	if !strings.Contains(out, `"level":"WARN","msg":"claude: Claude Code version 2.0.10 is unsupported`) {
+		t.Errorf("Expected the version warning to be logged, got:\n%s", out)
+	}
+}
+
+func TestStrictVersionCheckRejectsUnknownVersion(t *testing.T) {
+	cliPath, _ := writeVersionedCLI(t, "dev build")
+
+	_, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath, StrictVersionCheck: true})
+	var versionErr *claude.CLIVersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != "" {
+		t.Fatalf("Expected CLIVersionError for an unknown version, got %v", err)
+	}
+}
+
+func TestStrictVersionCheckRejectsMissingCapabilities(t *testing.T) {
+	cliPath, _ := writeVersionedCLI(t, "2.0.55")
+
+	options := &claude.ClaudeAgentOptions{
+		CliPath:                 &cliPath,
+		StrictVersionCheck:      true,
+		EnableFileCheckpointing: true,
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse:   {{Hooks: []claude.HookCallback{nil}}},
+			claude.HookEventNotification: {{Hooks: []claude.HookCallback{nil}}},
+		},
+	}
+	_, err := connectVersioned(t, options)
+	var versionErr *claude.CLIVersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected CLIVersionError, got %v", err)
+	}
+	want := []string{"file checkpointing", "Notification hooks"}
+	if !reflect.DeepEqual(versionErr.Missing, want) {
+		t.Errorf("Expected missing %v, got %v", want, versionErr.Missing)
+	}
+
+	// Without the unsupported features the same CLI is accepted
+	options.EnableFileCheckpointing = false
+	delete(options.Hooks, claude.HookEventNotification)
+	if _, err := connectVersioned(t, options); err != nil {
+		t.Errorf("Expected supported options to connect, got %v", err)
+	}
+}
+
+func TestResolveCLI(t *testing.T) {
+	cliPath, probes := writeVersionedCLI(t, "2.0.70")
+
+	info, err := claude.ResolveCLI(context.Background(), &claude.ClaudeAgentOptions{CliPath: &cliPath})
+	if err != nil {
+		t.Fatalf("ResolveCLI failed: %v", err)
+	}
+	if info.Path != cliPath || info.Version != "2.0.70" || info.ModTime.IsZero() {
+		t.Errorf("Unexpected CLIInfo: %+v", info)
+	}
+	if !info.Capabilities.FileCheckpointing {
+		t.Errorf("2.0.70 supports checkpointing: %+v", info.Capabilities)
+	}
+	if info.Capabilities.SupportsHookEvent(claude.HookEventPermissionRequest) {
+		t.Error("2.0.70 does not fire PermissionRequest hooks")
+	}
+
+	if _, err := connectVersioned(t, &claude.ClaudeAgentOptions{CliPath: &cliPath}); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if n := countStarts(t, probes); n != 1 {
+		t.Errorf("Connect should reuse the probe from ResolveCLI, got %d probes", n)
+	}
+}
+
+func TestCLIVersionProbeUsesEnvPolicy(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	cliPath := writeFakeCLI(t, `
+if [ "$1" = "-v" ]; then
+	env > `+envFile+`
+	echo "`+claude.RecommendedCLIVersion+` (Claude Code)"
+	exit 0
+fi
+cat > /dev/null`)
+	t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "")
+	t.Setenv("PROBE_TEST_SECRET", "hunter22")
+	claude.ResetCLICache()
+	t.Cleanup(claude.ResetCLICache)
+
+	info, err := claude.ResolveCLI(context.Background(), &claude.ClaudeAgentOptions{
+		CliPath:   &cliPath,
+		EnvPolicy: claude.EnvPolicyClean,
+		Env:       map[string]string{"PROBE_TEST_OPTION": "1"},
+	})
+	if err != nil {
+		t.Fatalf("ResolveCLI failed: %v", err)
+	}
+	if info.Version != claude.RecommendedCLIVersion {
+		t.Fatalf("Expected the probed version, got %+v", info)
+	}
+
+	env, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(env), "PROBE_TEST_SECRET") {
+		t.Error("A variable EnvPolicyClean denies reached the version probe")
+	}
+	if !strings.Contains(string(env), "PROBE_TEST_OPTION=1") {
+		t.Errorf("Expected the options' Env in the version probe, got:\n%s", env)
+	}
+}
+
+func TestCapabilitiesForVersion(t *testing.T) {
+	tests := []struct {
+		version           string
+		fileCheckpointing bool
+		permissionHooks   bool
+	}{
+		{"2.0.50", false, false},
+		{"2.0.62", true, false},
+		{"2.0.76", true, false},
+		{"2.1.33", true, true},
+		{"3.0.0", true, true},
+		{"", true, true},
+	}
+	for _, tt := range tests {
+		caps := claude.CapabilitiesForVersion(tt.version)
+		if caps.FileCheckpointing != tt.fileCheckpointing ||
+			caps.SupportsHookEvent(claude.HookEventPermissionRequest) != tt.permissionHooks {
+			t.Errorf("CapabilitiesForVersion(%q) = %+v", tt.version, caps)
+		}
+		if !caps.SupportsHookEvent(claude.HookEventPreToolUse) {
+			t.Errorf("CapabilitiesForVersion(%q) should support PreToolUse", tt.version)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the .golden.json files under testdata/stream-json")
+
+// Fields of CLI output the SDK reads or deliberately ignores, keyed by the
+// object they appear in. A field missing from both lists means the CLI's
+// output changed and the parser needs a decision: map it or ignore it.
+var (
+	parsedFields = map[string][]string{
+		"user":              {"type", "message", "uuid", "parent_tool_use_id", "tool_use_result"},
+		"user.message":      {"content"},
+		"assistant":         {"type", "message", "parent_tool_use_id", "error"},
+		"assistant.message": {"model", "content"},
+		"result": {"type", "subtype", "duration_ms", "duration_api_ms", "is_error", "num_turns", "session_id",
+			"total_cost_usd", "usage", "result", "structured_output"},
+		"stream_event":       {"type", "uuid", "session_id", "event", "parent_tool_use_id"},
+		"block.text":         {"type", "text"},
+		"block.thinking":     {"type", "thinking", "signature"},
+		"block.tool_use":     {"type", "id", "name", "input"},
+		"block.tool_result":  {"type", "tool_use_id", "content", "is_error"},
+		"block.image":        {"type", "source", "data", "mimeType"},
+		"block.image.source": {"type", "media_type", "data"},
+	}
+	ignoredFields = map[string][]string{
+		"user":              {"session_id"},
+		"user.message":      {"role"},
+		"assistant":         {"session_id", "uuid"},
+		"assistant.message": {"id", "type", "role", "stop_reason", "stop_sequence", "usage"},
+		"result":            {"uuid", "modelUsage", "permission_denials", "errors"},
+	}
+)
+
+// goldenFrame is the parsed form of one line of a transcript.
+type goldenFrame struct {
+	Type      string         `json:"type"`
+	Blocks    []string       `json:"blocks,omitempty"`
+	Message   claude.Message `json:"message,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Subtype   string         `json:"subtype,omitempty"`
+}
+
+// TestStreamJSONConformance decodes and parses every transcript under
+// testdata/stream-json, synthetic and recorded, and compares the typed result
+// with its golden file. Run with -update after deliberately changing the
+// parser.
+func TestStreamJSONConformance(t *testing.T) {
+	transcripts, err := filepath.Glob(filepath.Join("testdata", "stream-json", "*", "*.jsonl"))
+	if err != nil || len(transcripts) == 0 {
+		t.Fatalf("No transcripts found: %v", err)
+	}
+
+	for _, path := range transcripts {
+		name := filepath.Base(filepath.Dir(path)) + "/" + strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			frames, err := claude.DecodeStreamJSON(bytes.NewReader(raw), 1024*1024)
+			if err != nil {
+				t.Fatalf("DecodeStreamJSON failed: %v", err)
+			}
+			if lines := bytes.Count(raw, []byte("\n")); len(frames) != lines {
+				t.Fatalf("Decoded %d frames from %d lines", len(frames), lines)
+			}
+
+			var parsed []goldenFrame
+			for i, frame := range frames {
+				where := fmt.Sprintf("%s:%d", filepath.Base(path), i+1)
+				checkKnownFields(t, where, frame)
+				parsed = append(parsed, parseGoldenFrame(t, where, frame))
+			}
+
+			got, err := json.MarshalIndent(parsed, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			goldenPath := strings.TrimSuffix(path, ".jsonl") + ".golden.json"
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Missing golden file (run with -update): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Parsed output differs from %s (run with -update if intended):\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// parseGoldenFrame parses a frame the way the SDK routes it.
+func parseGoldenFrame(t *testing.T, where string, frame map[string]interface{}) goldenFrame {
+	msgType, _ := frame["type"].(string)
+
+	// Control frames are routed by request_id and subtype, never parsed
+	if strings.HasPrefix(msgType, "control_") {
+		g := goldenFrame{Type: msgType}
+		if msgType == "control_response" {
+			response, _ := frame["response"].(map[string]interface{})
+			g.RequestID, _ = response["request_id"].(string)
+			g.Subtype, _ = response["subtype"].(string)
+		} else {
+			g.RequestID, _ = frame["request_id"].(string)
+			request, _ := frame["request"].(map[string]interface{})
+			g.Subtype, _ = request["subtype"].(string)
+			if g.Subtype == "" && msgType == "control_request" {
+				t.Errorf("%s: control_request without subtype", where)
+			}
+		}
+		if g.RequestID == "" {
+			t.Errorf("%s: %s without request_id", where, msgType)
+		}
+		return g
+	}
+
+	msg, err := claude.ParseMessage(frame)
+	if err != nil {
+		t.Errorf("%s: ParseMessage failed: %v", where, err)
+		return goldenFrame{Type: msgType}
+	}
+
+	g := goldenFrame{Type: fmt.Sprintf("%T", msg), Message: msg}
+	var blocks []claude.ContentBlock
+	switch m := msg.(type) {
+	case *claude.AssistantMessage:
+		blocks = m.Content
+	case *claude.UserMessage:
+		blocks, _ = m.Content.([]claude.ContentBlock)
+	}
+	for _, block := range blocks {
+		g.Blocks = append(g.Blocks, fmt.Sprintf("%T", block))
+	}
+	return g
+}
+
+// checkKnownFields reports fields of a frame the parser neither reads nor
+// deliberately ignores.
+func checkKnownFields(t *testing.T, where string, frame map[string]interface{}) {
+	msgType, _ := frame["type"].(string)
+	if _, ok := parsedFields[msgType]; !ok {
+		// System messages keep every field in Data; control frames are routed
+		return
+	}
+	checkObjectFields(t, where, msgType, frame)
+
+	message, _ := frame["message"].(map[string]interface{})
+	if message == nil {
+		return
+	}
+	checkObjectFields(t, where, msgType+".message", message)
+
+	content, _ := message["content"].([]interface{})
+	for _, item := range content {
+		block, _ := item.(map[string]interface{})
+		blockType, _ := block["type"].(string)
+		checkObjectFields(t, where, "block."+blockType, block)
+		if source, ok := block["source"].(map[string]interface{}); ok {
+			checkObjectFields(t, where, "block."+blockType+".source", source)
+		}
+	}
+}
+
+func checkObjectFields(t *testing.T, where, object string, data map[string]interface{}) {
+	known := map[string]bool{}
+	for _, field := range parsedFields[object] {
+		known[field] = true
+	}
+	for _, field := range ignoredFields[object] {
+		known[field] = true
+	}
+	if len(known) == 0 {
+		t.Errorf("%s: unknown object %q; the parser does not handle it", where, object)
+		return
+	}
+
+	var unknown []string
+	for field := range data {
+		if !known[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	if len(unknown) > 0 {
+		t.Errorf("%s: %s has fields the parser does not handle: %v", where, object, unknown)
+	}
+}
@@ -0,0 +1,180 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// fakeInitResponder is a shell snippet for fake CLIs that answers the SDK's
+// initialize control request so clients can connect.
+const fakeInitResponder = `
+read line
+id=$(echo "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+`
+
+// captureLaunchEnv connects to a fake CLI and returns the environment the
+// transport passed to the command launcher.
+func captureLaunchEnv(t *testing.T, options *claude.ClaudeAgentOptions) map[string]string {
+	t.Helper()
+
+	var env []string
+	options.CommandLauncher = func(ctx context.Context, spec claude.LaunchSpec) (claude.LaunchSpec, error) {
+		env = spec.Env
+		return spec, nil
+	}
+	transport := connectFakeCLI(t, writeFakeCLI(t, `cat > /dev/null`), options)
+	transport.Close()
+
+	result := make(map[string]string)
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		result[name] = value
+	}
+	return result
+}
+
+func TestEnvPolicyInheritIsDefault(t *testing.T) {
+	t.Setenv("SERVICE_DB_PASSWORD", "hunter2")
+
+	env := captureLaunchEnv(t, &claude.ClaudeAgentOptions{})
+
+	if env["SERVICE_DB_PASSWORD"] != "hunter2" {
+		t.Error("Default policy should inherit the SDK's environment")
+	}
+	if env["CLAUDE_CODE_ENTRYPOINT"] != "sdk-go" {
+		t.Errorf("Expected entrypoint sdk-go, got %q", env["CLAUDE_CODE_ENTRYPOINT"])
+	}
+}
+
+func TestEnvPolicyAllowlist(t *testing.T) {
+	t.Setenv("SERVICE_DB_PASSWORD", "hunter2")
+	t.Setenv("LC_TEST_LOCALE", "C")
+	t.Setenv("APP_REGION", "eu")
+
+	env := captureLaunchEnv(t, &claude.ClaudeAgentOptions{
+		EnvPolicy:    claude.EnvPolicyAllowlist,
+		EnvAllowlist: []string{"PATH", "LC_*", "APP_REGION"},
+	})
+
+	if _, ok := env["SERVICE_DB_PASSWORD"]; ok {
+		t.Error("Allowlist policy should drop variables not on the list")
+	}
+	if env["LC_TEST_LOCALE"] != "C" {
+		t.Error("Prefix pattern LC_* should match LC_TEST_LOCALE")
+	}
+	if env["APP_REGION"] != "eu" {
+		t.Error("Exact name APP_REGION should be kept")
+	}
+	if env["PATH"] != os.Getenv("PATH") {
+		t.Error("PATH should be kept")
+	}
+}
+
+func TestEnvPolicyAllowlistDefault(t *testing.T) {
+	t.Setenv("SERVICE_DB_PASSWORD", "hunter2")
+
+	env := captureLaunchEnv(t, &claude.ClaudeAgentOptions{EnvPolicy: claude.EnvPolicyAllowlist})
+
+	if _, ok := env["SERVICE_DB_PASSWORD"]; ok {
+		t.Error("Default allowlist should drop service credentials")
+	}
+	if env["PATH"] == "" {
+		t.Error("Default allowlist should keep PATH")
+	}
+}
+
+func TestEnvPolicyCleanWithExplicitValues(t *testing.T) {
+	t.Setenv("SERVICE_DB_PASSWORD", "hunter2")
+
+	env := captureLaunchEnv(t, &claude.ClaudeAgentOptions{
+		EnvPolicy: claude.EnvPolicyClean,
+		Env:       map[string]string{"PATH": "/usr/bin:/bin"},
+		SecretEnv: map[string]claude.Secret{"ANTHROPIC_API_KEY": "sk-test"},
+	})
+
+	if _, ok := env["SERVICE_DB_PASSWORD"]; ok {
+		t.Error("Clean policy should not inherit anything")
+	}
+	if _, ok := env["HOME"]; ok {
+		t.Error("Clean policy should not inherit HOME")
+	}
+	if env["PATH"] != "/usr/bin:/bin" {
+		t.Errorf("Expected explicit PATH, got %q", env["PATH"])
+	}
+	if env["ANTHROPIC_API_KEY"] != "sk-test" {
+		t.Error("Secret values must reach the CLI unredacted")
+	}
+	if env["CLAUDE_AGENT_SDK_VERSION"] == "" {
+		t.Error("SDK variables should always be set")
+	}
+}
+
+func TestSecretEnvIsRedacted(t *testing.T) {
+	options := &claude.ClaudeAgentOptions{
+		EnvPolicy: claude.EnvPolicyClean,
+		SecretEnv: map[string]claude.Secret{"ANTHROPIC_API_KEY": "sk-test"},
+	}
+	transport, err := claude.NewSubprocessCLITransport("", options, "/bin/true")
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	env := strings.Join(transport.RedactedEnv(), "\n")
+	if strings.Contains(env, "sk-test") {
+		t.Errorf("RedactedEnv leaked the secret: %s", env)
+	}
+	if !strings.Contains(env, "ANTHROPIC_API_KEY=[REDACTED]") {
+		t.Errorf("Expected redacted placeholder, got %s", env)
+	}
+
+	secret := options.SecretEnv["ANTHROPIC_API_KEY"]
+	for _, formatted := range []string{
+		fmt.Sprint(secret),
+		fmt.Sprintf("%v %s %#v", secret, secret, secret),
+		fmt.Sprintf("%+v", options.SecretEnv),
+	} {
+		if strings.Contains(formatted, "sk-test") {
+			t.Errorf("Formatting leaked the secret: %s", formatted)
+		}
+	}
+	data, _ := json.Marshal(options.SecretEnv)
+	if strings.Contains(string(data), "sk-test") {
+		t.Errorf("JSON leaked the secret: %s", data)
+	}
+	if secret.Reveal() != "sk-test" {
+		t.Error("Reveal should return the secret value")
+	}
+}
+
+func TestClientSetsEntrypointOnChildOnly(t *testing.T) {
+	t.Setenv("CLAUDE_CODE_ENTRYPOINT", "outer-service")
+
+	out := filepath.Join(t.TempDir(), "entrypoint")
+	cliPath := writeFakeCLI(t, `echo "$CLAUDE_CODE_ENTRYPOINT" > `+out+fakeInitResponder+`cat > /dev/null`)
+
+	client := claude.NewClaudeSDKClient(&claude.ClaudeAgentOptions{CliPath: &cliPath})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if got := waitForFile(t, out, 2*time.Second); got != "sdk-go-client" {
+		t.Errorf("Expected child entrypoint sdk-go-client, got %q", got)
+	}
+	if got := os.Getenv("CLAUDE_CODE_ENTRYPOINT"); got != "outer-service" {
+		t.Errorf("Process environment was mutated: CLAUDE_CODE_ENTRYPOINT=%q", got)
+	}
+}
@@ -0,0 +1,154 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// corpusLines returns every line of the stream-json transcripts, used to
+// seed the fuzz targets with well-formed CLI output.
+func corpusLines(f *testing.F) [][]byte {
+	f.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "stream-json", "*", "*.jsonl"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	var lines [][]byte
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+		file.Close()
+	}
+	return lines
+}
+
+// FuzzParseMessage checks that arbitrary JSON objects either parse or return
+// an error with a nil message, and that parsed messages can be marshaled.
+func FuzzParseMessage(f *testing.F) {
+	for _, line := range corpusLines(f) {
+		f.Add(line)
+	}
+	f.Add([]byte(`{"type":"result","subtype":"success","duration_ms":1e308,"duration_api_ms":-1,"is_error":false,"num_turns":1e20,"session_id":""}`))
+	f.Add([]byte(`{"type":"user","message":{"content":[null]}}`))
+	f.Add([]byte(`{"type":"assistant","message":{"model":"m","content":[{"type":"image","source":{}}]}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return
+		}
+
+		msg, err := claude.ParseMessage(raw)
+		if err != nil {
+			if msg != nil {
+				t.Fatalf("ParseMessage returned both %T and error %v", msg, err)
+			}
+			return
+		}
+		if msg == nil {
+			t.Fatal("ParseMessage returned nil message without error")
+		}
+		if _, err := json.Marshal(msg); err != nil {
+			t.Fatalf("Parsed %T does not marshal: %v", msg, err)
+		}
+	})
+}
+
+// FuzzParseContentBlock checks that arbitrary JSON values either parse into
+// a content block or return an error.
+func FuzzParseContentBlock(f *testing.F) {
+	for _, line := range corpusLines(f) {
+		var frame struct {
+			Message struct {
+				Content []json.RawMessage `json:"content"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(line, &frame) == nil {
+			for _, block := range frame.Message.Content {
+				f.Add([]byte(block))
+			}
+		}
+	}
+	f.Add([]byte(`"text"`))
+	f.Add([]byte(`{"type":"tool_use","id":"t","name":"n","input":null}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var item interface{}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return
+		}
+
+		block, err := claude.ParseContentBlock(item)
+		if (block == nil) == (err == nil) {
+			t.Fatalf("ParseContentBlock returned block %#v and error %v", block, err)
+		}
+	})
+}
+
+// FuzzStreamFraming checks the stdout line accumulation: arbitrary output
+// never panics or exceeds the buffer limit silently, and well-formed objects
+// survive being split across lines.
+func FuzzStreamFraming(f *testing.F) {
+	for _, line := range corpusLines(f) {
+		f.Add(line, len(line)/2)
+	}
+	f.Add([]byte(`{"type":"user"}{"type":"assistant"}`), 7)
+	f.Add([]byte("null\n{\"a\":1}\n"), 0)
+
+	const maxBufferSize = 64 * 1024
+
+	f.Fuzz(func(t *testing.T, output []byte, split int) {
+		// Arbitrary output: errors are allowed, panics are not
+		messages, err := claude.DecodeStreamJSON(bytes.NewReader(output), maxBufferSize)
+		if err == nil {
+			for _, msg := range messages {
+				if msg == nil {
+					t.Fatal("DecodeStreamJSON returned a nil message")
+				}
+			}
+		}
+
+		// A single compact object split at an arbitrary point into two lines
+		// must decode to exactly that object
+		var object map[string]interface{}
+		if json.Unmarshal(output, &object) != nil || object == nil {
+			return
+		}
+		compact, _ := json.Marshal(object)
+		if len(compact) > maxBufferSize || split <= 0 || split >= len(compact) {
+			return
+		}
+		first, second := string(compact[:split]), string(compact[split:])
+		if strings.TrimSpace(first) != first || strings.TrimSpace(second) != second {
+			// Whitespace at the split point is trimmed by design
+			return
+		}
+		if json.Valid([]byte(first)) {
+			return
+		}
+
+		decoded, err := claude.DecodeStreamJSON(strings.NewReader(first+"\n"+second+"\n"), maxBufferSize)
+		if err != nil {
+			t.Fatalf("DecodeStreamJSON(%q | %q) failed: %v", first, second, err)
+		}
+		if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], object) {
+			t.Fatalf("DecodeStreamJSON(%q | %q) = %v, want %v", first, second, decoded, object)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+//go:build linux
+
+package unit
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+func TestResourceLimitsAppliedToCLI(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "limits")
+	// Limits hold from the first instruction, for the CLI and its children
+	cliPath := writeFakeCLI(t, `
+echo "$(ulimit -n) $(ulimit -t) $(sh -c 'ulimit -n')" > `+out+`
+cat > /dev/null`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		ResourceLimits: &claude.ResourceLimits{
+			OpenFiles:  256,
+			CPUSeconds: 120,
+		},
+	})
+	defer transport.Close()
+
+	if got := waitForFile(t, out, 2*time.Second); got != "256 120 256" {
+		t.Errorf("Expected limits '256 120 256', got %q", got)
+	}
+}
+
+func TestCPULimitViolationReturnsResourceLimitError(t *testing.T) {
+	cliPath := writeFakeCLI(t, `while :; do :; done`)
+
+	err := runFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		ResourceLimits: &claude.ResourceLimits{CPUSeconds: 1},
+	})
+
+	var limitErr *claude.ResourceLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected ResourceLimitError, got %T: %v", err, err)
+	}
+	if limitErr.Resource != claude.ResourceLimitCPUTime {
+		t.Errorf("Expected cpu_time, got %q", limitErr.Resource)
+	}
+	if limitErr.Limit != 1 {
+		t.Errorf("Expected limit 1, got %d", limitErr.Limit)
+	}
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatal("ResourceLimitError should wrap the ProcessError")
+	}
+	if procErr.Signal != "SIGXCPU" {
+		t.Errorf("Expected SIGXCPU, got %q", procErr.Signal)
+	}
+}
+
+func TestOpenFilesViolationReturnsResourceLimitError(t *testing.T) {
+	cliPath := writeFakeCLI(t, `echo "Error: EMFILE: too many open files, open '/tmp/x'" >&2; exit 1`)
+
+	err := runFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		ResourceLimits: &claude.ResourceLimits{OpenFiles: 64},
+	})
+
+	var limitErr *claude.ResourceLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected ResourceLimitError, got %T: %v", err, err)
+	}
+	if limitErr.Resource != claude.ResourceLimitOpenFiles {
+		t.Errorf("Expected open_files, got %q", limitErr.Resource)
+	}
+}
+
+func TestFailureWithoutLimitsIsPlainProcessError(t *testing.T) {
+	cliPath := writeFakeCLI(t, `echo "Error: EMFILE: too many open files" >&2; exit 1`)
+
+	err := runFakeCLI(t, cliPath, nil)
+
+	var limitErr *claude.ResourceLimitError
+	if errors.As(err, &limitErr) {
+		t.Fatalf("Expected no ResourceLimitError without configured limits, got %v", err)
+	}
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+	}
+}
+
+func TestRunAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("running the CLI as another user requires root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("user 'nobody' not found")
+	}
+
+	// The test's temp directories are private; open them up for nobody
+	dir := t.TempDir()
+	out := filepath.Join(dir, "whoami")
+	cliPath := writeFakeCLI(t, `echo "$(id -u) $HOME $(ulimit -n)" > `+out+`; cat > /dev/null`)
+	for _, d := range []string{dir, filepath.Dir(cliPath), filepath.Dir(dir)} {
+		os.Chmod(d, 0777)
+	}
+
+	// Limits are set by prlimit running as the user, not by this program
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		User:           stringPtr("nobody"),
+		ResourceLimits: &claude.ResourceLimits{OpenFiles: 128},
+	})
+	defer transport.Close()
+
+	got := waitForFile(t, out, 2*time.Second)
+	expected := nobody.Uid + " " + nobody.HomeDir + " 128"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestUnknownUserFailsConnect(t *testing.T) {
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+
+	transport, err := claude.NewSubprocessCLITransport("", &claude.ClaudeAgentOptions{
+		User: stringPtr("no-such-user-for-claude-sdk"),
+	}, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	err = transport.Connect(t.Context())
+	var connErr *claude.CLIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("Expected CLIConnectionError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "no-such-user-for-claude-sdk") {
+		t.Errorf("Expected error to name the user, got %v", err)
+	}
+}
+
+func TestMissingPrlimitFailsConnect(t *testing.T) {
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+
+	transport, err := claude.NewSubprocessCLITransport("", &claude.ClaudeAgentOptions{
+		ResourceLimits: &claude.ResourceLimits{
+			OpenFiles:   256,
+			PrlimitPath: filepath.Join(t.TempDir(), "prlimit"),
+		},
+	}, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	err = transport.Connect(t.Context())
+	var connErr *claude.CLIConnectionError
+	if !errors.As(err, &connErr) || !strings.Contains(err.Error(), "prlimit") {
+		t.Fatalf("Expected a CLIConnectionError naming prlimit, got %T: %v", err, err)
+	}
+}
+
+func TestMissingCgroupFailsConnect(t *testing.T) {
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+
+	transport, err := claude.NewSubprocessCLITransport("", &claude.ClaudeAgentOptions{
+		ResourceLimits: &claude.ResourceLimits{CgroupPath: filepath.Join(t.TempDir(), "missing")},
+	}, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	err = transport.Connect(t.Context())
+	var connErr *claude.CLIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("Expected CLIConnectionError, got %T: %v", err, err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected cause to be os.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+func TestPrefixLauncherWrapsCommand(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "wrapper.log")
+	out := filepath.Join(dir, "cli.out")
+
+	wrapper := filepath.Join(dir, "wrapper")
+	script := "#!/bin/sh\necho \"$@\" > " + log + "\nexec \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write wrapper: %v", err)
+	}
+
+	cliPath := writeFakeCLI(t, `echo "$FROM_OPTIONS" > `+out+`; cat > /dev/null`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Env:             map[string]string{"FROM_OPTIONS": "passed-through"},
+		CommandLauncher: claude.PrefixLauncher(wrapper),
+	})
+	defer transport.Close()
+
+	if got := waitForFile(t, out, 2*time.Second); got != "passed-through" {
+		t.Errorf("Expected env to reach the CLI, got %q", got)
+	}
+
+	logged := waitForFile(t, log, 2*time.Second)
+	if !strings.HasPrefix(logged, cliPath+" --output-format stream-json") {
+		t.Errorf("Expected wrapper to receive CLI path and args, got %q", logged)
+	}
+}
+
+func TestCommandLauncherErrorFailsConnect(t *testing.T) {
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+	launchErr := errors.New("no sandbox available")
+
+	transport, err := claude.NewSubprocessCLITransport("", &claude.ClaudeAgentOptions{
+		CommandLauncher: func(ctx context.Context, spec claude.LaunchSpec) (claude.LaunchSpec, error) {
+			return spec, launchErr
+		},
+	}, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	err = transport.Connect(context.Background())
+	if !errors.Is(err, launchErr) {
+		t.Fatalf("Expected launcher error to be wrapped, got %v", err)
+	}
+	if transport.IsReady() {
+		t.Error("Transport should not be ready after launcher failure")
+	}
+}
+
+func TestCommandLauncherReceivesSpec(t *testing.T) {
+	cwd := t.TempDir()
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+
+	var got claude.LaunchSpec
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Cwd: &cwd,
+		Env: map[string]string{"CUSTOM": "1"},
+		CommandLauncher: func(ctx context.Context, spec claude.LaunchSpec) (claude.LaunchSpec, error) {
+			got = spec
+			return spec, nil
+		},
+	})
+	defer transport.Close()
+
+	if got.Path != cliPath {
+		t.Errorf("Expected path %s, got %s", cliPath, got.Path)
+	}
+	if got.Dir != cwd {
+		t.Errorf("Expected dir %s, got %s", cwd, got.Dir)
+	}
+	if !containsString(got.Env, "CUSTOM=1") || !containsString(got.Env, "CLAUDE_CODE_ENTRYPOINT=sdk-go") {
+		t.Errorf("Expected env to contain custom and SDK variables, got %v", got.Env)
+	}
+	if !containsString(got.Args, "--input-format") {
+		t.Errorf("Expected CLI args, got %v", got.Args)
+	}
+}
+
+func TestBubblewrapLauncherSpec(t *testing.T) {
+	launcher := claude.BubblewrapLauncher(claude.BubblewrapOptions{
+		WritablePaths: []string{"/home/agent/.claude"},
+	})
+
+	spec, err := launcher(context.Background(), claude.LaunchSpec{
+		Path: "/usr/local/bin/claude",
+		Args: []string{"--output-format", "stream-json"},
+		Env:   []string{"A=1"},
+		Dir:   "/work",
+		Files: []string{"/tmp/claude-sdk-args-1/system-prompt.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Launcher failed: %v", err)
+	}
+
+	if spec.Path != "bwrap" {
+		t.Errorf("Expected bwrap, got %s", spec.Path)
+	}
+	args := strings.Join(spec.Args, " ")
+	for _, expected := range []string{
+		"--ro-bind / /",
+		"--tmpfs /tmp",
+		"--share-net",
+		"--ro-bind /tmp/claude-sdk-args-1/system-prompt.txt /tmp/claude-sdk-args-1/system-prompt.txt",
+		"--bind /home/agent/.claude /home/agent/.claude",
+		"--bind /work /work --chdir /work",
+		"-- /usr/local/bin/claude --output-format stream-json",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expected bwrap args to contain %q, got %q", expected, args)
+		}
+	}
+	if !strings.HasSuffix(args, "stream-json") {
+		t.Errorf("CLI args should come last, got %q", args)
+	}
+	if len(spec.Env) != 1 || spec.Env[0] != "A=1" {
+		t.Errorf("Expected env to pass through, got %v", spec.Env)
+	}
+}
+
+func TestBubblewrapLauncherRunsCLI(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bwrap not installed")
+	}
+
+	cwd := t.TempDir()
+	cliPath := writeFakeCLI(t, `
+touch /readonly-check 2>/dev/null && echo writable-root > result || echo readonly-root > result
+cat > /dev/null`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Cwd: &cwd,
+		CommandLauncher: claude.BubblewrapLauncher(claude.BubblewrapOptions{
+			ReadOnlyPaths: []string{filepath.Dir(cliPath)},
+		}),
+	})
+	defer transport.Close()
+
+	if got := waitForFile(t, filepath.Join(cwd, "result"), 5*time.Second); got != "readonly-root" {
+		t.Errorf("Expected read-only root with writable cwd, got %q", got)
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
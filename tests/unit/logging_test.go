@@ -0,0 +1,123 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+// logBuffer collects JSON log records at every level.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) logger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// records returns the logged records whose message is msg.
+func (b *logBuffer) records(t *testing.T, msg string) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var found []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		if record["msg"] == msg {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+func TestLoggerRecordsControlRequests(t *testing.T) {
+	logs := &logBuffer{}
+	input := map[string]interface{}{"command": "ls"}
+	scenario := claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		RequestPermission("Bash", input, claudetest.ExpectAllow()).
+		Emit(claudetest.Result("s1"))
+
+	options := &claude.ClaudeAgentOptions{Logger: logs.logger(), CanUseTool: allowBash}
+	if _, err := collectQuery(t, "List the files", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	sent := logs.records(t, "claude: sending control request")
+	if len(sent) == 0 || sent[0]["subtype"] != "initialize" || sent[0]["request_id"] == "" {
+		t.Errorf("Expected the initialize request to be logged with its request ID, got %v", sent)
+	}
+
+	received := logs.records(t, "claude: received control request")
+	if len(received) != 1 {
+		t.Fatalf("Expected one received control request, got %v", received)
+	}
+	record := received[0]
+	if record["level"] != "DEBUG" || record["subtype"] != "can_use_tool" || record["session_id"] != "s1" {
+		t.Errorf("Unexpected record %v", record)
+	}
+	if id, _ := record["request_id"].(string); id == "" {
+		t.Errorf("Expected a request_id attribute, got %v", record)
+	}
+}
+
+func TestLoggerRecordsParseErrors(t *testing.T) {
+	logs := &logBuffer{}
+	scenario := claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("Hi").
+		Emit(map[string]interface{}{"type": "assistant", "session_id": "s1", "message": "not an object"})
+
+	options := &claude.ClaudeAgentOptions{Logger: logs.logger()}
+	if _, err := collectQuery(t, "Hi", options, claudetest.NewTransport(t, scenario)); err == nil {
+		t.Fatal("Expected the malformed message to fail the query")
+	}
+
+	records := logs.records(t, "claude: failed to parse message")
+	if len(records) != 1 {
+		t.Fatalf("Expected one parse error record, got %v", records)
+	}
+	if r := records[0]; r["level"] != "ERROR" || r["type"] != "assistant" || r["session_id"] != "s1" || r["error"] == "" {
+		t.Errorf("Unexpected record %v", r)
+	}
+}
+
+func TestLoggerRecordsFailedControlResponses(t *testing.T) {
+	logs := &logBuffer{}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Hi").
+		RequestPermission("Bash", map[string]interface{}{"command": "ls"}, claudetest.ExpectError()).
+		Emit(claudetest.Result("s1"))
+
+	// No CanUseTool, so the permission request fails
+	options := &claude.ClaudeAgentOptions{Logger: logs.logger()}
+	if _, err := collectQuery(t, "Hi", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	records := logs.records(t, "claude: control request handler failed")
+	if len(records) != 1 || records[0]["level"] != "WARN" || records[0]["subtype"] != "can_use_tool" {
+		t.Errorf("Expected a warning for the failed permission request, got %v", records)
+	}
+}
@@ -0,0 +1,295 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudemetrics"
+	"github.com/Facets-cloud/claude-agent-sdk-go/claudetest"
+)
+
+// recordingMetrics keeps every counter and observation in memory.
+type recordingMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]float64
+	observations map[string][]float64
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counters: make(map[string]float64), observations: make(map[string][]float64)}
+}
+
+// metricKey renders name and labels like name{a=1,b=2}.
+func metricKey(name string, labels claude.Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *recordingMetrics) Add(name string, delta float64, labels claude.Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[metricKey(name, labels)] += delta
+}
+
+func (m *recordingMetrics) Observe(name string, value float64, labels claude.Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey(name, labels)
+	m.observations[key] = append(m.observations[key], value)
+}
+
+func (m *recordingMetrics) counter(key string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[key]
+}
+
+func (m *recordingMetrics) observed(key string) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.observations[key]
+}
+
+func TestMetricsForQuery(t *testing.T) {
+	metrics := newRecordingMetrics()
+	input := map[string]interface{}{"command": "ls"}
+	result := claudetest.Result("s1")
+	result["usage"] = map[string]interface{}{"input_tokens": 120, "output_tokens": 45}
+
+	scenario := claudetest.NewScenario().
+		Emit(claudetest.SystemInit("s1")).
+		ExpectUserMessage("List the files").
+		Emit(claudetest.ToolUse("tu_1", "Bash", input)).
+		CallHook(claude.HookEventPreToolUse, map[string]interface{}{"tool_name": "Bash", "tool_input": input}, claudetest.ExpectSuccess()).
+		RequestPermission("Bash", input, claudetest.ExpectAllow()).
+		RequestPermission("Write", map[string]interface{}{"path": "x"}, claudetest.ExpectDeny()).
+		Emit(claudetest.ToolResult("tu_1", "main.go")).
+		Emit(result)
+
+	options := &claude.ClaudeAgentOptions{
+		Metrics:    metrics,
+		CanUseTool: allowBash,
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{
+				Hooks: []claude.HookCallback{
+					func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+						return claude.HookJSONOutput{}, nil
+					},
+				},
+			}},
+		},
+	}
+	if _, err := collectQuery(t, "List the files", options, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	for key, want := range map[string]float64{
+		"claude_turns_total{model=claude-sonnet-4-5,outcome=success}": 1,
+		"claude_cost_usd_total{model=claude-sonnet-4-5}":              0.001,
+		"claude_tokens_total{model=claude-sonnet-4-5,type=input}":     120,
+		"claude_tokens_total{model=claude-sonnet-4-5,type=output}":    45,
+		"claude_tool_calls_total{tool=Bash}":                          1,
+		"claude_permission_decisions_total{behavior=allow,tool=Bash}": 1,
+		"claude_permission_decisions_total{behavior=deny,tool=Write}": 1,
+		"claude_parse_errors_total":                                   0,
+	} {
+		if got := metrics.counter(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if d := metrics.observed("claude_turn_duration_seconds{model=claude-sonnet-4-5}"); len(d) != 1 || d[0] != 0.1 {
+		t.Errorf("Expected a 0.1s turn duration, got %v", d)
+	}
+	if d := metrics.observed("claude_turn_api_duration_seconds{model=claude-sonnet-4-5}"); len(d) != 1 || d[0] != 0.08 {
+		t.Errorf("Expected a 0.08s API duration, got %v", d)
+	}
+	if d := metrics.observed("claude_hook_duration_seconds{event=PreToolUse}"); len(d) != 1 {
+		t.Errorf("Expected one hook latency observation, got %v", d)
+	}
+}
+
+func TestMetricsUseModelUsage(t *testing.T) {
+	metrics := newRecordingMetrics()
+	result := claudetest.Result("s1")
+	result["modelUsage"] = map[string]interface{}{
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 100, "outputTokens": 20, "costUSD": 0.002},
+		"claude-haiku-4-5":  map[string]interface{}{"inputTokens": 50, "outputTokens": 5, "costUSD": 0.0001},
+	}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Hi").
+		Emit(claudetest.AssistantText("Hello")).
+		Emit(result)
+
+	if _, err := collectQuery(t, "Hi", &claude.ClaudeAgentOptions{Metrics: metrics}, claudetest.NewTransport(t, scenario)); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for key, want := range map[string]float64{
+		"claude_cost_usd_total{model=claude-sonnet-4-5}":           0.002,
+		"claude_cost_usd_total{model=claude-haiku-4-5}":            0.0001,
+		"claude_tokens_total{model=claude-haiku-4-5,type=input}":   50,
+		"claude_tokens_total{model=claude-sonnet-4-5,type=output}": 20,
+	} {
+		if got := metrics.counter(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestMetricsCountSessionTotalsOnce(t *testing.T) {
+	metrics := newRecordingMetrics()
+
+	// Each result repeats the session's totals so far
+	first := claudetest.Result("s1")
+	first["total_cost_usd"] = 0.002
+	first["modelUsage"] = map[string]interface{}{
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 100, "outputTokens": 20, "costUSD": 0.002},
+	}
+	second := claudetest.Result("s1")
+	second["total_cost_usd"] = 0.0051
+	second["modelUsage"] = map[string]interface{}{
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 250, "outputTokens": 50, "costUSD": 0.005},
+		"claude-haiku-4-5":  map[string]interface{}{"inputTokens": 40, "outputTokens": 4, "costUSD": 0.0001},
+	}
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("one").
+		Emit(claudetest.AssistantText("first")).
+		Emit(first).
+		ExpectUserMessage("two").
+		Emit(claudetest.AssistantText("second")).
+		Emit(second)
+
+	client := claude.NewClaudeSDKClientWithTransport(&claude.ClaudeAgentOptions{Metrics: metrics}, claudetest.NewTransport(t, scenario))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+	for _, prompt := range []string{"one", "two"} {
+		msgCh, errCh := client.Query(ctx, prompt)
+		for range msgCh {
+		}
+		if err := <-errCh; err != nil {
+			t.Fatalf("Turn %q failed: %v", prompt, err)
+		}
+	}
+
+	for key, want := range map[string]float64{
+		"claude_tokens_total{model=claude-sonnet-4-5,type=input}":  250,
+		"claude_tokens_total{model=claude-sonnet-4-5,type=output}": 50,
+		"claude_tokens_total{model=claude-haiku-4-5,type=input}":   40,
+	} {
+		if got := metrics.counter(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if got := metrics.counter("claude_cost_usd_total{model=claude-sonnet-4-5}"); math.Abs(got-0.005) > 1e-9 {
+		t.Errorf("Expected the session's $0.005 for sonnet, got %v", got)
+	}
+	if got := metrics.counter("claude_cost_usd_total{model=claude-haiku-4-5}"); math.Abs(got-0.0001) > 1e-9 {
+		t.Errorf("Expected the session's $0.0001 for haiku, got %v", got)
+	}
+}
+
+func TestMetricsCountParseErrors(t *testing.T) {
+	metrics := newRecordingMetrics()
+	scenario := claudetest.NewScenario().
+		ExpectUserMessage("Hi").
+		Emit(map[string]interface{}{"type": "assistant", "message": "not an object"})
+
+	if _, err := collectQuery(t, "Hi", &claude.ClaudeAgentOptions{Metrics: metrics}, claudetest.NewTransport(t, scenario)); err == nil {
+		t.Fatal("Expected the malformed message to fail the query")
+	}
+	if got := metrics.counter(claude.MetricParseErrors); got != 1 {
+		t.Errorf("Expected one parse error, got %v", got)
+	}
+}
+
+func TestPrometheusTextFormat(t *testing.T) {
+	prom := claudemetrics.NewPrometheus(&claudemetrics.PrometheusOptions{
+		Buckets:     []float64{0.1, 1},
+		ConstLabels: claude.Labels{"service": "triage"},
+	})
+	prom.Add(claude.MetricToolCalls, 2, claude.Labels{claude.LabelTool: "Bash"})
+	prom.Add(claude.MetricToolCalls, 1, claude.Labels{claude.LabelTool: `say "hi"`})
+	prom.Observe(claude.MetricHookDuration, 0.0625, claude.Labels{claude.LabelEvent: "PreToolUse"})
+	prom.Observe(claude.MetricHookDuration, 0.5, claude.Labels{claude.LabelEvent: "PreToolUse"})
+	prom.Observe(claude.MetricHookDuration, 3, claude.Labels{claude.LabelEvent: "PreToolUse"})
+
+	recorder := httptest.NewRecorder()
+	prom.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	want := `# HELP claude_hook_duration_seconds Hook callback duration in seconds, by event.
+# TYPE claude_hook_duration_seconds histogram
+claude_hook_duration_seconds_bucket{event="PreToolUse",service="triage",le="0.1"} 1
+claude_hook_duration_seconds_bucket{event="PreToolUse",service="triage",le="1"} 2
+claude_hook_duration_seconds_bucket{event="PreToolUse",service="triage",le="+Inf"} 3
+claude_hook_duration_seconds_sum{event="PreToolUse",service="triage"} 3.5625
+claude_hook_duration_seconds_count{event="PreToolUse",service="triage"} 3
+# HELP claude_tool_calls_total Tool uses requested by the model, by tool.
+# TYPE claude_tool_calls_total counter
+claude_tool_calls_total{service="triage",tool="Bash"} 2
+claude_tool_calls_total{service="triage",tool="say \"hi\""} 1
+`
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	ev := claudemetrics.NewExpvar("test_expvar_")
+	prom := claudemetrics.NewPrometheus(nil)
+	metrics := claudemetrics.Multi(ev, prom)
+
+	metrics.Add(claude.MetricToolCalls, 1, claude.Labels{claude.LabelTool: "Bash"})
+	metrics.Add(claude.MetricToolCalls, 2, claude.Labels{claude.LabelTool: "Bash"})
+	metrics.Observe(claude.MetricHookDuration, 0.25, claude.Labels{claude.LabelEvent: "Stop"})
+	metrics.Observe(claude.MetricHookDuration, 0.75, claude.Labels{claude.LabelEvent: "Stop"})
+
+	var calls map[string]float64
+	if err := json.Unmarshal([]byte(expvar.Get("test_expvar_claude_tool_calls_total").String()), &calls); err != nil {
+		t.Fatal(err)
+	}
+	if calls["tool=Bash"] != 3 {
+		t.Errorf("Expected 3 Bash calls, got %v", calls)
+	}
+
+	var hooks map[string]map[string]float64
+	if err := json.Unmarshal([]byte(expvar.Get("test_expvar_claude_hook_duration_seconds").String()), &hooks); err != nil {
+		t.Fatal(err)
+	}
+	if h := hooks["event=Stop"]; h["count"] != 2 || h["sum"] != 1 || h["max"] != 0.75 {
+		t.Errorf("Unexpected histogram %v", h)
+	}
+
+	// Another Expvar with the same prefix shares the variables
+	claudemetrics.NewExpvar("test_expvar_").Add(claude.MetricToolCalls, 1, claude.Labels{claude.LabelTool: "Bash"})
+	if err := json.Unmarshal([]byte(expvar.Get("test_expvar_claude_tool_calls_total").String()), &calls); err != nil || calls["tool=Bash"] != 4 {
+		t.Errorf("Expected shared variables, got %v (%v)", calls, err)
+	}
+
+	var out strings.Builder
+	prom.WriteTo(&out)
+	if !strings.Contains(out.String(), `claude_tool_calls_total{tool="Bash"} 3`) {
+		t.Errorf("Multi should also record to Prometheus, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,199 @@
+//go:build unix
+
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// echoPromptCLI saves the user message it receives to $PROMPT_FILE and
+// finishes the turn.
+const echoPromptCLI = fakeInitResponder + `
+read line
+echo "$line" > "$PROMPT_FILE"
+echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+cat > /dev/null
+`
+
+// middlewareOptions returns options running echoPromptCLI with middlewares,
+// and the file the prompt is saved to.
+func middlewareOptions(t *testing.T, middlewares ...claude.TransportMiddleware) (*claude.ClaudeAgentOptions, string) {
+	t.Helper()
+	cliPath := writeFakeCLI(t, echoPromptCLI)
+	promptFile := filepath.Join(t.TempDir(), "prompt.json")
+	return &claude.ClaudeAgentOptions{
+		CliPath:             &cliPath,
+		Env:                 map[string]string{"PROMPT_FILE": promptFile},
+		TransportMiddleware: middlewares,
+	}, promptFile
+}
+
+func queryMessages(t *testing.T, options *claude.ClaudeAgentOptions) []claude.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	msgCh, errCh, err := claude.Query(ctx, "Hello", options, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Query stream failed: %v", err)
+	}
+	return messages
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	var trace bytes.Buffer
+	options, _ := middlewareOptions(t, claude.TraceMiddleware(&trace))
+	queryMessages(t, options)
+
+	var sent, received, endInput int
+	for _, line := range strings.Split(strings.TrimSpace(trace.String()), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			t.Fatalf("Malformed trace line: %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Errorf("Trace line has no timestamp: %q", line)
+		}
+		switch fields[1] {
+		case ">>":
+			sent++
+			if !json.Valid([]byte(fields[2])) {
+				t.Errorf("Sent frame is not JSON: %q", fields[2])
+			}
+		case "<<":
+			received++
+		case "--":
+			endInput++
+		}
+	}
+	// initialize and the prompt; initialize response, assistant and result
+	if sent != 2 || received != 3 || endInput != 1 {
+		t.Errorf("Expected 2 sent, 3 received and 1 end input, got %d, %d, %d:\n%s", sent, received, endInput, trace.String())
+	}
+}
+
+func TestInterceptFramesRewritesAndDrops(t *testing.T) {
+	tagTenant := claude.InterceptFrames(claude.FrameInterceptor{
+		Send: func(ctx context.Context, frame map[string]interface{}) (map[string]interface{}, error) {
+			if frame["type"] == "user" {
+				frame["metadata"] = map[string]interface{}{"tenant": "acme"}
+			}
+			return frame, nil
+		},
+		Receive: func(msg map[string]interface{}) map[string]interface{} {
+			if msg["type"] == "assistant" {
+				return nil
+			}
+			return msg
+		},
+	})
+	options, promptFile := middlewareOptions(t, tagTenant)
+	messages := queryMessages(t, options)
+
+	if len(messages) != 1 {
+		t.Fatalf("Expected the assistant message to be dropped, got %d messages", len(messages))
+	}
+	if _, ok := messages[0].(*claude.ResultMessage); !ok {
+		t.Errorf("Expected a result, got %T", messages[0])
+	}
+
+	data, err := os.ReadFile(promptFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompt map[string]interface{}
+	if err := json.Unmarshal(data, &prompt); err != nil {
+		t.Fatalf("CLI received invalid JSON: %v", err)
+	}
+	if metadata, _ := prompt["metadata"].(map[string]interface{}); metadata["tenant"] != "acme" {
+		t.Errorf("Expected tenant metadata on the user message, got %s", data)
+	}
+}
+
+func TestTransportMiddlewareOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) claude.TransportMiddleware {
+		return claude.InterceptFrames(claude.FrameInterceptor{
+			Send: func(ctx context.Context, frame map[string]interface{}) (map[string]interface{}, error) {
+				if frame["type"] == "user" {
+					mu.Lock()
+					order = append(order, "send "+name)
+					mu.Unlock()
+				}
+				return frame, nil
+			},
+			Receive: func(msg map[string]interface{}) map[string]interface{} {
+				if msg["type"] == "result" {
+					mu.Lock()
+					order = append(order, "receive "+name)
+					mu.Unlock()
+				}
+				return msg
+			},
+		})
+	}
+	options, _ := middlewareOptions(t, record("outer"), record("inner"))
+	queryMessages(t, options)
+
+	want := "send outer,send inner,receive inner,receive outer"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestTransportMetrics(t *testing.T) {
+	metrics := claude.NewTransportMetrics()
+	options, _ := middlewareOptions(t, metrics.Middleware())
+	queryMessages(t, options)
+
+	stats := metrics.Stats()
+	if stats.FramesSent != 2 || stats.FramesReceived != 3 {
+		t.Errorf("Expected 2 frames sent and 3 received, got %+v", stats)
+	}
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 || stats.LargestFrameSent == 0 || stats.LargestFrameReceived == 0 {
+		t.Errorf("Expected byte counts, got %+v", stats)
+	}
+	if stats.ControlLatency.Count != 1 || stats.ControlLatency.Max <= 0 {
+		t.Errorf("Expected the initialize round trip to be measured, got %+v", stats.ControlLatency)
+	}
+	if stats.TurnLatency.Count != 1 || stats.FirstMessageLatency.Count != 1 {
+		t.Errorf("Expected one turn, got %+v and %+v", stats.TurnLatency, stats.FirstMessageLatency)
+	}
+	if stats.FirstMessageLatency.Max > stats.TurnLatency.Max {
+		t.Errorf("First message cannot arrive after the result: %+v", stats)
+	}
+}
+
+func TestClientAppliesTransportMiddleware(t *testing.T) {
+	var trace bytes.Buffer
+	options, _ := middlewareOptions(t, claude.TraceMiddleware(&trace))
+
+	client := claude.NewClaudeSDKClient(options)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	client.Close()
+
+	if !strings.Contains(trace.String(), `"subtype":"initialize"`) {
+		t.Errorf("Expected the initialize request in the trace, got:\n%s", trace.String())
+	}
+}
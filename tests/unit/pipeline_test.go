@@ -0,0 +1,135 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+const streamedDeltas = 20
+
+// streamingCLI streams 20 text deltas "1," to "20,", then asks for permission
+// to run a tool and finishes the turn.
+const streamingCLI = fakeInitResponder + `
+read line
+for i in $(seq 1 20); do
+  echo '{"type":"stream_event","uuid":"u'$i'","session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"'$i',"}}}'
+done
+echo '{"type":"control_request","request_id":"cli_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}'
+read line
+echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Done"}]}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+cat > /dev/null
+`
+
+// runSlowConsumer runs streamingCLI with a buffer of two messages and only
+// starts reading once the permission callback ran. It returns the streamed
+// text and the number of stream events received.
+func runSlowConsumer(t *testing.T, policy claude.OverflowPolicy, metrics *claude.PipelineMetrics) (string, int) {
+	t.Helper()
+
+	cliPath := writeFakeCLI(t, streamingCLI)
+	bufferSize := 2
+	permissionAsked := make(chan struct{})
+	options := &claude.ClaudeAgentOptions{
+		CliPath:                  &cliPath,
+		MessageChannelBufferSize: &bufferSize,
+		StreamEventOverflow:      policy,
+		PipelineMetrics:          metrics,
+		CanUseTool: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+			close(permissionAsked)
+			return claude.PermissionResultAllow{Behavior: "allow"}, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	msgCh, errCh, err := claude.Query(ctx, "Hello", options, nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// The control request is behind 20 unread messages
+	select {
+	case <-permissionAsked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Permission callback was blocked by the unread messages")
+	}
+
+	var text strings.Builder
+	events := 0
+	for msg := range msgCh {
+		if event, ok := msg.(*claude.StreamEvent); ok {
+			events++
+			delta, _ := event.Event["delta"].(map[string]interface{})
+			text.WriteString(delta["text"].(string))
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Query stream failed: %v", err)
+	}
+	return text.String(), events
+}
+
+func allDeltas() string {
+	var text strings.Builder
+	for i := 1; i <= streamedDeltas; i++ {
+		fmt.Fprintf(&text, "%d,", i)
+	}
+	return text.String()
+}
+
+func TestOverflowBlockDeliversEverything(t *testing.T) {
+	metrics := claude.NewPipelineMetrics()
+	text, events := runSlowConsumer(t, claude.OverflowBlock, metrics)
+
+	if events != streamedDeltas || text != allDeltas() {
+		t.Errorf("Expected all %d deltas, got %d: %q", streamedDeltas, events, text)
+	}
+	stats := metrics.Stats()
+	if stats.StreamEventsDropped != 0 || stats.StreamEventsCoalesced != 0 {
+		t.Errorf("Block policy must not drop or coalesce, got %+v", stats)
+	}
+	if stats.MaxBacklog <= 2 {
+		t.Errorf("Expected the backlog to grow past the buffer, got %d", stats.MaxBacklog)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	metrics := claude.NewPipelineMetrics()
+	text, events := runSlowConsumer(t, claude.OverflowDropOldest, metrics)
+
+	stats := metrics.Stats()
+	if stats.StreamEventsDropped == 0 {
+		t.Fatal("Expected stream events to be dropped")
+	}
+	if events+int(stats.StreamEventsDropped) != streamedDeltas {
+		t.Errorf("Received %d and dropped %d of %d events", events, stats.StreamEventsDropped, streamedDeltas)
+	}
+	// The newest deltas survive
+	if !strings.HasSuffix(text, "19,20,") {
+		t.Errorf("Expected the latest deltas to be kept, got %q", text)
+	}
+}
+
+func TestOverflowCoalesce(t *testing.T) {
+	metrics := claude.NewPipelineMetrics()
+	text, events := runSlowConsumer(t, claude.OverflowCoalesce, metrics)
+
+	stats := metrics.Stats()
+	if stats.StreamEventsCoalesced == 0 {
+		t.Fatal("Expected stream events to be coalesced")
+	}
+	if events+int(stats.StreamEventsCoalesced) != streamedDeltas {
+		t.Errorf("Received %d and coalesced %d of %d events", events, stats.StreamEventsCoalesced, streamedDeltas)
+	}
+	if text != allDeltas() {
+		t.Errorf("Coalescing must not lose text, got %q", text)
+	}
+}
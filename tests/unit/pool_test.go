@@ -0,0 +1,327 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// poolCLI answers every control request and finishes a turn for each user
+// message. Each start is appended to $POOL_STARTS.
+const poolCLI = `
+echo $$ >> "$POOL_STARTS"
+sleep "${POOL_INIT_DELAY:-0}"
+while read -r line; do
+	case "$line" in
+	*'"type":"control_request"'*)
+		id=$(echo "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+		echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+		;;
+	*'"type":"user"'*)
+		echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"pooled"}]}}'
+		echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+		;;
+	esac
+done
+`
+
+// newTestPool creates a pool over a fake CLI and returns the file listing
+// the PIDs of started processes.
+func newTestPool(t *testing.T, script string, poolOptions *claude.PoolOptions) (*claude.Pool, string) {
+	t.Helper()
+
+	starts := filepath.Join(t.TempDir(), "starts")
+	cliPath := writeFakeCLI(t, script)
+	pool, err := claude.NewPool(&claude.ClaudeAgentOptions{
+		CliPath: &cliPath,
+		Env:     map[string]string{"POOL_STARTS": starts},
+	}, poolOptions)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return pool, starts
+}
+
+// waitForStats polls pool stats until cond holds.
+func waitForStats(t *testing.T, pool *claude.Pool, cond func(claude.PoolStats) bool) claude.PoolStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats := pool.Stats(); cond(stats) {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for pool stats, last: %+v", pool.Stats())
+	return claude.PoolStats{}
+}
+
+func runPoolQuery(t *testing.T, pool *claude.Pool) []claude.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgCh, errCh, err := pool.Query(ctx, "Hello")
+	if err != nil {
+		t.Fatalf("Pool query failed: %v", err)
+	}
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Pool query stream failed: %v", err)
+	}
+	return messages
+}
+
+func countStarts(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return len(strings.Fields(string(data)))
+}
+
+func TestPoolServesQueriesFromReadyProcesses(t *testing.T) {
+	pool, starts := newTestPool(t, poolCLI, &claude.PoolOptions{Size: 2})
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 2 })
+
+	for i := 0; i < 3; i++ {
+		messages := runPoolQuery(t, pool)
+		if len(messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(messages))
+		}
+		waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 2 })
+	}
+
+	stats := pool.Stats()
+	if stats.Hits != 3 || stats.Misses != 0 {
+		t.Errorf("Expected 3 hits and no misses, got %+v", stats)
+	}
+	if stats.Started != 5 || countStarts(t, starts) != 5 {
+		t.Errorf("Expected 5 processes (2 initial, 3 replacements), stats %+v, starts %d", stats, countStarts(t, starts))
+	}
+}
+
+func TestPoolMissStartsProcess(t *testing.T) {
+	t.Setenv("POOL_INIT_DELAY", "0.5")
+	pool, _ := newTestPool(t, poolCLI, &claude.PoolOptions{Size: 1})
+
+	// The pool is still warming, so the query starts its own process
+	messages := runPoolQuery(t, pool)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	stats := pool.Stats()
+	if stats.Hits != 0 || stats.Misses != 1 {
+		t.Errorf("Expected one miss, got %+v", stats)
+	}
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+}
+
+func TestPoolReportsHitsAndMisses(t *testing.T) {
+	t.Setenv("POOL_INIT_DELAY", "0.5")
+	cliPath := writeFakeCLI(t, poolCLI)
+	metrics := newRecordingMetrics()
+	pool, err := claude.NewPool(&claude.ClaudeAgentOptions{
+		CliPath: &cliPath,
+		Env:     map[string]string{"POOL_STARTS": "/dev/null"},
+		Metrics: metrics,
+	}, &claude.PoolOptions{Size: 1})
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer pool.Close()
+
+	runPoolQuery(t, pool)
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+	runPoolQuery(t, pool)
+
+	hits := metrics.counter(claude.MetricPoolQueries + "{outcome=hit}")
+	misses := metrics.counter(claude.MetricPoolQueries + "{outcome=miss}")
+	if hits != 1 || misses != 1 {
+		t.Errorf("Expected one hit and one miss, got %v and %v", hits, misses)
+	}
+}
+
+func TestPoolDiscardsIdleProcesses(t *testing.T) {
+	pool, _ := newTestPool(t, poolCLI, &claude.PoolOptions{Size: 1, MaxIdle: 50 * time.Millisecond, HealthCheckInterval: time.Hour})
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+	time.Sleep(100 * time.Millisecond)
+
+	runPoolQuery(t, pool)
+	stats := pool.Stats()
+	if stats.Discarded != 1 || stats.Misses != 1 {
+		t.Errorf("Expected the idle process to be discarded and the query to miss, got %+v", stats)
+	}
+}
+
+func TestPoolHealthCheckDiscardsExitedProcesses(t *testing.T) {
+	// Exits right after initialize
+	script := `echo $$ >> "$POOL_STARTS"` + "\n" + fakeInitResponder
+	pool, _ := newTestPool(t, script, &claude.PoolOptions{Size: 1, HealthCheckInterval: 50 * time.Millisecond})
+
+	// Two discards from a pool of one means the exited process was replaced
+	stats := waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Discarded >= 2 })
+	if stats.Hits != 0 || stats.Started < 2 {
+		t.Errorf("Expected exited processes to be replaced without hits, got %+v", stats)
+	}
+}
+
+// stuckPoolCLI answers control requests but never finishes a turn. With
+// POOL_NOTICE set it also prints a message after each control response.
+const stuckPoolCLI = `
+echo $$ >> "$POOL_STARTS"
+sleep "${POOL_INIT_DELAY:-0}"
+while read -r line; do
+	case "$line" in
+	*'"type":"control_request"'*)
+		id=$(echo "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+		echo '{"type":"control_response","response":{"subtype":"success","request_id":"'$id'","response":{}}}'
+		[ -n "$POOL_NOTICE" ] && echo '{"type":"system","subtype":"notice","session_id":"s1"}'
+		;;
+	esac
+done
+`
+
+func TestPoolDiscardsProcessesWithUnreadOutput(t *testing.T) {
+	cliPath := writeFakeCLI(t, stuckPoolCLI)
+	pool, err := claude.NewPool(&claude.ClaudeAgentOptions{
+		CliPath: &cliPath,
+		Env:     map[string]string{"POOL_STARTS": filepath.Join(t.TempDir(), "starts"), "POOL_NOTICE": "1"},
+	}, &claude.PoolOptions{Size: 1, HealthCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer pool.Close()
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+	// Let the notice reach the handler, which holds it for a consumer
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, _, err := pool.Query(ctx, "Hello"); err != nil {
+		t.Fatalf("Pool query failed: %v", err)
+	}
+	if stats := pool.Stats(); stats.Hits != 0 || stats.Misses != 1 || stats.Discarded != 1 {
+		t.Errorf("Expected the process with unread output to be discarded, got %+v", stats)
+	}
+}
+
+func TestPoolCloseStopsBorrowedProcesses(t *testing.T) {
+	starts := filepath.Join(t.TempDir(), "starts")
+	cliPath := writeFakeCLI(t, stuckPoolCLI)
+	pool, err := claude.NewPool(&claude.ClaudeAgentOptions{
+		CliPath: &cliPath,
+		Env:     map[string]string{"POOL_STARTS": starts, "POOL_INIT_DELAY": "0.3"},
+		// Keeps stdin open until a result, so the CLI only exits if stopped
+		CanUseTool: allowBash,
+	}, &claude.PoolOptions{Size: 1, HealthCheckInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer pool.Close()
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+
+	// The first query takes the ready process; the replacement is still
+	// starting, so the second starts its own
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var streams []<-chan claude.Message
+	for i := 0; i < 2; i++ {
+		msgCh, _, err := pool.Query(ctx, "Hello")
+		if err != nil {
+			t.Fatalf("Pool query %d failed: %v", i+1, err)
+		}
+		streams = append(streams, msgCh)
+	}
+	if stats := pool.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("Expected a hit and a miss, got %+v", stats)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return")
+	}
+
+	for i, msgCh := range streams {
+		select {
+		case _, ok := <-msgCh:
+			if ok {
+				t.Errorf("Query %d produced a message", i+1)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Query %d still running after Close", i+1)
+		}
+	}
+	data, _ := os.ReadFile(starts)
+	for _, field := range strings.Fields(string(data)) {
+		pid, _ := strconv.Atoi(field)
+		if processAlive(pid) {
+			t.Errorf("Process %d still running after Close", pid)
+		}
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	pool, _ := newTestPool(t, poolCLI, &claude.PoolOptions{Size: 1})
+	waitForStats(t, pool, func(s claude.PoolStats) bool { return s.Ready == 1 })
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if stats := pool.Stats(); stats.Ready != 0 || stats.Warming != 0 {
+		t.Errorf("Expected an empty pool after Close, got %+v", stats)
+	}
+	if _, _, err := pool.Query(context.Background(), "Hello"); err == nil {
+		t.Error("Query on a closed pool should fail")
+	}
+}
+
+func TestOptionsFingerprint(t *testing.T) {
+	cliPath := writeFakeCLI(t, `cat > /dev/null`)
+	options := func(model string, extra map[string]*string) *claude.ClaudeAgentOptions {
+		return &claude.ClaudeAgentOptions{CliPath: &cliPath, Model: &model, ExtraArgs: extra}
+	}
+	extra := map[string]*string{"debug-to-stderr": nil, "alpha": stringPtr("1"), "beta": stringPtr("2"), "gamma": stringPtr("3")}
+
+	base, err := claude.OptionsFingerprint(options("claude-sonnet-4-5", extra))
+	if err != nil {
+		t.Fatalf("OptionsFingerprint failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := claude.OptionsFingerprint(options("claude-sonnet-4-5", extra)); again != base {
+			t.Fatal("Fingerprint is not stable")
+		}
+	}
+
+	if other, _ := claude.OptionsFingerprint(options("claude-opus-4-1", extra)); other == base {
+		t.Error("Different models should have different fingerprints")
+	}
+
+	withHook := options("claude-sonnet-4-5", extra)
+	withHook.Hooks = map[claude.HookEvent][]claude.HookMatcher{
+		claude.HookEventPreToolUse: {{Matcher: "Bash", Hooks: []claude.HookCallback{nil}}},
+	}
+	if other, _ := claude.OptionsFingerprint(withHook); other == base {
+		t.Error("Hooks should change the fingerprint")
+	}
+}
@@ -0,0 +1,205 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// scriptedSessionCLI answers initialize, asks the SDK to run a hook and a
+// permission check, then finishes the turn.
+const scriptedSessionCLI = fakeInitResponder + `
+read line
+echo '{"type":"control_request","request_id":"cli_1","request":{"subtype":"hook_callback","callback_id":"hook_0","input":{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}},"tool_use_id":"tu_1"}}'
+read line
+echo '{"type":"control_request","request_id":"cli_2","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}'
+read line
+echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Listed the files."}]}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1","total_cost_usd":0.01}'
+cat > /dev/null
+`
+
+// sessionOptions returns options with a hook and permission callback whose
+// invocations are counted.
+func sessionOptions(hookCalls, permissionCalls *int32, allow bool) *claude.ClaudeAgentOptions {
+	return &claude.ClaudeAgentOptions{
+		Hooks: map[claude.HookEvent][]claude.HookMatcher{
+			claude.HookEventPreToolUse: {{
+				Matcher: "Bash",
+				Hooks: []claude.HookCallback{
+					func(ctx context.Context, input map[string]interface{}, toolUseID *string, hookCtx claude.HookContext) (claude.HookJSONOutput, error) {
+						atomic.AddInt32(hookCalls, 1)
+						return claude.HookJSONOutput{}, nil
+					},
+				},
+			}},
+		},
+		CanUseTool: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx claude.ToolPermissionContext) (claude.PermissionResult, error) {
+			atomic.AddInt32(permissionCalls, 1)
+			if allow {
+				return claude.PermissionResultAllow{Behavior: "allow"}, nil
+			}
+			return claude.PermissionResultDeny{Behavior: "deny", Message: "not in tests"}, nil
+		},
+	}
+}
+
+// runSession runs a one-shot query over transport and collects the results.
+func runSession(t *testing.T, options *claude.ClaudeAgentOptions, transport claude.Transport) ([]claude.Message, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	msgCh, errCh, err := claude.Query(ctx, "List the files", options, transport)
+	if err != nil {
+		return nil, err
+	}
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	return messages, <-errCh
+}
+
+// recordSession records the scripted session to a file and returns its path.
+func recordSession(t *testing.T) string {
+	t.Helper()
+
+	var hookCalls, permissionCalls int32
+	options := sessionOptions(&hookCalls, &permissionCalls, true)
+	inner, err := claude.NewSubprocessCLITransport("", options, writeFakeCLI(t, scriptedSessionCLI))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := claude.NewRecordingTransportFile(inner, path)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	messages, err := runSession(t, options, recorder)
+	recorder.Close()
+	if err != nil {
+		t.Fatalf("Recorded session failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages in recorded session, got %d", len(messages))
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("Recording failed: %v", err)
+	}
+	return path
+}
+
+func TestRecordingTransportWritesBothDirections(t *testing.T) {
+	path := recordSession(t)
+
+	frames, err := claude.LoadRecording(path)
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+
+	counts := make(map[claude.FrameDirection]int)
+	for _, frame := range frames {
+		counts[frame.Direction]++
+		if frame.Time.IsZero() {
+			t.Error("Every frame should carry a timestamp")
+		}
+	}
+	// initialize, user message, hook response, permission response
+	if counts[claude.FrameSent] != 4 {
+		t.Errorf("Expected 4 sent frames, got %d", counts[claude.FrameSent])
+	}
+	// initialize response, 2 control requests, assistant, result
+	if counts[claude.FrameReceived] != 5 {
+		t.Errorf("Expected 5 received frames, got %d", counts[claude.FrameReceived])
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected recording mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestReplayTransportRunsCallbacksAgainstRecording(t *testing.T) {
+	path := recordSession(t)
+
+	replay, err := claude.NewReplayTransportFile(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to load replay: %v", err)
+	}
+
+	var hookCalls, permissionCalls int32
+	messages, err := runSession(t, sessionOptions(&hookCalls, &permissionCalls, true), replay)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if _, ok := messages[1].(*claude.ResultMessage); !ok {
+		t.Errorf("Expected result message last, got %T", messages[1])
+	}
+	if hookCalls != 1 || permissionCalls != 1 {
+		t.Errorf("Expected hook and permission callbacks to run once, got %d and %d", hookCalls, permissionCalls)
+	}
+}
+
+func TestReplayTransportDetectsDivergence(t *testing.T) {
+	path := recordSession(t)
+
+	replay, err := claude.NewReplayTransportFile(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to load replay: %v", err)
+	}
+
+	// Deny where the recording allowed
+	var hookCalls, permissionCalls int32
+	_, err = runSession(t, sessionOptions(&hookCalls, &permissionCalls, false), replay)
+
+	var mismatch *claude.ReplayMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected ReplayMismatchError, got %T: %v", err, err)
+	}
+	if !strings.Contains(mismatch.Expected, `"allow"`) || !strings.Contains(mismatch.Actual, `"deny"`) {
+		t.Errorf("Expected mismatch to show both frames, got %v", mismatch)
+	}
+}
+
+func TestReplayTransportDetectsDifferentPrompt(t *testing.T) {
+	path := recordSession(t)
+
+	replay, err := claude.NewReplayTransportFile(path, &claude.ReplayOptions{WriteTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to load replay: %v", err)
+	}
+
+	var hookCalls, permissionCalls int32
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgCh, errCh, err := claude.Query(ctx, "Delete the files", sessionOptions(&hookCalls, &permissionCalls, true), replay)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range msgCh {
+	}
+
+	var mismatch *claude.ReplayMismatchError
+	if err := <-errCh; !errors.As(err, &mismatch) {
+		t.Fatalf("Expected ReplayMismatchError, got %T: %v", err, err)
+	}
+	if !strings.Contains(mismatch.Actual, "Delete the files") {
+		t.Errorf("Expected actual frame to contain the new prompt, got %s", mismatch.Actual)
+	}
+}
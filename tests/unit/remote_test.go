@@ -0,0 +1,414 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/agenthost"
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/wire"
+)
+
+const testAgentHostToken = "test-token"
+
+// startAgentHost serves script over TCP and WebSocket on loopback and
+// returns the server with its tcp:// and ws:// addresses.
+func startAgentHost(t *testing.T, script string, serverOptions *agenthost.ServerOptions) (*agenthost.Server, string, string) {
+	t.Helper()
+
+	cliPath := writeFakeCLI(t, script)
+	if serverOptions == nil {
+		serverOptions = &agenthost.ServerOptions{}
+	}
+	if serverOptions.Tokens == nil {
+		serverOptions.Tokens = []string{testAgentHostToken}
+	}
+	server, err := agenthost.NewServer(&claude.ClaudeAgentOptions{
+		CliPath: &cliPath,
+		Env:     map[string]string{"POOL_STARTS": "/dev/null"},
+	}, serverOptions)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	httpServer := httptest.NewServer(server)
+
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Close()
+	})
+	return server, "tcp://" + listener.Addr().String(), "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/agent"
+}
+
+func newRemote(t *testing.T, address string, options *claude.RemoteTransportOptions) *claude.RemoteTransport {
+	t.Helper()
+	if options == nil {
+		options = &claude.RemoteTransportOptions{}
+	}
+	if options.Token == "" {
+		options.Token = testAgentHostToken
+	}
+	transport, err := claude.NewRemoteTransport(address, options)
+	if err != nil {
+		t.Fatalf("NewRemoteTransport failed: %v", err)
+	}
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+// waitForSessions polls until the server runs n sessions.
+func waitForSessions(t *testing.T, server *agenthost.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Sessions() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d sessions, got %d", n, server.Sessions())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemoteTransportRunsSession(t *testing.T) {
+	server, tcpAddr, wsAddr := startAgentHost(t, scriptedSessionCLI, nil)
+
+	for name, address := range map[string]string{"tcp": tcpAddr, "websocket": wsAddr} {
+		t.Run(name, func(t *testing.T) {
+			var hookCalls, permissionCalls int32
+			options := sessionOptions(&hookCalls, &permissionCalls, true)
+
+			messages, err := runSession(t, options, newRemote(t, address, nil))
+			if err != nil {
+				t.Fatalf("Remote session failed: %v", err)
+			}
+			if len(messages) != 2 {
+				t.Fatalf("Expected 2 messages, got %d", len(messages))
+			}
+			if result, ok := messages[1].(*claude.ResultMessage); !ok || result.IsError {
+				t.Errorf("Expected a successful result, got %#v", messages[1])
+			}
+			// Control requests from the remote CLI reach local callbacks
+			if atomic.LoadInt32(&hookCalls) != 1 || atomic.LoadInt32(&permissionCalls) != 1 {
+				t.Errorf("Expected one hook and one permission call, got %d and %d", hookCalls, permissionCalls)
+			}
+			waitForSessions(t, server, 0)
+		})
+	}
+}
+
+func TestRemoteTransportRejectsBadToken(t *testing.T) {
+	server, tcpAddr, wsAddr := startAgentHost(t, poolCLI, nil)
+
+	for _, address := range []string{tcpAddr, wsAddr} {
+		transport := newRemote(t, address, &claude.RemoteTransportOptions{Token: "wrong"})
+		err := transport.Connect(context.Background())
+		var connErr *claude.CLIConnectionError
+		if !errors.As(err, &connErr) || !strings.Contains(err.Error(), "unauthorized") {
+			t.Errorf("%s: expected an unauthorized error, got %v", address, err)
+		}
+	}
+	if server.Sessions() != 0 {
+		t.Error("Rejected clients must not start a CLI")
+	}
+}
+
+func TestNewServerRequiresToken(t *testing.T) {
+	if _, err := agenthost.NewServer(nil, &agenthost.ServerOptions{}); err == nil {
+		t.Error("NewServer without tokens should fail")
+	}
+	if _, err := claude.NewRemoteTransport("http://example.com", nil); err == nil {
+		t.Error("NewRemoteTransport should reject unsupported schemes")
+	}
+}
+
+// flakyProxy forwards TCP connections to target and can drop or freeze the
+// connections it has open.
+type flakyProxy struct {
+	listener net.Listener
+	target   string
+
+	mu    sync.Mutex
+	conns []net.Conn
+	// frozen stops forwarding on existing connections without closing them
+	frozen chan struct{}
+}
+
+func newFlakyProxy(t *testing.T, target string) *flakyProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &flakyProxy{listener: listener, target: target, frozen: make(chan struct{})}
+	go p.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		p.drop()
+	})
+	return p
+}
+
+func (p *flakyProxy) address() string {
+	return "tcp://" + p.listener.Addr().String()
+}
+
+func (p *flakyProxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, client, upstream)
+		frozen := p.frozen
+		p.mu.Unlock()
+		go p.pipe(client, upstream, frozen)
+		go p.pipe(upstream, client, frozen)
+	}
+}
+
+func (p *flakyProxy) pipe(dst, src net.Conn, frozen chan struct{}) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			select {
+			case <-frozen:
+				<-make(chan struct{}) // Swallow everything from now on
+			default:
+			}
+			dst.Write(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				dst.Close()
+			}
+			return
+		}
+	}
+}
+
+// drop closes every open connection.
+func (p *flakyProxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// freeze stops forwarding on open connections; new connections work.
+func (p *flakyProxy) freeze() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.frozen)
+	p.frozen = make(chan struct{})
+}
+
+// runRemoteTurn sends prompt over client and waits for the result.
+func runRemoteTurn(t *testing.T, client *claude.ClaudeSDKClient) []claude.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	msgCh, errCh := client.Query(ctx, "Hello")
+	var messages []claude.Message
+	for msg := range msgCh {
+		messages = append(messages, msg)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Turn failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	return messages
+}
+
+func TestRemoteTransportResumesAfterDisconnect(t *testing.T) {
+	server, tcpAddr, _ := startAgentHost(t, poolCLI, nil)
+	proxy := newFlakyProxy(t, strings.TrimPrefix(tcpAddr, "tcp://"))
+
+	transport := newRemote(t, proxy.address(), &claude.RemoteTransportOptions{HeartbeatInterval: 50 * time.Millisecond})
+	client := claude.NewClaudeSDKClientWithTransport(&claude.ClaudeAgentOptions{}, transport)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+	sessionID := transport.SessionID()
+
+	runRemoteTurn(t, client)
+
+	// A dropped connection is noticed by the read error
+	proxy.drop()
+	runRemoteTurn(t, client)
+
+	// A silent connection is noticed by missed heartbeats
+	proxy.freeze()
+	runRemoteTurn(t, client)
+
+	if transport.SessionID() != sessionID {
+		t.Errorf("Expected to resume session %s, got %s", sessionID, transport.SessionID())
+	}
+	if server.Sessions() != 1 {
+		t.Errorf("Expected the CLI to survive reconnects, got %d sessions", server.Sessions())
+	}
+	if !transport.IsReady() {
+		t.Error("Transport should be ready after reconnecting")
+	}
+}
+
+func TestAgentHostEndsAbandonedSessions(t *testing.T) {
+	server, tcpAddr, _ := startAgentHost(t, poolCLI, &agenthost.ServerOptions{ReconnectWindow: 100 * time.Millisecond})
+	proxy := newFlakyProxy(t, strings.TrimPrefix(tcpAddr, "tcp://"))
+
+	transport := newRemote(t, proxy.address(), &claude.RemoteTransportOptions{ReconnectTimeout: -1})
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	waitForSessions(t, server, 1)
+
+	_, errCh := transport.ReadMessages(context.Background())
+	proxy.drop()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Expected an error when reconnecting is disabled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the connection error")
+	}
+	if transport.IsReady() {
+		t.Error("Transport should not be ready after the session failed")
+	}
+
+	// The CLI is stopped once the reconnect window passes
+	waitForSessions(t, server, 0)
+}
+
+// helloAgentHost opens a raw connection and returns it with the server's
+// reply to hello.
+func helloAgentHost(t *testing.T, address string, hello *wire.Envelope) (wire.Conn, *wire.Envelope) {
+	t.Helper()
+	conn, err := wire.Dial(context.Background(), address, nil, 1<<20)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	hello.Type = wire.TypeHello
+	if err := wire.WriteEnvelope(conn, hello); err != nil {
+		t.Fatalf("Writing hello failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := wire.ReadEnvelope(conn)
+	if err != nil {
+		t.Fatalf("Reading the reply to hello failed: %v", err)
+	}
+	return conn, reply
+}
+
+func TestAgentHostSessionsBelongToTheirToken(t *testing.T) {
+	server, tcpAddr, _ := startAgentHost(t, poolCLI, &agenthost.ServerOptions{
+		Tokens: []string{testAgentHostToken, "other-token"},
+	})
+
+	transport := newRemote(t, tcpAddr, nil)
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	waitForSessions(t, server, 1)
+
+	// A valid token cannot take over another token's session
+	_, reply := helloAgentHost(t, tcpAddr, &wire.Envelope{Token: "other-token", Session: transport.SessionID()})
+	if reply.Type != wire.TypeReject || reply.Error != "unknown or expired session" {
+		t.Errorf("Expected the resume to be rejected, got %#v", reply)
+	}
+	if !transport.IsReady() {
+		t.Error("The owner's connection should be unaffected")
+	}
+}
+
+// chattyCLI writes output until its stdin is closed.
+const chattyCLI = `
+while :; do
+	echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"chatty output that nobody acknowledges"}]}}'
+done &
+cat >/dev/null
+kill $!
+`
+
+func TestAgentHostEndsSessionsWithTooMuchPendingOutput(t *testing.T) {
+	server, tcpAddr, _ := startAgentHost(t, chattyCLI, &agenthost.ServerOptions{
+		ReconnectWindow: time.Minute,
+		MaxPendingSize:  64 * 1024,
+	})
+
+	conn, reply := helloAgentHost(t, tcpAddr, &wire.Envelope{Token: testAgentHostToken})
+	if reply.Type != wire.TypeWelcome {
+		t.Fatalf("Expected welcome, got %#v", reply)
+	}
+	waitForSessions(t, server, 1)
+
+	// Without a client acknowledging it the output piles up, and the session
+	// ends long before the reconnect window passes
+	conn.Close()
+	waitForSessions(t, server, 0)
+}
+
+func TestAgentHostRefusesCrossOriginWebSockets(t *testing.T) {
+	server, _, wsAddr := startAgentHost(t, poolCLI, nil)
+	httpAddr := "http" + strings.TrimPrefix(wsAddr, "ws")
+	u, err := url.Parse(httpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for origin, want := range map[string]int{
+		"https://evil.example": http.StatusForbidden,
+		"http://" + u.Host:     http.StatusUpgradeRequired,
+	} {
+		req, err := http.NewRequest(http.MethodGet, httpAddr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		// A same-origin request gets past the check and fails the upgrade
+		if resp.StatusCode != want {
+			t.Errorf("Origin %s: expected status %d, got %d", origin, want, resp.StatusCode)
+		}
+	}
+
+	// Clients outside a browser send no Origin
+	transport := newRemote(t, wsAddr, nil)
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect without an Origin failed: %v", err)
+	}
+	waitForSessions(t, server, 1)
+}
@@ -0,0 +1,161 @@
+//go:build unix
+
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// connectFakeCLI connects a transport to the fake CLI without closing it.
+func connectFakeCLI(t *testing.T, cliPath string, options *claude.ClaudeAgentOptions) *claude.SubprocessCLITransport {
+	t.Helper()
+
+	transport, err := claude.NewSubprocessCLITransport("", options, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return transport
+}
+
+// waitForFile polls until path exists or the timeout expires.
+func waitForFile(t *testing.T, path string, timeout time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return strings.TrimSpace(string(data))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", path)
+	return ""
+}
+
+// processAlive reports whether pid is running. Zombies (killed but not yet
+// reaped by init) count as dead.
+func processAlive(pid int) bool {
+	if stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil {
+		fields := strings.Fields(string(stat))
+		return len(fields) > 2 && fields[2] != "Z"
+	}
+	return syscall.Kill(pid, 0) == nil
+}
+
+func TestCloseLetsCLIExitAfterStdinClosed(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	cliPath := writeFakeCLI(t, `
+trap 'echo term > `+marker+`; exit 0' TERM
+cat > /dev/null
+echo stdin-closed > `+marker)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Shutdown: &claude.ShutdownOptions{
+			StdinGracePeriod: 5 * time.Second,
+			TermGracePeriod:  time.Second,
+		},
+	})
+
+	start := time.Now()
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Close took %v, expected the CLI to exit as soon as stdin closed", elapsed)
+	}
+
+	if got := waitForFile(t, marker, time.Second); got != "stdin-closed" {
+		t.Errorf("Expected CLI to exit on its own, got marker %q", got)
+	}
+}
+
+func TestCloseSendsSIGTERMAfterGracePeriod(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	cliPath := writeFakeCLI(t, `
+trap 'echo term > `+marker+`; exit 0' TERM
+while true; do sleep 0.05; done`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Shutdown: &claude.ShutdownOptions{
+			StdinGracePeriod: 100 * time.Millisecond,
+			TermGracePeriod:  5 * time.Second,
+		},
+	})
+
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := waitForFile(t, marker, time.Second); got != "term" {
+		t.Errorf("Expected CLI to receive SIGTERM, got marker %q", got)
+	}
+}
+
+func TestCloseKillsCLIIgnoringSIGTERM(t *testing.T) {
+	cliPath := writeFakeCLI(t, `
+trap '' TERM
+while true; do sleep 0.05; done`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Shutdown: &claude.ShutdownOptions{
+			StdinGracePeriod: 50 * time.Millisecond,
+			TermGracePeriod:  50 * time.Millisecond,
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		transport.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return after SIGKILL")
+	}
+}
+
+func TestCloseCleansUpGrandchildren(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	cliPath := writeFakeCLI(t, `
+sleep 60 &
+echo $! > `+pidFile+`
+cat > /dev/null`)
+
+	transport := connectFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{
+		Shutdown: &claude.ShutdownOptions{StdinGracePeriod: time.Second},
+	})
+
+	pid, err := strconv.Atoi(waitForFile(t, pidFile, 2*time.Second))
+	if err != nil {
+		t.Fatalf("Failed to read grandchild pid: %v", err)
+	}
+	if !processAlive(pid) {
+		t.Fatal("Grandchild should be running before Close")
+	}
+
+	if err := transport.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Error("Grandchild process survived Close")
+	}
+}
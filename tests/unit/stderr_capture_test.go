@@ -0,0 +1,217 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+)
+
+// writeFakeCLI writes an executable shell script that stands in for the
+// Claude Code CLI and returns its path.
+func writeFakeCLI(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI scripts require a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "claude")
+	script := "#!/bin/sh\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake CLI: %v", err)
+	}
+	t.Setenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK", "1")
+	return path
+}
+
+// runFakeCLI connects a transport to the fake CLI and returns the first
+// error reported by ReadMessages.
+func runFakeCLI(t *testing.T, cliPath string, options *claude.ClaudeAgentOptions) error {
+	t.Helper()
+
+	transport, err := claude.NewSubprocessCLITransport("", options, cliPath)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer transport.Close()
+
+	msgCh, errCh := transport.ReadMessages(ctx)
+	for range msgCh {
+	}
+	return <-errCh
+}
+
+func TestProcessErrorIncludesStderrTail(t *testing.T) {
+	cliPath := writeFakeCLI(t, `
+i=1
+while [ $i -le 20 ]; do
+  echo "log line $i" >&2
+  i=$((i+1))
+done
+exit 3`)
+
+	err := runFakeCLI(t, cliPath, &claude.ClaudeAgentOptions{StderrTailLines: intPtr(5)})
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+	}
+	if procErr.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", procErr.ExitCode)
+	}
+
+	lines := strings.Split(procErr.Stderr, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 stderr lines, got %d: %q", len(lines), procErr.Stderr)
+	}
+	if lines[0] != "log line 16" || lines[4] != "log line 20" {
+		t.Errorf("Expected last 5 lines, got %q", lines)
+	}
+	if procErr.Kind != claude.ProcessErrorKindUnknown {
+		t.Errorf("Expected unknown kind, got %q", procErr.Kind)
+	}
+}
+
+func TestProcessErrorStderrCallbackStillCalled(t *testing.T) {
+	cliPath := writeFakeCLI(t, `echo "callback line" >&2; exit 1`)
+
+	var received []string
+	options := &claude.ClaudeAgentOptions{
+		Stderr: func(line string) { received = append(received, line) },
+	}
+	err := runFakeCLI(t, cliPath, options)
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+	}
+	if procErr.Stderr != "callback line" {
+		t.Errorf("Expected stderr tail 'callback line', got %q", procErr.Stderr)
+	}
+	if len(received) != 1 || received[0] != "callback line" {
+		t.Errorf("Expected Stderr callback to receive the line, got %v", received)
+	}
+}
+
+func TestLongStderrLinesAreTruncatedAndDrained(t *testing.T) {
+	// One oversized line, then more output than a pipe buffer holds
+	cliPath := writeFakeCLI(t, `
+{ head -c 200000 /dev/zero | tr '\0' x; echo; } >&2
+i=1
+while [ $i -le 2000 ]; do
+  echo "log line $i padded to fill the pipe buffer ................................................" >&2
+  i=$((i+1))
+done
+echo "last line" >&2
+exit 2`)
+
+	var first string
+	maxBuffer := 1024
+	options := &claude.ClaudeAgentOptions{
+		MaxBufferSize: &maxBuffer,
+		Stderr: func(line string) {
+			if first == "" {
+				first = line
+			}
+		},
+	}
+	err := runFakeCLI(t, cliPath, options)
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+	}
+	if !strings.HasSuffix(procErr.Stderr, "last line") {
+		t.Errorf("Expected stderr to be read to the end, got tail %q", procErr.Stderr)
+	}
+	if want := strings.Repeat("x", 1024) + " [truncated 198976 bytes]"; first != want {
+		t.Errorf("Expected the long line truncated to 1024 bytes, got %d bytes ending %q", len(first), first[max(0, len(first)-30):])
+	}
+}
+
+func TestProcessErrorClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected claude.ProcessErrorKind
+	}{
+		{
+			name:     "not logged in",
+			script:   `echo "Invalid API key · Please run /login" >&2; exit 1`,
+			expected: claude.ProcessErrorKindNotLoggedIn,
+		},
+		{
+			name:     "unsupported flag",
+			script:   `echo "error: unknown option '--include-partial-messages'" >&2; exit 1`,
+			expected: claude.ProcessErrorKindUnsupportedFlag,
+		},
+		{
+			name:     "node crash",
+			script:   `echo "FATAL ERROR: Reached heap limit Allocation failed - JavaScript heap out of memory" >&2; exit 134`,
+			expected: claude.ProcessErrorKindNodeCrash,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cliPath := writeFakeCLI(t, tt.script)
+			err := runFakeCLI(t, cliPath, nil)
+
+			var procErr *claude.ProcessError
+			if !errors.As(err, &procErr) {
+				t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+			}
+			if procErr.Kind != tt.expected {
+				t.Errorf("Expected kind %q, got %q (stderr: %q)", tt.expected, procErr.Kind, procErr.Stderr)
+			}
+		})
+	}
+}
+
+func TestMetricsCountCLIStartsAndFailures(t *testing.T) {
+	metrics := newRecordingMetrics()
+	options := &claude.ClaudeAgentOptions{Metrics: metrics}
+
+	runFakeCLI(t, writeFakeCLI(t, `exit 0`), options)
+	runFakeCLI(t, writeFakeCLI(t, `echo "Invalid API key · Please run /login" >&2; exit 1`), options)
+
+	if got := metrics.counter(claude.MetricCLIStarts); got != 2 {
+		t.Errorf("Expected 2 CLI starts, got %v", got)
+	}
+	if got := metrics.counter("claude_cli_failures_total{kind=not_logged_in}"); got != 1 {
+		t.Errorf("Expected one not_logged_in failure, got %v", got)
+	}
+}
+
+func TestProcessErrorRecordsSignal(t *testing.T) {
+	cliPath := writeFakeCLI(t, `echo "about to crash" >&2; kill -SEGV $$`)
+
+	err := runFakeCLI(t, cliPath, nil)
+
+	var procErr *claude.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Expected ProcessError, got %T: %v", err, err)
+	}
+	if procErr.Signal != "SIGSEGV" {
+		t.Errorf("Expected signal SIGSEGV, got %q", procErr.Signal)
+	}
+	if procErr.Kind != claude.ProcessErrorKindNodeCrash {
+		t.Errorf("Expected node crash kind, got %q", procErr.Kind)
+	}
+	if !strings.Contains(procErr.Error(), "SIGSEGV") {
+		t.Errorf("Expected error message to mention signal, got %q", procErr.Error())
+	}
+}
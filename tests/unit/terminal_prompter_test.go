@@ -0,0 +1,247 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/Facets-cloud/claude-agent-sdk-go"
+	"github.com/Facets-cloud/claude-agent-sdk-go/permissions"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newTestPrompter(t *testing.T, input string, cwd string) (*permissions.TerminalPrompter, *syncBuffer) {
+	t.Helper()
+	out := &syncBuffer{}
+	prompter, err := permissions.NewTerminalPrompter(&permissions.TerminalOptions{In: strings.NewReader(input), Out: out, Cwd: cwd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prompter, out
+}
+
+func TestTerminalPrompterChoices(t *testing.T) {
+	ctx := context.Background()
+	bash := map[string]interface{}{"command": "go test ./...", "description": "Run the tests"}
+	prompter, out := newTestPrompter(t, "maybe\ny\na\np\nn\nnot now\nx\n\n", "")
+
+	result, err := prompter.CanUseTool(ctx, "Bash", bash, claude.ToolPermissionContext{})
+	if allow, ok := result.(claude.PermissionResultAllow); err != nil || !ok || allow.UpdatedPermissions != nil {
+		t.Fatalf("Expected allow once, got %#v (%v)", result, err)
+	}
+	if !strings.Contains(out.String(), "Unknown choice \"maybe\"") {
+		t.Error("Expected an unknown choice to be asked again")
+	}
+	if !strings.Contains(out.String(), "  # Run the tests\n  $ go test ./...\n") {
+		t.Errorf("Expected the command in the prompt, got:\n%s", out.String())
+	}
+
+	result, _ = prompter.CanUseTool(ctx, "Bash", bash, claude.ToolPermissionContext{})
+	allow, ok := result.(claude.PermissionResultAllow)
+	if !ok || len(allow.UpdatedPermissions) != 1 {
+		t.Fatalf("Expected allow always with a permission update, got %#v", result)
+	}
+	update := allow.UpdatedPermissions[0]
+	if update.Type != "addRules" || *update.Destination != claude.PermissionUpdateDestinationSession ||
+		update.Rules[0].ToolName != "Bash" || *update.Rules[0].RuleContent != "go test ./..." {
+		t.Errorf("Unexpected session update %+v", update)
+	}
+
+	// The CLI's suggestions are used when it makes some
+	suggestion := claude.PermissionUpdate{Type: "addDirectories", Directories: []string{"/tmp/build"}}
+	result, _ = prompter.CanUseTool(ctx, "Read", map[string]interface{}{"file_path": "/tmp/build/out"},
+		claude.ToolPermissionContext{Suggestions: []claude.PermissionUpdate{suggestion}})
+	allow, _ = result.(claude.PermissionResultAllow)
+	if len(allow.UpdatedPermissions) != 1 || allow.UpdatedPermissions[0].Type != "addDirectories" ||
+		*allow.UpdatedPermissions[0].Destination != claude.PermissionUpdateDestinationProjectSettings {
+		t.Errorf("Expected the suggestion saved to project settings, got %#v", result)
+	}
+
+	result, _ = prompter.CanUseTool(ctx, "Bash", bash, claude.ToolPermissionContext{})
+	if deny, ok := result.(claude.PermissionResultDeny); !ok || deny.Message != "not now" || deny.Interrupt {
+		t.Errorf("Expected a deny with the user's message, got %#v", result)
+	}
+
+	result, _ = prompter.CanUseTool(ctx, "Bash", bash, claude.ToolPermissionContext{})
+	if deny, ok := result.(claude.PermissionResultDeny); !ok || !deny.Interrupt || deny.Message == "" {
+		t.Errorf("Expected deny and interrupt with a default message, got %#v", result)
+	}
+
+	// Input ended
+	if _, err := prompter.CanUseTool(ctx, "Bash", bash, claude.ToolPermissionContext{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected an error once input ends, got %v", err)
+	}
+}
+
+func TestTerminalPrompterShowsDiffs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompter, out := newTestPrompter(t, "y\ny\ny\n", dir)
+	ctx := context.Background()
+
+	prompter.CanUseTool(ctx, "Edit", map[string]interface{}{
+		"file_path":  "/src/a.go",
+		"old_string": "a := 1\nb := 2\nreturn a",
+		"new_string": "a := 1\nb := 3\nreturn a",
+	}, claude.ToolPermissionContext{})
+	if !strings.Contains(out.String(), "  /src/a.go\n    a := 1\n  - b := 2\n  + b := 3\n    return a\n") {
+		t.Errorf("Expected an Edit diff, got:\n%s", out.String())
+	}
+
+	prompter.CanUseTool(ctx, "Write", map[string]interface{}{
+		"file_path": "main.go",
+		"content":   "package main\n\nfunc main() { run() }\n",
+	}, claude.ToolPermissionContext{})
+	if !strings.Contains(out.String(), "  main.go\n    package main\n    \n  - func main() {}\n  + func main() { run() }\n") {
+		t.Errorf("Expected a diff against the existing file, got:\n%s", out.String())
+	}
+
+	prompter.CanUseTool(ctx, "mcp__calc__add", map[string]interface{}{"a": 1}, claude.ToolPermissionContext{})
+	if !strings.Contains(out.String(), "Claude wants to use mcp__calc__add\n  {\n    \"a\": 1\n  }\n") {
+		t.Errorf("Expected pretty-printed JSON input, got:\n%s", out.String())
+	}
+}
+
+func TestTerminalPrompterSerializesRequests(t *testing.T) {
+	inR, inW := io.Pipe()
+	out := &syncBuffer{}
+	prompter, err := permissions.NewTerminalPrompter(&permissions.TerminalOptions{In: inR, Out: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	results := make([]claude.PermissionResult, 2)
+	for i, command := range []string{"first", "second"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = prompter.CanUseTool(ctx, "Bash", map[string]interface{}{"command": command}, claude.ToolPermissionContext{})
+		}()
+	}
+
+	// Only one prompt is shown until it is answered
+	waitFor(t, func() bool { return strings.Count(out.String(), "Allow?") == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if n := strings.Count(out.String(), "Claude wants to use"); n != 1 {
+		t.Fatalf("Expected one prompt at a time, got %d:\n%s", n, out.String())
+	}
+	inW.Write([]byte("y\n"))
+	waitFor(t, func() bool { return strings.Count(out.String(), "Allow?") == 2 })
+	inW.Write([]byte("n\n\n"))
+	wg.Wait()
+
+	allowed, denied := 0, 0
+	for _, result := range results {
+		switch result.(type) {
+		case claude.PermissionResultAllow:
+			allowed++
+		case claude.PermissionResultDeny:
+			denied++
+		}
+	}
+	if allowed != 1 || denied != 1 {
+		t.Errorf("Expected one allow and one deny, got %#v", results)
+	}
+
+	// A waiting prompt gives up with its context
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if _, err := prompter.CanUseTool(short, "Bash", map[string]interface{}{"command": "x"}, claude.ToolPermissionContext{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error, got %v", err)
+	}
+}
+
+func TestTerminalPrompterEscapesControlCharacters(t *testing.T) {
+	prompter, out := newTestPrompter(t, "n\n\nn\n\n", "")
+	command := "rm -rf ~\r\x1b[2K$ ls\x1b[1A"
+	prompter.CanUseTool(context.Background(), "Bash", map[string]interface{}{"command": command, "description": "List\u202efiles"}, claude.ToolPermissionContext{})
+	prompter.CanUseTool(context.Background(), "mcp__x\x1b[31m", map[string]interface{}{}, claude.ToolPermissionContext{})
+
+	if strings.ContainsAny(out.String(), "\x1b\r\u202e") {
+		t.Fatalf("Expected control characters to be escaped, got %q", out.String())
+	}
+	for _, want := range []string{
+		`Claude wants to use mcp__x\x1b[31m`,
+		`  # List\u202efiles`,
+		`  $ rm -rf ~\r\x1b[2K$ ls\x1b[1A`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %s in the prompt, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestTerminalPrompterClose(t *testing.T) {
+	inR, inW := io.Pipe()
+	defer inW.Close()
+	out := &syncBuffer{}
+	prompter, err := permissions.NewTerminalPrompter(&permissions.TerminalOptions{In: inR, Out: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := prompter.CanUseTool(context.Background(), "Bash", map[string]interface{}{"command": "ls"}, claude.ToolPermissionContext{})
+		errCh <- err
+	}()
+	waitFor(t, func() bool { return strings.Contains(out.String(), "Allow?") })
+
+	if err := prompter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, permissions.ErrPrompterClosed) {
+			t.Errorf("Expected ErrPrompterClosed for the pending prompt, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pending prompt did not end on Close")
+	}
+	if _, err := prompter.CanUseTool(context.Background(), "Bash", map[string]interface{}{"command": "ls"}, claude.ToolPermissionContext{}); !errors.Is(err, permissions.ErrPrompterClosed) {
+		t.Errorf("Expected ErrPrompterClosed after Close, got %v", err)
+	}
+	if err := prompter.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,281 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Tracer creates spans for the operations of an agent run. Set
+// ClaudeAgentOptions.Tracer to trace queries; package claudeotel provides a
+// Tracer backed by OpenTelemetry.
+type Tracer interface {
+	// Start begins a span named name as a child of the span in ctx, if
+	// any, and returns a context carrying the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// End finishes the span, recording err if it is not nil.
+	End(err error)
+}
+
+// Attribute is a span attribute. Value is a string, bool, int, int64 or
+// float64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span names used by the SDK.
+const (
+	SpanQuery          = "claude.query"           // One Query, from start to the end of its stream
+	SpanTurn           = "claude.turn"            // One ClaudeSDKClient turn, until its ResultMessage
+	SpanToolUse        = "claude.tool_use"        // From a ToolUseBlock to its ToolResultBlock
+	SpanCanUseTool     = "claude.can_use_tool"    // One CanUseTool callback
+	SpanHook           = "claude.hook"            // One hook callback
+	SpanMCPToolCall    = "claude.mcp.tool_call"   // One SDK MCP server tool call
+	SpanControlRequest = "claude.control_request" // One control request round trip to the CLI
+)
+
+// Attribute keys used by the SDK.
+const (
+	AttrModel               = "claude.model"
+	AttrSessionID           = "claude.session_id"
+	AttrCostUSD             = "claude.cost_usd"
+	AttrNumTurns            = "claude.num_turns"
+	AttrDurationMs          = "claude.duration_ms"
+	AttrResultSubtype       = "claude.result.subtype"
+	AttrInputTokens         = "claude.usage.input_tokens"
+	AttrOutputTokens        = "claude.usage.output_tokens"
+	AttrCacheReadTokens     = "claude.usage.cache_read_input_tokens"
+	AttrCacheCreationTokens = "claude.usage.cache_creation_input_tokens"
+	AttrToolName            = "claude.tool.name"
+	AttrToolUseID           = "claude.tool.use_id"
+	AttrPermissionBehavior  = "claude.permission.behavior"
+	AttrHookEvent           = "claude.hook.event"
+	AttrHookCallbackID      = "claude.hook.callback_id"
+	AttrMCPServer           = "claude.mcp.server"
+	AttrControlSubtype      = "claude.control.subtype"
+)
+
+// runTracer follows an agent run through the message stream and parents
+// spans under the current query or turn. A nil runTracer traces nothing.
+type runTracer struct {
+	tracer Tracer
+
+	mu          sync.Mutex
+	parent      context.Context // Context of the open query or turn span
+	turn        Span
+	endOnResult bool
+	tools       map[string]toolSpan // Open tool use spans by tool use ID
+}
+
+type toolSpan struct {
+	ctx  context.Context
+	span Span
+	name string
+}
+
+func newRunTracer(tracer Tracer) *runTracer {
+	if tracer == nil {
+		return nil
+	}
+	return &runTracer{tracer: tracer, tools: make(map[string]toolSpan)}
+}
+
+// begin starts a query or turn span and returns ctx with it. A turn that is
+// still open absorbs the new one.
+func (rt *runTracer) begin(ctx context.Context, name string) context.Context {
+	if rt == nil {
+		return ctx
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.turn != nil {
+		return rt.parent
+	}
+	rt.parent, rt.turn = rt.tracer.Start(ctx, name)
+	rt.endOnResult = name == SpanTurn
+	return rt.parent
+}
+
+// end finishes the open query or turn span and any tool spans left in it.
+func (rt *runTracer) end(err error) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.endLocked(err)
+}
+
+func (rt *runTracer) endLocked(err error) {
+	for id, tool := range rt.tools {
+		tool.span.End(nil)
+		delete(rt.tools, id)
+	}
+	if rt.turn != nil {
+		rt.turn.End(err)
+		rt.turn = nil
+		rt.parent = nil
+	}
+}
+
+// start begins a span for an operation of the run. It is parented under
+// the open tool use span for toolUseID, else the open turn, else ctx. The
+// returned context carries the span but keeps ctx's cancellation.
+func (rt *runTracer) start(ctx context.Context, name, toolUseID string, attrs ...Attribute) (context.Context, Span) {
+	if rt == nil {
+		return ctx, nil
+	}
+	rt.mu.Lock()
+	parent := rt.parent
+	if tool, ok := rt.tools[toolUseID]; ok && toolUseID != "" {
+		parent = tool.ctx
+	}
+	rt.mu.Unlock()
+
+	if parent == nil {
+		return rt.tracer.Start(ctx, name, attrs...)
+	}
+	spanCtx, span := rt.tracer.Start(parent, name, attrs...)
+	return valuesFrom{Context: ctx, values: spanCtx}, span
+}
+
+// finishSpan ends span if tracing is enabled.
+func finishSpan(span Span, err error) {
+	if span != nil {
+		span.End(err)
+	}
+}
+
+// observe follows a regular message from the CLI: tool uses open spans,
+// tool results close them and the result message annotates the turn.
+func (rt *runTracer) observe(msg map[string]interface{}) {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	switch msg["type"] {
+	case "system":
+		if model, ok := msg["model"].(string); ok && rt.turn != nil {
+			rt.turn.SetAttributes(Attribute{AttrModel, model})
+		}
+	case "assistant":
+		message, _ := msg["message"].(map[string]interface{})
+		if model, ok := message["model"].(string); ok && rt.turn != nil {
+			rt.turn.SetAttributes(Attribute{AttrModel, model})
+		}
+		parent := rt.parent
+		if parentID, ok := msg["parent_tool_use_id"].(string); ok {
+			if tool, ok := rt.tools[parentID]; ok {
+				parent = tool.ctx
+			}
+		}
+		if parent == nil {
+			return
+		}
+		for _, block := range contentBlocks(message) {
+			if block["type"] != "tool_use" {
+				continue
+			}
+			id, _ := block["id"].(string)
+			name, _ := block["name"].(string)
+			ctx, span := rt.tracer.Start(parent, SpanToolUse, Attribute{AttrToolName, name}, Attribute{AttrToolUseID, id})
+			rt.tools[id] = toolSpan{ctx: ctx, span: span, name: name}
+		}
+	case "user":
+		message, _ := msg["message"].(map[string]interface{})
+		for _, block := range contentBlocks(message) {
+			if block["type"] != "tool_result" {
+				continue
+			}
+			id, _ := block["tool_use_id"].(string)
+			tool, ok := rt.tools[id]
+			if !ok {
+				continue
+			}
+			delete(rt.tools, id)
+			var err error
+			if isError, _ := block["is_error"].(bool); isError {
+				err = fmt.Errorf("tool %s failed", tool.name)
+			}
+			tool.span.End(err)
+		}
+	case "result":
+		if rt.turn == nil {
+			return
+		}
+		rt.turn.SetAttributes(resultAttributes(msg)...)
+		if rt.endOnResult {
+			var err error
+			if isError, _ := msg["is_error"].(bool); isError {
+				subtype, _ := msg["subtype"].(string)
+				err = fmt.Errorf("result: %s", subtype)
+			}
+			rt.endLocked(err)
+		}
+	}
+}
+
+func contentBlocks(message map[string]interface{}) []map[string]interface{} {
+	content, _ := message["content"].([]interface{})
+	blocks := make([]map[string]interface{}, 0, len(content))
+	for _, c := range content {
+		if block, ok := c.(map[string]interface{}); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// resultAttributes returns the session, cost and usage of a result message.
+func resultAttributes(msg map[string]interface{}) []Attribute {
+	var attrs []Attribute
+	if v, ok := msg["session_id"].(string); ok {
+		attrs = append(attrs, Attribute{AttrSessionID, v})
+	}
+	if v, ok := msg["subtype"].(string); ok {
+		attrs = append(attrs, Attribute{AttrResultSubtype, v})
+	}
+	if v, ok := msg["total_cost_usd"].(float64); ok {
+		attrs = append(attrs, Attribute{AttrCostUSD, v})
+	}
+	if v, ok := msg["num_turns"].(float64); ok {
+		attrs = append(attrs, Attribute{AttrNumTurns, int64(v)})
+	}
+	if v, ok := msg["duration_ms"].(float64); ok {
+		attrs = append(attrs, Attribute{AttrDurationMs, int64(v)})
+	}
+	usage, _ := msg["usage"].(map[string]interface{})
+	for field, key := range map[string]string{
+		"input_tokens":                AttrInputTokens,
+		"output_tokens":               AttrOutputTokens,
+		"cache_read_input_tokens":     AttrCacheReadTokens,
+		"cache_creation_input_tokens": AttrCacheCreationTokens,
+	} {
+		if v, ok := usage[field].(float64); ok {
+			attrs = append(attrs, Attribute{key, int64(v)})
+		}
+	}
+	return attrs
+}
+
+// valuesFrom takes values, such as the current span, from one context and
+// cancellation from another.
+type valuesFrom struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesFrom) Value(key interface{}) interface{} {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
@@ -0,0 +1,425 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportMiddleware wraps a Transport to add behavior such as logging,
+// metrics or rewriting frames. Middlewares listed in
+// ClaudeAgentOptions.TransportMiddleware are applied by Query, QueryStream,
+// Pool and ClaudeSDKClient; the first one is outermost, so it sees frames
+// the SDK writes first and messages from the CLI last.
+//
+// A middleware usually embeds the Transport it wraps and overrides Write or
+// ReadMessages. InterceptFrames builds one from per-frame functions.
+type TransportMiddleware func(next Transport) Transport
+
+// applyTransportMiddleware wraps trans in middlewares, first outermost.
+func applyTransportMiddleware(trans Transport, middlewares []TransportMiddleware) Transport {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			trans = middlewares[i](trans)
+		}
+	}
+	return trans
+}
+
+// frameTransport calls hooks for every frame passing through the embedded
+// Transport. Nil hooks are skipped.
+type frameTransport struct {
+	Transport
+
+	// onWrite sees each JSON line written to the CLI and returns the line to
+	// send, or nil to drop it
+	onWrite func(ctx context.Context, line []byte) ([]byte, error)
+	// onMessage sees each message from the CLI and returns the message to
+	// deliver, or nil to drop it
+	onMessage func(msg map[string]interface{}) map[string]interface{}
+	// onError sees errors from the wrapped transport's error channel
+	onError func(err error)
+	// onEndInput is called before EndInput is forwarded
+	onEndInput func()
+
+	closeOnce sync.Once
+	closed    chan struct{} // Closed by Close to stop forwarding
+	forwarder sync.WaitGroup
+}
+
+// newFrameTransport wraps next; set the hooks before it is used.
+func newFrameTransport(next Transport) *frameTransport {
+	return &frameTransport{Transport: next, closed: make(chan struct{})}
+}
+
+// Write applies onWrite to each line of data and forwards what remains.
+func (t *frameTransport) Write(ctx context.Context, data string) error {
+	if t.onWrite == nil {
+		return t.Transport.Write(ctx, data)
+	}
+	var out strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rewritten, err := t.onWrite(ctx, []byte(line))
+		if err != nil {
+			return err
+		}
+		if rewritten != nil {
+			out.Write(rewritten)
+			out.WriteByte('\n')
+		}
+	}
+	if out.Len() == 0 {
+		return nil
+	}
+	return t.Transport.Write(ctx, out.String())
+}
+
+// ReadMessages applies onMessage and onError to everything the wrapped
+// transport delivers.
+func (t *frameTransport) ReadMessages(ctx context.Context) (<-chan map[string]interface{}, <-chan error) {
+	innerMsgCh, innerErrCh := t.Transport.ReadMessages(ctx)
+	if t.onMessage == nil && t.onError == nil {
+		return innerMsgCh, innerErrCh
+	}
+
+	// Unbuffered so no forwarded message is still queued when the channels
+	// are closed
+	msgCh := make(chan map[string]interface{})
+	errCh := make(chan error, 1)
+
+	forwardErr := func(err error) {
+		if t.onError != nil {
+			t.onError(err)
+		}
+		errCh <- err
+	}
+
+	t.forwarder.Add(1)
+	go func() {
+		defer t.forwarder.Done()
+		defer close(msgCh)
+		defer close(errCh)
+
+		for {
+			select {
+			case <-t.closed:
+				return
+			case msg, ok := <-innerMsgCh:
+				if !ok {
+					// Pick up an error sent just before the stream ended
+					select {
+					case err, ok := <-innerErrCh:
+						if ok && err != nil {
+							forwardErr(err)
+						}
+					default:
+					}
+					return
+				}
+				if t.onMessage != nil {
+					if msg = t.onMessage(msg); msg == nil {
+						continue
+					}
+				}
+				select {
+				case msgCh <- msg:
+				case <-ctx.Done():
+					return
+				case <-t.closed:
+					return
+				}
+			case err, ok := <-innerErrCh:
+				if !ok {
+					innerErrCh = nil
+					continue
+				}
+				if err != nil {
+					forwardErr(err)
+					return
+				}
+			}
+		}
+	}()
+
+	return msgCh, errCh
+}
+
+// Close closes the wrapped transport and waits until no hook runs anymore,
+// so whatever the hooks write to can be released afterwards.
+func (t *frameTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	err := t.Transport.Close()
+	t.forwarder.Wait()
+	return err
+}
+
+// EndInput calls onEndInput and forwards.
+func (t *frameTransport) EndInput() error {
+	if t.onEndInput != nil {
+		t.onEndInput()
+	}
+	return t.Transport.EndInput()
+}
+
+// FrameInterceptor inspects or rewrites decoded frames. Either function may
+// be nil.
+type FrameInterceptor struct {
+	// Send is called for every frame the SDK writes to the CLI. It returns
+	// the frame to send, nil to drop it, or an error that fails the Write.
+	Send func(ctx context.Context, frame map[string]interface{}) (map[string]interface{}, error)
+	// Receive is called for every message the CLI writes. It returns the
+	// message to deliver, or nil to drop it.
+	Receive func(msg map[string]interface{}) map[string]interface{}
+}
+
+// InterceptFrames returns a middleware that passes frames through
+// interceptor, e.g. to redact secrets or add metadata to user messages.
+//
+// Example:
+//
+//	// Tag every user message with the tenant it belongs to
+//	tagTenant := claude.InterceptFrames(claude.FrameInterceptor{
+//	    Send: func(ctx context.Context, frame map[string]interface{}) (map[string]interface{}, error) {
+//	        if frame["type"] == "user" {
+//	            frame["metadata"] = map[string]interface{}{"tenant": tenantID}
+//	        }
+//	        return frame, nil
+//	    },
+//	})
+//	options := &claude.ClaudeAgentOptions{
+//	    TransportMiddleware: []claude.TransportMiddleware{tagTenant},
+//	}
+func InterceptFrames(interceptor FrameInterceptor) TransportMiddleware {
+	return func(next Transport) Transport {
+		t := newFrameTransport(next)
+		t.onMessage = interceptor.Receive
+		if interceptor.Send != nil {
+			t.onWrite = func(ctx context.Context, line []byte) ([]byte, error) {
+				var frame map[string]interface{}
+				if err := json.Unmarshal(line, &frame); err != nil {
+					// Not a JSON object: pass it through untouched
+					return line, nil
+				}
+				frame, err := interceptor.Send(ctx, frame)
+				if err != nil || frame == nil {
+					return nil, err
+				}
+				return json.Marshal(frame)
+			}
+		}
+		return t
+	}
+}
+
+// TraceMiddleware returns a middleware that logs the raw protocol to w, one
+// line per event:
+//
+//	2025-01-02T15:04:05.000000Z >> {"type":"user",...}     frame sent to the CLI
+//	2025-01-02T15:04:05.000000Z << {"type":"assistant",...} message from the CLI
+//	2025-01-02T15:04:05.000000Z -- end input
+//	2025-01-02T15:04:05.000000Z !! <error>
+//
+// Writes to w are serialized. Traces contain prompts and tool output; treat
+// them like the conversation itself.
+func TraceMiddleware(w io.Writer) TransportMiddleware {
+	var mu sync.Mutex
+	trace := func(marker string, text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s %s %s\n", time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"), marker, text)
+	}
+
+	return func(next Transport) Transport {
+		t := newFrameTransport(next)
+		t.onWrite = func(ctx context.Context, line []byte) ([]byte, error) {
+			trace(">>", string(line))
+			return line, nil
+		}
+		t.onMessage = func(msg map[string]interface{}) map[string]interface{} {
+			line, err := json.Marshal(msg)
+			if err != nil {
+				line = []byte(fmt.Sprintf("%v", msg))
+			}
+			trace("<<", string(line))
+			return msg
+		}
+		t.onError = func(err error) { trace("!!", err.Error()) }
+		t.onEndInput = func() { trace("--", "end input") }
+		return t
+	}
+}
+
+// LatencyStats summarizes a set of measured durations.
+type LatencyStats struct {
+	Count uint64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average duration, or 0 if nothing was measured.
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s *LatencyStats) observe(d time.Duration) {
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// TransportStats is a snapshot of TransportMetrics.
+type TransportStats struct {
+	FramesSent           uint64
+	FramesReceived       uint64
+	BytesSent            uint64 // Bytes of JSON written, excluding newlines
+	BytesReceived        uint64 // Bytes of the messages re-encoded as JSON
+	LargestFrameSent     int
+	LargestFrameReceived int
+	Errors               uint64
+
+	// ControlLatency measures SDK control requests (initialize, interrupt,
+	// set_model, ...) from being written to their response arriving
+	ControlLatency LatencyStats
+	// TurnLatency measures user messages from being written to the result
+	// message of their turn
+	TurnLatency LatencyStats
+	// FirstMessageLatency measures user messages from being written to the
+	// first message of the response that follows
+	FirstMessageLatency LatencyStats
+}
+
+// TransportMetrics counts frames and bytes in both directions and measures
+// control request and turn latencies of the transports it is installed on.
+// One TransportMetrics may be shared by several queries.
+//
+// Example:
+//
+//	metrics := claude.NewTransportMetrics()
+//	options := &claude.ClaudeAgentOptions{
+//	    TransportMiddleware: []claude.TransportMiddleware{metrics.Middleware()},
+//	}
+//	// ... run queries ...
+//	stats := metrics.Stats()
+//	fmt.Println(stats.FramesSent, stats.TurnLatency.Mean())
+type TransportMetrics struct {
+	mu    sync.Mutex
+	stats TransportStats
+}
+
+// NewTransportMetrics creates an empty TransportMetrics.
+func NewTransportMetrics() *TransportMetrics {
+	return &TransportMetrics{}
+}
+
+// Stats returns a snapshot of the counters.
+func (m *TransportMetrics) Stats() TransportStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// metricsFrame holds the fields of a sent frame metrics look at.
+type metricsFrame struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id"`
+}
+
+// Middleware returns a middleware that records into m. Each transport it
+// wraps tracks its own pending requests and turns.
+func (m *TransportMetrics) Middleware() TransportMiddleware {
+	return func(next Transport) Transport {
+		var mu sync.Mutex
+		pendingControl := make(map[string]time.Time)
+		var turnStarts []time.Time // Unanswered user messages, oldest first
+		awaitingFirst := false
+
+		t := newFrameTransport(next)
+		t.onWrite = func(ctx context.Context, line []byte) ([]byte, error) {
+			var frame metricsFrame
+			json.Unmarshal(line, &frame)
+			now := time.Now()
+
+			mu.Lock()
+			switch frame.Type {
+			case "control_request":
+				pendingControl[frame.RequestID] = now
+			case "user":
+				turnStarts = append(turnStarts, now)
+				awaitingFirst = true
+			}
+			mu.Unlock()
+
+			m.mu.Lock()
+			m.stats.FramesSent++
+			m.stats.BytesSent += uint64(len(line))
+			m.stats.LargestFrameSent = max(m.stats.LargestFrameSent, len(line))
+			m.mu.Unlock()
+			return line, nil
+		}
+		t.onMessage = func(msg map[string]interface{}) map[string]interface{} {
+			size := 0
+			if line, err := json.Marshal(msg); err == nil {
+				size = len(line)
+			}
+			now := time.Now()
+
+			var control, turn, first time.Duration
+			mu.Lock()
+			if awaitingFirst && msg["type"] != "control_request" && msg["type"] != "control_response" && len(turnStarts) > 0 {
+				first = now.Sub(turnStarts[len(turnStarts)-1])
+				awaitingFirst = false
+			}
+			switch msg["type"] {
+			case "control_response":
+				if response, ok := msg["response"].(map[string]interface{}); ok {
+					id, _ := response["request_id"].(string)
+					if start, ok := pendingControl[id]; ok {
+						control = now.Sub(start)
+						delete(pendingControl, id)
+					}
+				}
+			case "result":
+				if len(turnStarts) > 0 {
+					turn = now.Sub(turnStarts[0])
+					turnStarts = turnStarts[1:]
+				}
+			}
+			mu.Unlock()
+
+			m.mu.Lock()
+			m.stats.FramesReceived++
+			m.stats.BytesReceived += uint64(size)
+			m.stats.LargestFrameReceived = max(m.stats.LargestFrameReceived, size)
+			if control > 0 {
+				m.stats.ControlLatency.observe(control)
+			}
+			if turn > 0 {
+				m.stats.TurnLatency.observe(turn)
+			}
+			if first > 0 {
+				m.stats.FirstMessageLatency.observe(first)
+			}
+			m.mu.Unlock()
+			return msg
+		}
+		t.onError = func(err error) {
+			m.mu.Lock()
+			m.stats.Errors++
+			m.mu.Unlock()
+		}
+		return t
+	}
+}
@@ -0,0 +1,241 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FrameDirection identifies what a recorded frame represents.
+type FrameDirection string
+
+const (
+	// FrameSent is a frame written by the SDK to the CLI (stdin).
+	FrameSent FrameDirection = "send"
+
+	// FrameReceived is a frame read by the SDK from the CLI (stdout).
+	FrameReceived FrameDirection = "recv"
+
+	// FrameEndInput records a call to EndInput.
+	FrameEndInput FrameDirection = "end_input"
+
+	// FrameError records an error reported by the wrapped transport's
+	// ReadMessages error channel.
+	FrameError FrameDirection = "error"
+)
+
+// RecordedFrame is one line of a session recording.
+type RecordedFrame struct {
+	Time      time.Time       `json:"ts"`
+	Direction FrameDirection  `json:"dir"`
+	Frame     json.RawMessage `json:"frame,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// RecordingTransport wraps a Transport and writes every frame exchanged with
+// it, in both directions and with timestamps, to a JSONL stream. Recordings
+// can be replayed with ReplayTransport.
+//
+// Example:
+//
+//	inner, _ := claude.NewSubprocessCLITransport("", options, "")
+//	rec, err := claude.NewRecordingTransportFile(inner, "session.jsonl")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	msgCh, errCh, err := claude.Query(ctx, "Hello", options, rec)
+type RecordingTransport struct {
+	inner  Transport
+	w      io.Writer
+	closer io.Closer
+	mu     sync.Mutex
+	err    error
+}
+
+// NewRecordingTransport returns a transport that records all traffic of
+// inner to w. Writes to w are serialized.
+func NewRecordingTransport(inner Transport, w io.Writer) *RecordingTransport {
+	return &RecordingTransport{inner: inner, w: w}
+}
+
+// NewRecordingTransportFile records all traffic of inner to a new file at
+// path. The file is created with mode 0600 because recordings contain
+// prompts and tool output, and is closed when the transport is closed.
+func NewRecordingTransportFile(inner Transport, path string) (*RecordingTransport, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	t := NewRecordingTransport(inner, f)
+	t.closer = f
+	return t, nil
+}
+
+// Err returns the first error encountered while writing the recording.
+// Recording failures never interrupt the session itself.
+func (t *RecordingTransport) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// record appends a frame to the recording.
+func (t *RecordingTransport) record(frame RecordedFrame) {
+	frame.Time = time.Now().UTC()
+	line, err := json.Marshal(frame)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil {
+		_, err = t.w.Write(append(line, '\n'))
+	}
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Connect connects the wrapped transport.
+func (t *RecordingTransport) Connect(ctx context.Context) error {
+	return t.inner.Connect(ctx)
+}
+
+// Write records each JSON line in data and forwards it to the wrapped
+// transport.
+func (t *RecordingTransport) Write(ctx context.Context, data string) error {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		frame := json.RawMessage(line)
+		if !json.Valid(frame) {
+			// Keep non-JSON writes as a JSON string so the recording stays valid
+			frame, _ = json.Marshal(line)
+		}
+		t.record(RecordedFrame{Direction: FrameSent, Frame: frame})
+	}
+	return t.inner.Write(ctx, data)
+}
+
+// ReadMessages records and forwards every message and error from the
+// wrapped transport.
+func (t *RecordingTransport) ReadMessages(ctx context.Context) (<-chan map[string]interface{}, <-chan error) {
+	innerMsgCh, innerErrCh := t.inner.ReadMessages(ctx)
+	// Unbuffered so no forwarded message is still queued when the channels
+	// are closed
+	msgCh := make(chan map[string]interface{})
+	errCh := make(chan error, 1)
+
+	forwardErr := func(err error) {
+		t.record(RecordedFrame{Direction: FrameError, Error: err.Error()})
+		errCh <- err
+	}
+
+	go func() {
+		defer close(msgCh)
+		defer close(errCh)
+
+		for {
+			select {
+			case msg, ok := <-innerMsgCh:
+				if !ok {
+					// Pick up an error sent just before the stream ended
+					select {
+					case err, ok := <-innerErrCh:
+						if ok && err != nil {
+							forwardErr(err)
+						}
+					default:
+					}
+					return
+				}
+				if frame, err := json.Marshal(msg); err == nil {
+					t.record(RecordedFrame{Direction: FrameReceived, Frame: frame})
+				}
+				select {
+				case msgCh <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case err, ok := <-innerErrCh:
+				if !ok {
+					innerErrCh = nil
+					continue
+				}
+				if err != nil {
+					forwardErr(err)
+					return
+				}
+			}
+		}
+	}()
+
+	return msgCh, errCh
+}
+
+// EndInput records the end of input and forwards it.
+func (t *RecordingTransport) EndInput() error {
+	t.record(RecordedFrame{Direction: FrameEndInput})
+	return t.inner.EndInput()
+}
+
+// IsReady reports whether the wrapped transport is ready.
+func (t *RecordingTransport) IsReady() bool {
+	return t.inner.IsReady()
+}
+
+// Close closes the wrapped transport and, for file recordings, the file.
+func (t *RecordingTransport) Close() error {
+	err := t.inner.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closer != nil {
+		if closeErr := t.closer.Close(); closeErr != nil && t.err == nil {
+			t.err = closeErr
+		}
+		t.closer = nil
+	}
+	return err
+}
+
+// LoadRecording reads a JSONL recording written by RecordingTransport.
+func LoadRecording(path string) ([]RecordedFrame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f)
+}
+
+// ReadRecording parses a JSONL recording from r.
+func ReadRecording(r io.Reader) ([]RecordedFrame, error) {
+	var frames []RecordedFrame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var frame RecordedFrame
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", lineNo, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
@@ -0,0 +1,450 @@
+package claude
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Facets-cloud/claude-agent-sdk-go/internal/wire"
+)
+
+const (
+	defaultRemoteHeartbeatInterval = 15 * time.Second
+	defaultRemoteReconnectTimeout  = 30 * time.Second
+	defaultRemoteMaxMessageSize    = 16 * 1024 * 1024
+
+	// Missed heartbeats before a connection is considered dead
+	remoteHeartbeatMisses = 3
+
+	// Received frames between explicit acknowledgements, bounding how much
+	// the server keeps for resending
+	remoteAckInterval = 16
+
+	remoteReconnectMinBackoff = 100 * time.Millisecond
+	remoteReconnectMaxBackoff = 2 * time.Second
+)
+
+// RemoteTransportOptions configures a RemoteTransport.
+type RemoteTransportOptions struct {
+	// Token authenticates the client to the agent host
+	Token string
+	// Metadata is passed to the agent host, which may use it to choose the
+	// options the CLI is started with
+	Metadata map[string]string
+	// TLSConfig enables TLS for tcp:// addresses and configures it for wss://
+	TLSConfig *tls.Config
+	// HeartbeatInterval is how often the connection is checked; it is
+	// considered dead after three intervals without traffic (default: 15s)
+	HeartbeatInterval time.Duration
+	// ReconnectTimeout is how long to keep reconnecting after the connection
+	// drops before the session fails (default: 30s, negative disables)
+	ReconnectTimeout time.Duration
+	// MaxMessageSize limits a single frame (default: 16MB)
+	MaxMessageSize int
+	// Logger receives connection loss and reconnect events (default: discard)
+	Logger *slog.Logger
+}
+
+// RemoteTransport drives a Claude Code CLI running on another host, through
+// the agenthost server, over TCP ("tcp://host:port") or WebSocket
+// ("ws://host:port/path", "wss://host:port/path").
+//
+// Every frame is numbered and kept until the agent host acknowledges it, in
+// both directions, so when the connection drops the transport reconnects to
+// the same session and resumes without losing or repeating frames. The CLI
+// keeps running on the agent host while the client reconnects.
+//
+// The agent host chooses the options the CLI runs with; options passed to
+// Query or NewClaudeSDKClient only configure the control protocol (hooks,
+// CanUseTool, SDK MCP servers, agents).
+//
+// Example:
+//
+//	transport, err := claude.NewRemoteTransport("wss://worker-1:8443/agent", &claude.RemoteTransportOptions{
+//	    Token: os.Getenv("AGENT_HOST_TOKEN"),
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	msgCh, errCh, err := claude.Query(ctx, "Hello", options, transport)
+type RemoteTransport struct {
+	address string
+	options RemoteTransportOptions
+
+	mu        sync.Mutex
+	conn      wire.Conn
+	sessionID string
+	connected bool
+	closed    bool
+	failed    bool
+
+	outbox wire.Outbox
+	inbox  wire.Inbox
+
+	msgCh  chan map[string]interface{}
+	errCh  chan error
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRemoteTransport creates a transport for the agent host at address.
+// options may be nil to use the defaults.
+func NewRemoteTransport(address string, options *RemoteTransportOptions) (*RemoteTransport, error) {
+	if !strings.HasPrefix(address, "tcp://") && !strings.HasPrefix(address, "ws://") && !strings.HasPrefix(address, "wss://") {
+		return nil, fmt.Errorf("unsupported remote address %q: expected tcp://, ws:// or wss://", address)
+	}
+
+	var opts RemoteTransportOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaultRemoteHeartbeatInterval
+	}
+	if opts.ReconnectTimeout == 0 {
+		opts.ReconnectTimeout = defaultRemoteReconnectTimeout
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = defaultRemoteMaxMessageSize
+	}
+	if opts.Logger == nil {
+		opts.Logger = discardLogger
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RemoteTransport{
+		address: address,
+		options: opts,
+		msgCh:   make(chan map[string]interface{}, 10),
+		errCh:   make(chan error, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// SessionID returns the session the agent host assigned, or "" before
+// Connect.
+func (t *RemoteTransport) SessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// Connect connects to the agent host, which starts the CLI.
+func (t *RemoteTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	if t.connected || t.closed {
+		t.mu.Unlock()
+		return NewCLIConnectionError("remote transport already connected", nil)
+	}
+	t.mu.Unlock()
+
+	conn, _, err := t.handshake(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.conn = conn
+	t.connected = true
+	t.mu.Unlock()
+
+	t.wg.Add(2)
+	go t.readLoop()
+	go t.heartbeat()
+	return nil
+}
+
+// handshake dials the agent host and opens or resumes the session. Frames
+// the server has not acknowledged are resent on the new connection.
+// rejected reports a refusal that retrying cannot fix.
+func (t *RemoteTransport) handshake(ctx context.Context) (conn wire.Conn, rejected bool, err error) {
+	conn, err = wire.Dial(ctx, t.address, t.options.TLSConfig, t.options.MaxMessageSize)
+	if err != nil {
+		return nil, false, NewCLIConnectionError(fmt.Sprintf("failed to connect to agent host %s", t.address), err)
+	}
+
+	hello := &wire.Envelope{
+		Type:     wire.TypeHello,
+		Token:    t.options.Token,
+		Session:  t.SessionID(),
+		Ack:      t.inbox.Last(),
+		Metadata: t.options.Metadata,
+	}
+	conn.SetReadDeadline(time.Now().Add(t.heartbeatTimeout()))
+	if err := wire.WriteEnvelope(conn, hello); err != nil {
+		conn.Close()
+		return nil, false, NewCLIConnectionError("failed to send hello to agent host", err)
+	}
+	reply, err := wire.ReadEnvelope(conn)
+	if err != nil {
+		conn.Close()
+		return nil, false, NewCLIConnectionError("agent host did not answer hello", err)
+	}
+	if reply.Type != wire.TypeWelcome {
+		conn.Close()
+		return nil, true, NewCLIConnectionError(fmt.Sprintf("agent host rejected the session: %s", reply.Error), nil)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionID = reply.Session
+	t.outbox.Ack(reply.Ack)
+	for _, env := range t.outbox.Pending() {
+		if err := wire.WriteEnvelope(conn, env); err != nil {
+			conn.Close()
+			return nil, false, NewCLIConnectionError("failed to resend frames to agent host", err)
+		}
+	}
+	return conn, false, nil
+}
+
+func (t *RemoteTransport) heartbeatTimeout() time.Duration {
+	return remoteHeartbeatMisses * t.options.HeartbeatInterval
+}
+
+// readLoop delivers frames from the agent host, reconnecting when the
+// connection drops.
+func (t *RemoteTransport) readLoop() {
+	defer t.wg.Done()
+	defer close(t.msgCh)
+	defer close(t.errCh)
+
+	received := 0
+	for {
+		t.mu.Lock()
+		conn := t.conn
+		t.mu.Unlock()
+		if conn == nil {
+			return // Closed while reconnecting
+		}
+
+		conn.SetReadDeadline(time.Now().Add(t.heartbeatTimeout()))
+		env, err := wire.ReadEnvelope(conn)
+		if err != nil {
+			if t.isClosed() {
+				return
+			}
+			if err := t.reconnect(conn); err != nil {
+				t.fail(err)
+				return
+			}
+			continue
+		}
+
+		if env.Ack > 0 {
+			t.outbox.Ack(env.Ack)
+		}
+		if !env.Sequenced() || !t.inbox.Accept(env.Seq) {
+			continue
+		}
+		if received++; received%remoteAckInterval == 0 {
+			t.send(&wire.Envelope{Type: wire.TypeAck, Ack: env.Seq})
+		}
+
+		switch env.Type {
+		case wire.TypeData:
+			var msg map[string]interface{}
+			if err := json.Unmarshal(env.Frame, &msg); err != nil {
+				t.fail(NewCLIJSONDecodeError(string(env.Frame), err))
+				return
+			}
+			select {
+			case t.msgCh <- msg:
+			case <-t.ctx.Done():
+				return
+			}
+		case wire.TypeError:
+			t.fail(NewCLIConnectionError(fmt.Sprintf("agent host: %s", env.Error), nil))
+			return
+		case wire.TypeEOF:
+			// The CLI exited; let the agent host end the session
+			t.send(&wire.Envelope{Type: wire.TypeClose, Ack: env.Seq})
+			return
+		}
+	}
+}
+
+// reconnect replaces the dropped connection old, retrying with backoff until
+// ReconnectTimeout expires.
+func (t *RemoteTransport) reconnect(old wire.Conn) error {
+	// Close first: it unblocks a write stuck on the dead connection that
+	// may be holding the lock
+	old.Close()
+	t.mu.Lock()
+	if t.conn == old {
+		t.conn = nil
+	}
+	t.mu.Unlock()
+
+	logger := t.options.Logger.With("address", t.address, "remote_session_id", t.SessionID())
+	if t.options.ReconnectTimeout < 0 {
+		logger.Error("claude: connection to agent host lost")
+		return NewCLIConnectionError("connection to agent host lost", nil)
+	}
+	logger.Warn("claude: connection to agent host lost, reconnecting")
+
+	ctx, cancel := context.WithTimeout(t.ctx, t.options.ReconnectTimeout)
+	defer cancel()
+
+	backoff := remoteReconnectMinBackoff
+	var lastErr error
+	for {
+		conn, rejected, err := t.handshake(ctx)
+		if err == nil {
+			t.mu.Lock()
+			if t.closed {
+				t.mu.Unlock()
+				conn.Close()
+				return nil
+			}
+			t.conn = conn
+			t.mu.Unlock()
+			logger.Info("claude: reconnected to agent host")
+			return nil
+		}
+		lastErr = err
+		if rejected {
+			logger.Error("claude: agent host rejected reconnect", "error", err)
+			return err
+		}
+		logger.Debug("claude: reconnect attempt failed", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			logger.Error("claude: could not reconnect to agent host", "error", lastErr)
+			return NewCLIConnectionError("could not reconnect to agent host", lastErr)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, remoteReconnectMaxBackoff)
+	}
+}
+
+// heartbeat pings the agent host so dead connections are noticed and
+// acknowledgements flow while the session is idle.
+func (t *RemoteTransport) heartbeat() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.options.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			t.send(&wire.Envelope{Type: wire.TypePing, Ack: t.inbox.Last()})
+		}
+	}
+}
+
+// send writes an unsequenced envelope to the current connection. Failures
+// are left to the read loop to notice.
+func (t *RemoteTransport) send(env *wire.Envelope) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		wire.WriteEnvelope(t.conn, env)
+	}
+}
+
+// sendSequenced numbers env, keeps it until acknowledged and writes it to
+// the current connection, if any. A failed write is resent after the
+// reconnect.
+func (t *RemoteTransport) sendSequenced(env *wire.Envelope) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.connected || t.closed || t.failed {
+		return NewCLIConnectionError("remote transport is not ready for writing", nil)
+	}
+	t.outbox.Add(env)
+	if t.conn != nil {
+		wire.WriteEnvelope(t.conn, env)
+	}
+	return nil
+}
+
+// fail reports err on the error channel and stops accepting writes.
+func (t *RemoteTransport) fail(err error) {
+	t.mu.Lock()
+	t.failed = true
+	t.mu.Unlock()
+	select {
+	case t.errCh <- err:
+	default:
+	}
+}
+
+func (t *RemoteTransport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// Write sends each JSON line in data to the CLI.
+func (t *RemoteTransport) Write(ctx context.Context, data string) error {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			return fmt.Errorf("remote transport can only send JSON lines: %q", line)
+		}
+		if err := t.sendSequenced(&wire.Envelope{Type: wire.TypeData, Frame: json.RawMessage(line)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMessages returns the messages the CLI writes. The channels are closed
+// when the CLI exits, the session fails or the transport is closed.
+func (t *RemoteTransport) ReadMessages(ctx context.Context) (<-chan map[string]interface{}, <-chan error) {
+	return t.msgCh, t.errCh
+}
+
+// EndInput closes the CLI's stdin on the agent host.
+func (t *RemoteTransport) EndInput() error {
+	return t.sendSequenced(&wire.Envelope{Type: wire.TypeEndInput})
+}
+
+// IsReady reports whether the session is connected and has not failed. It
+// stays true while the transport reconnects.
+func (t *RemoteTransport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected && !t.closed && !t.failed
+}
+
+// Close ends the session, which stops the CLI on the agent host.
+func (t *RemoteTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	conn := t.conn
+	t.conn = nil
+	connected := t.connected
+	t.mu.Unlock()
+
+	if conn != nil {
+		wire.WriteEnvelope(conn, &wire.Envelope{Type: wire.TypeClose, Ack: t.inbox.Last()})
+		conn.Close()
+	}
+	t.cancel()
+	if connected {
+		t.wg.Wait()
+	} else {
+		close(t.msgCh)
+		close(t.errCh)
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultReplayWriteTimeout = 10 * time.Second
+
+// errReplayClosed stops the replay loop when the transport is closed.
+var errReplayClosed = errors.New("replay transport closed")
+
+// ReplayOptions configures a ReplayTransport.
+type ReplayOptions struct {
+	// IgnoreKeys are object keys removed at any depth before comparing a
+	// write with the recording, for fields that legitimately differ between
+	// runs (e.g. "uuid").
+	IgnoreKeys []string
+
+	// WriteTimeout is how long to wait for an expected write before failing
+	// (default: 10s).
+	WriteTimeout time.Duration
+}
+
+// ReplayTransport plays back a session recorded by RecordingTransport
+// without starting the CLI.
+//
+// Recorded CLI output is fed to the SDK in order. When the recording shows a
+// write from the SDK, replay waits for the SDK to make that write and checks
+// that it matches; a mismatch is reported as a *ReplayMismatchError on the
+// ReadMessages error channel. Because control requests recorded from the CLI
+// are replayed as well, hooks, CanUseTool and SDK MCP tools run for real and
+// their responses are checked against the recording.
+//
+// Request IDs generated by the SDK differ between runs; replay maps them to
+// the recorded IDs so recorded control responses reach the right request.
+//
+// Example:
+//
+//	replay, err := claude.NewReplayTransportFile("testdata/session.jsonl", nil)
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	msgCh, errCh, err := claude.Query(ctx, "Hello", options, replay)
+type ReplayTransport struct {
+	frames       []RecordedFrame
+	ignoreKeys   map[string]bool
+	writeTimeout time.Duration
+
+	mu          sync.Mutex
+	writes      []interface{} // Writes not yet matched against the recording
+	writeSignal chan struct{}
+	requestIDs  map[string]string // Recorded SDK request ID -> actual request ID
+	finished    bool
+	ready       bool
+	started     bool
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewReplayTransport creates a transport that replays frames.
+func NewReplayTransport(frames []RecordedFrame, options *ReplayOptions) *ReplayTransport {
+	if options == nil {
+		options = &ReplayOptions{}
+	}
+
+	writeTimeout := defaultReplayWriteTimeout
+	if options.WriteTimeout > 0 {
+		writeTimeout = options.WriteTimeout
+	}
+
+	ignoreKeys := make(map[string]bool, len(options.IgnoreKeys))
+	for _, key := range options.IgnoreKeys {
+		ignoreKeys[key] = true
+	}
+
+	return &ReplayTransport{
+		frames:       frames,
+		ignoreKeys:   ignoreKeys,
+		writeTimeout: writeTimeout,
+		writeSignal:  make(chan struct{}, 1),
+		requestIDs:   make(map[string]string),
+		done:         make(chan struct{}),
+	}
+}
+
+// NewReplayTransportFile creates a transport that replays the recording at
+// path.
+func NewReplayTransportFile(path string, options *ReplayOptions) (*ReplayTransport, error) {
+	frames, err := LoadRecording(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording: %w", err)
+	}
+	return NewReplayTransport(frames, options), nil
+}
+
+// Connect marks the transport ready.
+func (t *ReplayTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return NewCLIConnectionError("replay transport is closed", nil)
+	default:
+	}
+	t.ready = true
+	return nil
+}
+
+// Write queues data to be matched against the next recorded writes.
+func (t *ReplayTransport) Write(ctx context.Context, data string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.ready {
+		return NewCLIConnectionError("replay transport is not ready for writing", nil)
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var frame interface{}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			frame = line
+		}
+		if t.finished {
+			return NewReplayMismatchError("unexpected write after end of recording", len(t.frames), "", line)
+		}
+		t.writes = append(t.writes, frame)
+	}
+
+	select {
+	case t.writeSignal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ReadMessages replays the recording. It must be called once.
+func (t *ReplayTransport) ReadMessages(ctx context.Context) (<-chan map[string]interface{}, <-chan error) {
+	// Unbuffered so every replayed message is handed to the reader before
+	// the channels are closed
+	msgCh := make(chan map[string]interface{})
+	errCh := make(chan error, 1)
+
+	t.mu.Lock()
+	started := t.started
+	t.started = true
+	t.mu.Unlock()
+	if started {
+		errCh <- fmt.Errorf("replay transport: ReadMessages called more than once")
+		close(msgCh)
+		close(errCh)
+		return msgCh, errCh
+	}
+
+	go func() {
+		defer close(msgCh)
+		defer close(errCh)
+
+		if err := t.replay(ctx, msgCh); err != nil && err != errReplayClosed {
+			errCh <- err
+		}
+	}()
+
+	return msgCh, errCh
+}
+
+// replay walks the recording, emitting received frames and checking sent
+// frames.
+func (t *ReplayTransport) replay(ctx context.Context, msgCh chan<- map[string]interface{}) error {
+	for i, frame := range t.frames {
+		switch frame.Direction {
+		case FrameReceived:
+			var msg map[string]interface{}
+			if err := json.Unmarshal(frame.Frame, &msg); err != nil {
+				return fmt.Errorf("replay frame %d: %w", i, err)
+			}
+			t.mapControlResponseID(msg)
+			select {
+			case msgCh <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.done:
+				return errReplayClosed
+			}
+		case FrameSent:
+			if err := t.expectWrite(ctx, i, frame); err != nil {
+				return err
+			}
+		case FrameError:
+			return &ClaudeSDKError{Message: frame.Error}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished = true
+	if len(t.writes) > 0 {
+		actual, _ := json.Marshal(t.writes[0])
+		return NewReplayMismatchError("unexpected write not in recording", len(t.frames), "", string(actual))
+	}
+	return nil
+}
+
+// expectWrite waits for the SDK to write the frame recorded at index and
+// compares it with the recording.
+func (t *ReplayTransport) expectWrite(ctx context.Context, index int, frame RecordedFrame) error {
+	var expected interface{}
+	if err := json.Unmarshal(frame.Frame, &expected); err != nil {
+		return fmt.Errorf("replay frame %d: %w", index, err)
+	}
+
+	timer := time.NewTimer(t.writeTimeout)
+	defer timer.Stop()
+
+	for {
+		t.mu.Lock()
+		if i := t.findWrite(expected); i >= 0 {
+			actual := t.writes[i]
+			t.writes = append(t.writes[:i], t.writes[i+1:]...)
+			err := t.compare(index, expected, actual)
+			t.mu.Unlock()
+			return err
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-t.writeSignal:
+		case <-timer.C:
+			return NewReplayMismatchError("timed out waiting for write", index, string(frame.Frame), "")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.done:
+			return errReplayClosed
+		}
+	}
+}
+
+// findWrite returns the index of the pending write that corresponds to
+// expected, or -1. Control responses are matched by request ID because the
+// SDK answers concurrent control requests in any order; all other writes
+// are matched in order.
+func (t *ReplayTransport) findWrite(expected interface{}) int {
+	if frameType(expected) == "control_response" {
+		id := controlResponseID(expected)
+		for i, w := range t.writes {
+			if frameType(w) == "control_response" && controlResponseID(w) == id {
+				return i
+			}
+		}
+		return -1
+	}
+	for i, w := range t.writes {
+		if frameType(w) != "control_response" {
+			return i
+		}
+	}
+	return -1
+}
+
+// compare checks a write against the recorded frame. For control requests
+// sent by the SDK, the request ID is excluded and remembered so the recorded
+// response can be routed back.
+func (t *ReplayTransport) compare(index int, expected, actual interface{}) error {
+	if frameType(expected) == "control_request" && frameType(actual) == "control_request" {
+		recordedID, _ := expected.(map[string]interface{})["request_id"].(string)
+		actualID, _ := actual.(map[string]interface{})["request_id"].(string)
+		t.requestIDs[recordedID] = actualID
+	}
+
+	ignore := t.ignoreKeys
+	if frameType(expected) == "control_request" {
+		ignore = withKey(ignore, "request_id")
+	}
+	if !reflect.DeepEqual(stripKeys(expected, ignore), stripKeys(actual, ignore)) {
+		expectedJSON, _ := json.Marshal(expected)
+		actualJSON, _ := json.Marshal(actual)
+		return NewReplayMismatchError("write does not match recording", index, string(expectedJSON), string(actualJSON))
+	}
+	return nil
+}
+
+// mapControlResponseID rewrites the request ID of a recorded control
+// response to the ID the SDK used in this run.
+func (t *ReplayTransport) mapControlResponseID(msg map[string]interface{}) {
+	if frameType(msg) != "control_response" {
+		return
+	}
+	response, ok := msg["response"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	recordedID, _ := response["request_id"].(string)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if actualID, ok := t.requestIDs[recordedID]; ok {
+		response["request_id"] = actualID
+	}
+}
+
+// EndInput is a no-op; the end of input is implied by the recording.
+func (t *ReplayTransport) EndInput() error {
+	return nil
+}
+
+// IsReady reports whether the transport is connected and not closed.
+func (t *ReplayTransport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ready
+}
+
+// Close stops the replay.
+func (t *ReplayTransport) Close() error {
+	t.mu.Lock()
+	t.ready = false
+	t.mu.Unlock()
+
+	t.closeOnce.Do(func() { close(t.done) })
+	return nil
+}
+
+// frameType returns the "type" field of a decoded frame.
+func frameType(frame interface{}) string {
+	m, _ := frame.(map[string]interface{})
+	msgType, _ := m["type"].(string)
+	return msgType
+}
+
+// controlResponseID returns response.request_id of a decoded control response.
+func controlResponseID(frame interface{}) string {
+	m, _ := frame.(map[string]interface{})
+	response, _ := m["response"].(map[string]interface{})
+	id, _ := response["request_id"].(string)
+	return id
+}
+
+// withKey returns a copy of keys with key added.
+func withKey(keys map[string]bool, key string) map[string]bool {
+	result := make(map[string]bool, len(keys)+1)
+	for k := range keys {
+		result[k] = true
+	}
+	result[key] = true
+	return result
+}
+
+// stripKeys returns a copy of v without the given object keys at any depth.
+func stripKeys(v interface{}, keys map[string]bool) interface{} {
+	if len(keys) == 0 {
+		return v
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if !keys[k] {
+				result[k] = stripKeys(item, keys)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = stripKeys(item, keys)
+		}
+		return result
+	default:
+		return v
+	}
+}
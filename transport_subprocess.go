@@ -6,19 +6,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 const (
-	defaultMaxBufferSize     = 1024 * 1024 // 1MB
-	minimumClaudeCodeVersion = "2.0.0"
+	defaultMaxBufferSize = 1024 * 1024 // 1MB
+
+	defaultStdinGracePeriod = 5 * time.Second
+	defaultTermGracePeriod  = 5 * time.Second
+	killWaitTimeout         = 2 * time.Second
 )
 
 // SubprocessCLITransport implements Transport using Claude Code CLI subprocess.
@@ -29,12 +33,18 @@ type SubprocessCLITransport struct {
 	cliPath       string
 	cwd           string
 	cmd           *exec.Cmd
+	proc          *processWaiter
+	isolation     *isolationState
+	argSpill      *argSpill
 	stdin         io.WriteCloser
 	stdout        io.ReadCloser
 	stderr        io.ReadCloser
+	stderrTail    *stderrRingBuffer
 	ready         bool
 	exitError     error
 	maxBufferSize int
+	cliInfo       *CLIInfo
+	logger        *slog.Logger
 	mu            sync.RWMutex
 	writeMu       sync.Mutex // Serializes concurrent writes to stdin
 	stderrWg      sync.WaitGroup
@@ -57,7 +67,7 @@ func NewSubprocessCLITransport(prompt interface{}, options *ClaudeAgentOptions,
 	// Find CLI if not specified
 	if cliPath == "" {
 		var err error
-		cliPath, err = findCLI()
+		cliPath, err = defaultCLIRegistry.find()
 		if err != nil {
 			return nil, err
 		}
@@ -75,6 +85,12 @@ func NewSubprocessCLITransport(prompt interface{}, options *ClaudeAgentOptions,
 		maxBufferSize = *options.MaxBufferSize
 	}
 
+	// Get number of stderr lines kept for diagnostics
+	stderrTailLines := defaultStderrTailLines
+	if options.StderrTailLines != nil && *options.StderrTailLines > 0 {
+		stderrTailLines = *options.StderrTailLines
+	}
+
 	return &SubprocessCLITransport{
 		prompt:        prompt,
 		isStreaming:   isStreaming,
@@ -82,6 +98,8 @@ func NewSubprocessCLITransport(prompt interface{}, options *ClaudeAgentOptions,
 		cliPath:       cliPath,
 		cwd:           cwd,
 		maxBufferSize: maxBufferSize,
+		stderrTail:    newStderrRingBuffer(stderrTailLines),
+		logger:        optionsLogger(options),
 	}, nil
 }
 
@@ -110,7 +128,14 @@ func findCLI() (string, error) {
 	}
 
 	// Finally, check for bundled CLI binary
-	if bundledPath, err := getBundledCLIPath(); err == nil && bundledPath != "" {
+	bundledPath, err := getBundledCLIPath()
+	if err != nil {
+		return "", NewCLINotFoundError(
+			fmt.Sprintf("Claude Code CLI not found, and the bundled CLI could not be used: %v", err),
+			"",
+		)
+	}
+	if bundledPath != "" {
 		return bundledPath, nil
 	}
 
@@ -144,19 +169,74 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to build command: %w", err)
 	}
-	t.cmd = exec.CommandContext(ctx, t.cliPath, args...)
 
-	// Set working directory
+	// Check working directory exists
 	if t.cwd != "" {
-		// Check if directory exists
 		if _, err := os.Stat(t.cwd); os.IsNotExist(err) {
 			return NewCLIConnectionError(fmt.Sprintf("working directory does not exist: %s", t.cwd), err)
 		}
-		t.cmd.Dir = t.cwd
 	}
 
-	// Set environment variables
-	t.cmd.Env = t.buildEnv()
+	// Resolve OS user and resource limit isolation
+	t.isolation, err = newIsolationState(t.options)
+	if err != nil {
+		return NewCLIConnectionError("failed to configure process isolation", err)
+	}
+
+	// Move oversized values (system prompt, MCP config, settings) into
+	// private files so exec does not fail with E2BIG
+	env := t.buildEnv()
+	var spillUser *osUser
+	if t.isolation != nil {
+		spillUser = t.isolation.user
+	}
+	args, t.argSpill, err = spillLargeArgs(t.cliPath, args, env, commandLineLimit(), spillUser)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !t.ready {
+			t.argSpill.remove()
+			t.argSpill = nil
+		}
+	}()
+
+	// Let a custom launcher wrap the command (bwrap, nsjail, ssh, ...)
+	spec := LaunchSpec{
+		Path: t.cliPath,
+		Args: args,
+		Env:  env,
+		Dir:  t.cwd,
+	}
+	if t.argSpill != nil {
+		spec.Files = t.argSpill.files
+	}
+	if t.options.CommandLauncher != nil {
+		spec, err = t.options.CommandLauncher(ctx, spec)
+		if err != nil {
+			return NewCLIConnectionError("command launcher failed", err)
+		}
+	}
+
+	t.cmd = exec.CommandContext(ctx, spec.Path, spec.Args...)
+	t.cmd.Dir = spec.Dir
+	t.cmd.Env = spec.Env
+
+	// Run the CLI in its own process group and kill the whole group if the
+	// context is cancelled
+	newProcessGroup := t.options.Shutdown == nil || !t.options.Shutdown.InheritProcessGroup
+	configureProcessAttributes(t.cmd, newProcessGroup)
+	cmd := t.cmd
+	t.cmd.Cancel = func() error {
+		return signalProcessTree(cmd, syscall.SIGKILL)
+	}
+
+	// Apply OS user and cgroup to the command
+	if err := t.isolation.apply(t.cmd); err != nil {
+		t.cmd = nil
+		return NewCLIConnectionError("failed to configure process isolation", err)
+	}
+	defer t.isolation.release()
 
 	// Setup pipes
 	t.stdin, err = t.cmd.StdinPipe()
@@ -169,26 +249,32 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 		return NewCLIConnectionError("failed to create stdout pipe", err)
 	}
 
-	// Setup stderr if needed
-	shouldPipeStderr := t.options.Stderr != nil || t.options.ExtraArgs["debug-to-stderr"] != nil
-	if shouldPipeStderr {
-		t.stderr, err = t.cmd.StderrPipe()
-		if err != nil {
-			return NewCLIConnectionError("failed to create stderr pipe", err)
-		}
+	// Always capture stderr so failures can be diagnosed
+	t.stderr, err = t.cmd.StderrPipe()
+	if err != nil {
+		return NewCLIConnectionError("failed to create stderr pipe", err)
 	}
 
 	// Start process
 	if err := t.cmd.Start(); err != nil {
 		t.exitError = NewCLIConnectionError("failed to start Claude Code", err)
+		t.logger.Error("claude: failed to start CLI", "cli_path", t.cliPath, "error", err)
 		return t.exitError
 	}
+	t.proc = newProcessWaiter(t.cmd)
 
-	// Start stderr reader if needed
-	if shouldPipeStderr && t.stderr != nil {
-		t.stderrWg.Add(1)
-		go t.handleStderr()
+	if t.options.Metrics != nil {
+		t.options.Metrics.Add(MetricCLIStarts, 1, nil)
 	}
+	startAttrs := []any{"pid", t.cmd.Process.Pid, "cli_path", t.cliPath}
+	if t.cliInfo != nil && t.cliInfo.Version != "" {
+		startAttrs = append(startAttrs, "cli_version", t.cliInfo.Version)
+	}
+	t.logger.Info("claude: CLI started", startAttrs...)
+
+	// Start stderr reader
+	t.stderrWg.Add(1)
+	go t.handleStderr()
 
 	t.ready = true
 	return nil
@@ -417,8 +503,9 @@ func (t *SubprocessCLITransport) buildCommand() ([]string, error) {
 		}
 	}
 
-	// Extra args
-	for flag, value := range t.options.ExtraArgs {
+	// Extra args, sorted so the command line is stable
+	for _, flag := range sortedKeys(t.options.ExtraArgs) {
+		value := t.options.ExtraArgs[flag]
 		if value == nil {
 			args = append(args, "--"+flag)
 		} else {
@@ -433,16 +520,30 @@ func (t *SubprocessCLITransport) buildCommand() ([]string, error) {
 }
 
 // buildEnv constructs environment variables.
+//
+// The SDK's environment is filtered by EnvPolicy, then the target user's
+// identity, Env, SecretEnv and the SDK's own variables are added in that
+// order so later entries take precedence.
 func (t *SubprocessCLITransport) buildEnv() []string {
-	env := os.Environ()
+	env := baseEnv(t.options)
+
+	// Add identity of the OS user the CLI runs as
+	env = append(env, t.isolation.env()...)
 
 	// Add user env vars
-	for k, v := range t.options.Env {
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	for _, k := range sortedKeys(t.options.Env) {
+		env = append(env, fmt.Sprintf("%s=%s", k, t.options.Env[k]))
+	}
+	for _, k := range sortedKeys(t.options.SecretEnv) {
+		env = append(env, fmt.Sprintf("%s=%s", k, t.options.SecretEnv[k].Reveal()))
 	}
 
 	// Add SDK identifier
-	env = append(env, "CLAUDE_CODE_ENTRYPOINT=sdk-go")
+	entrypoint := "sdk-go"
+	if t.options.entrypoint != "" {
+		entrypoint = t.options.entrypoint
+	}
+	env = append(env, "CLAUDE_CODE_ENTRYPOINT="+entrypoint)
 	env = append(env, fmt.Sprintf("CLAUDE_AGENT_SDK_VERSION=%s", SDKVersion))
 
 	// Enable file checkpointing if requested
@@ -458,23 +559,83 @@ func (t *SubprocessCLITransport) buildEnv() []string {
 	return env
 }
 
-// handleStderr reads stderr in background.
+// RedactedEnv returns the environment the CLI is started with, with the
+// values of SecretEnv entries replaced by a placeholder. It is safe to log.
+func (t *SubprocessCLITransport) RedactedEnv() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	secretKeys := make(map[string]bool, len(t.options.SecretEnv))
+	for k := range t.options.SecretEnv {
+		secretKeys[k] = true
+	}
+	return redactEnv(t.buildEnv(), secretKeys)
+}
+
+// handleStderr reads stderr in background, keeping the most recent lines
+// for error diagnostics and forwarding each line to the Stderr callback.
 func (t *SubprocessCLITransport) handleStderr() {
 	defer t.stderrWg.Done()
 
-	scanner := bufio.NewScanner(t.stderr)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
+	// Lines longer than maxBufferSize are truncated, and the rest of them
+	// is still read: the CLI blocks on a full stderr pipe if nobody drains it
+	reader := bufio.NewReaderSize(t.stderr, 64*1024)
+	var line []byte
+	truncated := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if room := t.maxBufferSize - len(line); room > 0 {
+			if len(chunk) > room {
+				truncated += len(chunk) - room
+				chunk = chunk[:room]
+			}
+			line = append(line, chunk...)
+		} else {
+			truncated += len(chunk)
+		}
+		if err == bufio.ErrBufferFull {
 			continue
 		}
 
-		if t.options.Stderr != nil {
-			t.options.Stderr(line)
+		text := strings.TrimSuffix(string(line), "\r")
+		if truncated > 0 {
+			text += fmt.Sprintf(" [truncated %d bytes]", truncated)
+		}
+		line, truncated = line[:0], 0
+		if text != "" {
+			t.stderrTail.Add(text)
+			if t.options.Stderr != nil {
+				t.options.Stderr(text)
+			}
+		}
+		if err != nil {
+			return
 		}
 	}
 }
 
+// waitForStderr waits up to timeout for the stderr reader to drain.
+func (t *SubprocessCLITransport) waitForStderr(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		t.stderrWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// Stderr reader didn't finish (e.g. a grandchild still holds the pipe)
+	}
+}
+
+// StderrTail returns the most recent lines the CLI wrote to stderr.
+func (t *SubprocessCLITransport) StderrTail() []string {
+	return t.stderrTail.Lines()
+}
+
 // Write sends data to stdin.
 func (t *SubprocessCLITransport) Write(ctx context.Context, data string) error {
 	// Use read lock to check state
@@ -501,11 +662,12 @@ func (t *SubprocessCLITransport) Write(ctx context.Context, data string) error {
 
 	_, err := t.stdin.Write([]byte(data))
 	if err != nil {
+		writeErr := NewCLIConnectionError("failed to write to process stdin", err)
 		t.mu.Lock()
 		t.ready = false
-		t.exitError = NewCLIConnectionError("failed to write to process stdin", err)
+		t.exitError = writeErr
 		t.mu.Unlock()
-		return t.exitError
+		return writeErr
 	}
 
 	return nil
@@ -516,6 +678,11 @@ func (t *SubprocessCLITransport) ReadMessages(ctx context.Context) (<-chan map[s
 	msgCh := make(chan map[string]interface{}, 10)
 	errCh := make(chan error, 1)
 
+	t.mu.RLock()
+	proc := t.proc
+	isolation := t.isolation
+	t.mu.RUnlock()
+
 	go func() {
 		defer close(msgCh)
 		defer close(errCh)
@@ -529,7 +696,7 @@ func (t *SubprocessCLITransport) ReadMessages(ctx context.Context) (<-chan map[s
 		buf := make([]byte, 0, initialSize)
 		scanner.Buffer(buf, t.maxBufferSize)
 
-		var jsonBuffer strings.Builder
+		decoder := newStreamDecoder(t.maxBufferSize)
 
 		for scanner.Scan() {
 			select {
@@ -538,57 +705,55 @@ func (t *SubprocessCLITransport) ReadMessages(ctx context.Context) (<-chan map[s
 			default:
 			}
 
-			line := scanner.Text()
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
+			messages, err := decoder.decodeLine(scanner.Text())
+			for _, data := range messages {
+				msgCh <- data
 			}
-
-			// Split by newlines (in case multiple JSON objects on one line)
-			jsonLines := strings.Split(line, "\n")
-
-			for _, jsonLine := range jsonLines {
-				jsonLine = strings.TrimSpace(jsonLine)
-				if jsonLine == "" {
-					continue
-				}
-
-				// Accumulate partial JSON using strings.Builder for efficiency
-				jsonBuffer.WriteString(jsonLine)
-
-				if jsonBuffer.Len() > t.maxBufferSize {
-					errCh <- NewCLIJSONDecodeError(
-						fmt.Sprintf("JSON message exceeded maximum buffer size of %d bytes", t.maxBufferSize),
-						fmt.Errorf("buffer size %d exceeds limit %d", jsonBuffer.Len(), t.maxBufferSize),
-					)
-					return
-				}
-
-				// Try to parse
-				var data map[string]interface{}
-				if err := json.Unmarshal([]byte(jsonBuffer.String()), &data); err == nil {
-					// Successfully parsed
-					jsonBuffer.Reset()
-					msgCh <- data
-				}
-				// If parse fails, keep accumulating
+			if err != nil {
+				t.logger.Error("claude: failed to decode CLI output", "error", err)
+				errCh <- err
+				return
 			}
 		}
 
 		if err := scanner.Err(); err != nil && err != io.EOF {
+			t.logger.Error("claude: failed to read CLI output", "error", err)
 			errCh <- NewCLIConnectionError("error reading from stdout", err)
 			return
 		}
 
+		// Drain stderr before Wait closes the pipe so the tail is complete
+		t.waitForStderr(time.Second)
+
 		// Wait for process to complete
-		if err := t.cmd.Wait(); err != nil {
+		if proc == nil {
+			return
+		}
+		if err := proc.wait(); err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
-				t.exitError = NewProcessError(
-					"command failed",
-					exitErr.ExitCode(),
-					"check stderr output for details",
-				)
-				errCh <- t.exitError
+				signal := ""
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+					signal = signalName(status.Signal())
+				}
+				procErr := newProcessExitError(exitErr.ExitCode(), signal, t.stderrTail.String())
+				var exitError error = procErr
+				kind := string(procErr.Kind)
+				if kind == "" {
+					kind = "unknown"
+				}
+				if limitErr := isolation.detectLimitViolation(procErr); limitErr != nil {
+					exitError = limitErr
+					kind = "resource_limit"
+				}
+				if t.options.Metrics != nil {
+					t.options.Metrics.Add(MetricCLIFailures, 1, Labels{LabelKind: kind})
+				}
+				t.logger.Error("claude: CLI exited with an error",
+					"exit_code", procErr.ExitCode, "signal", signal, "kind", kind, "error", exitError)
+				t.mu.Lock()
+				t.exitError = exitError
+				t.mu.Unlock()
+				errCh <- exitError
 			}
 		}
 	}()
@@ -624,6 +789,10 @@ func (t *SubprocessCLITransport) IsReady() bool {
 }
 
 // Close terminates the subprocess and cleans up.
+//
+// Shutdown is graceful: stdin is closed first so the CLI can finish writing
+// transcripts and checkpoints, then SIGTERM and finally SIGKILL are sent to
+// the CLI's process group if it has not exited (see ShutdownOptions).
 func (t *SubprocessCLITransport) Close() error {
 	// Acquire write lock first to prevent TOCTOU race with Write()
 	t.writeMu.Lock()
@@ -644,92 +813,144 @@ func (t *SubprocessCLITransport) Close() error {
 		t.stdin = nil
 	}
 
-	// Kill process if still running
-	if t.cmd.Process != nil && t.cmd.ProcessState == nil {
-		t.cmd.Process.Kill()
-	}
-
-	// Wait for process with timeout to avoid hanging
-	if t.cmd != nil && t.cmd.Process != nil {
-		done := make(chan struct{})
-		go func() {
-			t.cmd.Wait()
-			close(done)
-		}()
-
-		// Wait up to 2 seconds for process to exit
-		select {
-		case <-done:
-			// Process exited normally
-		case <-time.After(2 * time.Second):
-			// Force kill if still running
-			if t.cmd.Process != nil {
-				t.cmd.Process.Signal(os.Kill)
-			}
-		}
+	if t.proc != nil {
+		t.shutdownProcess()
 	}
 
 	// Wait for stderr reader to finish (with timeout)
-	stderrDone := make(chan struct{})
-	go func() {
-		t.stderrWg.Wait()
-		close(stderrDone)
-	}()
-	select {
-	case <-stderrDone:
-	case <-time.After(1 * time.Second):
-		// Stderr reader didn't finish, continue anyway
-	}
+	t.waitForStderr(time.Second)
+
+	// Remove files holding oversized arguments
+	t.argSpill.remove()
 
 	t.cmd = nil
+	t.proc = nil
+	t.isolation = nil
+	t.argSpill = nil
 	t.exitError = nil
 
 	return nil
 }
 
-// checkClaudeVersion checks if the Claude Code CLI version meets minimum requirements.
-// Returns an error if the version check fails critically, or logs a warning for outdated versions.
-func (t *SubprocessCLITransport) checkClaudeVersion(ctx context.Context) error {
-	// Skip version check if environment variable is set
-	if os.Getenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK") != "" {
-		return nil
+// shutdownProcess waits for the CLI to exit after stdin was closed,
+// escalating to SIGTERM and then SIGKILL when the grace periods expire.
+func (t *SubprocessCLITransport) shutdownProcess() {
+	stdinGrace := defaultStdinGracePeriod
+	termGrace := defaultTermGracePeriod
+	if shutdown := t.options.Shutdown; shutdown != nil {
+		if shutdown.StdinGracePeriod > 0 {
+			stdinGrace = shutdown.StdinGracePeriod
+		}
+		if shutdown.TermGracePeriod > 0 {
+			termGrace = shutdown.TermGracePeriod
+		}
 	}
 
-	// Create context with timeout
-	checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
+	go t.proc.wait()
 
-	// Run claude -v to get version
-	cmd := exec.CommandContext(checkCtx, t.cliPath, "-v")
-	output, err := cmd.Output()
-	if err != nil {
-		// If version check fails, log but don't block (CLI might still work)
-		return nil
+	if !t.proc.waitTimeout(stdinGrace) {
+		t.logger.Warn("claude: CLI did not exit after stdin closed, sending SIGTERM",
+			"pid", t.cmd.Process.Pid, "grace_period", stdinGrace)
+		signalProcessTree(t.cmd, syscall.SIGTERM)
+		if !t.proc.waitTimeout(termGrace) {
+			t.logger.Warn("claude: CLI did not exit after SIGTERM, sending SIGKILL",
+				"pid", t.cmd.Process.Pid, "grace_period", termGrace)
+			signalProcessTree(t.cmd, syscall.SIGKILL)
+			t.proc.waitTimeout(killWaitTimeout)
+		}
 	}
 
-	// Parse version from output
-	versionStr := strings.TrimSpace(string(output))
-	re := regexp.MustCompile(`([0-9]+\.[0-9]+\.[0-9]+)`)
-	match := re.FindStringSubmatch(versionStr)
+	// Kill anything the CLI left behind in its process group
+	signalProcessTree(t.cmd, syscall.SIGKILL)
+}
+
+// processWaiter calls cmd.Wait exactly once and lets several goroutines
+// observe the result.
+type processWaiter struct {
+	cmd  *exec.Cmd
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newProcessWaiter(cmd *exec.Cmd) *processWaiter {
+	return &processWaiter{cmd: cmd, done: make(chan struct{})}
+}
+
+// wait blocks until the process exits and returns the result of cmd.Wait.
+func (w *processWaiter) wait() error {
+	w.once.Do(func() {
+		w.err = w.cmd.Wait()
+		close(w.done)
+	})
+	<-w.done
+	return w.err
+}
+
+// waitTimeout reports whether the process exited within timeout.
+// Someone must be calling wait for the process to be observed as exited.
+func (w *processWaiter) waitTimeout(timeout time.Duration) bool {
+	select {
+	case <-w.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
 
-	if match == nil {
-		// Couldn't parse version, skip check
+// checkClaudeVersion checks the CLI version and capabilities against
+// MinimumCLIVersion and the options. Problems fail Connect with a
+// CLIVersionError under StrictVersionCheck and are otherwise logged as a
+// warning once per binary, or printed to stderr when no Logger is set.
+func (t *SubprocessCLITransport) checkClaudeVersion(ctx context.Context) error {
+	// Skip version check if environment variable is set
+	if os.Getenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK") != "" {
 		return nil
 	}
 
-	version := match[1]
+	// A launcher decides what actually runs, so its probes are not cached
+	info, entry := defaultCLIRegistry.info(ctx, t.cliPath, t.options.CommandLauncher == nil, t.probeVersion)
+	t.cliInfo = info
 
-	// Compare versions
-	if compareVersions(version, minimumClaudeCodeVersion) < 0 {
-		warning := fmt.Sprintf("Warning: Claude Code version %s is unsupported in the Agent SDK. "+
+	var problem string
+	missing := missingCapabilities(info.Capabilities, t.options)
+	switch {
+	case info.Version == "":
+		problem = fmt.Sprintf("could not determine the Claude Code version of %s. "+
+			"Minimum required version is %s.", t.cliPath, MinimumCLIVersion)
+	case compareVersions(info.Version, MinimumCLIVersion) < 0:
+		problem = fmt.Sprintf("Claude Code version %s is unsupported in the Agent SDK. "+
 			"Minimum required version is %s. "+
-			"Some features may not work correctly.", version, minimumClaudeCodeVersion)
-		fmt.Fprintln(os.Stderr, warning)
+			"Some features may not work correctly.", info.Version, MinimumCLIVersion)
+	case len(missing) > 0:
+		problem = fmt.Sprintf("Claude Code version %s does not support %s.",
+			info.Version, strings.Join(missing, ", "))
+	default:
+		return nil
 	}
 
+	if t.options.StrictVersionCheck {
+		return NewCLIVersionError(problem, t.cliPath, info.Version, missing)
+	}
+	// An unknown version only matters in strict mode; the CLI might still work
+	if info.Version != "" && defaultCLIRegistry.warnOnce(entry, problem) {
+		if t.options.Logger != nil {
+			t.logger.Warn("claude: "+problem, "cli_path", t.cliPath, "cli_version", info.Version)
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning: "+problem)
+		}
+	}
 	return nil
 }
 
+// CLIInfo returns the version and capabilities of the CLI found by Connect,
+// or nil if the version check was skipped or Connect has not run.
+func (t *SubprocessCLITransport) CLIInfo() *CLIInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.cliInfo
+}
+
 // compareVersions compares two semantic version strings.
 // Returns: -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2
 func compareVersions(v1, v2 string) int {
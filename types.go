@@ -3,6 +3,8 @@ package claude
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
+	"time"
 )
 
 // PermissionMode defines the permission handling mode.
@@ -252,13 +254,17 @@ func (PermissionResultDeny) isPermissionResult() {}
 
 // PermissionResultAsk indicates the tool requires user confirmation.
 //
-// This result prompts the user to approve, deny, or modify the tool use.
-// You can optionally modify the tool's input parameters or update permission
-// settings for future tool uses.
+// The control protocol only answers allow or deny: a CanUseTool callback is
+// already the prompt the CLI would show. An Ask result is therefore sent to
+// the CLI as a denial carrying Message and a note that the user must confirm,
+// so Claude can ask the user in the conversation and retry. UpdatedInput and
+// UpdatedPermissions are not applied. To put a human in the loop, return the
+// result of a prompter such as permissions.TerminalPrompter or
+// approval.Service instead.
 //
 // Fields:
 //   - Behavior: Must be "ask"
-//   - Message: Optional message shown to the user when asking for permission
+//   - Message: Optional message explaining why confirmation is needed
 //   - UpdatedInput: Optional modified input parameters for the tool
 //   - UpdatedPermissions: Optional permission updates to apply if user approves
 //
@@ -273,35 +279,6 @@ func (PermissionResultDeny) isPermissionResult() {}
 //	        }, nil
 //	    }
 //	}
-//
-// Example - Ask with modified input:
-//
-//	if toolName == "Write" {
-//	    filePath := input["file_path"].(string)
-//	    if strings.HasPrefix(filePath, "/etc/") {
-//	        return PermissionResultAsk{
-//	            Behavior: "ask",
-//	            Message: "Write to system directory - proceed with caution?",
-//	            UpdatedInput: map[string]interface{}{
-//	                "file_path": filePath,
-//	                "backup": true, // Suggest creating a backup
-//	            },
-//	        }, nil
-//	    }
-//	}
-//
-// Example - Ask and update future permissions:
-//
-//	return PermissionResultAsk{
-//	    Behavior: "ask",
-//	    Message: "Allow network access to external API?",
-//	    UpdatedPermissions: []PermissionUpdate{
-//	        {
-//	            ToolName: "WebFetch",
-//	            Permission: "allow",
-//	        },
-//	    },
-//	}, nil
 type PermissionResultAsk struct {
 	Behavior           string                 `json:"behavior"` // Always "ask"
 	Message            string                 `json:"message,omitempty"`
@@ -539,6 +516,34 @@ type HookMatcher struct {
 // StderrCallback is called for each line of stderr output.
 type StderrCallback func(line string)
 
+// LaunchSpec describes a command the transport is about to execute.
+type LaunchSpec struct {
+	Path string   // Executable to run
+	Args []string // Arguments, not including the executable
+	Env  []string // Environment in "KEY=value" form
+	Dir  string   // Working directory; empty means the current directory
+
+	// Files lists files the SDK created for the CLI to read, such as
+	// oversized arguments moved out of Args. Launchers that hide parts of the
+	// filesystem (e.g. a private /tmp) or run the CLI on another host must
+	// make them available at the same paths.
+	Files []string
+}
+
+// CommandLauncher rewrites the command used to start the Claude Code CLI.
+//
+// It receives the resolved CLI path, arguments, environment and working
+// directory, and returns the command that is actually executed. This lets the
+// CLI run inside isolation tools such as bwrap, nsjail, firejail or ssh
+// without a custom transport. See PrefixLauncher and BubblewrapLauncher.
+//
+// Example:
+//
+//	options := &ClaudeAgentOptions{
+//	    CommandLauncher: PrefixLauncher("firejail", "--quiet", "--private-tmp"),
+//	}
+type CommandLauncher func(ctx context.Context, spec LaunchSpec) (LaunchSpec, error)
+
 // McpServerConfig represents MCP server configuration (various types).
 type McpServerConfig interface {
 	isMcpServerConfig()
@@ -704,6 +709,94 @@ type SandboxSettings struct {
 	EnableWeakerNestedSandbox *bool `json:"enableWeakerNestedSandbox,omitempty"`
 }
 
+// ShutdownOptions configures how SubprocessCLITransport stops the CLI on Close.
+//
+// The shutdown sequence is: close stdin, wait StdinGracePeriod for the CLI to
+// exit on its own (flushing transcripts and checkpoints), send SIGTERM, wait
+// TermGracePeriod, then send SIGKILL. Signals are delivered to the CLI's whole
+// process group so grandchildren such as MCP stdio servers are cleaned up too.
+//
+// Example:
+//
+//	options := &ClaudeAgentOptions{
+//	    Shutdown: &ShutdownOptions{
+//	        StdinGracePeriod: 10 * time.Second,
+//	        TermGracePeriod:  2 * time.Second,
+//	    },
+//	}
+type ShutdownOptions struct {
+	// StdinGracePeriod is how long to wait for the CLI to exit after stdin is
+	// closed before sending SIGTERM (default: 5s).
+	StdinGracePeriod time.Duration
+
+	// TermGracePeriod is how long to wait after SIGTERM before sending
+	// SIGKILL (default: 5s).
+	TermGracePeriod time.Duration
+
+	// InheritProcessGroup keeps the CLI in the caller's process group instead
+	// of starting a new one. Terminal signals such as Ctrl-C then reach the
+	// CLI directly, but grandchildren are no longer cleaned up on Close.
+	InheritProcessGroup bool
+}
+
+// ResourceLimits configures OS-level limits applied to the CLI subprocess.
+//
+// Zero values leave the corresponding limit unchanged. Rlimits and cgroups are
+// only supported on Linux; Connect fails on other platforms if any are set.
+// Rlimits are set before the CLI is executed, so every process it spawns
+// inherits them: the CLI is started through prlimit(1) from util-linux,
+// which sets the limits on itself and execs the CLI. prlimit must be
+// installed and executable by the CLI's User. Joining a cgroup happens
+// atomically at process creation.
+//
+// When the CLI exits because it exceeded one of these limits, the transport
+// reports a *ResourceLimitError wrapping the underlying *ProcessError.
+//
+// Example:
+//
+//	options := &ClaudeAgentOptions{
+//	    User: stringPtr("agent"),
+//	    ResourceLimits: &ResourceLimits{
+//	        AddressSpaceBytes: 8 << 30,
+//	        CPUSeconds:        600,
+//	        OpenFiles:         1024,
+//	        CgroupPath:        "/sys/fs/cgroup/agents/run-42",
+//	        CgroupMemoryMax:   2 << 30,
+//	        CgroupCPUs:        1.5,
+//	    },
+//	}
+type ResourceLimits struct {
+	// AddressSpaceBytes caps virtual memory (RLIMIT_AS). Node reserves large
+	// virtual ranges, so values below a few GiB usually prevent startup.
+	AddressSpaceBytes uint64
+
+	// CPUSeconds caps CPU time (RLIMIT_CPU). The CLI receives SIGXCPU when the
+	// limit is reached and SIGKILL shortly after.
+	CPUSeconds uint64
+
+	// OpenFiles caps the number of open file descriptors (RLIMIT_NOFILE).
+	OpenFiles uint64
+
+	// Processes caps the number of processes for the CLI's user (RLIMIT_NPROC).
+	// The count includes every process owned by that user, not just the CLI tree.
+	Processes uint64
+
+	// PrlimitPath is the prlimit(1) binary used to set the rlimits above
+	// (default: "prlimit" on PATH).
+	PrlimitPath string
+
+	// CgroupPath is a cgroup v2 directory the CLI is placed in at creation,
+	// e.g. "/sys/fs/cgroup/agents/run-42". The directory must already exist.
+	CgroupPath string
+
+	// CgroupMemoryMax, if set, is written to memory.max in CgroupPath.
+	CgroupMemoryMax uint64
+
+	// CgroupCPUs, if set, is written to cpu.max in CgroupPath as a quota of
+	// that many CPUs (e.g. 0.5 for half a CPU).
+	CgroupCPUs float64
+}
+
 // ClaudeAgentOptions contains all configuration options for Claude SDK.
 type ClaudeAgentOptions struct {
 	// Base set of tools to use (separate from allowed/disallowed filtering)
@@ -752,8 +845,22 @@ type ClaudeAgentOptions struct {
 	// Working directory and environment
 	Cwd     *string           `json:"cwd,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
-	User    *string           `json:"user,omitempty"`
-	AddDirs []string          `json:"add_dirs,omitempty"`
+	User    *string           `json:"user,omitempty"` // OS user name or uid to run the CLI as (Unix only)
+
+	// EnvPolicy controls which of the SDK's own environment variables reach
+	// the CLI (default: EnvPolicyInherit). EnvAllowlist lists the names kept
+	// by EnvPolicyAllowlist; entries ending in "*" match by prefix.
+	EnvPolicy    EnvPolicy `json:"-"` // Not sent to CLI
+	EnvAllowlist []string  `json:"-"` // Not sent to CLI
+
+	// SecretEnv holds environment variables whose values are redacted
+	// wherever the SDK prints or logs the CLI environment.
+	SecretEnv map[string]Secret `json:"-"` // Not sent to CLI
+
+	AddDirs []string `json:"add_dirs,omitempty"`
+
+	// ResourceLimits applies rlimits and cgroup v2 limits to the CLI process.
+	ResourceLimits *ResourceLimits `json:"-"` // Not sent to CLI
 
 	// Settings
 	Settings       *string         `json:"settings,omitempty"`
@@ -774,13 +881,69 @@ type ClaudeAgentOptions struct {
 	IncludePartialMessages   bool               `json:"include_partial_messages,omitempty"`
 	MaxBufferSize            *int               `json:"max_buffer_size,omitempty"` // Maximum buffer size for JSON messages (default: 10MB)
 	ScannerInitialBufferSize *int               `json:"-"`                         // Initial buffer size for scanner (default: 64KB, not sent to CLI)
-	MessageChannelBufferSize *int               `json:"-"`                         // Internal buffer size for message channels (default: 100, not sent to CLI)
+	MessageChannelBufferSize *int               `json:"-"`                         // Unread messages held before StreamEventOverflow applies; reading from the CLI pauses at 16 times this (default: 100, not sent to CLI)
+	StderrTailLines          *int               `json:"-"`                         // Number of stderr lines kept for ProcessError diagnostics (default: 50, not sent to CLI)
 	ExtraArgs                map[string]*string `json:"extra_args,omitempty"`      // nil value = flag without value
 
+	// StreamEventOverflow decides what happens to partial StreamEvents once
+	// the consumer is MessageChannelBufferSize messages behind (default:
+	// OverflowBlock). Control requests are answered however far behind the
+	// consumer is.
+	StreamEventOverflow OverflowPolicy `json:"-"` // Not sent to CLI
+	// PipelineMetrics, if set, counts dropped and coalesced StreamEvents and
+	// the largest backlog.
+	PipelineMetrics *PipelineMetrics `json:"-"` // Not sent to CLI
+	// Tracer, if set, receives a span per query or client turn with child
+	// spans for tool uses, callbacks, SDK MCP tool calls and control requests.
+	// See package claudeotel for OpenTelemetry.
+	Tracer Tracer `json:"-"` // Not sent to CLI
+	// Metrics, if set, receives counters and histograms for turns, cost,
+	// tokens, tool calls, permission decisions, hooks, control request
+	// timeouts and CLI processes. See package claudemetrics.
+	Metrics Metrics `json:"-"` // Not sent to CLI
+	// Logger, if set, receives CLI lifecycle, control protocol, parse and
+	// transport events. Records carry session_id and request_id attributes
+	// where they apply. Version warnings go to it instead of stderr.
+	Logger *slog.Logger `json:"-"` // Not sent to CLI
+	// Budget, if set, charges every turn to the keys of a BudgetLedger
+	// account. Queries are refused once a key reached its limit, and a
+	// turn is interrupted when its estimated usage would cross it.
+	Budget *BudgetAccount `json:"-"` // Not sent to CLI
+	// Auditor, if set, records session starts, tool uses and results,
+	// permission decisions, hook outputs and results. See FileAuditor for
+	// a tamper-evident log.
+	Auditor Auditor `json:"-"` // Not sent to CLI
+	// CallbackLimits bounds how many CanUseTool, hook and SDK MCP tool
+	// callbacks run at once and how long each may run. Panics in callbacks
+	// are recovered into error responses either way.
+	CallbackLimits *CallbackLimits `json:"-"` // Not sent to CLI
+
 	// Plugins
 	Plugins []SdkPluginConfig `json:"plugins,omitempty"`
 
+	// TransportMiddleware wraps the transport of every query and client
+	// using these options, first outermost (see TransportMiddleware).
+	TransportMiddleware []TransportMiddleware `json:"-"` // Functions, not serialized
+
+	// CommandLauncher wraps the CLI command before it is started.
+	// If nil, the CLI is executed directly.
+	CommandLauncher CommandLauncher `json:"-"` // Function, not serialized
+
+	// Shutdown configures the graceful shutdown sequence used by Close.
+	// If nil, defaults are used (see ShutdownOptions).
+	Shutdown *ShutdownOptions `json:"-"` // Not sent to CLI
+
 	// CliPath specifies a custom path to the Claude Code CLI binary.
 	// If set, this path will be used instead of auto-discovery.
 	CliPath *string `json:"-"` // Not sent to CLI
+
+	// StrictVersionCheck makes Connect fail with a CLIVersionError when the
+	// CLI is older than MinimumCLIVersion, its version cannot be determined,
+	// or it lacks a capability these options use. By default a warning is
+	// printed to stderr once per CLI binary.
+	StrictVersionCheck bool `json:"-"` // Not sent to CLI
+
+	// entrypoint overrides CLAUDE_CODE_ENTRYPOINT in the CLI's environment
+	// (set by ClaudeSDKClient; default "sdk-go").
+	entrypoint string
 }